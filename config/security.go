@@ -48,6 +48,12 @@ type Security struct {
 	ClusterSSLCert  string   `toml:"cluster-ssl-cert" json:"cluster-ssl-cert"`
 	ClusterSSLKey   string   `toml:"cluster-ssl-key" json:"cluster-ssl-key"`
 	ClusterVerifyCN []string `toml:"cluster-verify-cn" json:"cluster-verify-cn"`
+
+	// ClusterSSLCABytes, ClusterSSLCertBytes and ClusterSSLKeyBytes are the PEM blocks used instead of the files,
+	// for the certificates that are not stored on disk.
+	ClusterSSLCABytes   []byte `toml:"-" json:"-"`
+	ClusterSSLCertBytes []byte `toml:"-" json:"-"`
+	ClusterSSLKeyBytes  []byte `toml:"-" json:"-"`
 }
 
 // NewSecurity creates a Security.
@@ -60,16 +66,35 @@ func NewSecurity(sslCA, sslCert, sslKey string, verityCN []string) Security {
 	}
 }
 
+// NewSecurityFromBytes creates a Security with the PEM blocks of the CA, the certificate and the key.
+// The connections are verified the same way as with the files of NewSecurity.
+func NewSecurityFromBytes(ca, cert, key []byte, verifyCN []string) Security {
+	return Security{
+		ClusterSSLCABytes:   ca,
+		ClusterSSLCertBytes: cert,
+		ClusterSSLKeyBytes:  key,
+		ClusterVerifyCN:     verifyCN,
+	}
+}
+
+// TLSEnabled tells whether the connections use TLS, i.e. the CA is set by either a file or PEM bytes.
+func (s *Security) TLSEnabled() bool {
+	return len(s.ClusterSSLCA) != 0 || len(s.ClusterSSLCABytes) != 0
+}
+
 // ToTLSConfig generates tls's config based on security section of the config.
+// The PEM bytes take precedence over the files.
 func (s *Security) ToTLSConfig() (tlsConfig *tls.Config, err error) {
-	if len(s.ClusterSSLCA) != 0 {
+	if s.TLSEnabled() {
 		certPool := x509.NewCertPool()
 		// Create a certificate pool from the certificate authority
-		var ca []byte
-		ca, err = os.ReadFile(s.ClusterSSLCA)
-		if err != nil {
-			err = errors.Errorf("could not read ca certificate: %s", err)
-			return
+		ca := s.ClusterSSLCABytes
+		if len(ca) == 0 {
+			ca, err = os.ReadFile(s.ClusterSSLCA)
+			if err != nil {
+				err = errors.Errorf("could not read ca certificate: %s", err)
+				return
+			}
 		}
 		// Append the certificates from the CA
 		if !certPool.AppendCertsFromPEM(ca) {
@@ -81,8 +106,17 @@ func (s *Security) ToTLSConfig() (tlsConfig *tls.Config, err error) {
 			ClientCAs: certPool,
 		}
 
-		if len(s.ClusterSSLCert) != 0 && len(s.ClusterSSLKey) != 0 {
-			getCert := func() (*tls.Certificate, error) {
+		var getCert func() (*tls.Certificate, error)
+		if len(s.ClusterSSLCertBytes) != 0 && len(s.ClusterSSLKeyBytes) != 0 {
+			getCert = func() (*tls.Certificate, error) {
+				cert, err := tls.X509KeyPair(s.ClusterSSLCertBytes, s.ClusterSSLKeyBytes)
+				if err != nil {
+					return nil, errors.Errorf("could not load client key pair: %s", err)
+				}
+				return &cert, nil
+			}
+		} else if len(s.ClusterSSLCert) != 0 && len(s.ClusterSSLKey) != 0 {
+			getCert = func() (*tls.Certificate, error) {
 				// Load the client certificates from disk
 				cert, err := tls.LoadX509KeyPair(s.ClusterSSLCert, s.ClusterSSLKey)
 				if err != nil {
@@ -90,6 +124,8 @@ func (s *Security) ToTLSConfig() (tlsConfig *tls.Config, err error) {
 				}
 				return &cert, nil
 			}
+		}
+		if getCert != nil {
 			// pre-test cert's loading.
 			if _, err = getCert(); err != nil {
 				return
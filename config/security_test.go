@@ -70,6 +70,31 @@ func TestTLSConfig(t *testing.T) {
 	assert.Nil(t, os.Remove(keyFile))
 }
 
+func TestTLSConfigFromBytes(t *testing.T) {
+	security := NewSecurityFromBytes([]byte(cert), []byte(cert), []byte(key), nil)
+	assert.True(t, security.TLSEnabled())
+	tlsConfig, err := security.ToTLSConfig()
+	assert.Nil(t, err)
+	assert.NotNil(t, tlsConfig)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.NotNil(t, tlsConfig.ClientCAs)
+	clientCert, err := tlsConfig.GetClientCertificate(nil)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, clientCert.Certificate)
+
+	security = NewSecurityFromBytes([]byte(cert), []byte(cert), []byte("invalid"), nil)
+	_, err = security.ToTLSConfig()
+	assert.NotNil(t, err)
+	security = NewSecurityFromBytes([]byte("invalid"), nil, nil, nil)
+	_, err = security.ToTLSConfig()
+	assert.NotNil(t, err)
+
+	security = Security{}
+	tlsConfig, err = security.ToTLSConfig()
+	assert.Nil(t, err)
+	assert.Nil(t, tlsConfig)
+}
+
 var cert = `-----BEGIN CERTIFICATE-----
 MIIC+jCCAeKgAwIBAgIRALsvlisKJzXtiwKcv7toreswDQYJKoZIhvcNAQELBQAw
 EjEQMA4GA1UEChMHQWNtZSBDbzAeFw0xOTAzMTMwNzExNDhaFw0yMDAzMTIwNzEx
@@ -239,6 +239,16 @@ func (e *ErrTokenLimit) Error() string {
 	return fmt.Sprintf("Store token is up to the limit, store id = %d.", e.StoreID)
 }
 
+// ErrStoreUnavailable is the error that the requests to a store are rejected by its circuit breaker, which is
+// tripped by the consecutive failures to send requests to the store.
+type ErrStoreUnavailable struct {
+	StoreID uint64
+}
+
+func (e *ErrStoreUnavailable) Error() string {
+	return fmt.Sprintf("store %d is unavailable, its circuit breaker is open", e.StoreID)
+}
+
 // ErrAssertionFailed is the error that assertion on data failed.
 type ErrAssertionFailed struct {
 	*kvrpcpb.AssertionFailed
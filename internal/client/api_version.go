@@ -2,6 +2,7 @@ package client
 
 import (
 	"bytes"
+	"encoding/binary"
 
 	"github.com/pingcap/kvproto/pkg/kvrpcpb"
 	"github.com/pkg/errors"
@@ -33,48 +34,59 @@ var (
 	APIV2TxnEndKey = []byte{'x', 0, 0, 1}
 )
 
-func getV2Prefix(mode Mode) []byte {
+// MaxKeyspaceID is the max ID of a keyspace, which takes 3 bytes of the key prefix in API V2.
+const MaxKeyspaceID = 1<<24 - 1
+
+func getV2Prefix(mode Mode, keyspaceID uint32) []byte {
 	switch mode {
 	case ModeRaw:
-		return APIV2RawKeyPrefix
+		return keyspacePrefix(APIV2RawKeyPrefix[0], keyspaceID)
 	case ModeTxn:
-		return APIV2TxnKeyPrefix
+		return keyspacePrefix(APIV2TxnKeyPrefix[0], keyspaceID)
 	}
 	panic("unreachable")
 }
 
-func getV2EndKey(mode Mode) []byte {
+func getV2EndKey(mode Mode, keyspaceID uint32) []byte {
 	switch mode {
 	case ModeRaw:
-		return APIV2RawEndKey
+		return keyspacePrefix(APIV2RawKeyPrefix[0], keyspaceID+1)
 	case ModeTxn:
-		return APIV2TxnEndKey
+		return keyspacePrefix(APIV2TxnKeyPrefix[0], keyspaceID+1)
 	}
 	panic("unreachable")
 }
 
+// keyspacePrefix returns the mode byte followed by the keyspace ID in 3 bytes of big endian.
+// The ID after MaxKeyspaceID carries into the mode byte, which is the end key of the last keyspace.
+func keyspacePrefix(modeByte byte, keyspaceID uint32) []byte {
+	prefix := make([]byte, 4)
+	binary.BigEndian.PutUint32(prefix, uint32(modeByte)<<24+keyspaceID)
+	return prefix
+}
+
 // EncodeV2Key encode a user key into API V2 format.
-func EncodeV2Key(mode Mode, key []byte) []byte {
-	return append(getV2Prefix(mode), key...)
+func EncodeV2Key(mode Mode, keyspaceID uint32, key []byte) []byte {
+	return append(getV2Prefix(mode, keyspaceID), key...)
 }
 
 // EncodeV2Range encode a range into API V2 format.
-func EncodeV2Range(mode Mode, start, end []byte) ([]byte, []byte) {
+func EncodeV2Range(mode Mode, keyspaceID uint32, start, end []byte) ([]byte, []byte) {
 	var b []byte
 	if len(end) > 0 {
-		b = EncodeV2Key(mode, end)
+		b = EncodeV2Key(mode, keyspaceID, end)
 	} else {
-		b = getV2EndKey(mode)
+		b = getV2EndKey(mode, keyspaceID)
 	}
-	return EncodeV2Key(mode, start), b
+	return EncodeV2Key(mode, keyspaceID, start), b
 }
 
 // EncodeV2KeyRanges encode KeyRange slice into API V2 formatted new slice.
-func EncodeV2KeyRanges(mode Mode, keyRanges []*kvrpcpb.KeyRange) []*kvrpcpb.KeyRange {
+func EncodeV2KeyRanges(mode Mode, keyspaceID uint32, keyRanges []*kvrpcpb.KeyRange) []*kvrpcpb.KeyRange {
 	encodedRanges := make([]*kvrpcpb.KeyRange, 0, len(keyRanges))
 	for i := 0; i < len(keyRanges); i++ {
 		keyRange := kvrpcpb.KeyRange{}
-		keyRange.StartKey, keyRange.EndKey = EncodeV2Range(mode, keyRanges[i].StartKey, keyRanges[i].EndKey)
+		keyRange.StartKey, keyRange.EndKey = EncodeV2Range(mode, keyspaceID, keyRanges[i].StartKey, keyRanges[i].EndKey)
 		encodedRanges = append(encodedRanges, &keyRange)
 	}
 	return encodedRanges
@@ -82,16 +94,16 @@ func EncodeV2KeyRanges(mode Mode, keyRanges []*kvrpcpb.KeyRange) []*kvrpcpb.KeyR
 
 // MapV2RangeToV1 maps a range in API V2 format into V1 range.
 // This function forbid the user seeing other keyspace.
-func MapV2RangeToV1(mode Mode, start []byte, end []byte) ([]byte, []byte) {
+func MapV2RangeToV1(mode Mode, keyspaceID uint32, start []byte, end []byte) ([]byte, []byte) {
 	var a, b []byte
-	minKey := getV2Prefix(mode)
+	minKey := getV2Prefix(mode, keyspaceID)
 	if bytes.Compare(start, minKey) < 0 {
 		a = []byte{}
 	} else {
 		a = start[len(minKey):]
 	}
 
-	maxKey := getV2EndKey(mode)
+	maxKey := getV2EndKey(mode, keyspaceID)
 	if len(end) == 0 || bytes.Compare(end, maxKey) >= 0 {
 		b = []byte{}
 	} else {
@@ -102,20 +114,20 @@ func MapV2RangeToV1(mode Mode, start []byte, end []byte) ([]byte, []byte) {
 }
 
 // EncodeV2Keys encodes keys into API V2 format.
-func EncodeV2Keys(mode Mode, keys [][]byte) [][]byte {
+func EncodeV2Keys(mode Mode, keyspaceID uint32, keys [][]byte) [][]byte {
 	var ks [][]byte
 	for _, key := range keys {
-		ks = append(ks, EncodeV2Key(mode, key))
+		ks = append(ks, EncodeV2Key(mode, keyspaceID, key))
 	}
 	return ks
 }
 
 // EncodeV2Pairs encodes pairs into API V2 format.
-func EncodeV2Pairs(mode Mode, pairs []*kvrpcpb.KvPair) []*kvrpcpb.KvPair {
+func EncodeV2Pairs(mode Mode, keyspaceID uint32, pairs []*kvrpcpb.KvPair) []*kvrpcpb.KvPair {
 	var ps []*kvrpcpb.KvPair
 	for _, pair := range pairs {
 		p := *pair
-		p.Key = EncodeV2Key(mode, p.Key)
+		p.Key = EncodeV2Key(mode, keyspaceID, p.Key)
 		ps = append(ps, &p)
 	}
 	return ps
@@ -134,47 +146,51 @@ func EncodeRequest(req *tikvrpc.Request) (*tikvrpc.Request, error) {
 	switch req.Type {
 	case tikvrpc.CmdRawGet:
 		r := *req.RawGet()
-		r.Key = EncodeV2Key(ModeRaw, r.Key)
+		r.Key = EncodeV2Key(ModeRaw, req.KeyspaceID, r.Key)
 		newReq.Req = &r
 	case tikvrpc.CmdRawBatchGet:
 		r := *req.RawBatchGet()
-		r.Keys = EncodeV2Keys(ModeRaw, r.Keys)
+		r.Keys = EncodeV2Keys(ModeRaw, req.KeyspaceID, r.Keys)
 		newReq.Req = &r
 	case tikvrpc.CmdRawPut:
 		r := *req.RawPut()
-		r.Key = EncodeV2Key(ModeRaw, r.Key)
+		r.Key = EncodeV2Key(ModeRaw, req.KeyspaceID, r.Key)
 		newReq.Req = &r
 	case tikvrpc.CmdRawBatchPut:
 		r := *req.RawBatchPut()
-		r.Pairs = EncodeV2Pairs(ModeRaw, r.Pairs)
+		r.Pairs = EncodeV2Pairs(ModeRaw, req.KeyspaceID, r.Pairs)
 		newReq.Req = &r
 	case tikvrpc.CmdRawDelete:
 		r := *req.RawDelete()
-		r.Key = EncodeV2Key(ModeRaw, r.Key)
+		r.Key = EncodeV2Key(ModeRaw, req.KeyspaceID, r.Key)
 		newReq.Req = &r
 	case tikvrpc.CmdRawBatchDelete:
 		r := *req.RawBatchDelete()
-		r.Keys = EncodeV2Keys(ModeRaw, r.Keys)
+		r.Keys = EncodeV2Keys(ModeRaw, req.KeyspaceID, r.Keys)
 		newReq.Req = &r
 	case tikvrpc.CmdRawDeleteRange:
 		r := *req.RawDeleteRange()
-		r.StartKey, r.EndKey = EncodeV2Range(ModeRaw, r.StartKey, r.EndKey)
+		r.StartKey, r.EndKey = EncodeV2Range(ModeRaw, req.KeyspaceID, r.StartKey, r.EndKey)
 		newReq.Req = &r
 	case tikvrpc.CmdRawScan:
 		r := *req.RawScan()
-		r.StartKey, r.EndKey = EncodeV2Range(ModeRaw, r.StartKey, r.EndKey)
+		r.StartKey, r.EndKey = EncodeV2Range(ModeRaw, req.KeyspaceID, r.StartKey, r.EndKey)
 		newReq.Req = &r
 	case tikvrpc.CmdGetKeyTTL:
 		r := *req.RawGetKeyTTL()
-		r.Key = EncodeV2Key(ModeRaw, r.Key)
+		r.Key = EncodeV2Key(ModeRaw, req.KeyspaceID, r.Key)
 		newReq.Req = &r
 	case tikvrpc.CmdRawCompareAndSwap:
 		r := *req.RawCompareAndSwap()
-		r.Key = EncodeV2Key(ModeRaw, r.Key)
+		r.Key = EncodeV2Key(ModeRaw, req.KeyspaceID, r.Key)
 		newReq.Req = &r
 	case tikvrpc.CmdRawChecksum:
 		r := *req.RawChecksum()
-		r.Ranges = EncodeV2KeyRanges(ModeRaw, r.Ranges)
+		r.Ranges = EncodeV2KeyRanges(ModeRaw, req.KeyspaceID, r.Ranges)
+		newReq.Req = &r
+	case tikvrpc.CmdRawBatchScan:
+		r := *req.RawBatchScan()
+		r.Ranges = EncodeV2KeyRanges(ModeRaw, req.KeyspaceID, r.Ranges)
 		newReq.Req = &r
 	}
 
@@ -182,8 +198,8 @@ func EncodeRequest(req *tikvrpc.Request) (*tikvrpc.Request, error) {
 }
 
 // DecodeV2Key decodes API V2 encoded key into a normal user key.
-func DecodeV2Key(mode Mode, key []byte) ([]byte, error) {
-	prefix := getV2Prefix(mode)
+func DecodeV2Key(mode Mode, keyspaceID uint32, key []byte) ([]byte, error) {
+	prefix := getV2Prefix(mode, keyspaceID)
 	if !bytes.HasPrefix(key, prefix) {
 		return nil, errors.Errorf("invalid encoded key prefix: %q", key)
 	}
@@ -191,12 +207,12 @@ func DecodeV2Key(mode Mode, key []byte) ([]byte, error) {
 }
 
 // DecodeV2Pairs decodes API V2 encoded pairs into normal user pairs.
-func DecodeV2Pairs(mode Mode, pairs []*kvrpcpb.KvPair) ([]*kvrpcpb.KvPair, error) {
+func DecodeV2Pairs(mode Mode, keyspaceID uint32, pairs []*kvrpcpb.KvPair) ([]*kvrpcpb.KvPair, error) {
 	var ps []*kvrpcpb.KvPair
 	for _, pair := range pairs {
 		var err error
 		p := *pair
-		p.Key, err = DecodeV2Key(mode, p.Key)
+		p.Key, err = DecodeV2Key(mode, keyspaceID, p.Key)
 		if err != nil {
 			return nil, err
 		}
@@ -216,10 +232,13 @@ func DecodeResponse(req *tikvrpc.Request, resp *tikvrpc.Response) (*tikvrpc.Resp
 	switch req.Type {
 	case tikvrpc.CmdRawBatchGet:
 		r := resp.Resp.(*kvrpcpb.RawBatchGetResponse)
-		r.Pairs, err = DecodeV2Pairs(ModeRaw, r.Pairs)
+		r.Pairs, err = DecodeV2Pairs(ModeRaw, req.KeyspaceID, r.Pairs)
 	case tikvrpc.CmdRawScan:
 		r := resp.Resp.(*kvrpcpb.RawScanResponse)
-		r.Kvs, err = DecodeV2Pairs(ModeRaw, r.Kvs)
+		r.Kvs, err = DecodeV2Pairs(ModeRaw, req.KeyspaceID, r.Kvs)
+	case tikvrpc.CmdRawBatchScan:
+		r := resp.Resp.(*kvrpcpb.RawBatchScanResponse)
+		r.Kvs, err = DecodeV2Pairs(ModeRaw, req.KeyspaceID, r.Kvs)
 	}
 
 	return resp, err
@@ -47,22 +47,56 @@ func TestEncodeEncodeV2KeyRanges(t *testing.T) {
 	}
 	expect := []*kvrpcpb.KeyRange{
 		{
-			StartKey: getV2Prefix(ModeRaw),
-			EndKey:   getV2EndKey(ModeRaw),
+			StartKey: getV2Prefix(ModeRaw, 0),
+			EndKey:   getV2EndKey(ModeRaw, 0),
 		},
 		{
-			StartKey: getV2Prefix(ModeRaw),
-			EndKey:   append(getV2Prefix(ModeRaw), 'z'),
+			StartKey: getV2Prefix(ModeRaw, 0),
+			EndKey:   append(getV2Prefix(ModeRaw, 0), 'z'),
 		},
 		{
-			StartKey: append(getV2Prefix(ModeRaw), 'a'),
-			EndKey:   getV2EndKey(ModeRaw),
+			StartKey: append(getV2Prefix(ModeRaw, 0), 'a'),
+			EndKey:   getV2EndKey(ModeRaw, 0),
 		},
 		{
-			StartKey: append(getV2Prefix(ModeRaw), 'a'),
-			EndKey:   append(getV2Prefix(ModeRaw), 'z'),
+			StartKey: append(getV2Prefix(ModeRaw, 0), 'a'),
+			EndKey:   append(getV2Prefix(ModeRaw, 0), 'z'),
 		},
 	}
-	encodedKeyRanges := EncodeV2KeyRanges(ModeRaw, keyRanges)
+	encodedKeyRanges := EncodeV2KeyRanges(ModeRaw, 0, keyRanges)
 	require.Equal(t, expect, encodedKeyRanges)
 }
+
+func TestEncodeKeyspace(t *testing.T) {
+	req := &tikvrpc.Request{
+		Type: tikvrpc.CmdRawScan,
+		Req: &kvrpcpb.RawScanRequest{
+			StartKey: []byte("a"),
+		},
+		KeyspaceID: 0x010203,
+	}
+	req.ApiVersion = kvrpcpb.APIVersion_V2
+
+	r, err := EncodeRequest(req)
+	require.Nil(t, err)
+	require.Equal(t, []byte{'r', 1, 2, 3, 'a'}, r.RawScan().StartKey)
+	require.Equal(t, []byte{'r', 1, 2, 4}, r.RawScan().EndKey)
+
+	resp := &tikvrpc.Response{Resp: &kvrpcpb.RawScanResponse{
+		Kvs: []*kvrpcpb.KvPair{{Key: []byte{'r', 1, 2, 3, 'b'}}},
+	}}
+	resp, err = DecodeResponse(req, resp)
+	require.Nil(t, err)
+	require.Equal(t, []byte("b"), resp.Resp.(*kvrpcpb.RawScanResponse).Kvs[0].Key)
+	// The keys of other keyspaces are rejected.
+	resp = &tikvrpc.Response{Resp: &kvrpcpb.RawScanResponse{
+		Kvs: []*kvrpcpb.KvPair{{Key: []byte{'r', 0, 0, 0, 'b'}}},
+	}}
+	_, err = DecodeResponse(req, resp)
+	require.NotNil(t, err)
+
+	require.Equal(t, []byte{'s', 0, 0, 0}, getV2EndKey(ModeRaw, MaxKeyspaceID))
+	start, end := MapV2RangeToV1(ModeRaw, 0x010203, []byte{'r', 1, 2, 3, 'c'}, []byte{'r', 1, 2, 4})
+	require.Equal(t, []byte("c"), start)
+	require.Equal(t, []byte{}, end)
+}
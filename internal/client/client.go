@@ -64,12 +64,15 @@ import (
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
 )
 
 // MaxRecvMsgSize set max gRPC receive message size received from server. If any message size is larger than
@@ -141,7 +144,7 @@ func (a *connArray) Init(addr string, security config.Security, idleNotify *uint
 	a.target = addr
 
 	opt := grpc.WithTransportCredentials(insecure.NewCredentials())
-	if len(security.ClusterSSLCA) != 0 {
+	if security.TLSEnabled() {
 		tlsConfig, err := security.ToTLSConfig()
 		if err != nil {
 			return errors.WithStack(err)
@@ -195,6 +198,7 @@ func (a *connArray) Init(addr string, security config.Security, idleNotify *uint
 				Time:    time.Duration(keepAlive) * time.Second,
 				Timeout: time.Duration(keepAliveTimeout) * time.Second,
 			}),
+			grpc.WithStatsHandler(bytesStatsHandler{}),
 		}, opts...)
 
 		conn, err := grpc.DialContext(
@@ -255,9 +259,11 @@ func (a *connArray) Close() {
 }
 
 type option struct {
-	gRPCDialOptions []grpc.DialOption
-	security        config.Security
-	dialTimeout     time.Duration
+	gRPCDialOptions  []grpc.DialOption
+	security         config.Security
+	dialTimeout      time.Duration
+	retryOnConnError bool
+	connectionCount  uint
 }
 
 // Opt is the option for the client.
@@ -271,12 +277,58 @@ func WithSecurity(security config.Security) Opt {
 }
 
 // WithGRPCDialOptions is used to set the grpc.DialOption.
+// They are applied after the default options of the connections, so they override the defaults.
 func WithGRPCDialOptions(grpcDialOptions ...grpc.DialOption) Opt {
 	return func(c *option) {
 		c.gRPCDialOptions = grpcDialOptions
 	}
 }
 
+// WithGRPCConnectionCount sets the number of connections to each store, which overrides grpc-connection-count of
+// the TiKV client config if it's positive. The requests are sent through the connections in round-robin.
+func WithGRPCConnectionCount(count uint) Opt {
+	return func(c *option) {
+		c.connectionCount = count
+	}
+}
+
+// WithRetryOnConnectionError makes the client retry a request once when it fails with a connection-level error,
+// e.g. the connection is reset after a NAT gateway drops it while it's idle. The retry is sent by a unary call,
+// which waits for gRPC to reconnect, instead of the batch connection which is not available until it reconnects.
+// Only the raw commands that can be applied twice are retried, see isIdempotent, as the request may have reached
+// TiKV before the connection failed. The others fail as before, and the caller decides whether to retry. A request
+// that fails again is returned to the region request sender, which backs off before sending it again, so the retry
+// here only saves that backoff for the first request after the connection breaks.
+func WithRetryOnConnectionError() Opt {
+	return func(c *option) {
+		c.retryOnConnError = true
+	}
+}
+
+// bytesStatsHandler counts the bytes of the messages before and after compression by TiKVGRPCBytesCounter.
+type bytesStatsHandler struct{}
+
+func (bytesStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (bytesStatsHandler) HandleRPC(_ context.Context, s stats.RPCStats) {
+	switch s := s.(type) {
+	case *stats.OutPayload:
+		metrics.GRPCBytesSentPayload.Add(float64(s.Length))
+		metrics.GRPCBytesSentWire.Add(float64(s.WireLength))
+	case *stats.InPayload:
+		metrics.GRPCBytesReceivedPayload.Add(float64(s.Length))
+		metrics.GRPCBytesReceivedWire.Add(float64(s.WireLength))
+	}
+}
+
+func (bytesStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (bytesStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
+
 // RPCClient is RPC client struct.
 // TODO: Add flow control between RPC clients in TiDB ond RPC servers in TiKV.
 // Since we use shared client connection to communicate to the same TiKV, it's possible
@@ -286,6 +338,8 @@ type RPCClient struct {
 
 	conns  map[string]*connArray
 	option *option
+	// retired holds the connections replaced by SetSecurity, which are closed after retiredConnCloseDelay.
+	retired map[*connArray]struct{}
 
 	idleNotify uint32
 
@@ -297,7 +351,8 @@ type RPCClient struct {
 // NewRPCClient creates a client that manages connections and rpc calls with tikv-servers.
 func NewRPCClient(opts ...Opt) *RPCClient {
 	cli := &RPCClient{
-		conns: make(map[string]*connArray),
+		conns:   make(map[string]*connArray),
+		retired: make(map[*connArray]struct{}),
 		option: &option{
 			dialTimeout: dialTimeout,
 		},
@@ -340,6 +395,9 @@ func (c *RPCClient) createConnArray(addr string, enableBatch bool, opts ...func(
 	if !ok {
 		var err error
 		client := config.GetGlobalConfig().TiKVClient
+		if c.option.connectionCount > 0 {
+			client.GrpcConnectionCount = c.option.connectionCount
+		}
 		for _, opt := range opts {
 			opt(&client)
 		}
@@ -369,10 +427,60 @@ func (c *RPCClient) closeConns() {
 		for _, array := range c.conns {
 			array.Close()
 		}
+		for array := range c.retired {
+			array.Close()
+		}
+		c.retired = nil
 	}
 	c.Unlock()
 }
 
+// retiredConnCloseDelay is how long the connections replaced by SetSecurity are kept for the requests in flight.
+var retiredConnCloseDelay = ReadTimeoutMedium
+
+// SetSecurity replaces the security config, e.g. to use the rotated certificates. The connections created before
+// are moved out of the client, so that the following requests connect with the new config, and are closed after
+// the requests in flight on them are expected to finish.
+func (c *RPCClient) SetSecurity(security config.Security) error {
+	if security.TLSEnabled() {
+		if _, err := security.ToTLSConfig(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	c.Lock()
+	defer c.Unlock()
+	if c.isClosed {
+		return errors.Errorf("rpcClient is closed")
+	}
+	c.option.security = security
+	retired := make([]*connArray, 0, len(c.conns))
+	for addr, array := range c.conns {
+		retired = append(retired, array)
+		c.retired[array] = struct{}{}
+		delete(c.conns, addr)
+	}
+	if len(retired) > 0 {
+		time.AfterFunc(retiredConnCloseDelay, func() { c.closeRetired(retired) })
+	}
+	return nil
+}
+
+// closeRetired closes the retired connections, unless they are already closed by Close.
+func (c *RPCClient) closeRetired(arrays []*connArray) {
+	var toClose []*connArray
+	c.Lock()
+	for _, array := range arrays {
+		if _, ok := c.retired[array]; ok {
+			delete(c.retired, array)
+			toClose = append(toClose, array)
+		}
+	}
+	c.Unlock()
+	for _, array := range toClose {
+		array.Close()
+	}
+}
+
 var (
 	sendReqHistCache       sync.Map
 	sendReqCounterCache    sync.Map
@@ -452,7 +560,7 @@ func (c *RPCClient) updateTiKVSendReqHistogram(req *tikvrpc.Request, resp *tikvr
 	}
 }
 
-func (c *RPCClient) sendRequest(ctx context.Context, addr string, req *tikvrpc.Request, timeout time.Duration) (resp *tikvrpc.Response, err error) {
+func (c *RPCClient) sendRequest(ctx context.Context, addr string, req *tikvrpc.Request, timeout time.Duration, allowBatch bool) (resp *tikvrpc.Response, err error) {
 	var spanRPC opentracing.Span
 	if span := opentracing.SpanFromContext(ctx); span != nil && span.Tracer() != nil {
 		spanRPC = span.Tracer().StartSpan(fmt.Sprintf("rpcClient.SendRequest, region ID: %d, type: %s", req.RegionId, req.Type), opentracing.ChildOf(span.Context()))
@@ -491,7 +599,7 @@ func (c *RPCClient) sendRequest(ctx context.Context, addr string, req *tikvrpc.R
 
 	// TiDB RPC server supports batch RPC, but batch connection will send heart beat, It's not necessary since
 	// request to TiDB is not high frequency.
-	if config.GetGlobalConfig().TiKVClient.MaxBatchSize > 0 && enableBatch {
+	if config.GetGlobalConfig().TiKVClient.MaxBatchSize > 0 && enableBatch && allowBatch {
 		if batchReq := req.ToBatchCommandsRequest(); batchReq != nil {
 			defer trace.StartRegion(ctx, req.Type.String()).End()
 			return sendBatchRequest(ctx, addr, req.ForwardedHost, connArray.batchConn, batchReq, timeout)
@@ -537,13 +645,36 @@ func (c *RPCClient) SendRequest(ctx context.Context, addr string, req *tikvrpc.R
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.sendRequest(ctx, addr, req, timeout)
+	resp, err := c.sendRequest(ctx, addr, req, timeout, true)
+	if err != nil && c.option.retryOnConnError && isIdempotent(req.Type) && isConnectionError(err) && ctx.Err() == nil {
+		logutil.BgLogger().Info("retry the request after a connection error",
+			zap.String("target", addr), zap.Stringer("type", req.Type), zap.Error(err))
+		resp, err = c.sendRequest(ctx, addr, req, timeout, false)
+	}
 	if err != nil {
 		return nil, err
 	}
 	return DecodeResponse(req, resp)
 }
 
+// isIdempotent tells whether applying the command twice has the same effect as applying it once. A CAS isn't, as
+// the second one fails after the first one swaps the value.
+func isIdempotent(cmd tikvrpc.CmdType) bool {
+	switch cmd {
+	case tikvrpc.CmdRawGet, tikvrpc.CmdRawBatchGet, tikvrpc.CmdRawScan, tikvrpc.CmdRawBatchScan, tikvrpc.CmdGetKeyTTL,
+		tikvrpc.CmdRawChecksum, tikvrpc.CmdRawPut, tikvrpc.CmdRawBatchPut, tikvrpc.CmdRawDelete,
+		tikvrpc.CmdRawBatchDelete, tikvrpc.CmdRawDeleteRange:
+		return true
+	default:
+		return false
+	}
+}
+
+// isConnectionError tells whether the request failed because of the connection rather than TiKV.
+func isConnectionError(err error) bool {
+	return status.Code(errors.Cause(err)) == codes.Unavailable
+}
+
 func (c *RPCClient) getCopStreamResponse(ctx context.Context, client tikvpb.TikvClient, req *tikvrpc.Request, timeout time.Duration, connArray *connArray) (*tikvrpc.Response, error) {
 	// Coprocessor streaming request.
 	// Use context to support timeout for grpc streaming client.
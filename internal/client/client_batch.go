@@ -555,6 +555,12 @@ func (c *batchCommandsClient) waitConnReady() (err error) {
 			cancel()
 			break
 		}
+		// The connection is closed and never becomes ready.
+		if s == connectivity.Shutdown {
+			cancel()
+			err = errors.New("connection is closed")
+			return
+		}
 		if !c.conn.WaitForStateChange(dialCtx, s) {
 			cancel()
 			err = dialCtx.Err()
@@ -0,0 +1,80 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/tikv/client-go/v2/config"
+	"github.com/tikv/client-go/v2/tikvrpc"
+)
+
+// BenchmarkGRPCConnectionCount sends RawBatchGet requests of 16 keys concurrently to a loopback mock TiKV, which
+// returns 16KB of values for each, to show how the throughput of the raw batch path scales with the number of
+// connections to a store.
+func BenchmarkGRPCConnectionCount(b *testing.B) {
+	server, port := startMockTikvService()
+	if port <= 0 {
+		b.Fatal("failed to start the mock TiKV service")
+	}
+	defer server.Stop()
+	addr := fmt.Sprintf("%s:%d", "127.0.0.1", port)
+
+	keys := make([][]byte, 16)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%02d", i))
+	}
+	req := tikvrpc.NewRequest(tikvrpc.CmdRawBatchGet, &kvrpcpb.RawBatchGetRequest{Keys: keys})
+	for _, maxBatchSize := range []uint{0, 128} {
+		for _, count := range []uint{1, 2, 4, 8} {
+			b.Run(fmt.Sprintf("batch=%d/conns=%d", maxBatchSize, count), func(b *testing.B) {
+				defer config.UpdateGlobal(func(conf *config.Config) {
+					conf.TiKVClient.MaxBatchSize = maxBatchSize
+				})()
+				rpcClient := NewRPCClient(WithGRPCConnectionCount(count))
+				defer rpcClient.Close()
+				send := func() error {
+					resp, err := rpcClient.SendRequest(context.Background(), addr, req, 10*time.Second)
+					if err != nil {
+						return err
+					}
+					if n := len(resp.Resp.(*kvrpcpb.RawBatchGetResponse).GetPairs()); n != len(keys) {
+						return fmt.Errorf("got %d pairs, want %d", n, len(keys))
+					}
+					return nil
+				}
+				if err := send(); err != nil {
+					b.Fatal(err)
+				}
+
+				b.SetBytes(int64(len(keys) * mockRawValueSize))
+				b.SetParallelism(16)
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						if err := send(); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				})
+			})
+		}
+	}
+}
@@ -37,6 +37,7 @@ package client
 import (
 	"context"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 	"sync"
@@ -50,11 +51,16 @@ import (
 	"github.com/pingcap/kvproto/pkg/metapb"
 	"github.com/pingcap/kvproto/pkg/tikvpb"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/tikv/client-go/v2/config"
+	"github.com/tikv/client-go/v2/metrics"
 	"github.com/tikv/client-go/v2/tikvrpc"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -86,6 +92,58 @@ func TestConn(t *testing.T) {
 	assert.Nil(t, conn4)
 }
 
+func TestGRPCConnectionCount(t *testing.T) {
+	defer config.UpdateGlobal(func(conf *config.Config) {
+		conf.TiKVClient.MaxBatchSize = 0
+		conf.TiKVClient.GrpcConnectionCount = 1
+	})()
+
+	client := NewRPCClient(WithGRPCConnectionCount(3))
+	defer client.Close()
+	conns, err := client.getConnArray("127.0.0.1:6379", true)
+	assert.Nil(t, err)
+	assert.Len(t, conns.v, 3)
+	seen := make(map[*grpc.ClientConn]struct{})
+	for i := 0; i < 3; i++ {
+		seen[conns.Get()] = struct{}{}
+	}
+	assert.Len(t, seen, 3)
+}
+
+func TestSetSecurity(t *testing.T) {
+	defer config.UpdateGlobal(func(conf *config.Config) {
+		conf.TiKVClient.MaxBatchSize = 0
+	})()
+	defer func(delay time.Duration) { retiredConnCloseDelay = delay }(retiredConnCloseDelay)
+	retiredConnCloseDelay = 100 * time.Millisecond
+
+	client := NewRPCClient()
+	defer client.Close()
+	addr := "127.0.0.1:6379"
+	conn1, err := client.getConnArray(addr, true)
+	require.Nil(t, err)
+
+	require.NotNil(t, client.SetSecurity(config.Security{ClusterSSLCA: "/nonexistent/ca.pem"}))
+	require.Same(t, conn1, client.conns[addr])
+
+	require.Nil(t, client.SetSecurity(config.Security{}))
+	conn2, err := client.getConnArray(addr, true)
+	require.Nil(t, err)
+	require.NotSame(t, conn1, conn2)
+	// The old connections are kept for the requests in flight for a while.
+	isClosed := func(a *connArray) bool {
+		select {
+		case <-a.done:
+			return true
+		default:
+			return false
+		}
+	}
+	require.False(t, isClosed(conn1))
+	require.Eventually(t, func() bool { return isClosed(conn1) }, 5*time.Second, 10*time.Millisecond)
+	require.False(t, isClosed(conn2))
+}
+
 func TestGetConnAfterClose(t *testing.T) {
 	client := NewRPCClient()
 
@@ -303,6 +361,234 @@ func TestForwardMetadataByUnaryCall(t *testing.T) {
 	assert.Equal(t, atomic.LoadUint64(&checkCnt), uint64(4))
 }
 
+func TestGRPCDialOptions(t *testing.T) {
+	server, port := startMockTikvService()
+	require.True(t, port > 0)
+	defer server.Stop()
+	addr := fmt.Sprintf("%s:%d", "127.0.0.1", port)
+
+	// Disable batch.
+	defer config.UpdateGlobal(func(conf *config.Config) {
+		conf.TiKVClient.MaxBatchSize = 0
+		conf.TiKVClient.GrpcConnectionCount = 1
+	})()
+	var intercepted uint64
+	authInterceptor := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		atomic.AddUint64(&intercepted, 1)
+		return invoker(metadata.AppendToOutgoingContext(ctx, "authorization", "token"), method, req, reply, cc, opts...)
+	}
+	rpcClient := NewRPCClient(WithGRPCDialOptions(grpc.WithChainUnaryInterceptor(authInterceptor)))
+	defer rpcClient.closeConns()
+
+	var checkCnt uint64
+	server.setMetaChecker(func(ctx context.Context) error {
+		atomic.AddUint64(&checkCnt, 1)
+		md, ok := metadata.FromIncomingContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, []string{"token"}, md.Get("authorization"))
+		return nil
+	})
+
+	prewriteReq := tikvrpc.NewRequest(tikvrpc.CmdPrewrite, &kvrpcpb.PrewriteRequest{})
+	for i := 0; i < 3; i++ {
+		_, err := rpcClient.SendRequest(context.Background(), addr, prewriteReq, 10*time.Second)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, uint64(3), atomic.LoadUint64(&intercepted))
+	assert.Equal(t, uint64(3), atomic.LoadUint64(&checkCnt))
+}
+
+// dropProxy forwards TCP connections to target, and breaks them like a NAT gateway dropping the idle ones: reset
+// closes them, and drop discards everything sent through them afterwards without closing them.
+type dropProxy struct {
+	listener net.Listener
+	target   string
+
+	mu      sync.Mutex
+	conns   []*net.TCPConn
+	dropped map[*net.TCPConn]bool
+}
+
+func startDropProxy(t *testing.T, target string) *dropProxy {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	p := &dropProxy{listener: listener, target: target, dropped: make(map[*net.TCPConn]bool)}
+	go p.run()
+	return p
+}
+
+func (p *dropProxy) run() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		upstream, err := net.Dial("tcp", p.target)
+		if err != nil {
+			conn.Close()
+			continue
+		}
+		p.mu.Lock()
+		p.conns = append(p.conns, conn.(*net.TCPConn), upstream.(*net.TCPConn))
+		p.mu.Unlock()
+		go p.forward(conn.(*net.TCPConn), upstream.(*net.TCPConn))
+		go p.forward(upstream.(*net.TCPConn), conn.(*net.TCPConn))
+	}
+}
+
+// forward copies from src to dst until src is dropped, and discards what it reads from src after that.
+func (p *dropProxy) forward(dst, src *net.TCPConn) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if err != nil {
+			return
+		}
+		p.mu.Lock()
+		dropped := p.dropped[src]
+		p.mu.Unlock()
+		if dropped {
+			continue
+		}
+		if _, err := dst.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+}
+
+func (p *dropProxy) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range p.conns {
+		conn.SetLinger(0)
+		conn.Close()
+	}
+	p.conns = nil
+}
+
+func (p *dropProxy) drop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range p.conns {
+		p.dropped[conn] = true
+	}
+	p.conns = nil
+}
+
+func (p *dropProxy) close() {
+	p.listener.Close()
+	p.reset()
+}
+
+func TestRetryOnConnectionError(t *testing.T) {
+	server, port := startMockTikvService()
+	require.True(t, port > 0)
+	defer server.Stop()
+	proxy := startDropProxy(t, fmt.Sprintf("%s:%d", "127.0.0.1", port))
+	defer proxy.close()
+	addr := proxy.listener.Addr().String()
+
+	for _, maxBatchSize := range []uint{0, 128} {
+		restore := config.UpdateGlobal(func(conf *config.Config) {
+			conf.TiKVClient.MaxBatchSize = maxBatchSize
+			conf.TiKVClient.GrpcConnectionCount = 1
+		})
+		req := tikvrpc.NewRequest(tikvrpc.CmdRawBatchGet, &kvrpcpb.RawBatchGetRequest{Keys: [][]byte{[]byte("key")}})
+
+		rpcClient := NewRPCClient()
+		_, err := rpcClient.SendRequest(context.Background(), addr, req, 10*time.Second)
+		assert.Nil(t, err)
+		proxy.reset()
+		_, err = rpcClient.SendRequest(context.Background(), addr, req, 10*time.Second)
+		assert.True(t, isConnectionError(err), "%v", err)
+		rpcClient.closeConns()
+
+		rpcClient = NewRPCClient(WithRetryOnConnectionError())
+		_, err = rpcClient.SendRequest(context.Background(), addr, req, 10*time.Second)
+		assert.Nil(t, err)
+		proxy.reset()
+		_, err = rpcClient.SendRequest(context.Background(), addr, req, 10*time.Second)
+		assert.Nil(t, err)
+
+		// A CAS isn't retried, as it might be applied twice.
+		proxy.reset()
+		cas := tikvrpc.NewRequest(tikvrpc.CmdRawCompareAndSwap, &kvrpcpb.RawCASRequest{Key: []byte("key")})
+		_, err = rpcClient.SendRequest(context.Background(), addr, cas, 10*time.Second)
+		assert.True(t, isConnectionError(err), "%v", err)
+		rpcClient.closeConns()
+		restore()
+	}
+}
+
+func TestRetryAfterSilentDrop(t *testing.T) {
+	if testing.Short() {
+		t.Skip("keepalive takes at least 10s to detect a dropped connection")
+	}
+	server, port := startMockTikvService()
+	require.True(t, port > 0)
+	defer server.Stop()
+	proxy := startDropProxy(t, fmt.Sprintf("%s:%d", "127.0.0.1", port))
+	defer proxy.close()
+	addr := proxy.listener.Addr().String()
+
+	for _, maxBatchSize := range []uint{0, 128} {
+		restore := config.UpdateGlobal(func(conf *config.Config) {
+			conf.TiKVClient.MaxBatchSize = maxBatchSize
+			conf.TiKVClient.GrpcConnectionCount = 1
+		})
+		req := tikvrpc.NewRequest(tikvrpc.CmdRawBatchGet, &kvrpcpb.RawBatchGetRequest{Keys: [][]byte{[]byte("key")}})
+
+		// gRPC raises the keepalive time to 10s at least.
+		rpcClient := NewRPCClient(WithRetryOnConnectionError(), WithGRPCDialOptions(grpc.WithKeepaliveParams(
+			keepalive.ClientParameters{Time: 10 * time.Second, Timeout: time.Second, PermitWithoutStream: true})))
+		_, err := rpcClient.SendRequest(context.Background(), addr, req, 30*time.Second)
+		assert.Nil(t, err)
+		// The request sent through the dropped connection gets no response, until keepalive finds the connection
+		// dead and closes it, and then it's retried through a new connection.
+		proxy.drop()
+		_, err = rpcClient.SendRequest(context.Background(), addr, req, 30*time.Second)
+		assert.Nil(t, err)
+		rpcClient.closeConns()
+		restore()
+	}
+}
+
+func TestGRPCCompression(t *testing.T) {
+	server, port := startMockTikvService()
+	require.True(t, port > 0)
+	defer server.Stop()
+	addr := fmt.Sprintf("%s:%d", "127.0.0.1", port)
+
+	req := tikvrpc.NewRequest(tikvrpc.CmdPrewrite, &kvrpcpb.PrewriteRequest{
+		Mutations: []*kvrpcpb.Mutation{{Key: []byte("key"), Value: make([]byte, 64*1024)}},
+	})
+	sent := func(rpcClient *RPCClient) (payload, wire float64) {
+		payload, wire = testutil.ToFloat64(metrics.GRPCBytesSentPayload), testutil.ToFloat64(metrics.GRPCBytesSentWire)
+		_, err := rpcClient.SendRequest(context.Background(), addr, req, 10*time.Second)
+		assert.Nil(t, err)
+		return testutil.ToFloat64(metrics.GRPCBytesSentPayload) - payload, testutil.ToFloat64(metrics.GRPCBytesSentWire) - wire
+	}
+	for _, maxBatchSize := range []uint{0, 128} {
+		restore := config.UpdateGlobal(func(conf *config.Config) {
+			conf.TiKVClient.MaxBatchSize = maxBatchSize
+			conf.TiKVClient.GrpcConnectionCount = 1
+		})
+
+		rpcClient := NewRPCClient()
+		payload, wire := sent(rpcClient)
+		assert.Greater(t, payload, float64(64*1024))
+		assert.GreaterOrEqual(t, wire, payload)
+		rpcClient.closeConns()
+
+		rpcClient = NewRPCClient(WithGRPCDialOptions(grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name))))
+		payload, wire = sent(rpcClient)
+		assert.Greater(t, payload, float64(64*1024))
+		assert.Less(t, wire, payload/10)
+		rpcClient.closeConns()
+		restore()
+	}
+}
+
 func TestForwardMetadataByBatchCommands(t *testing.T) {
 	server, port := startMockTikvService()
 	require.True(t, port > 0)
@@ -53,6 +53,25 @@ func (s *server) KvPrewrite(ctx context.Context, req *kvrpcpb.PrewriteRequest) (
 	return &kvrpcpb.PrewriteResponse{}, nil
 }
 
+// mockRawValueSize is the size of the values the mock TiKV returns for RawBatchGet.
+const mockRawValueSize = 1024
+
+func (s *server) RawBatchGet(ctx context.Context, req *kvrpcpb.RawBatchGetRequest) (*kvrpcpb.RawBatchGetResponse, error) {
+	if err := s.checkMetadata(ctx); err != nil {
+		return nil, err
+	}
+	return mockRawBatchGet(req), nil
+}
+
+// mockRawBatchGet returns a value of mockRawValueSize for every key of the request.
+func mockRawBatchGet(req *kvrpcpb.RawBatchGetRequest) *kvrpcpb.RawBatchGetResponse {
+	pairs := make([]*kvrpcpb.KvPair, len(req.GetKeys()))
+	for i, key := range req.GetKeys() {
+		pairs[i] = &kvrpcpb.KvPair{Key: key, Value: make([]byte, mockRawValueSize)}
+	}
+	return &kvrpcpb.RawBatchGetResponse{Pairs: pairs}
+}
+
 func (s *server) CoprocessorStream(req *coprocessor.Request, ss tikvpb.Tikv_CoprocessorStreamServer) error {
 	if err := s.checkMetadata(ss.Context()); err != nil {
 		return err
@@ -73,6 +92,12 @@ func (s *server) BatchCommands(ss tikvpb.Tikv_BatchCommandsServer) error {
 
 		responses := make([]*tikvpb.BatchCommandsResponse_Response, 0, len(req.GetRequestIds()))
 		for i := 0; i < len(req.GetRequestIds()); i++ {
+			if rawBatchGet := req.GetRequests()[i].GetRawBatchGet(); rawBatchGet != nil {
+				responses = append(responses, &tikvpb.BatchCommandsResponse_Response{
+					Cmd: &tikvpb.BatchCommandsResponse_Response_RawBatchGet{RawBatchGet: mockRawBatchGet(rawBatchGet)},
+				})
+				continue
+			}
 			responses = append(responses, &tikvpb.BatchCommandsResponse_Response{
 				Cmd: &tikvpb.BatchCommandsResponse_Response_Empty{
 					Empty: &tikvpb.BatchCommandsEmptyResponse{},
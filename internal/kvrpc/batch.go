@@ -25,6 +25,8 @@ type Batch struct {
 	Keys     [][]byte
 	Values   [][]byte
 	TTLs     []uint64
+	// Size is the total size of the keys and values.
+	Size int
 }
 
 // BatchResult wraps a Batch request's server response or an error.
@@ -33,50 +35,58 @@ type BatchResult struct {
 	Error error
 }
 
-// AppendBatches divides the mutation to be requested into Batches so that the size of each batch is
-// approximately the same as the given limit.
-func AppendBatches(batches []Batch, regionID locate.RegionVerID, groupKeys [][]byte, keyToValue map[string][]byte, keyToTTL map[string]uint64, limit int) []Batch {
-	var start, size int
+// AppendBatches divides the mutation to be requested into Batches, ensuring that neither the total size of
+// keys and values nor the count of keys of each Batch exceeds the given limits. A non-positive limit means no limit.
+// A single pair larger than sizeLimit is put into a Batch by itself.
+// TTLs of the Batches are left empty if keyToTTL is empty.
+func AppendBatches(batches []Batch, regionID locate.RegionVerID, groupKeys [][]byte, keyToValue map[string][]byte, keyToTTL map[string]uint64, sizeLimit, countLimit int) []Batch {
+	var size int
 	var keys, values [][]byte
 	var ttls []uint64
-	for start = 0; start < len(groupKeys); start++ {
-		if size >= limit {
-			batches = append(batches, Batch{RegionID: regionID, Keys: keys, Values: values, TTLs: ttls})
-			keys = make([][]byte, 0)
-			values = make([][]byte, 0)
-			ttls = make([]uint64, 0)
+	for _, key := range groupKeys {
+		value := keyToValue[string(key)]
+		pairSize := len(key) + len(value)
+		if len(keys) > 0 && exceedsLimits(size+pairSize, len(keys)+1, sizeLimit, countLimit) {
+			batches = append(batches, Batch{RegionID: regionID, Keys: keys, Values: values, TTLs: ttls, Size: size})
+			keys, values, ttls = nil, nil, nil
 			size = 0
 		}
-		key := groupKeys[start]
-		value := keyToValue[string(key)]
-		ttl := keyToTTL[string(key)]
 		keys = append(keys, key)
 		values = append(values, value)
-		ttls = append(ttls, ttl)
-		size += len(key)
-		size += len(value)
+		if len(keyToTTL) > 0 {
+			ttls = append(ttls, keyToTTL[string(key)])
+		}
+		size += pairSize
 	}
 	if len(keys) != 0 {
-		batches = append(batches, Batch{RegionID: regionID, Keys: keys, Values: values, TTLs: ttls})
+		batches = append(batches, Batch{RegionID: regionID, Keys: keys, Values: values, TTLs: ttls, Size: size})
 	}
 	return batches
 }
 
-// AppendKeyBatches divides the mutation to be requested into Batches, ensuring that the count of keys of each
-// Batch is not greater than the given limit.
-func AppendKeyBatches(batches []Batch, regionID locate.RegionVerID, groupKeys [][]byte, limit int) []Batch {
+// AppendKeyBatches divides the mutation to be requested into Batches, ensuring that neither the total size of keys
+// nor the count of keys of each Batch exceeds the given limits. A non-positive limit means no limit.
+// A single key larger than sizeLimit is put into a Batch by itself.
+func AppendKeyBatches(batches []Batch, regionID locate.RegionVerID, groupKeys [][]byte, sizeLimit, countLimit int) []Batch {
+	var size int
 	var keys [][]byte
-	for start, count := 0, 0; start < len(groupKeys); start++ {
-		if count > limit {
-			batches = append(batches, Batch{RegionID: regionID, Keys: keys})
-			keys = make([][]byte, 0, limit)
-			count = 0
+	for _, key := range groupKeys {
+		if len(keys) > 0 && exceedsLimits(size+len(key), len(keys)+1, sizeLimit, countLimit) {
+			batches = append(batches, Batch{RegionID: regionID, Keys: keys, Size: size})
+			keys = nil
+			size = 0
 		}
-		keys = append(keys, groupKeys[start])
-		count++
+		keys = append(keys, key)
+		size += len(key)
 	}
 	if len(keys) != 0 {
-		batches = append(batches, Batch{RegionID: regionID, Keys: keys})
+		batches = append(batches, Batch{RegionID: regionID, Keys: keys, Size: size})
 	}
 	return batches
 }
+
+// exceedsLimits tells whether a batch of the given size and count exceeds the limits.
+// A non-positive limit means no limit.
+func exceedsLimits(size, count, sizeLimit, countLimit int) bool {
+	return (sizeLimit > 0 && size > sizeLimit) || (countLimit > 0 && count > countLimit)
+}
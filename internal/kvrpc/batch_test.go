@@ -0,0 +1,96 @@
+// Copyright 2021 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvrpc
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tikv/client-go/v2/internal/locate"
+)
+
+func batchSize(batch Batch) int {
+	size := 0
+	for i, key := range batch.Keys {
+		size += len(key)
+		if batch.Values != nil {
+			size += len(batch.Values[i])
+		}
+	}
+	return size
+}
+
+func TestAppendBatchesLimits(t *testing.T) {
+	regionID := locate.NewRegionVerID(1, 1, 1)
+
+	// many tiny pairs are limited by count.
+	keys := make([][]byte, 0, 10000)
+	keyToValue := make(map[string][]byte, 10000)
+	for i := 0; i < 10000; i++ {
+		key := []byte(fmt.Sprintf("k%05d", i))
+		keys = append(keys, key)
+		keyToValue[string(key)] = []byte("v")
+	}
+	batches := AppendBatches(nil, regionID, keys, keyToValue, nil, 16*1024, 512)
+	assert.Len(t, batches, 20)
+	total := 0
+	for _, batch := range batches {
+		assert.LessOrEqual(t, len(batch.Keys), 512)
+		assert.LessOrEqual(t, batchSize(batch), 16*1024)
+		assert.Equal(t, batchSize(batch), batch.Size)
+		assert.Nil(t, batch.TTLs)
+		total += len(batch.Keys)
+	}
+	assert.Equal(t, len(keys), total)
+
+	// few giant pairs are limited by size, counting the keys, and a pair over the limit is alone.
+	keys = [][]byte{bytes.Repeat([]byte("a"), 6000), []byte("b"), bytes.Repeat([]byte("c"), 20000), []byte("d")}
+	keyToValue = map[string][]byte{
+		string(keys[0]): bytes.Repeat([]byte("v"), 6000),
+		string(keys[1]): bytes.Repeat([]byte("v"), 5000),
+		string(keys[2]): []byte("v"),
+		string(keys[3]): []byte("v"),
+	}
+	keyToTTL := map[string]uint64{string(keys[0]): 1, string(keys[1]): 2, string(keys[2]): 3, string(keys[3]): 4}
+	batches = AppendBatches(nil, regionID, keys, keyToValue, keyToTTL, 16*1024, 512)
+	assert.Len(t, batches, 4)
+	for i, batch := range batches {
+		assert.Equal(t, [][]byte{keys[i]}, batch.Keys)
+		assert.Equal(t, []uint64{uint64(i + 1)}, batch.TTLs)
+	}
+}
+
+func TestAppendKeyBatchesLimits(t *testing.T) {
+	regionID := locate.NewRegionVerID(1, 1, 1)
+
+	keys := make([][]byte, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("k%05d", i)))
+	}
+	batches := AppendKeyBatches(nil, regionID, keys, 0, 512)
+	assert.Len(t, batches, 2)
+	assert.Len(t, batches[0].Keys, 512)
+
+	keys = [][]byte{bytes.Repeat([]byte("a"), 600), bytes.Repeat([]byte("b"), 600), []byte("c"), bytes.Repeat([]byte("d"), 2000)}
+	batches = AppendKeyBatches(nil, regionID, keys, 1024, 512)
+	assert.Len(t, batches, 3)
+	for _, batch := range batches[:2] {
+		assert.LessOrEqual(t, batchSize(batch), 1024)
+		assert.Equal(t, batchSize(batch), batch.Size)
+	}
+	assert.Equal(t, [][]byte{keys[3]}, batches[2].Keys)
+}
@@ -13,19 +13,30 @@ import (
 // CodecPDClientV2 wraps a PD Client to decode the region meta in API v2 manner.
 type CodecPDClientV2 struct {
 	*CodecPDClient
-	mode client.Mode
+	mode       client.Mode
+	keyspaceID uint32
 }
 
 // NewCodecPDClientV2 create a CodecPDClientV2.
 func NewCodecPDClientV2(client pd.Client, mode client.Mode) *CodecPDClientV2 {
+	return NewCodecPDClientV2WithKeyspace(client, mode, 0)
+}
+
+// NewCodecPDClientV2WithKeyspace creates a CodecPDClientV2 for the keys of the keyspace.
+func NewCodecPDClientV2WithKeyspace(client pd.Client, mode client.Mode, keyspaceID uint32) *CodecPDClientV2 {
 	codecClient := NewCodeCPDClient(client)
-	return &CodecPDClientV2{codecClient, mode}
+	return &CodecPDClientV2{codecClient, mode, keyspaceID}
+}
+
+// GetKeyspaceID returns the ID of the keyspace of the client.
+func (c *CodecPDClientV2) GetKeyspaceID() uint32 {
+	return c.keyspaceID
 }
 
 // GetRegion encodes the key before send requests to pd-server and decodes the
 // returned StartKey && EndKey from pd-server.
 func (c *CodecPDClientV2) GetRegion(ctx context.Context, key []byte, opts ...pd.GetRegionOption) (*pd.Region, error) {
-	queryKey := client.EncodeV2Key(c.mode, key)
+	queryKey := client.EncodeV2Key(c.mode, c.keyspaceID, key)
 	region, err := c.CodecPDClient.GetRegion(ctx, queryKey, opts...)
 	return c.processRegionResult(region, err)
 }
@@ -33,7 +44,7 @@ func (c *CodecPDClientV2) GetRegion(ctx context.Context, key []byte, opts ...pd.
 // GetPrevRegion encodes the key before send requests to pd-server and decodes the
 // returned StartKey && EndKey from pd-server.
 func (c *CodecPDClientV2) GetPrevRegion(ctx context.Context, key []byte, opts ...pd.GetRegionOption) (*pd.Region, error) {
-	queryKey := client.EncodeV2Key(c.mode, key)
+	queryKey := client.EncodeV2Key(c.mode, c.keyspaceID, key)
 	region, err := c.CodecPDClient.GetPrevRegion(ctx, queryKey, opts...)
 	return c.processRegionResult(region, err)
 }
@@ -48,7 +59,7 @@ func (c *CodecPDClientV2) GetRegionByID(ctx context.Context, regionID uint64, op
 // ScanRegions encodes the key before send requests to pd-server and decodes the
 // returned StartKey && EndKey from pd-server.
 func (c *CodecPDClientV2) ScanRegions(ctx context.Context, startKey []byte, endKey []byte, limit int) ([]*pd.Region, error) {
-	start, end := client.EncodeV2Range(c.mode, startKey, endKey)
+	start, end := client.EncodeV2Range(c.mode, c.keyspaceID, startKey, endKey)
 	regions, err := c.CodecPDClient.ScanRegions(ctx, start, end, limit)
 	if err != nil {
 		return nil, err
@@ -64,7 +75,7 @@ func (c *CodecPDClientV2) ScanRegions(ctx context.Context, startKey []byte, endK
 func (c *CodecPDClientV2) SplitRegions(ctx context.Context, splitKeys [][]byte, opts ...pd.RegionsOption) (*pdpb.SplitRegionsResponse, error) {
 	var keys [][]byte
 	for i := range splitKeys {
-		withPrefix := client.EncodeV2Key(c.mode, splitKeys[i])
+		withPrefix := client.EncodeV2Key(c.mode, c.keyspaceID, splitKeys[i])
 		keys = append(keys, codec.EncodeBytes(nil, withPrefix))
 	}
 	return c.CodecPDClient.SplitRegions(ctx, keys, opts...)
@@ -80,7 +91,7 @@ func (c *CodecPDClientV2) processRegionResult(region *pd.Region, err error) (*pd
 		region.Buckets = nil
 
 		region.Meta.StartKey, region.Meta.EndKey =
-			client.MapV2RangeToV1(c.mode, region.Meta.StartKey, region.Meta.EndKey)
+			client.MapV2RangeToV1(c.mode, c.keyspaceID, region.Meta.StartKey, region.Meta.EndKey)
 	}
 
 	return region, nil
@@ -104,7 +115,7 @@ func (c *CodecPDClientV2) decodeRegionWithShallowCopy(region *metapb.Region) (*m
 		return nil, err
 	}
 
-	newRegion.StartKey, newRegion.EndKey = client.MapV2RangeToV1(c.mode, newRegion.StartKey, newRegion.EndKey)
+	newRegion.StartKey, newRegion.EndKey = client.MapV2RangeToV1(c.mode, c.keyspaceID, newRegion.StartKey, newRegion.EndKey)
 
 	return &newRegion, nil
 }
@@ -126,6 +126,8 @@ type Region struct {
 	syncFlag      int32          // region need be sync in next turn
 	lastAccess    int64          // last region access time, see checkRegionCacheTTL
 	invalidReason InvalidReason  // the reason why the region is invalidated
+	// stats are the statistics of the cache that the region is loaded into, which counts the invalidations.
+	stats *regionCacheStats
 }
 
 // AccessIndex represent the index for accessIndex array
@@ -238,7 +240,7 @@ func (r *regionStore) filterStoreCandidate(aidx AccessIndex, op *storeSelectorOp
 }
 
 func newRegion(bo *retry.Backoffer, c *RegionCache, pdRegion *pd.Region) (*Region, error) {
-	r := &Region{meta: pdRegion.Meta}
+	r := &Region{meta: pdRegion.Meta, stats: &c.stats}
 	// regionStore pull used store from global store map
 	// to avoid acquire storeMu in later access.
 	rs := &regionStore{
@@ -328,7 +330,9 @@ func (r *Region) checkRegionCacheTTL(ts int64) bool {
 func (r *Region) invalidate(reason InvalidReason) {
 	metrics.RegionCacheCounterWithInvalidateRegionFromCacheOK.Inc()
 	atomic.StoreInt32((*int32)(&r.invalidReason), int32(reason))
-	atomic.StoreInt64(&r.lastAccess, invalidatedLastAccessTime)
+	if atomic.SwapInt64(&r.lastAccess, invalidatedLastAccessTime) != invalidatedLastAccessTime && r.stats != nil {
+		atomic.AddInt64(&r.stats.invalidations[reason], 1)
+	}
 }
 
 // scheduleReload schedules reload region request in next LocateKey.
@@ -364,6 +368,7 @@ func (r *Region) isValid() bool {
 type RegionCache struct {
 	pdClient         pd.Client
 	apiVersion       kvrpcpb.APIVersion
+	keyspaceID       uint32
 	enableForwarding bool
 
 	mu struct {
@@ -383,6 +388,8 @@ type RegionCache struct {
 	}
 	notifyCheckCh chan struct{}
 
+	stats regionCacheStats
+
 	// Context for background jobs
 	ctx        context.Context
 	cancelFunc context.CancelFunc
@@ -403,6 +410,7 @@ func NewRegionCache(pdClient pd.Client) *RegionCache {
 	switch pdClient.(type) {
 	case *CodecPDClientV2:
 		c.apiVersion = kvrpcpb.APIVersion_V2
+		c.keyspaceID = pdClient.(*CodecPDClientV2).GetKeyspaceID()
 	default:
 		c.apiVersion = kvrpcpb.APIVersion_V1
 	}
@@ -937,8 +945,40 @@ func (c *RegionCache) LocateEndKey(bo *retry.Backoffer, key []byte) (*KeyLocatio
 	}, nil
 }
 
+// LocateLastRegion searches for the last region of the keyspace, i.e. the region whose end key is empty.
+// If it's not cached, regions are loaded in batches, starting from the last cached region.
+func (c *RegionCache) LocateLastRegion(bo *retry.Backoffer) (*KeyLocation, error) {
+	var startKey []byte
+	c.mu.RLock()
+	r := c.mu.sorted.Last()
+	c.mu.RUnlock()
+	if r != nil {
+		startKey = r.StartKey()
+	}
+	if r == nil || len(r.EndKey()) > 0 || !r.checkRegionCacheTTL(time.Now().Unix()) || r.checkNeedReload() {
+		for {
+			regions, err := c.BatchLoadRegionsWithKeyRange(bo, startKey, nil, defaultRegionsPerBatch)
+			if err != nil {
+				return nil, err
+			}
+			r = regions[len(regions)-1]
+			if len(r.EndKey()) == 0 {
+				break
+			}
+			startKey = r.EndKey()
+		}
+	}
+	return &KeyLocation{
+		Region:   r.VerID(),
+		StartKey: r.StartKey(),
+		EndKey:   r.EndKey(),
+		Buckets:  r.getStore().buckets,
+	}, nil
+}
+
 func (c *RegionCache) findRegionByKey(bo *retry.Backoffer, key []byte, isEndKey bool) (r *Region, err error) {
 	r = c.searchCachedRegion(key, isEndKey)
+	c.stats.onLookup(r != nil)
 	if r == nil {
 		// load region when it is not exists or expired.
 		lr, err := c.loadRegion(bo, key, isEndKey)
@@ -1085,6 +1125,7 @@ func (c *RegionCache) LocateRegionByID(bo *retry.Backoffer, regionID uint64) (*K
 	c.mu.RLock()
 	r := c.getRegionByIDFromCache(regionID)
 	c.mu.RUnlock()
+	c.stats.onLookup(r != nil)
 	if r != nil {
 		if r.checkNeedReloadAndMarkUpdated() {
 			lr, err := c.loadRegionByID(bo, regionID)
@@ -1239,6 +1280,49 @@ func (c *RegionCache) InvalidateCachedRegionWithReason(id RegionVerID, reason In
 	cachedRegion.invalidate(reason)
 }
 
+// InvalidateCachedRegionsInRange removes the cached regions that intersect with range [startKey, endKey), so that
+// they are loaded from PD the next time they are accessed. An empty endKey means unbounded. It returns the number
+// of the regions invalidated.
+func (c *RegionCache) InvalidateCachedRegionsInRange(startKey, endKey []byte) int {
+	c.mu.RLock()
+	regions := c.mu.sorted.Intersecting(startKey, endKey)
+	c.mu.RUnlock()
+	for _, region := range regions {
+		region.invalidate(Other)
+	}
+	return len(regions)
+}
+
+// ReloadCachedRegions reloads the key ranges covered by the cached regions from PD in batches, so that the regions
+// that have been split, merged or moved are replaced with their latest versions. It returns the number of the
+// regions loaded.
+func (c *RegionCache) ReloadCachedRegions(bo *retry.Backoffer) (int, error) {
+	c.mu.RLock()
+	cached := c.mu.sorted.Intersecting(nil, nil)
+	c.mu.RUnlock()
+
+	count := 0
+	for i := 0; i < len(cached); {
+		// Reload the contiguous regions from cached[i] together.
+		startKey, endKey := cached[i].StartKey(), cached[i].EndKey()
+		for i++; i < len(cached) && len(endKey) > 0 && bytes.Equal(cached[i].StartKey(), endKey); i++ {
+			endKey = cached[i].EndKey()
+		}
+		for {
+			regions, err := c.BatchLoadRegionsWithKeyRange(bo, startKey, endKey, defaultRegionsPerBatch)
+			if err != nil {
+				return count, err
+			}
+			count += len(regions)
+			startKey = regions[len(regions)-1].EndKey()
+			if len(startKey) == 0 || (len(endKey) > 0 && bytes.Compare(startKey, endKey) >= 0) {
+				break
+			}
+		}
+	}
+	return count, nil
+}
+
 // UpdateLeader update some region cache with newer leader info.
 func (c *RegionCache) UpdateLeader(regionID RegionVerID, leader *metapb.Peer, currentPeerIdx AccessIndex) {
 	r := c.GetCachedRegionWithRLock(regionID)
@@ -1283,6 +1367,7 @@ func (c *RegionCache) removeVersionFromCache(oldVer RegionVerID, regionID uint64
 // insertRegionToCache tries to insert the Region to cache.
 // It should be protected by c.mu.Lock().
 func (c *RegionCache) insertRegionToCache(cachedRegion *Region) {
+	atomic.StoreInt64(&c.stats.lastLoad, time.Now().UnixNano())
 	oldRegion := c.mu.sorted.ReplaceOrInsert(cachedRegion)
 	if oldRegion != nil {
 		store := cachedRegion.getStore()
@@ -2557,7 +2642,7 @@ func createKVHealthClient(ctx context.Context, addr string) (*grpc.ClientConn, h
 	cfg := config.GetGlobalConfig()
 
 	opt := grpc.WithTransportCredentials(insecure.NewCredentials())
-	if len(cfg.Security.ClusterSSLCA) != 0 {
+	if cfg.Security.TLSEnabled() {
 		tlsConfig, err := cfg.Security.ToTLSConfig()
 		if err != nil {
 			return nil, nil, errors.WithStack(err)
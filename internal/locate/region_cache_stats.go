@@ -0,0 +1,97 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locate
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// regionCacheStats holds the counters of a RegionCache, which are updated atomically.
+type regionCacheStats struct {
+	hits          int64
+	misses        int64
+	invalidations [Other + 1]int64
+	// lastLoad is the unix nano time when a region is loaded into the cache last time.
+	lastLoad int64
+}
+
+func (s *regionCacheStats) onLookup(hit bool) {
+	if hit {
+		atomic.AddInt64(&s.hits, 1)
+	} else {
+		atomic.AddInt64(&s.misses, 1)
+	}
+}
+
+// RegionCacheStats is a snapshot of the statistics of a RegionCache.
+type RegionCacheStats struct {
+	// Regions is the number of the valid regions in the cache.
+	Regions int `json:"regions"`
+	// Hits and Misses count the lookups of regions by key or by ID that are served by the cache or have to load
+	// the region from PD, since the cache is created.
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// Invalidations counts the invalidated regions by the cause.
+	Invalidations RegionCacheInvalidations `json:"invalidations"`
+	// LastLoad is the time when a region is loaded into the cache last time, or zero if no region is loaded yet.
+	LastLoad time.Time `json:"last_load"`
+}
+
+// RegionCacheInvalidations counts the invalidated regions of a RegionCache by the cause.
+type RegionCacheInvalidations struct {
+	// NoLeader counts the regions whose leaders are not found, e.g. after a NotLeader error without a new leader.
+	NoLeader int64 `json:"no_leader"`
+	// RegionNotFound counts the regions that are not found in the stores.
+	RegionNotFound int64 `json:"region_not_found"`
+	// EpochNotMatch counts the regions that have been split or merged.
+	EpochNotMatch int64 `json:"epoch_not_match"`
+	// StoreNotFound counts the regions whose stores are removed or down.
+	StoreNotFound int64 `json:"store_not_found"`
+	// Other counts the regions invalidated by the other causes, such as the failures to send requests to their
+	// stores.
+	Other int64 `json:"other"`
+}
+
+// Stats returns the statistics of the cache. It's cheap except that the valid regions are counted.
+func (c *RegionCache) Stats() RegionCacheStats {
+	ts := time.Now().Unix()
+	regions := 0
+	c.mu.RLock()
+	for _, r := range c.mu.regions {
+		if ts-atomic.LoadInt64(&r.lastAccess) <= regionCacheTTLSec {
+			regions++
+		}
+	}
+	c.mu.RUnlock()
+
+	s := &c.stats
+	stats := RegionCacheStats{
+		Regions: regions,
+		Hits:    atomic.LoadInt64(&s.hits),
+		Misses:  atomic.LoadInt64(&s.misses),
+		Invalidations: RegionCacheInvalidations{
+			NoLeader:       atomic.LoadInt64(&s.invalidations[NoLeader]),
+			RegionNotFound: atomic.LoadInt64(&s.invalidations[RegionNotFound]),
+			EpochNotMatch:  atomic.LoadInt64(&s.invalidations[EpochNotMatch]),
+			StoreNotFound:  atomic.LoadInt64(&s.invalidations[StoreNotFound]),
+			Other:          atomic.LoadInt64(&s.invalidations[Other]),
+		},
+	}
+	if lastLoad := atomic.LoadInt64(&s.lastLoad); lastLoad > 0 {
+		stats.LastLoad = time.Unix(0, lastLoad)
+	}
+	return stats
+}
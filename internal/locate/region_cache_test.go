@@ -36,6 +36,7 @@ package locate
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -915,6 +916,33 @@ func (s *testRegionCacheSuite) TestSplit() {
 	s.checkCache(2)
 }
 
+func (s *testRegionCacheSuite) TestLocateLastRegion() {
+	loc, err := s.cache.LocateLastRegion(s.bo)
+	s.Nil(err)
+	s.Equal(loc.Region.id, s.region1)
+
+	// split to ['' - 'm' - 'x' - '']
+	region2 := s.cluster.AllocID()
+	newPeers := s.cluster.AllocIDs(2)
+	s.cluster.Split(s.region1, region2, []byte("m"), newPeers, newPeers[0])
+	region3 := s.cluster.AllocID()
+	newPeers = s.cluster.AllocIDs(2)
+	s.cluster.Split(region2, region3, []byte("x"), newPeers, newPeers[0])
+
+	// tikv-server reports `NotInRegion`, the last region is reloaded from PD.
+	s.cache.InvalidateCachedRegion(loc.Region)
+	loc, err = s.cache.LocateLastRegion(s.bo)
+	s.Nil(err)
+	s.Equal(loc.Region.id, region3)
+	s.Equal(loc.StartKey, []byte("x"))
+	s.Len(loc.EndKey, 0)
+
+	// it's served from the cache.
+	loc, err = s.cache.LocateLastRegion(s.bo)
+	s.Nil(err)
+	s.Equal(loc.Region.id, region3)
+}
+
 func (s *testRegionCacheSuite) TestMerge() {
 	// key range: ['' - 'm' - 'z']
 	region2 := s.cluster.AllocID()
@@ -1053,6 +1081,64 @@ func (s *testRegionCacheSuite) TestListRegionIDsInCache() {
 	s.Equal(regionIDs, []uint64{s.region1, region2})
 }
 
+func (s *testRegionCacheSuite) TestInvalidateAndReloadCachedRegions() {
+	// ['' - 'm' - 'z']
+	region2 := s.cluster.AllocID()
+	newPeers := s.cluster.AllocIDs(2)
+	s.cluster.Split(s.region1, region2, []byte("m"), newPeers, newPeers[0])
+	s.getRegion([]byte("a"))
+	s.getRegion([]byte("n"))
+	s.checkCache(2)
+
+	s.Equal(1, s.cache.InvalidateCachedRegionsInRange([]byte("n"), []byte("p")))
+	s.checkCache(1)
+	s.Equal(1, s.cache.InvalidateCachedRegionsInRange([]byte("a"), []byte("m")))
+	s.checkCache(0)
+	s.Equal(2, s.cache.InvalidateCachedRegionsInRange(nil, nil))
+
+	// ['' - 'm' - 'q' - 'z'], the cached region2 is stale after the split.
+	s.getRegion([]byte("a"))
+	s.getRegion([]byte("n"))
+	region3 := s.cluster.AllocID()
+	newPeers = s.cluster.AllocIDs(2)
+	s.cluster.Split(region2, region3, []byte("q"), newPeers, newPeers[0])
+	count, err := s.cache.ReloadCachedRegions(s.bo)
+	s.Nil(err)
+	s.Equal(3, count)
+	s.checkCache(3)
+	s.Equal(region3, s.cache.searchCachedRegion([]byte("r"), false).GetID())
+	s.Equal([]byte("q"), s.cache.searchCachedRegion([]byte("n"), false).EndKey())
+}
+
+func (s *testRegionCacheSuite) TestRegionCacheStats() {
+	stats := s.cache.Stats()
+	s.Equal(RegionCacheStats{}, stats)
+
+	r := s.getRegion([]byte("a"))
+	s.getRegion([]byte("b"))
+	_, err := s.cache.LocateRegionByID(s.bo, s.region1)
+	s.Nil(err)
+	stats = s.cache.Stats()
+	s.Equal(1, stats.Regions)
+	s.Equal(int64(2), stats.Hits)
+	s.Equal(int64(1), stats.Misses)
+	s.False(stats.LastLoad.IsZero())
+
+	// A region invalidated twice counts once.
+	s.cache.InvalidateCachedRegionWithReason(r.VerID(), EpochNotMatch)
+	s.cache.InvalidateCachedRegionWithReason(r.VerID(), EpochNotMatch)
+	s.getRegion([]byte("a"))
+	r = s.getRegion([]byte("a"))
+	s.cache.InvalidateCachedRegionWithReason(r.VerID(), NoLeader)
+	stats = s.cache.Stats()
+	s.Equal(0, stats.Regions)
+	s.Equal(RegionCacheInvalidations{EpochNotMatch: 1, NoLeader: 1}, stats.Invalidations)
+
+	data, err := json.Marshal(stats)
+	s.Nil(err)
+	s.Contains(string(data), `"invalidations":{"no_leader":1,"region_not_found":0,"epoch_not_match":1`)
+}
+
 func (s *testRegionCacheSuite) TestScanRegions() {
 	// Split at "a", "b", "c", "d"
 	regions := s.cluster.AllocIDs(4)
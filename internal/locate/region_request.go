@@ -100,15 +100,23 @@ func LoadShuttingDown() uint32 {
 type RegionRequestSender struct {
 	regionCache       *RegionCache
 	apiVersion        kvrpcpb.APIVersion
+	keyspaceID        uint32
 	client            client.Client
 	storeAddr         string
 	rpcError          error
 	replicaSelector   *replicaSelector
 	failStoreIDs      map[uint64]struct{}
 	failProxyStoreIDs map[uint64]struct{}
+	storeBreaker      *StoreBreaker
+	retryHook         RetryHook
 	RegionRequestRuntimeStats
 }
 
+// RetryHook is called synchronously every time a RegionRequestSender retries a request in place. regionErr is nil if
+// the request is retried because it failed to be sent. backoff is the type of the backoff before the retry, or empty
+// if the request is retried at once, and sleep is the time of the backoff.
+type RetryHook func(req *tikvrpc.Request, regionID RegionVerID, regionErr *errorpb.Error, backoff string, sleep time.Duration)
+
 // RegionRequestRuntimeStats records the runtime stats of send region requests.
 type RegionRequestRuntimeStats struct {
 	Stats map[tikvrpc.CmdType]*RPCRuntimeStats
@@ -193,6 +201,7 @@ func NewRegionRequestSender(regionCache *RegionCache, client client.Client) *Reg
 	return &RegionRequestSender{
 		regionCache: regionCache,
 		apiVersion:  regionCache.apiVersion,
+		keyspaceID:  regionCache.keyspaceID,
 		client:      client,
 	}
 }
@@ -212,6 +221,16 @@ func (s *RegionRequestSender) SetStoreAddr(addr string) {
 	s.storeAddr = addr
 }
 
+// SetStoreBreaker sets the circuit breaker that fails the requests to the unavailable stores at once.
+func (s *RegionRequestSender) SetStoreBreaker(breaker *StoreBreaker) {
+	s.storeBreaker = breaker
+}
+
+// SetRetryHook sets the hook called every time the sender retries a request in place.
+func (s *RegionRequestSender) SetRetryHook(hook RetryHook) {
+	s.retryHook = hook
+}
+
 // GetStoreAddr returns the dest store address.
 func (s *RegionRequestSender) GetStoreAddr() string {
 	return s.storeAddr
@@ -1013,7 +1032,13 @@ func (s *RegionRequestSender) SendReqCtx(
 			}
 		}
 
-		var retry bool
+		var (
+			retry bool
+			// backoffs and sleep are the backoffs and the sleep time of bo before the attempt, which tell the backoff
+			// before the retry if the request is retried.
+			backoffs = bo.ErrorsNum()
+			sleep    = bo.GetTotalSleep()
+		)
 		resp, retry, err = s.sendReqToRegion(bo, rpcCtx, req, timeout)
 		if err != nil {
 			return nil, nil, err
@@ -1030,6 +1055,7 @@ func (s *RegionRequestSender) SendReqCtx(
 			}
 		}
 		if retry {
+			s.onRetry(bo, req, regionID, nil, backoffs, sleep)
 			tryTimes++
 			continue
 		}
@@ -1045,6 +1071,7 @@ func (s *RegionRequestSender) SendReqCtx(
 				return nil, nil, err
 			}
 			if retry {
+				s.onRetry(bo, req, regionID, regionErr, backoffs, sleep)
 				tryTimes++
 				continue
 			}
@@ -1123,6 +1150,7 @@ func fetchRespInfo(resp *tikvrpc.Response) string {
 
 func (s *RegionRequestSender) sendReqToRegion(bo *retry.Backoffer, rpcCtx *RPCContext, req *tikvrpc.Request, timeout time.Duration) (resp *tikvrpc.Response, retry bool, err error) {
 	req.ApiVersion = s.apiVersion
+	req.KeyspaceID = s.keyspaceID
 
 	if e := tikvrpc.SetContext(req, rpcCtx.Meta, rpcCtx.Peer); e != nil {
 		return nil, false, err
@@ -1134,6 +1162,11 @@ func (s *RegionRequestSender) sendReqToRegion(bo *retry.Backoffer, rpcCtx *RPCCo
 		}
 		defer s.releaseStoreToken(rpcCtx.Store)
 	}
+	if s.storeBreaker != nil {
+		if err := s.storeBreaker.allow(rpcCtx.Store.storeID); err != nil {
+			return nil, false, err
+		}
+	}
 
 	ctx := bo.GetCtx()
 	if rawHook := ctx.Value(RPCCancellerCtxKey{}); rawHook != nil {
@@ -1229,6 +1262,10 @@ func (s *RegionRequestSender) sendReqToRegion(bo *retry.Backoffer, rpcCtx *RPCCo
 		}
 	}
 
+	if s.storeBreaker != nil {
+		s.storeBreaker.onSendResult(rpcCtx.Store.storeID, err, ctx.Err() != nil)
+	}
+
 	if rpcCtx.ProxyStore != nil {
 		fromStore := strconv.FormatUint(rpcCtx.ProxyStore.storeID, 10)
 		toStore := strconv.FormatUint(rpcCtx.Store.storeID, 10)
@@ -1284,6 +1321,19 @@ func (s *RegionRequestSender) releaseStoreToken(st *Store) {
 	logutil.BgLogger().Warn("release store token failed, count equals to 0")
 }
 
+// onRetry calls the retry hook if it's set. backoffs and sleep are the backoffs and the sleep time of bo before the
+// failed attempt.
+func (s *RegionRequestSender) onRetry(bo *retry.Backoffer, req *tikvrpc.Request, regionID RegionVerID, regionErr *errorpb.Error, backoffs, sleep int) {
+	if s.retryHook == nil {
+		return
+	}
+	backoff := ""
+	if bo.ErrorsNum() > backoffs {
+		backoff = bo.LastBackoff()
+	}
+	s.retryHook(req, regionID, regionErr, backoff, time.Duration(bo.GetTotalSleep()-sleep)*time.Millisecond)
+}
+
 func (s *RegionRequestSender) onSendFail(bo *retry.Backoffer, ctx *RPCContext, err error) error {
 	if span := opentracing.SpanFromContext(bo.GetCtx()); span != nil && span.Tracer() != nil {
 		span1 := span.Tracer().StartSpan("regionRequest.onSendFail", opentracing.ChildOf(span.Context()))
@@ -1358,7 +1408,8 @@ func (s *RegionRequestSender) NeedReloadRegion(ctx *RPCContext) (need bool) {
 	return
 }
 
-func regionErrorToLabel(e *errorpb.Error) string {
+// RegionErrorToLabel returns the label of the type of the region error in the metrics.
+func RegionErrorToLabel(e *errorpb.Error) string {
 	if e.GetNotLeader() != nil {
 		return "not_leader"
 	} else if e.GetRegionNotFound() != nil {
@@ -1405,7 +1456,7 @@ func (s *RegionRequestSender) onRegionError(bo *retry.Backoffer, ctx *RPCContext
 	}
 
 	// NOTE: Please add the region error handler in the same order of errorpb.Error.
-	metrics.TiKVRegionErrorCounter.WithLabelValues(regionErrorToLabel(regionErr)).Inc()
+	metrics.TiKVRegionErrorCounter.WithLabelValues(RegionErrorToLabel(regionErr)).Inc()
 
 	if notLeader := regionErr.GetNotLeader(); notLeader != nil {
 		// Retry if error is `NotLeader`.
@@ -78,6 +78,15 @@ func (s *SortedRegions) DescendLessOrEqual(key []byte, isEndKey bool, ts int64)
 	return r
 }
 
+// Last returns the region with the largest start key, whether it's expired or not.
+func (s *SortedRegions) Last() *Region {
+	item, ok := s.b.Max()
+	if !ok {
+		return nil
+	}
+	return item.cachedRegion
+}
+
 // AscendGreaterOrEqual returns all items that are greater than or equal to the key.
 func (s *SortedRegions) AscendGreaterOrEqual(startKey, endKey []byte, limit int) (regions []*Region) {
 	s.b.AscendGreaterOrEqual(newBtreeSearchItem(startKey), func(item *btreeItem) bool {
@@ -91,6 +100,30 @@ func (s *SortedRegions) AscendGreaterOrEqual(startKey, endKey []byte, limit int)
 	return regions
 }
 
+// Intersecting returns the regions that intersect with range [startKey, endKey) in key order, whether they are
+// expired or not. An empty endKey means unbounded.
+func (s *SortedRegions) Intersecting(startKey, endKey []byte) (regions []*Region) {
+	s.b.DescendLessOrEqual(newBtreeSearchItem(startKey), func(item *btreeItem) bool {
+		r := item.cachedRegion
+		if len(r.EndKey()) == 0 || bytes.Compare(r.EndKey(), startKey) > 0 {
+			regions = append(regions, r)
+		}
+		return false
+	})
+	s.b.AscendGreaterOrEqual(newBtreeSearchItem(startKey), func(item *btreeItem) bool {
+		r := item.cachedRegion
+		if len(endKey) > 0 && bytes.Compare(r.StartKey(), endKey) >= 0 {
+			return false
+		}
+		// The region starting at startKey has been found above.
+		if !bytes.Equal(r.StartKey(), startKey) {
+			regions = append(regions, r)
+		}
+		return true
+	})
+	return regions
+}
+
 // removeIntersecting removes all items that have intersection with the key range of given region.
 // If the region itself is in the cache, it's not removed.
 func (s *SortedRegions) removeIntersecting(r *Region) []*btreeItem {
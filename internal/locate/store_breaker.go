@@ -0,0 +1,182 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locate
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	tikverr "github.com/tikv/client-go/v2/error"
+	"github.com/tikv/client-go/v2/internal/logutil"
+	"github.com/tikv/client-go/v2/metrics"
+	"go.uber.org/zap"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// storeBreakerState is the state of the circuit breaker of a store.
+type storeBreakerState struct {
+	state breakerState
+	// failures is the number of the consecutive failures since firstFailure.
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+	// probing is set while a request probes whether the store has recovered in the half open state.
+	probing bool
+}
+
+// StoreBreaker is a circuit breaker for each store. After threshold consecutive failures to send requests to a
+// store within window, the breaker of the store is open and the requests to the store fail at once with an
+// ErrStoreUnavailable, instead of waiting for the connection to fail and backing off. After coolDown, the breaker
+// is half open and lets one request through to probe the store, which closes the breaker if it succeeds or opens
+// it again if it fails. Region errors are responses from the store, so they don't count as failures.
+type StoreBreaker struct {
+	threshold int
+	window    time.Duration
+	coolDown  time.Duration
+	// now is replaced in tests.
+	now func() time.Time
+
+	mu     sync.Mutex
+	stores map[uint64]*storeBreakerState
+}
+
+// NewStoreBreaker creates a StoreBreaker, which can be shared by the RegionRequestSenders of many clients.
+func NewStoreBreaker(threshold int, window, coolDown time.Duration) *StoreBreaker {
+	return &StoreBreaker{
+		threshold: threshold,
+		window:    window,
+		coolDown:  coolDown,
+		now:       time.Now,
+		stores:    make(map[uint64]*storeBreakerState),
+	}
+}
+
+// OpenStores returns the IDs of the stores whose breakers are open or half open, in ascending order.
+func (b *StoreBreaker) OpenStores() []uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var stores []uint64
+	for id, st := range b.stores {
+		if st.state != breakerClosed {
+			stores = append(stores, id)
+		}
+	}
+	sort.Slice(stores, func(i, j int) bool { return stores[i] < stores[j] })
+	return stores
+}
+
+// Unavailable tells whether the requests to the store fail at once, i.e. its breaker is open and not cooled down
+// yet, or it's half open and a request is probing the store.
+func (b *StoreBreaker) Unavailable(storeID uint64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st, ok := b.stores[storeID]
+	if !ok {
+		return false
+	}
+	switch st.state {
+	case breakerOpen:
+		return b.now().Sub(st.openedAt) < b.coolDown
+	case breakerHalfOpen:
+		return st.probing
+	}
+	return false
+}
+
+// allow returns an ErrStoreUnavailable if the request to the store should fail at once.
+func (b *StoreBreaker) allow(storeID uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st, ok := b.stores[storeID]
+	if !ok {
+		return nil
+	}
+	switch st.state {
+	case breakerOpen:
+		if b.now().Sub(st.openedAt) < b.coolDown {
+			return errors.WithStack(&tikverr.ErrStoreUnavailable{StoreID: storeID})
+		}
+		b.setState(storeID, st, breakerHalfOpen)
+		st.probing = true
+	case breakerHalfOpen:
+		if st.probing {
+			return errors.WithStack(&tikverr.ErrStoreUnavailable{StoreID: storeID})
+		}
+		st.probing = true
+	}
+	return nil
+}
+
+// onSendResult records the result of a request sent to the store. A request cancelled by its caller tells nothing
+// about the store, so it only ends the probe.
+func (b *StoreBreaker) onSendResult(storeID uint64, err error, cancelled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st, ok := b.stores[storeID]
+	if !ok {
+		if err == nil || cancelled {
+			return
+		}
+		st = &storeBreakerState{}
+		b.stores[storeID] = st
+	}
+	if cancelled {
+		st.probing = false
+		return
+	}
+	if err == nil {
+		if st.state != breakerClosed {
+			logutil.BgLogger().Info("store recovered, close its circuit breaker", zap.Uint64("store", storeID))
+		}
+		st.failures, st.probing = 0, false
+		b.setState(storeID, st, breakerClosed)
+		return
+	}
+	now := b.now()
+	switch st.state {
+	case breakerClosed:
+		if st.failures == 0 || now.Sub(st.firstFailure) > b.window {
+			st.failures, st.firstFailure = 0, now
+		}
+		st.failures++
+		if st.failures < b.threshold {
+			return
+		}
+		logutil.BgLogger().Warn("too many failures to send requests to the store, open its circuit breaker",
+			zap.Uint64("store", storeID), zap.Int("failures", st.failures), zap.Error(err))
+	case breakerHalfOpen:
+		logutil.BgLogger().Warn("store is still unavailable, open its circuit breaker again",
+			zap.Uint64("store", storeID), zap.Error(err))
+	default:
+		return
+	}
+	st.openedAt, st.probing = now, false
+	b.setState(storeID, st, breakerOpen)
+}
+
+func (b *StoreBreaker) setState(storeID uint64, st *storeBreakerState, state breakerState) {
+	st.state = state
+	metrics.TiKVStoreBreakerStateGauge.WithLabelValues(strconv.FormatUint(storeID, 10)).Set(float64(state))
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	tikverr "github.com/tikv/client-go/v2/error"
+	"github.com/tikv/client-go/v2/metrics"
+)
+
+func TestStoreBreaker(t *testing.T) {
+	now := time.Now()
+	b := NewStoreBreaker(3, time.Second, 10*time.Second)
+	b.now = func() time.Time { return now }
+	sendErr := errors.New("connection refused")
+
+	// The failures spread over more than the window don't trip the breaker, neither do the cancelled requests.
+	b.onSendResult(1, sendErr, false)
+	b.onSendResult(1, sendErr, false)
+	now = now.Add(2 * time.Second)
+	b.onSendResult(1, sendErr, false)
+	b.onSendResult(1, sendErr, true)
+	b.onSendResult(1, sendErr, false)
+	require.Nil(t, b.allow(1))
+	require.Empty(t, b.OpenStores())
+
+	// A success resets the failures.
+	b.onSendResult(1, nil, false)
+	b.onSendResult(1, sendErr, false)
+	b.onSendResult(1, sendErr, false)
+	require.Nil(t, b.allow(1))
+
+	b.onSendResult(1, sendErr, false)
+	err := b.allow(1)
+	var unavailableErr *tikverr.ErrStoreUnavailable
+	require.True(t, errors.As(err, &unavailableErr))
+	require.Equal(t, uint64(1), unavailableErr.StoreID)
+	require.True(t, b.Unavailable(1))
+	require.False(t, b.Unavailable(2))
+	require.Nil(t, b.allow(2))
+	require.Equal(t, []uint64{1}, b.OpenStores())
+	require.Equal(t, float64(breakerOpen), testutil.ToFloat64(metrics.TiKVStoreBreakerStateGauge.WithLabelValues("1")))
+
+	// After the cool-down, only one request probes the store, and the breaker opens again if it fails.
+	now = now.Add(10 * time.Second)
+	require.False(t, b.Unavailable(1))
+	require.Nil(t, b.allow(1))
+	require.True(t, b.Unavailable(1))
+	require.NotNil(t, b.allow(1))
+	require.Equal(t, float64(breakerHalfOpen), testutil.ToFloat64(metrics.TiKVStoreBreakerStateGauge.WithLabelValues("1")))
+	b.onSendResult(1, sendErr, false)
+	require.NotNil(t, b.allow(1))
+
+	// A cancelled probe lets another request probe the store, and a successful probe closes the breaker.
+	now = now.Add(10 * time.Second)
+	require.Nil(t, b.allow(1))
+	b.onSendResult(1, sendErr, true)
+	require.Nil(t, b.allow(1))
+	b.onSendResult(1, nil, false)
+	require.Nil(t, b.allow(1))
+	require.Nil(t, b.allow(1))
+	require.Empty(t, b.OpenStores())
+	require.Equal(t, float64(breakerClosed), testutil.ToFloat64(metrics.TiKVStoreBreakerStateGauge.WithLabelValues("1")))
+}
@@ -295,7 +295,7 @@ type RawKV interface {
 	RawDelete(cf string, key []byte)
 	RawBatchDelete(cf string, keys [][]byte)
 	RawDeleteRange(cf string, startKey, endKey []byte)
-	RawCompareAndSwap(cf string, key, expectedValue, newvalue []byte) ([]byte, bool, error)
+	RawCompareAndSwap(cf string, key, expectedValue, newvalue []byte, expectNotExist bool) ([]byte, bool, error)
 	RawChecksum(cf string, startKey, endKey []byte) (uint64, uint64, uint64, error)
 }
 
@@ -1695,7 +1695,9 @@ func (mvcc *MVCCLevelDB) RawBatchGet(cf string, keys [][]byte) [][]byte {
 	values := make([][]byte, 0, len(keys))
 	for _, key := range keys {
 		value, err := db.Get(key, nil)
-		if err != leveldb.ErrNotFound {
+		if err == leveldb.ErrNotFound {
+			value = nil
+		} else {
 			tikverr.Log(err)
 		}
 		values = append(values, value)
@@ -1765,7 +1767,7 @@ func (mvcc *MVCCLevelDB) RawScan(cf string, startKey, endKey []byte, limit int)
 
 // RawReverseScan implements the RawKV interface.
 // Scan the range of [endKey, startKey)
-// It doesn't support Scanning from "", because locating the last Region is not yet implemented.
+// If startKey is empty, it scans from the end of the keyspace.
 func (mvcc *MVCCLevelDB) RawReverseScan(cf string, startKey, endKey []byte, limit int) []Pair {
 	mvcc.mu.Lock()
 	defer mvcc.mu.Unlock()
@@ -1775,8 +1777,12 @@ func (mvcc *MVCCLevelDB) RawReverseScan(cf string, startKey, endKey []byte, limi
 		return nil
 	}
 
+	var upperBound []byte
+	if len(startKey) > 0 {
+		upperBound = startKey
+	}
 	iter := db.NewIterator(&util.Range{
-		Limit: startKey,
+		Limit: upperBound,
 	}, nil)
 
 	success := iter.Last()
@@ -1843,8 +1849,9 @@ func (mvcc *MVCCLevelDB) RawDeleteRange(cf string, startKey, endKey []byte) {
 }
 
 // RawCompareAndSwap supports CAS function(write newValue if expectedValue equals value stored in db).
+// If expectNotExist is set, newValue is written only if the key doesn't exist.
 // `oldValue` and `swapped` returned specify the old value stored in db and whether CAS has happened.
-func (mvcc *MVCCLevelDB) RawCompareAndSwap(cf string, key, expectedValue, newValue []byte,
+func (mvcc *MVCCLevelDB) RawCompareAndSwap(cf string, key, expectedValue, newValue []byte, expectNotExist bool,
 ) (oldValue []byte, swapped bool, err error) {
 	mvcc.mu.Lock()
 	defer mvcc.mu.Unlock()
@@ -1860,12 +1867,19 @@ func (mvcc *MVCCLevelDB) RawCompareAndSwap(cf string, key, expectedValue, newVal
 	}
 
 	oldValue, err = db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		oldValue, err = nil, nil
+	}
 	if err != nil {
 		tikverr.Log(err)
 		return nil, false, errors.WithStack(err)
 	}
 
-	if !bytes.Equal(oldValue, expectedValue) {
+	if expectNotExist {
+		if oldValue != nil {
+			return oldValue, false, nil
+		}
+	} else if oldValue == nil || !bytes.Equal(oldValue, expectedValue) {
 		return oldValue, false, nil
 	}
 
@@ -1888,10 +1902,14 @@ func (mvcc *MVCCLevelDB) doRawDeleteRange(cf string, startKey, endKey []byte) er
 		return errors.Errorf("%s not exist", cf)
 	}
 
+	var upperBound []byte
+	if len(endKey) > 0 {
+		upperBound = endKey
+	}
 	batch := &leveldb.Batch{}
 	iter := db.NewIterator(&util.Range{
 		Start: startKey,
-		Limit: endKey,
+		Limit: upperBound,
 	}, nil)
 	for iter.Next() {
 		batch.Delete(iter.Key())
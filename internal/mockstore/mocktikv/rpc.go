@@ -457,12 +457,16 @@ func (h kvHandler) handleKvRawBatchGet(req *kvrpcpb.RawBatchGetRequest) *kvrpcpb
 		}
 	}
 	values := rawKV.RawBatchGet(req.Cf, req.Keys)
-	kvPairs := make([]*kvrpcpb.KvPair, len(values))
-	for i, key := range req.Keys {
-		kvPairs[i] = &kvrpcpb.KvPair{
-			Key:   key,
-			Value: values[i],
+	// Like TiKV, only the keys found are returned.
+	kvPairs := make([]*kvrpcpb.KvPair, 0, len(values))
+	for i, value := range values {
+		if value == nil {
+			continue
 		}
+		kvPairs = append(kvPairs, &kvrpcpb.KvPair{
+			Key:   req.Keys[i],
+			Value: value,
+		})
 	}
 	return &kvrpcpb.RawBatchGetResponse{
 		Pairs: kvPairs,
@@ -521,6 +525,7 @@ func (h kvHandler) HandleKvRawCompareAndSwap(req *kvrpcpb.RawCASRequest) *kvrpcp
 		req.GetKey(),
 		req.GetPreviousValue(),
 		req.GetValue(),
+		req.GetPreviousNotExist(),
 	)
 	if err != nil {
 		return &kvrpcpb.RawCASResponse{
@@ -553,7 +558,11 @@ func (h kvHandler) handleKvRawDeleteRange(req *kvrpcpb.RawDeleteRangeRequest) *k
 			Error: "not implemented",
 		}
 	}
-	rawKV.RawDeleteRange(req.GetCf(), req.GetStartKey(), req.GetEndKey())
+	upperBound := h.endKey
+	if len(req.EndKey) > 0 && (len(upperBound) == 0 || bytes.Compare(req.EndKey, upperBound) < 0) {
+		upperBound = req.EndKey
+	}
+	rawKV.RawDeleteRange(req.GetCf(), req.GetStartKey(), upperBound)
 	return &kvrpcpb.RawDeleteRangeResponse{}
 }
 
@@ -574,9 +583,13 @@ func (h kvHandler) handleKvRawScan(req *kvrpcpb.RawScanRequest) *kvrpcpb.RawScan
 		if bytes.Compare(req.EndKey, lowerBound) > 0 {
 			lowerBound = req.EndKey
 		}
+		upperBound := req.StartKey
+		if len(upperBound) == 0 {
+			upperBound = h.endKey
+		}
 		pairs = rawKV.RawReverseScan(
 			req.GetCf(),
-			req.StartKey,
+			upperBound,
 			lowerBound,
 			int(req.GetLimit()),
 		)
@@ -592,12 +605,56 @@ func (h kvHandler) handleKvRawScan(req *kvrpcpb.RawScanRequest) *kvrpcpb.RawScan
 			int(req.GetLimit()),
 		)
 	}
+	if req.KeyOnly {
+		for i := range pairs {
+			pairs[i].Value = nil
+		}
+	}
 
 	return &kvrpcpb.RawScanResponse{
 		Kvs: convertToPbPairs(pairs),
 	}
 }
 
+func (h kvHandler) handleKvRawBatchScan(req *kvrpcpb.RawBatchScanRequest) *kvrpcpb.RawBatchScanResponse {
+	rawKV, ok := h.mvccStore.(RawKV)
+	if !ok {
+		errStr := "not implemented"
+		return &kvrpcpb.RawBatchScanResponse{
+			RegionError: &errorpb.Error{
+				Message: errStr,
+			},
+		}
+	}
+
+	var kvs []*kvrpcpb.KvPair
+	for _, r := range req.Ranges {
+		var pairs []Pair
+		if req.Reverse {
+			lowerBound := h.startKey
+			if bytes.Compare(r.EndKey, lowerBound) > 0 {
+				lowerBound = r.EndKey
+			}
+			pairs = rawKV.RawReverseScan(req.GetCf(), r.StartKey, lowerBound, int(req.GetEachLimit()))
+		} else {
+			upperBound := h.endKey
+			if len(r.EndKey) > 0 && (len(upperBound) == 0 || bytes.Compare(r.EndKey, upperBound) < 0) {
+				upperBound = r.EndKey
+			}
+			pairs = rawKV.RawScan(req.GetCf(), r.StartKey, upperBound, int(req.GetEachLimit()))
+		}
+		if req.KeyOnly {
+			for i := range pairs {
+				pairs[i].Value = nil
+			}
+		}
+		kvs = append(kvs, convertToPbPairs(pairs)...)
+	}
+	return &kvrpcpb.RawBatchScanResponse{
+		Kvs: kvs,
+	}
+}
+
 func (h kvHandler) handleKvRawChecksum(req *kvrpcpb.RawChecksumRequest) *kvrpcpb.RawChecksumResponse {
 	rawKV, ok := h.mvccStore.(RawKV)
 	if !ok {
@@ -970,6 +1027,13 @@ func (c *RPCClient) SendRequest(ctx context.Context, addr string, req *tikvrpc.R
 			return resp, nil
 		}
 		resp.Resp = kvHandler{session}.handleKvRawScan(r)
+	case tikvrpc.CmdRawBatchScan:
+		r := req.RawBatchScan()
+		if err := session.checkRequest(reqCtx, r.Size()); err != nil {
+			resp.Resp = &kvrpcpb.RawBatchScanResponse{RegionError: err}
+			return resp, nil
+		}
+		resp.Resp = kvHandler{session}.handleKvRawBatchScan(r)
 	case tikvrpc.CmdRawCompareAndSwap:
 		r := req.RawCompareAndSwap()
 		if err := session.checkRequest(reqCtx, r.Size()); err != nil {
@@ -1069,6 +1133,12 @@ func (c *RPCClient) SendRequest(ctx context.Context, addr string, req *tikvrpc.R
 				Name:  "mvcc.num_rows",
 				Value: strconv.Itoa(len(scanResp.Pairs)),
 			}}}
+	// DebugCompact does nothing because there is no compaction in mock tikv.
+	case tikvrpc.CmdDebugCompact:
+		resp.Resp = &debugpb.CompactResponse{}
+	// StoreSafeTS has no region, it tells that the store is alive.
+	case tikvrpc.CmdStoreSafeTS:
+		resp.Resp = &kvrpcpb.StoreSafeTSResponse{}
 	default:
 		return nil, errors.Errorf("unsupported this request type %v", req.Type)
 	}
@@ -130,8 +130,8 @@ func (s *Session) CheckRequestContext(ctx *kvrpcpb.Context) *errorpb.Error {
 			},
 		}
 	}
-	// The Peer on the Store is not leader. If it's tiflash store , we pass this check.
-	if storePeer.GetId() != leaderPeer.GetId() && !isTiFlashRelatedStore(s.cluster.GetStore(storePeer.GetStoreId())) {
+	// The Peer on the Store is not leader. If it's tiflash store or a replica read, we pass this check.
+	if storePeer.GetId() != leaderPeer.GetId() && !ctx.GetReplicaRead() && !isTiFlashRelatedStore(s.cluster.GetStore(storePeer.GetStoreId())) {
 		return &errorpb.Error{
 			Message: *proto.String("not leader"),
 			NotLeader: &errorpb.NotLeader{
@@ -49,6 +49,8 @@ import (
 	"github.com/tikv/client-go/v2/internal/logutil"
 	"github.com/tikv/client-go/v2/kv"
 	"github.com/tikv/client-go/v2/util"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -64,6 +66,12 @@ type Backoffer struct {
 
 	vars *kv.Variables
 	noop bool
+	// sleepFn replaces the real sleep if it's set.
+	sleepFn func(time.Duration)
+	// fnCfg replaces the backoff function configs of all the Configs if it's set.
+	fnCfg *BackoffFnCfg
+	// tracer traces the backoffs under a recording OpenTelemetry span if it's set.
+	tracer trace.Tracer
 
 	errors         []error
 	configs        []*Config
@@ -96,6 +104,27 @@ func NewNoopBackoff(ctx context.Context) *Backoffer {
 	return &Backoffer{ctx: ctx, noop: true}
 }
 
+// WithSleepFn sets the function called instead of sleeping, so that tests can record the backoff sequence without
+// waiting. It's inherited by the backoffers cloned or forked from b.
+func (b *Backoffer) WithSleepFn(fn func(time.Duration)) *Backoffer {
+	b.sleepFn = fn
+	return b
+}
+
+// WithFnCfg sets the backoff function config used for every Config instead of their own ones, e.g. to apply the
+// jitter chosen by the user to all the retries. It's inherited by the backoffers cloned or forked from b.
+func (b *Backoffer) WithFnCfg(cfg *BackoffFnCfg) *Backoffer {
+	b.fnCfg = cfg
+	return b
+}
+
+// WithTracer sets the OpenTelemetry tracer of the backoff spans, so only the clients that are traced pay for them.
+// It's inherited by the backoffers cloned or forked from b.
+func (b *Backoffer) WithTracer(tracer trace.Tracer) *Backoffer {
+	b.tracer = tracer
+	return b
+}
+
 // withVars sets the kv.Variables to the Backoffer and return it.
 func (b *Backoffer) withVars(vars *kv.Variables) *Backoffer {
 	if vars != nil {
@@ -117,6 +146,14 @@ func (b *Backoffer) Backoff(cfg *Config, err error) error {
 		defer span1.Finish()
 		opentracing.ContextWithSpan(b.ctx, span1)
 	}
+	if span := trace.SpanFromContext(b.ctx); b.tracer != nil && span.IsRecording() {
+		_, span1 := b.tracer.Start(b.ctx, "tikv.backoff."+cfg.String())
+		totalSleep := b.totalSleep
+		defer func() {
+			span1.SetAttributes(attribute.Int("sleep_ms", b.totalSleep-totalSleep))
+			span1.End()
+		}()
+	}
 	return b.BackoffWithCfgAndMaxSleep(cfg, -1, err)
 }
 
@@ -168,10 +205,14 @@ func (b *Backoffer) BackoffWithCfgAndMaxSleep(cfg *Config, maxSleepMs int, err e
 	}
 	f, ok := b.fn[cfg.name]
 	if !ok {
-		f = cfg.createBackoffFn(b.vars)
+		if b.fnCfg != nil {
+			f = newBackoffFn(b.fnCfg.base, b.fnCfg.cap, b.fnCfg.jitter)
+		} else {
+			f = cfg.createBackoffFn(b.vars)
+		}
 		b.fn[cfg.name] = f
 	}
-	realSleep := f(b.ctx, maxSleepMs)
+	realSleep := f(b.ctx, maxSleepMs, b.sleepFn)
 	if cfg.metric != nil {
 		(*cfg.metric).Observe(float64(realSleep) / 1000)
 	}
@@ -243,6 +284,9 @@ func (b *Backoffer) Clone() *Backoffer {
 		totalSleep:     b.totalSleep,
 		excludedSleep:  b.excludedSleep,
 		vars:           b.vars,
+		sleepFn:        b.sleepFn,
+		fnCfg:          b.fnCfg,
+		tracer:         b.tracer,
 		errors:         append([]error{}, b.errors...),
 		configs:        append([]*Config{}, b.configs...),
 		backoffSleepMS: copyMapWithoutRecursive(b.backoffSleepMS),
@@ -267,6 +311,9 @@ func (b *Backoffer) Fork() (*Backoffer, context.CancelFunc) {
 		backoffSleepMS: copyMapWithoutRecursive(b.backoffSleepMS),
 		backoffTimes:   copyMapWithoutRecursive(b.backoffTimes),
 		vars:           b.vars,
+		sleepFn:        b.sleepFn,
+		fnCfg:          b.fnCfg,
+		tracer:         b.tracer,
 		parent:         b,
 	}, cancel
 }
@@ -293,6 +340,15 @@ func (b *Backoffer) GetTypes() []string {
 	return typs
 }
 
+// LastBackoff returns the type of the last backoff of the backoffer, not including its ancestors, or "" if it hasn't
+// backed off.
+func (b *Backoffer) LastBackoff() string {
+	if len(b.configs) == 0 {
+		return ""
+	}
+	return b.configs[len(b.configs)-1].String()
+}
+
 // GetCtx returns the binded context.
 func (b *Backoffer) GetCtx() context.Context {
 	return b.ctx
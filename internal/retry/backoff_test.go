@@ -38,6 +38,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -95,3 +96,32 @@ func TestBackoffDeepCopy(t *testing.T) {
 		assert.ErrorIs(t, err, BoMaxDataNotReady.err)
 	}
 }
+
+func TestBackoffWithSleepFn(t *testing.T) {
+	var sleeps []time.Duration
+	b := NewBackofferWithVars(context.TODO(), 14, nil).WithSleepFn(func(d time.Duration) {
+		sleeps = append(sleeps, d)
+	})
+	bForked, cancel := b.Fork()
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, bForked.Backoff(BoRegionMiss, errors.New("region miss")))
+	}
+	assert.Nil(t, b.Clone().Backoff(BoRegionMiss, errors.New("region miss")))
+	assert.Equal(t, []time.Duration{2 * time.Millisecond, 4 * time.Millisecond, 8 * time.Millisecond, 2 * time.Millisecond}, sleeps)
+	assert.Equal(t, 14, bForked.GetTotalSleep())
+}
+
+func TestBackoffWithFnCfg(t *testing.T) {
+	var sleeps []time.Duration
+	b := NewBackofferWithVars(context.TODO(), 1000, nil).WithSleepFn(func(d time.Duration) {
+		sleeps = append(sleeps, d)
+	}).WithFnCfg(NewBackoffFnCfg(10, 30, NoJitter))
+	bForked, cancel := b.Fork()
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, bForked.Backoff(BoTiKVServerBusy, errors.New("server is busy")))
+	}
+	assert.Nil(t, b.Clone().Backoff(BoRegionMiss, errors.New("region miss")))
+	assert.Equal(t, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond, 10 * time.Millisecond}, sleeps)
+}
@@ -58,7 +58,8 @@ type Config struct {
 }
 
 // backoffFn is the backoff function which compute the sleep time and do sleep.
-type backoffFn func(ctx context.Context, maxSleepMs int) int
+// If sleepFn isn't nil, it's called instead of sleeping.
+type backoffFn func(ctx context.Context, maxSleepMs int, sleepFn func(time.Duration)) int
 
 func (c *Config) createBackoffFn(vars *kv.Variables) backoffFn {
 	if strings.EqualFold(c.name, txnLockFastName) {
@@ -155,7 +156,7 @@ func newBackoffFn(base, cap, jitter int) backoffFn {
 	}
 	attempts := 0
 	lastSleep := base
-	return func(ctx context.Context, maxSleepMs int) int {
+	return func(ctx context.Context, maxSleepMs int, sleepFn func(time.Duration)) int {
 		var sleep int
 		switch jitter {
 		case NoJitter:
@@ -179,6 +180,12 @@ func newBackoffFn(base, cap, jitter int) backoffFn {
 		if maxSleepMs >= 0 && realSleep > maxSleepMs {
 			realSleep = maxSleepMs
 		}
+		if sleepFn != nil {
+			sleepFn(time.Duration(realSleep) * time.Millisecond)
+			attempts++
+			lastSleep = sleep
+			return realSleep
+		}
 		select {
 		case <-time.After(time.Duration(realSleep) * time.Millisecond):
 			attempts++
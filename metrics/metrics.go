@@ -54,6 +54,18 @@ var (
 	TiKVTxnWriteSizeHistogram                prometheus.Histogram
 	TiKVRawkvCmdHistogram                    *prometheus.HistogramVec
 	TiKVRawkvSizeHistogram                   *prometheus.HistogramVec
+	TiKVRawkvReplicaReadCounter              *prometheus.CounterVec
+	TiKVRawkvCmdPhaseHistogram               *prometheus.HistogramVec
+	TiKVRawkvRetryCounter                    *prometheus.CounterVec
+	TiKVRawkvBatchCountHistogram             *prometheus.HistogramVec
+	TiKVRawkvMaxBatchDurationHistogram       *prometheus.HistogramVec
+	TiKVRawkvBatchRegionCountHistogram       *prometheus.HistogramVec
+	TiKVRawkvBatchPairsHistogram             *prometheus.HistogramVec
+	TiKVRawkvBatchBytesHistogram             *prometheus.HistogramVec
+	TiKVRawkvBatchRetryCounter               *prometheus.CounterVec
+	TiKVRawkvErrorCounter                    *prometheus.CounterVec
+	TiKVRawkvCacheCounter                    *prometheus.CounterVec
+	TiKVRawkvCacheLoadHistogram              *prometheus.HistogramVec
 	TiKVTxnRegionsNumHistogram               *prometheus.HistogramVec
 	TiKVLoadSafepointCounter                 *prometheus.CounterVec
 	TiKVSecondaryLockCleanupFailureCounter   *prometheus.CounterVec
@@ -96,6 +108,8 @@ var (
 	TiKVReadThroughput                       prometheus.Histogram
 	TiKVUnsafeDestroyRangeFailuresCounterVec *prometheus.CounterVec
 	TiKVPrewriteAssertionUsageCounter        *prometheus.CounterVec
+	TiKVGRPCBytesCounter                     *prometheus.CounterVec
+	TiKVStoreBreakerStateGauge               *prometheus.GaugeVec
 )
 
 // Label constants.
@@ -116,9 +130,17 @@ const (
 	LblToStore         = "to_store"
 	LblStaleRead       = "stale_read"
 	LblSource          = "source"
+	LblStage           = "stage"
+	LblPhase           = "phase"
+	LblCommand         = "command"
+	LblKind            = "kind"
 )
 
+// The namespace and the subsystem of the metrics, which are set by InitMetrics.
+var metricsNamespace, metricsSubsystem string
+
 func initMetrics(namespace, subsystem string) {
+	metricsNamespace, metricsSubsystem = namespace, subsystem
 	TiKVTxnCmdHistogram = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: namespace,
@@ -214,23 +236,35 @@ func initMetrics(namespace, subsystem string) {
 			Buckets:   prometheus.ExponentialBuckets(16, 4, 17), // 16Bytes ~ 64GB
 		})
 
-	TiKVRawkvCmdHistogram = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
+	TiKVRawkvCmdHistogram = newRawkvCmdHistogram(namespace, subsystem, nil)
+	TiKVRawkvSizeHistogram = newRawkvSizeHistogram(namespace, subsystem, nil)
+	TiKVRawkvReplicaReadCounter = newRawkvReplicaReadCounter(namespace, subsystem, nil)
+	TiKVRawkvCmdPhaseHistogram = newRawkvCmdPhaseHistogram(namespace, subsystem, nil)
+	TiKVRawkvRetryCounter = newRawkvRetryCounter(namespace, subsystem, nil)
+	TiKVRawkvBatchCountHistogram = newRawkvBatchCountHistogram(namespace, subsystem, nil)
+	TiKVRawkvMaxBatchDurationHistogram = newRawkvMaxBatchDurationHistogram(namespace, subsystem, nil)
+	TiKVRawkvBatchRegionCountHistogram = newRawkvBatchRegionCountHistogram(namespace, subsystem, nil)
+	TiKVRawkvBatchPairsHistogram = newRawkvBatchPairsHistogram(namespace, subsystem, nil)
+	TiKVRawkvBatchBytesHistogram = newRawkvBatchBytesHistogram(namespace, subsystem, nil)
+	TiKVRawkvBatchRetryCounter = newRawkvBatchRetryCounter(namespace, subsystem, nil)
+	TiKVRawkvErrorCounter = newRawkvErrorCounter(namespace, subsystem, nil)
+
+	TiKVRawkvCacheCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
 			Namespace: namespace,
 			Subsystem: subsystem,
-			Name:      "rawkv_cmd_seconds",
-			Help:      "Bucketed histogram of processing time of rawkv cmds.",
-			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 29), // 0.5ms ~ 1.5days
+			Name:      "rawkv_cache_total",
+			Help:      "Counter of the reads of rawkv read-through caches, by whether they hit.",
 		}, []string{LblType})
 
-	TiKVRawkvSizeHistogram = prometheus.NewHistogramVec(
+	TiKVRawkvCacheLoadHistogram = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: namespace,
 			Subsystem: subsystem,
-			Name:      "rawkv_kv_size_bytes",
-			Help:      "Size of key/value to put, in bytes.",
-			Buckets:   prometheus.ExponentialBuckets(1, 2, 30), // 1Byte ~ 512MB
-		}, []string{LblType})
+			Name:      "rawkv_cache_load_seconds",
+			Help:      "Bucketed histogram of the time rawkv read-through caches spend loading the missed keys from their sources.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 29), // 0.5ms ~ 1.5days
+		}, []string{LblResult})
 
 	TiKVTxnRegionsNumHistogram = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -589,6 +623,22 @@ func initMetrics(namespace, subsystem string) {
 			Help:      "Counter of assertions used in prewrite requests",
 		}, []string{LblType})
 
+	TiKVGRPCBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "grpc_bytes_total",
+			Help:      "Counter of the bytes of gRPC messages sent to and received from TiKV, before (payload) and after (wire) compression.",
+		}, []string{LblType, LblStage})
+
+	TiKVStoreBreakerStateGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "store_breaker_state",
+			Help:      "State of the circuit breaker of each store: 0 for closed, 1 for open (tripped) and 2 for half open.",
+		}, []string{LblStore})
+
 	initShortcuts()
 }
 
@@ -617,6 +667,18 @@ func RegisterMetrics() {
 	prometheus.MustRegister(TiKVTxnWriteSizeHistogram)
 	prometheus.MustRegister(TiKVRawkvCmdHistogram)
 	prometheus.MustRegister(TiKVRawkvSizeHistogram)
+	prometheus.MustRegister(TiKVRawkvReplicaReadCounter)
+	prometheus.MustRegister(TiKVRawkvCmdPhaseHistogram)
+	prometheus.MustRegister(TiKVRawkvRetryCounter)
+	prometheus.MustRegister(TiKVRawkvBatchCountHistogram)
+	prometheus.MustRegister(TiKVRawkvMaxBatchDurationHistogram)
+	prometheus.MustRegister(TiKVRawkvBatchRegionCountHistogram)
+	prometheus.MustRegister(TiKVRawkvBatchPairsHistogram)
+	prometheus.MustRegister(TiKVRawkvBatchBytesHistogram)
+	prometheus.MustRegister(TiKVRawkvBatchRetryCounter)
+	prometheus.MustRegister(TiKVRawkvErrorCounter)
+	prometheus.MustRegister(TiKVRawkvCacheCounter)
+	prometheus.MustRegister(TiKVRawkvCacheLoadHistogram)
 	prometheus.MustRegister(TiKVTxnRegionsNumHistogram)
 	prometheus.MustRegister(TiKVLoadSafepointCounter)
 	prometheus.MustRegister(TiKVSecondaryLockCleanupFailureCounter)
@@ -659,6 +721,8 @@ func RegisterMetrics() {
 	prometheus.MustRegister(TiKVReadThroughput)
 	prometheus.MustRegister(TiKVUnsafeDestroyRangeFailuresCounterVec)
 	prometheus.MustRegister(TiKVPrewriteAssertionUsageCounter)
+	prometheus.MustRegister(TiKVGRPCBytesCounter)
+	prometheus.MustRegister(TiKVStoreBreakerStateGauge)
 }
 
 // readCounter reads the value of a prometheus.Counter.
@@ -0,0 +1,320 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RawkvMetrics are the metrics of rawkv clients, with their shortcuts. The clients share DefaultRawkvMetrics unless
+// they are created with their own metrics.
+type RawkvMetrics struct {
+	CmdHistogram              *prometheus.HistogramVec
+	SizeHistogram             *prometheus.HistogramVec
+	ReplicaReadCounter        *prometheus.CounterVec
+	CmdPhaseHistogram         *prometheus.HistogramVec
+	RetryCounter              *prometheus.CounterVec
+	BatchCountHistogram       *prometheus.HistogramVec
+	MaxBatchDurationHistogram *prometheus.HistogramVec
+	BatchRegionCountHistogram *prometheus.HistogramVec
+	BatchPairsHistogram       *prometheus.HistogramVec
+	BatchBytesHistogram       *prometheus.HistogramVec
+	BatchRetryCounter         *prometheus.CounterVec
+	ErrorCounter              *prometheus.CounterVec
+
+	CmdHistogramWithGet           prometheus.Observer
+	CmdHistogramWithBatchGet      prometheus.Observer
+	CmdHistogramWithPut           prometheus.Observer
+	CmdHistogramWithBatchPut      prometheus.Observer
+	CmdHistogramWithDelete        prometheus.Observer
+	CmdHistogramWithBatchDelete   prometheus.Observer
+	CmdHistogramWithRawScan       prometheus.Observer
+	CmdHistogramWithRawReversScan prometheus.Observer
+	SizeHistogramWithKey          prometheus.Observer
+	SizeHistogramWithValue        prometheus.Observer
+	CmdHistogramWithRawChecksum   prometheus.Observer
+	CmdHistogramWithRawBatchScan  prometheus.Observer
+	CmdHistogramWithExists        prometheus.Observer
+	CmdHistogramWithBatchExists   prometheus.Observer
+	CmdHistogramWithCount         prometheus.Observer
+	ReplicaReadLocal              prometheus.Counter
+	ReplicaReadRemote             prometheus.Counter
+
+	cmds map[string]*RawkvCmdMetrics
+}
+
+// RawkvCmdMetrics are the shortcuts of the breakdown of the duration and the sub-batches of a rawkv command.
+type RawkvCmdMetrics struct {
+	RPCDuration      prometheus.Observer
+	BackoffDuration  prometheus.Observer
+	RegionDuration   prometheus.Observer
+	BatchCount       prometheus.Observer
+	MaxBatchDuration prometheus.Observer
+	BatchRegionCount prometheus.Observer
+	BatchPairs       prometheus.Observer
+	BatchBytes       prometheus.Observer
+	BatchRetry       prometheus.Counter
+}
+
+// rawkvCmds are the commands whose RawkvCmdMetrics are created in advance.
+var rawkvCmds = []string{
+	"get", "exists", "batch_exists", "batch_get", "put", "batch_put", "delete", "batch_delete", "delete_range",
+	"batch_delete_range", "raw_scan", "raw_reverse_scan", "raw_batch_scan", "raw_checksum", "count", "get_key_ttl",
+	"batch_get_key_ttl", "cas", "put_if_absent", "get_and_put", "batch_cas", "incr", "append", "update_ttl", "persist",
+	"update", "scan_page",
+}
+
+// DefaultRawkvMetrics are the package-level rawkv metrics, i.e. the TiKVRawkv* metrics, which are registered by
+// RegisterMetrics.
+var DefaultRawkvMetrics *RawkvMetrics
+
+// NewRawkvMetrics creates the rawkv metrics with the const labels and registers them with the registerer, so that
+// the observations of a client go to its own series, e.g. labeled by the cluster the client talks to. The metrics
+// have the namespace and the subsystem of the package-level metrics. The metrics already registered with the same
+// labels, e.g. by another client of the same cluster, are shared rather than registered again.
+func NewRawkvMetrics(registerer prometheus.Registerer, constLabels prometheus.Labels) (*RawkvMetrics, error) {
+	m := &RawkvMetrics{
+		CmdHistogram:              newRawkvCmdHistogram(metricsNamespace, metricsSubsystem, constLabels),
+		SizeHistogram:             newRawkvSizeHistogram(metricsNamespace, metricsSubsystem, constLabels),
+		ReplicaReadCounter:        newRawkvReplicaReadCounter(metricsNamespace, metricsSubsystem, constLabels),
+		CmdPhaseHistogram:         newRawkvCmdPhaseHistogram(metricsNamespace, metricsSubsystem, constLabels),
+		RetryCounter:              newRawkvRetryCounter(metricsNamespace, metricsSubsystem, constLabels),
+		BatchCountHistogram:       newRawkvBatchCountHistogram(metricsNamespace, metricsSubsystem, constLabels),
+		MaxBatchDurationHistogram: newRawkvMaxBatchDurationHistogram(metricsNamespace, metricsSubsystem, constLabels),
+		BatchRegionCountHistogram: newRawkvBatchRegionCountHistogram(metricsNamespace, metricsSubsystem, constLabels),
+		BatchPairsHistogram:       newRawkvBatchPairsHistogram(metricsNamespace, metricsSubsystem, constLabels),
+		BatchBytesHistogram:       newRawkvBatchBytesHistogram(metricsNamespace, metricsSubsystem, constLabels),
+		BatchRetryCounter:         newRawkvBatchRetryCounter(metricsNamespace, metricsSubsystem, constLabels),
+		ErrorCounter:              newRawkvErrorCounter(metricsNamespace, metricsSubsystem, constLabels),
+	}
+	for _, vec := range []**prometheus.HistogramVec{&m.CmdHistogram, &m.SizeHistogram, &m.CmdPhaseHistogram, &m.BatchCountHistogram,
+		&m.MaxBatchDurationHistogram, &m.BatchRegionCountHistogram, &m.BatchPairsHistogram, &m.BatchBytesHistogram} {
+		if err := registerer.Register(*vec); err != nil {
+			existing, err := existingCollector(err)
+			if err != nil {
+				return nil, err
+			}
+			*vec = existing.(*prometheus.HistogramVec)
+		}
+	}
+	for _, vec := range []**prometheus.CounterVec{&m.ReplicaReadCounter, &m.RetryCounter, &m.BatchRetryCounter, &m.ErrorCounter} {
+		if err := registerer.Register(*vec); err != nil {
+			existing, err := existingCollector(err)
+			if err != nil {
+				return nil, err
+			}
+			*vec = existing.(*prometheus.CounterVec)
+		}
+	}
+	m.initShortcuts()
+	return m, nil
+}
+
+// existingCollector returns the registered collector if err tells the collector is already registered.
+func existingCollector(err error) (prometheus.Collector, error) {
+	var registeredErr prometheus.AlreadyRegisteredError
+	if errors.As(err, &registeredErr) {
+		return registeredErr.ExistingCollector, nil
+	}
+	return nil, errors.WithStack(err)
+}
+
+// Cmd returns the breakdown metrics of the command, which is labeled like CmdHistogram.
+func (m *RawkvMetrics) Cmd(cmd string) *RawkvCmdMetrics {
+	if cmdMetrics, ok := m.cmds[cmd]; ok {
+		return cmdMetrics
+	}
+	return m.newCmdMetrics(cmd)
+}
+
+func (m *RawkvMetrics) newCmdMetrics(cmd string) *RawkvCmdMetrics {
+	return &RawkvCmdMetrics{
+		RPCDuration:      m.CmdPhaseHistogram.WithLabelValues(cmd, "rpc"),
+		BackoffDuration:  m.CmdPhaseHistogram.WithLabelValues(cmd, "backoff"),
+		RegionDuration:   m.CmdPhaseHistogram.WithLabelValues(cmd, "region"),
+		BatchCount:       m.BatchCountHistogram.WithLabelValues(cmd),
+		MaxBatchDuration: m.MaxBatchDurationHistogram.WithLabelValues(cmd),
+		BatchRegionCount: m.BatchRegionCountHistogram.WithLabelValues(cmd),
+		BatchPairs:       m.BatchPairsHistogram.WithLabelValues(cmd),
+		BatchBytes:       m.BatchBytesHistogram.WithLabelValues(cmd),
+		BatchRetry:       m.BatchRetryCounter.WithLabelValues(cmd),
+	}
+}
+
+func (m *RawkvMetrics) initShortcuts() {
+	m.CmdHistogramWithGet = m.CmdHistogram.WithLabelValues("get")
+	m.CmdHistogramWithBatchGet = m.CmdHistogram.WithLabelValues("batch_get")
+	m.CmdHistogramWithPut = m.CmdHistogram.WithLabelValues("put")
+	m.CmdHistogramWithBatchPut = m.CmdHistogram.WithLabelValues("batch_put")
+	m.CmdHistogramWithDelete = m.CmdHistogram.WithLabelValues("delete")
+	m.CmdHistogramWithBatchDelete = m.CmdHistogram.WithLabelValues("batch_delete")
+	m.CmdHistogramWithRawScan = m.CmdHistogram.WithLabelValues("raw_scan")
+	m.CmdHistogramWithRawReversScan = m.CmdHistogram.WithLabelValues("raw_reverse_scan")
+	m.SizeHistogramWithKey = m.SizeHistogram.WithLabelValues("key")
+	m.SizeHistogramWithValue = m.SizeHistogram.WithLabelValues("value")
+	m.CmdHistogramWithRawChecksum = m.CmdHistogram.WithLabelValues("raw_checksum")
+	m.CmdHistogramWithRawBatchScan = m.CmdHistogram.WithLabelValues("raw_batch_scan")
+	m.CmdHistogramWithExists = m.CmdHistogram.WithLabelValues("exists")
+	m.CmdHistogramWithBatchExists = m.CmdHistogram.WithLabelValues("batch_exists")
+	m.CmdHistogramWithCount = m.CmdHistogram.WithLabelValues("count")
+	m.ReplicaReadLocal = m.ReplicaReadCounter.WithLabelValues("local")
+	m.ReplicaReadRemote = m.ReplicaReadCounter.WithLabelValues("remote")
+
+	m.cmds = make(map[string]*RawkvCmdMetrics, len(rawkvCmds))
+	for _, cmd := range rawkvCmds {
+		m.cmds[cmd] = m.newCmdMetrics(cmd)
+	}
+}
+
+func newRawkvCmdHistogram(namespace, subsystem string, constLabels prometheus.Labels) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "rawkv_cmd_seconds",
+			Help:        "Bucketed histogram of processing time of rawkv cmds.",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.ExponentialBuckets(0.0005, 2, 29), // 0.5ms ~ 1.5days
+		}, []string{LblType})
+}
+
+func newRawkvSizeHistogram(namespace, subsystem string, constLabels prometheus.Labels) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "rawkv_kv_size_bytes",
+			Help:        "Size of key/value to put, in bytes.",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.ExponentialBuckets(1, 2, 30), // 1Byte ~ 512MB
+		}, []string{LblType})
+}
+
+func newRawkvReplicaReadCounter(namespace, subsystem string, constLabels prometheus.Labels) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "rawkv_replica_read_total",
+			Help:        "Counter of rawkv replica reads served by the stores matching the preferred labels (local) or not (remote).",
+			ConstLabels: constLabels,
+		}, []string{LblType})
+}
+
+func newRawkvCmdPhaseHistogram(namespace, subsystem string, constLabels prometheus.Labels) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "rawkv_cmd_phase_seconds",
+			Help:        "Bucketed histogram of the time rawkv cmds spend in RPCs, backoffs and region resolution.",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.ExponentialBuckets(0.0005, 2, 29), // 0.5ms ~ 1.5days
+		}, []string{LblType, LblPhase})
+}
+
+func newRawkvRetryCounter(namespace, subsystem string, constLabels prometheus.Labels) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "rawkv_retry_total",
+			Help:        "Counter of the retries of rawkv cmds on region errors, by the type of the region errors.",
+			ConstLabels: constLabels,
+		}, []string{LblType})
+}
+
+func newRawkvBatchCountHistogram(namespace, subsystem string, constLabels prometheus.Labels) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "rawkv_batch_count",
+			Help:        "Bucketed histogram of the number of the sub-batches of rawkv batch cmds.",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.ExponentialBuckets(1, 2, 16), // 1 ~ 32768
+		}, []string{LblType})
+}
+
+func newRawkvMaxBatchDurationHistogram(namespace, subsystem string, constLabels prometheus.Labels) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "rawkv_max_batch_seconds",
+			Help:        "Bucketed histogram of the processing time of the slowest sub-batch of rawkv batch cmds.",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.ExponentialBuckets(0.0005, 2, 29), // 0.5ms ~ 1.5days
+		}, []string{LblType})
+}
+
+func newRawkvBatchRegionCountHistogram(namespace, subsystem string, constLabels prometheus.Labels) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "rawkv_batch_region_count",
+			Help:        "Bucketed histogram of the number of the regions the keys of rawkv batch cmds are grouped by.",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.ExponentialBuckets(1, 2, 16), // 1 ~ 32768
+		}, []string{LblType})
+}
+
+func newRawkvBatchPairsHistogram(namespace, subsystem string, constLabels prometheus.Labels) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "rawkv_batch_pairs",
+			Help:        "Bucketed histogram of the number of the keys or pairs of the sub-batches of rawkv batch cmds.",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.ExponentialBuckets(1, 2, 16), // 1 ~ 32768
+		}, []string{LblType})
+}
+
+func newRawkvBatchBytesHistogram(namespace, subsystem string, constLabels prometheus.Labels) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "rawkv_batch_bytes",
+			Help:        "Bucketed histogram of the size of the keys and values of the sub-batches of rawkv batch cmds, in bytes.",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.ExponentialBuckets(1, 2, 30), // 1Byte ~ 512MB
+		}, []string{LblType})
+}
+
+func newRawkvBatchRetryCounter(namespace, subsystem string, constLabels prometheus.Labels) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "rawkv_batch_retry_total",
+			Help:        "Counter of the sub-batches of rawkv batch cmds that meet region errors and are sent again.",
+			ConstLabels: constLabels,
+		}, []string{LblType})
+}
+
+func newRawkvErrorCounter(namespace, subsystem string, constLabels prometheus.Labels) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "rawkv_errors_total",
+			Help:        "Counter of the errors of rawkv requests, by the command of the requests and the kind of the errors.",
+			ConstLabels: constLabels,
+		}, []string{LblCommand, LblKind})
+}
@@ -46,6 +46,7 @@ var (
 
 	RawkvCmdHistogramWithGet           prometheus.Observer
 	RawkvCmdHistogramWithBatchGet      prometheus.Observer
+	RawkvCmdHistogramWithPut           prometheus.Observer
 	RawkvCmdHistogramWithBatchPut      prometheus.Observer
 	RawkvCmdHistogramWithDelete        prometheus.Observer
 	RawkvCmdHistogramWithBatchDelete   prometheus.Observer
@@ -54,6 +55,17 @@ var (
 	RawkvSizeHistogramWithKey          prometheus.Observer
 	RawkvSizeHistogramWithValue        prometheus.Observer
 	RawkvCmdHistogramWithRawChecksum   prometheus.Observer
+	RawkvCmdHistogramWithRawBatchScan  prometheus.Observer
+	RawkvCmdHistogramWithExists        prometheus.Observer
+	RawkvCmdHistogramWithBatchExists   prometheus.Observer
+	RawkvCmdHistogramWithCount         prometheus.Observer
+	RawkvReplicaReadLocal              prometheus.Counter
+	RawkvReplicaReadRemote             prometheus.Counter
+
+	RawkvCacheCounterWithHit         prometheus.Counter
+	RawkvCacheCounterWithMiss        prometheus.Counter
+	RawkvCacheLoadHistogramWithOK    prometheus.Observer
+	RawkvCacheLoadHistogramWithError prometheus.Observer
 
 	BackoffHistogramRPC                      prometheus.Observer
 	BackoffHistogramLock                     prometheus.Observer
@@ -135,6 +147,11 @@ var (
 	PrewriteAssertionUsageCounterExist    prometheus.Counter
 	PrewriteAssertionUsageCounterNotExist prometheus.Counter
 	PrewriteAssertionUsageCounterUnknown  prometheus.Counter
+
+	GRPCBytesSentPayload     prometheus.Counter
+	GRPCBytesSentWire        prometheus.Counter
+	GRPCBytesReceivedPayload prometheus.Counter
+	GRPCBytesReceivedWire    prometheus.Counter
 )
 
 func initShortcuts() {
@@ -144,16 +161,43 @@ func initShortcuts() {
 	TxnCmdHistogramWithGet = TiKVTxnCmdHistogram.WithLabelValues(LblGet)
 	TxnCmdHistogramWithLockKeys = TiKVTxnCmdHistogram.WithLabelValues(LblLockKeys)
 
-	RawkvCmdHistogramWithGet = TiKVRawkvCmdHistogram.WithLabelValues("get")
-	RawkvCmdHistogramWithBatchGet = TiKVRawkvCmdHistogram.WithLabelValues("batch_get")
-	RawkvCmdHistogramWithBatchPut = TiKVRawkvCmdHistogram.WithLabelValues("batch_put")
-	RawkvCmdHistogramWithDelete = TiKVRawkvCmdHistogram.WithLabelValues("delete")
-	RawkvCmdHistogramWithBatchDelete = TiKVRawkvCmdHistogram.WithLabelValues("batch_delete")
-	RawkvCmdHistogramWithRawScan = TiKVRawkvCmdHistogram.WithLabelValues("raw_scan")
-	RawkvCmdHistogramWithRawReversScan = TiKVRawkvCmdHistogram.WithLabelValues("raw_reverse_scan")
-	RawkvSizeHistogramWithKey = TiKVRawkvSizeHistogram.WithLabelValues("key")
-	RawkvSizeHistogramWithValue = TiKVRawkvSizeHistogram.WithLabelValues("value")
-	RawkvCmdHistogramWithRawChecksum = TiKVRawkvSizeHistogram.WithLabelValues("raw_checksum")
+	DefaultRawkvMetrics = &RawkvMetrics{
+		CmdHistogram:              TiKVRawkvCmdHistogram,
+		SizeHistogram:             TiKVRawkvSizeHistogram,
+		ReplicaReadCounter:        TiKVRawkvReplicaReadCounter,
+		CmdPhaseHistogram:         TiKVRawkvCmdPhaseHistogram,
+		RetryCounter:              TiKVRawkvRetryCounter,
+		BatchCountHistogram:       TiKVRawkvBatchCountHistogram,
+		MaxBatchDurationHistogram: TiKVRawkvMaxBatchDurationHistogram,
+		BatchRegionCountHistogram: TiKVRawkvBatchRegionCountHistogram,
+		BatchPairsHistogram:       TiKVRawkvBatchPairsHistogram,
+		BatchBytesHistogram:       TiKVRawkvBatchBytesHistogram,
+		BatchRetryCounter:         TiKVRawkvBatchRetryCounter,
+		ErrorCounter:              TiKVRawkvErrorCounter,
+	}
+	DefaultRawkvMetrics.initShortcuts()
+	RawkvCmdHistogramWithGet = DefaultRawkvMetrics.CmdHistogramWithGet
+	RawkvCmdHistogramWithBatchGet = DefaultRawkvMetrics.CmdHistogramWithBatchGet
+	RawkvCmdHistogramWithPut = DefaultRawkvMetrics.CmdHistogramWithPut
+	RawkvCmdHistogramWithBatchPut = DefaultRawkvMetrics.CmdHistogramWithBatchPut
+	RawkvCmdHistogramWithDelete = DefaultRawkvMetrics.CmdHistogramWithDelete
+	RawkvCmdHistogramWithBatchDelete = DefaultRawkvMetrics.CmdHistogramWithBatchDelete
+	RawkvCmdHistogramWithRawScan = DefaultRawkvMetrics.CmdHistogramWithRawScan
+	RawkvCmdHistogramWithRawReversScan = DefaultRawkvMetrics.CmdHistogramWithRawReversScan
+	RawkvSizeHistogramWithKey = DefaultRawkvMetrics.SizeHistogramWithKey
+	RawkvSizeHistogramWithValue = DefaultRawkvMetrics.SizeHistogramWithValue
+	RawkvCmdHistogramWithRawChecksum = DefaultRawkvMetrics.CmdHistogramWithRawChecksum
+	RawkvCmdHistogramWithRawBatchScan = DefaultRawkvMetrics.CmdHistogramWithRawBatchScan
+	RawkvCmdHistogramWithExists = DefaultRawkvMetrics.CmdHistogramWithExists
+	RawkvCmdHistogramWithBatchExists = DefaultRawkvMetrics.CmdHistogramWithBatchExists
+	RawkvCmdHistogramWithCount = DefaultRawkvMetrics.CmdHistogramWithCount
+	RawkvReplicaReadLocal = DefaultRawkvMetrics.ReplicaReadLocal
+	RawkvReplicaReadRemote = DefaultRawkvMetrics.ReplicaReadRemote
+
+	RawkvCacheCounterWithHit = TiKVRawkvCacheCounter.WithLabelValues("hit")
+	RawkvCacheCounterWithMiss = TiKVRawkvCacheCounter.WithLabelValues("miss")
+	RawkvCacheLoadHistogramWithOK = TiKVRawkvCacheLoadHistogram.WithLabelValues("ok")
+	RawkvCacheLoadHistogramWithError = TiKVRawkvCacheLoadHistogram.WithLabelValues("err")
 
 	BackoffHistogramRPC = TiKVBackoffHistogram.WithLabelValues("tikvRPC")
 	BackoffHistogramLock = TiKVBackoffHistogram.WithLabelValues("txnLock")
@@ -235,4 +279,9 @@ func initShortcuts() {
 	PrewriteAssertionUsageCounterExist = TiKVPrewriteAssertionUsageCounter.WithLabelValues("exist")
 	PrewriteAssertionUsageCounterNotExist = TiKVPrewriteAssertionUsageCounter.WithLabelValues("not-exist")
 	PrewriteAssertionUsageCounterUnknown = TiKVPrewriteAssertionUsageCounter.WithLabelValues("unknown")
+
+	GRPCBytesSentPayload = TiKVGRPCBytesCounter.WithLabelValues("sent", "payload")
+	GRPCBytesSentWire = TiKVGRPCBytesCounter.WithLabelValues("sent", "wire")
+	GRPCBytesReceivedPayload = TiKVGRPCBytesCounter.WithLabelValues("received", "payload")
+	GRPCBytesReceivedWire = TiKVGRPCBytesCounter.WithLabelValues("received", "wire")
 }
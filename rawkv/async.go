@@ -0,0 +1,420 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rawkv
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tikv/client-go/v2/internal/retry"
+	"github.com/tikv/client-go/v2/tikvrpc"
+)
+
+const (
+	// asyncQueueSize is the number of the asynchronous writes that can wait to be sent, beyond which AsyncPut and
+	// AsyncDelete block.
+	asyncQueueSize = 4096
+	// asyncFlushSize is the max number of the asynchronous writes to a region sent together.
+	asyncFlushSize = 4096
+)
+
+// ErrClientClosed is returned by the futures of the asynchronous writes issued after the client is closed.
+var ErrClientClosed = errors.New("the client is closed")
+
+// Future is the result of an asynchronous write issued by AsyncPut or AsyncDelete.
+type Future struct {
+	op *asyncOp
+}
+
+// Wait waits until the write is done and returns its error, or returns the error of ctx if ctx is done first, in
+// which case the write may still be done later. It can be called more than once and concurrently.
+func (f Future) Wait(ctx context.Context) error {
+	select {
+	case <-f.op.done:
+		return f.op.err
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// asyncOp is an asynchronous write, whose err is set before done is closed.
+type asyncOp struct {
+	ctx    context.Context
+	key    []byte
+	value  []byte
+	ttl    uint64
+	delete bool
+	// regionID is the region of key when the write is issued, by which it's queued.
+	regionID uint64
+
+	err  error
+	done chan struct{}
+}
+
+func (op *asyncOp) finish(err error) {
+	op.err = err
+	close(op.done)
+}
+
+// AsyncPut stores a key-value pair to TiKV like PutWithTTL without waiting for it, and a ttl of 0 means no TTL.
+// The writes waiting to be sent to a region are coalesced into RawBatchPut requests, so that many writes can be in
+// flight without a goroutine for each, and the writes to different regions are sent concurrently. The writes to the
+// same key are applied in the order they are issued. It blocks only if too many writes are waiting to be sent, until
+// ctx is done, in which case the future fails with the error of ctx. Close sends the writes issued before it and
+// fails the ones issued after it.
+//
+// ctx also bounds the write after AsyncPut returns: a write whose ctx is done before it's sent fails with the error
+// of ctx, and the request sending it is given up once the ctxs of all the writes in it are done. The writes are
+// at-least-once, so a write that fails with the error of ctx, or whose Wait returns the error of ctx, may still be
+// applied by TiKV.
+func (c *Client) AsyncPut(ctx context.Context, key, value []byte, ttl uint64) Future {
+	return c.issueAsync(ctx, &asyncOp{ctx: ctx, key: key, value: value, ttl: ttl, done: make(chan struct{})})
+}
+
+// AsyncDelete deletes a key-value pair from TiKV like Delete without waiting for it. The deletes waiting to be sent
+// are coalesced into RawBatchDelete requests, see AsyncPut.
+func (c *Client) AsyncDelete(ctx context.Context, key []byte) Future {
+	return c.issueAsync(ctx, &asyncOp{ctx: ctx, key: key, delete: true, done: make(chan struct{})})
+}
+
+// coalesceWrite tells whether a Put or Delete with the options is coalesced, see WithWriteCoalescing.
+func (c *Client) coalesceWrite(options []RawOption) bool {
+	return c.coalesceDelay > 0 && !c.atomic && len(options) == 0
+}
+
+func (c *Client) issueAsync(ctx context.Context, op *asyncOp) Future {
+	loc, err := c.regionCache.LocateKey(c.newBackoffer(ctx, c.getRawKVOptions()), op.key)
+	if err != nil {
+		op.finish(err)
+		return Future{op}
+	}
+	op.regionID = loc.Region.GetID()
+	c.asyncMu.RLock()
+	defer c.asyncMu.RUnlock()
+	if c.asyncClosed {
+		op.finish(errors.WithStack(ErrClientClosed))
+		return Future{op}
+	}
+	c.asyncOnce.Do(func() {
+		c.asyncOps = make(chan *asyncOp, asyncQueueSize)
+		c.asyncDone = make(chan struct{})
+		go c.dispatchAsync()
+	})
+	select {
+	case c.asyncOps <- op:
+	case <-ctx.Done():
+		op.finish(errors.WithStack(ctx.Err()))
+	}
+	return Future{op}
+}
+
+// closeAsync fails the asynchronous writes issued from now on, and waits until the ones issued before are sent.
+func (c *Client) closeAsync() {
+	c.asyncMu.Lock()
+	closed := c.asyncClosed
+	c.asyncClosed = true
+	c.asyncMu.Unlock()
+	if closed || c.asyncOps == nil {
+		return
+	}
+	close(c.asyncOps)
+	<-c.asyncDone
+}
+
+// asyncBatch is the writes to be sent together, whose keys are distinct.
+type asyncBatch struct {
+	queue *asyncQueue
+	ops   []*asyncOp
+	keys  map[string]struct{}
+	// ready is set when the batch is full or it has waited for the delay of WithWriteCoalescing.
+	ready bool
+	timer *time.Timer
+}
+
+// asyncQueue is the batches waiting to be sent to a region, which are sent one by one in order.
+type asyncQueue struct {
+	regionID uint64
+	batches  []*asyncBatch
+	// flushing tells whether a batch of the queue is being sent.
+	flushing bool
+}
+
+// asyncKey is the queue taking the writes to a key, and the number of the writes to it waiting or being sent.
+type asyncKey struct {
+	queue *asyncQueue
+	n     int
+}
+
+// asyncDispatcher queues the asynchronous writes by region, and sends the queues concurrently. It's only accessed by
+// the goroutine of dispatchAsync, to which the timers of the batches and the flushes report.
+type asyncDispatcher struct {
+	c         *Client
+	flushSize int
+	queues    map[uint64]*asyncQueue
+	// keys are the keys with writes waiting or being sent, whose later writes go to the same queue, so the writes to
+	// a key are sent in order even if it's moved to another region meanwhile.
+	keys    map[string]*asyncKey
+	pending int
+	closing bool
+	ready   chan *asyncBatch
+	flushed chan *asyncBatch
+}
+
+// dispatchAsync sends the asynchronous writes until Close. The writes to a region waiting when its previous ones are
+// sent are sent together, so that the more writes are issued, the larger the requests are, and a slow region doesn't
+// hold the writes to the others. If the writes are coalesced, the first of a batch waits for the others until the
+// delay or the batch of WithWriteCoalescing is reached. A write to a key already in the batch being gathered starts
+// the next batch, which keeps the order of the writes to the key.
+func (c *Client) dispatchAsync() {
+	defer close(c.asyncDone)
+	d := &asyncDispatcher{
+		c:         c,
+		flushSize: asyncFlushSize,
+		queues:    make(map[uint64]*asyncQueue),
+		keys:      make(map[string]*asyncKey),
+		ready:     make(chan *asyncBatch),
+		flushed:   make(chan *asyncBatch),
+	}
+	if c.coalesceBatch > 0 {
+		d.flushSize = c.coalesceBatch
+	}
+	ops := c.asyncOps
+	for ops != nil || d.pending > 0 {
+		select {
+		case op, ok := <-ops:
+			if !ok {
+				// Close sends all the writes waiting right away.
+				ops, d.closing = nil, true
+				for _, q := range d.queues {
+					d.flush(q)
+				}
+				continue
+			}
+			d.add(op)
+		case b := <-d.ready:
+			b.ready = true
+			d.flush(b.queue)
+		case b := <-d.flushed:
+			d.done(b)
+		}
+	}
+}
+
+func (d *asyncDispatcher) add(op *asyncOp) {
+	var q *asyncQueue
+	if k, ok := d.keys[string(op.key)]; ok {
+		q = k.queue
+		k.n++
+	} else {
+		if q = d.queues[op.regionID]; q == nil {
+			q = &asyncQueue{regionID: op.regionID}
+			d.queues[op.regionID] = q
+		}
+		d.keys[string(op.key)] = &asyncKey{queue: q, n: 1}
+	}
+	d.pending++
+
+	var b *asyncBatch
+	if n := len(q.batches); n > 0 {
+		b = q.batches[n-1]
+		if _, ok := b.keys[string(op.key)]; ok || len(b.ops) >= d.flushSize {
+			b = nil
+		}
+	}
+	if b == nil {
+		b = &asyncBatch{queue: q, keys: make(map[string]struct{}), ready: d.c.coalesceDelay <= 0}
+		if !b.ready {
+			b.timer = time.AfterFunc(d.c.coalesceDelay, func() {
+				select {
+				case d.ready <- b:
+				case <-d.c.asyncDone:
+				}
+			})
+		}
+		q.batches = append(q.batches, b)
+	}
+	b.ops = append(b.ops, op)
+	b.keys[string(op.key)] = struct{}{}
+	if len(b.ops) >= d.flushSize {
+		b.ready = true
+	}
+	d.flush(q)
+}
+
+// flush sends the first batch of q if it's ready and no batch of q is being sent.
+func (d *asyncDispatcher) flush(q *asyncQueue) {
+	if q.flushing || len(q.batches) == 0 || !(q.batches[0].ready || d.closing) {
+		return
+	}
+	b := q.batches[0]
+	q.batches = q.batches[1:]
+	q.flushing = true
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	go func() {
+		d.c.flushAsync(b.ops)
+		d.flushed <- b
+	}()
+}
+
+// done releases the writes of the batch sent, and sends the next batch of its queue.
+func (d *asyncDispatcher) done(b *asyncBatch) {
+	q := b.queue
+	q.flushing = false
+	d.pending -= len(b.ops)
+	for _, op := range b.ops {
+		k := d.keys[string(op.key)]
+		if k.n--; k.n == 0 {
+			delete(d.keys, string(op.key))
+		}
+	}
+	if len(q.batches) == 0 {
+		delete(d.queues, q.regionID)
+		return
+	}
+	d.flush(q)
+}
+
+// flushContext returns the ctx of sending the writes, which is done when the ctxs of all of them are done, so the
+// request is given up only if no caller waits for it.
+func flushContext(ops []*asyncOp) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for _, op := range ops {
+			select {
+			case <-op.ctx.Done():
+			case <-ctx.Done():
+				return
+			}
+		}
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+// flushAsync sends the writes, whose keys are distinct, and finishes their futures. A write fails with the error of
+// the request to its region, so the writes to the other regions succeed. The writes whose ctxs are done already are
+// not sent.
+func (c *Client) flushAsync(ops []*asyncOp) {
+	live := ops[:0:0]
+	for _, op := range ops {
+		if err := op.ctx.Err(); err != nil {
+			op.finish(errors.WithStack(err))
+			continue
+		}
+		live = append(live, op)
+	}
+	if len(live) == 0 {
+		return
+	}
+	ops = live
+	ctx, cancel := flushContext(ops)
+	defer cancel()
+
+	var (
+		puts, deletes   []*asyncOp
+		putKeys, values [][]byte
+		ttls            []uint64
+		deleteKeys      [][]byte
+		withTTL         bool
+	)
+	for _, op := range ops {
+		if op.delete {
+			deletes = append(deletes, op)
+			deleteKeys = append(deleteKeys, op.key)
+			continue
+		}
+		puts = append(puts, op)
+		putKeys = append(putKeys, op.key)
+		values = append(values, op.value)
+		ttls = append(ttls, op.ttl)
+		withTTL = withTTL || op.ttl > 0
+	}
+	if !withTTL {
+		ttls = nil
+	}
+
+	opts := c.getRawKVOptions()
+	if len(puts) > 0 {
+		bo := c.newBackoffer(ctx, opts)
+		result, err := c.sendBatchPutWithResult(bo, putKeys, values, ttls, opts, false)
+		keyErrs := make(map[string]error)
+		for _, failure := range result.Failures {
+			for _, key := range failure.FailedKeys {
+				keyErrs[string(key)] = failure.Err
+			}
+		}
+		for _, key := range result.SucceededKeys {
+			keyErrs[string(key)] = nil
+		}
+		for _, op := range puts {
+			if keyErr, ok := keyErrs[string(op.key)]; ok {
+				op.finish(keyErr)
+			} else {
+				op.finish(err)
+			}
+		}
+	}
+	if len(deletes) > 0 {
+		bo := c.newBackoffer(ctx, opts)
+		keyErrs, err := c.sendAsyncDeletes(bo, deleteKeys, opts)
+		for _, op := range deletes {
+			if keyErr, ok := keyErrs[string(op.key)]; ok {
+				op.finish(keyErr)
+			} else {
+				op.finish(err)
+			}
+		}
+	}
+}
+
+// sendAsyncDeletes deletes the keys by the regions they belong to, and returns the error of every key, which is nil
+// if it's deleted. If the keys fail to be grouped by region, the error is returned for all of them.
+func (c *Client) sendAsyncDeletes(bo *retry.Backoffer, keys [][]byte, opts *rawOptions) (map[string]error, error) {
+	start := startPhase(bo)
+	groups, _, err := c.regionCache.GroupKeysByRegion(bo, keys, nil)
+	opts.breakdown.onRegion(bo, start)
+	if err != nil {
+		return nil, err
+	}
+	groupKeys := make([][][]byte, 0, len(groups))
+	for _, keys := range groups {
+		groupKeys = append(groupKeys, keys)
+	}
+	groupErrs := make([]error, len(groupKeys))
+	// The groups are sent by their own goroutines rather than runBatches, since sendBatchReq runs its batches by
+	// runBatches, and a group holding a batch slot while waiting for another one could deadlock the client.
+	var wg sync.WaitGroup
+	for i := range groupKeys {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			groupBo, cancel := bo.Fork()
+			defer cancel()
+			_, groupErrs[i] = c.sendBatchReq(groupBo, groupKeys[i], opts, tikvrpc.CmdRawBatchDelete)
+		}(i)
+	}
+	wg.Wait()
+	keyErrs := make(map[string]error, len(keys))
+	for i, err := range groupErrs {
+		for _, key := range groupKeys[i] {
+			keyErrs[string(key)] = err
+		}
+	}
+	return keyErrs, nil
+}
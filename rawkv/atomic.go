@@ -0,0 +1,296 @@
+// Copyright 2021 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rawkv
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+	"github.com/tikv/client-go/v2/internal/retry"
+	"github.com/tikv/client-go/v2/metrics"
+)
+
+var (
+	// ErrCASConflict is returned when an atomic read-modify-write loses the race to concurrent writers,
+	// either at once by Persist or after the backoff is exhausted by the others. It's safe to retry.
+	ErrCASConflict = errors.New("raw CAS conflict, the value is changed concurrently")
+	// ErrInvalidCounter is returned by Incr and Decr when the existing value isn't an 8-byte integer.
+	ErrInvalidCounter = errors.New("the value of the counter is not an 8-byte integer")
+	// ErrValueTooLarge is returned by Append when the appended value would exceed the size limit.
+	ErrValueTooLarge = errors.New("the value is too large")
+)
+
+// boRawCASConflict is the backoff between the retries of a CAS which conflicts with other writers.
+var boRawCASConflict = retry.NewConfig("rawCASConflict", &metrics.BackoffHistogramEmpty, retry.NewBackoffFnCfg(2, 500, retry.EqualJitter), ErrCASConflict)
+
+// Incr atomically adds delta to the counter stored in key and returns the new value.
+// The counter is encoded as an 8-byte big-endian integer, and a missing key counts as zero.
+// ErrInvalidCounter is returned if the existing value isn't 8 bytes.
+// The update is a CAS retry loop with backoff on conflicts; ErrCASConflict is returned if the backoff is exhausted.
+//
+// Like CompareAndSwap, it requires SetAtomicForCAS(true), otherwise ErrAtomicModeRequired is returned.
+func (c *Client) Incr(ctx context.Context, key []byte, delta int64, options ...RawOption) (_ int64, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Incr")
+	defer func() { endSpan(span, err) }()
+	if !c.atomic {
+		return 0, errors.WithStack(ErrAtomicModeRequired)
+	}
+	opts := c.getRawKVOptions(options...)
+	defer func() { c.observeBreakdown(ctx, "incr", opts, err) }()
+	newValue, err := c.casUpdate(ctx, key, func(current []byte) ([]byte, error) {
+		var n int64
+		if current != nil {
+			if len(current) != 8 {
+				return nil, errors.WithStack(ErrInvalidCounter)
+			}
+			n = int64(binary.BigEndian.Uint64(current))
+		}
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(n+delta))
+		return buf, nil
+	}, opts)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(newValue)), nil
+}
+
+// Decr atomically subtracts delta from the counter stored in key and returns the new value. See Incr for details.
+func (c *Client) Decr(ctx context.Context, key []byte, delta int64, options ...RawOption) (_ int64, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Decr")
+	defer func() { endSpan(span, err) }()
+	return c.Incr(ctx, key, -delta, options...)
+}
+
+// Append atomically appends suffix to the value of key, an absent key is treated as an empty value,
+// and returns the new value. ErrValueTooLarge is returned if the new value would be larger than maxValueSize,
+// a non-positive maxValueSize means no limit.
+// The update is a CAS retry loop with backoff on conflicts, it stops when ctx is done or
+// the backoff is exhausted, which returns ErrCASConflict.
+//
+// Like CompareAndSwap, it requires SetAtomicForCAS(true), otherwise ErrAtomicModeRequired is returned.
+func (c *Client) Append(ctx context.Context, key, suffix []byte, maxValueSize int, options ...RawOption) (_ []byte, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Append")
+	defer func() { endSpan(span, err) }()
+	if !c.atomic {
+		return nil, errors.WithStack(ErrAtomicModeRequired)
+	}
+	opts := c.getRawKVOptions(options...)
+	defer func() { c.observeBreakdown(ctx, "append", opts, err) }()
+	return c.casUpdate(ctx, key, func(current []byte) ([]byte, error) {
+		if maxValueSize > 0 && len(current)+len(suffix) > maxValueSize {
+			return nil, errors.Wrapf(ErrValueTooLarge, "%d bytes exceeds the limit %d", len(current)+len(suffix), maxValueSize)
+		}
+		newValue := make([]byte, 0, len(current)+len(suffix))
+		return append(append(newValue, current...), suffix...), nil
+	}, opts)
+}
+
+// UpdateTTL refreshes the TTL of the key without changing its value, and returns whether the key exists.
+// TiKV can't update a TTL alone, so the value is swapped onto itself with the new TTL by CAS, which retries with
+// backoff if the value is changed concurrently. A key deleted concurrently is never written back.
+//
+// Like CompareAndSwap, it requires SetAtomicForCAS(true), otherwise ErrAtomicModeRequired is returned.
+func (c *Client) UpdateTTL(ctx context.Context, key []byte, ttl uint64, options ...RawOption) (_ bool, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.UpdateTTL")
+	defer func() { endSpan(span, err) }()
+	if !c.atomic {
+		return false, errors.WithStack(ErrAtomicModeRequired)
+	}
+	opts := c.getRawKVOptions(options...)
+	defer func() { c.observeBreakdown(ctx, "update_ttl", opts, err) }()
+	opts.TTL = ttl
+	value, err := c.Get(ctx, key, SetColumnFamily(c.getColumnFamily(opts)))
+	if err != nil {
+		return false, err
+	}
+	bo := c.newBackoffer(ctx, opts)
+	for value != nil {
+		actual, swapped, err := c.compareAndSwap(ctx, key, value, value, opts)
+		if err != nil || swapped {
+			return swapped, err
+		}
+		if err := backoffOnConflict(bo, opts); err != nil {
+			return false, err
+		}
+		value = actual
+	}
+	return false, nil
+}
+
+// Persist removes the TTL of the key so that it never expires, keeping its value, and returns whether the key exists.
+// The value is swapped onto itself without TTL by one CAS. If the value is changed concurrently, ErrCASConflict is
+// returned and the caller can retry.
+//
+// Like CompareAndSwap, it requires SetAtomicForCAS(true), otherwise ErrAtomicModeRequired is returned.
+func (c *Client) Persist(ctx context.Context, key []byte, options ...RawOption) (_ bool, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Persist")
+	defer func() { endSpan(span, err) }()
+	if !c.atomic {
+		return false, errors.WithStack(ErrAtomicModeRequired)
+	}
+	opts := c.getRawKVOptions(options...)
+	defer func() { c.observeBreakdown(ctx, "persist", opts, err) }()
+	opts.TTL = 0
+	value, err := c.Get(ctx, key, SetColumnFamily(c.getColumnFamily(opts)))
+	if err != nil || value == nil {
+		return false, err
+	}
+	actual, swapped, err := c.compareAndSwap(ctx, key, value, value, opts)
+	if err != nil || swapped {
+		return swapped, err
+	}
+	if actual == nil {
+		return false, nil
+	}
+	return true, errors.WithStack(ErrCASConflict)
+}
+
+// casUpdate replaces the value of key by update(current) with a CAS retry loop, and returns the written value.
+// current is nil if the key is absent.
+func (c *Client) casUpdate(ctx context.Context, key []byte, update func(current []byte) ([]byte, error), opts *rawOptions) ([]byte, error) {
+	bo := c.newBackoffer(ctx, opts)
+	// Guess the key is absent for the first try, the failed CAS returns the current value.
+	var current []byte
+	for guessed := true; ; guessed = false {
+		newValue, err := update(current)
+		if err != nil {
+			return nil, err
+		}
+		actual, swapped, err := c.compareAndSwap(ctx, key, current, newValue, opts)
+		if err != nil {
+			return nil, err
+		}
+		if swapped {
+			return newValue, nil
+		}
+		if !guessed {
+			if err := backoffOnConflict(bo, opts); err != nil {
+				return nil, err
+			}
+		}
+		current = actual
+	}
+}
+
+// backoffOnConflict backs off bo before retrying a CAS that conflicts with other writers, and adds the sleep to the
+// breakdown of opts.
+func backoffOnConflict(bo *retry.Backoffer, opts *rawOptions) error {
+	sleep := bo.GetTotalSleep()
+	defer opts.breakdown.onBackoff(bo, sleep)
+	return bo.Backoff(boRawCASConflict, ErrCASConflict)
+}
+
+// UpdateAbortedError is returned by Update when its fn returns an error, which is kept in Err. Nothing is written
+// by the attempt that aborts.
+type UpdateAbortedError struct {
+	Err error
+}
+
+func (e *UpdateAbortedError) Error() string {
+	return "the update is aborted: " + e.Err.Error()
+}
+
+func (e *UpdateAbortedError) Unwrap() error {
+	return e.Err
+}
+
+type updateOptions struct {
+	maxAttempts int
+	ttl         uint64
+	rawOptions  []RawOption
+}
+
+// UpdateOption is an option of Update.
+type UpdateOption func(*updateOptions)
+
+// WithUpdateMaxAttempts sets the max number of the CAS attempts, after which ErrCASConflict is returned. By default
+// the attempts are only bounded by the backoff of the client.
+func WithUpdateMaxAttempts(n int) UpdateOption {
+	return func(o *updateOptions) {
+		o.maxAttempts = n
+	}
+}
+
+// WithUpdateTTL writes the new value with the TTL in seconds. By default the new value never expires.
+func WithUpdateTTL(ttl uint64) UpdateOption {
+	return func(o *updateOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithUpdateRawOptions sets the RawOptions of the reads and the writes, e.g. SetColumnFamily or WithMaxBackoff.
+func WithUpdateRawOptions(options ...RawOption) UpdateOption {
+	return func(o *updateOptions) {
+		o.rawOptions = append(o.rawOptions, options...)
+	}
+}
+
+// Update replaces the value of key by fn(old) with a CAS retry loop, and returns the value written. old is nil if
+// the key is absent. If fn returns a nil value, nothing is written and old is returned. fn is called again with the
+// current value whenever the CAS conflicts with another writer, so it must not have side effects. The retries back
+// off like the other requests of the client.
+//
+// If fn returns an error, Update stops and returns an *UpdateAbortedError wrapping it. If the attempts or the
+// backoff are exhausted, it returns ErrCASConflict, which is safe to retry.
+//
+// Like CompareAndSwap, it requires SetAtomicForCAS(true), otherwise ErrAtomicModeRequired is returned.
+func (c *Client) Update(ctx context.Context, key []byte, fn func(old []byte) (new []byte, err error), options ...UpdateOption) (_ []byte, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Update")
+	defer func() { endSpan(span, err) }()
+	if !c.atomic {
+		return nil, errors.WithStack(ErrAtomicModeRequired)
+	}
+	var o updateOptions
+	for _, option := range options {
+		option(&o)
+	}
+	if o.maxAttempts < 0 {
+		return nil, errors.Errorf("invalid update max attempts %d", o.maxAttempts)
+	}
+	opts := c.getRawKVOptions(o.rawOptions...)
+	defer func() { c.observeBreakdown(ctx, "update", opts, err) }()
+	opts.TTL = o.ttl
+	// Unlike casUpdate, the key isn't guessed to be absent, so that fn only sees the values that exist.
+	old, err := c.Get(ctx, key, SetColumnFamily(c.getColumnFamily(opts)))
+	if err != nil {
+		return nil, err
+	}
+	bo := c.newBackoffer(ctx, opts)
+	for attempt := 1; ; attempt++ {
+		newValue, err := fn(old)
+		if err != nil {
+			return nil, &UpdateAbortedError{Err: err}
+		}
+		if newValue == nil {
+			return old, nil
+		}
+		actual, swapped, err := c.compareAndSwap(ctx, key, old, newValue, opts)
+		if err != nil {
+			return nil, err
+		}
+		if swapped {
+			return newValue, nil
+		}
+		if o.maxAttempts > 0 && attempt >= o.maxAttempts {
+			return nil, errors.Wrapf(ErrCASConflict, "%d attempts", attempt)
+		}
+		if err := backoffOnConflict(bo, opts); err != nil {
+			return nil, err
+		}
+		old = actual
+	}
+}
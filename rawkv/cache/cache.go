@@ -0,0 +1,189 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cache implements a read-through cache on rawkv, which keeps the values of a slower source in TiKV with a
+// TTL.
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tikv/client-go/v2/internal/logutil"
+	"github.com/tikv/client-go/v2/metrics"
+	"github.com/tikv/client-go/v2/rawkv"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// Loader loads the value of key from the source of a cache. It returns a nil value if the key doesn't exist in the
+// source, which isn't cached.
+type Loader func(ctx context.Context, key []byte) ([]byte, error)
+
+// Cache is a read-through cache stored in TiKV. A key missed in TiKV is loaded from the source, and written back
+// with the TTL of the cache, so it's loaded again after it expires. The concurrent loads of the same key by a Cache
+// are de-duplicated. It's safe for concurrent use.
+//
+// Usage:
+//
+//	c, err := cache.New(client, loadFromDB, time.Minute, cache.WithPutIfAbsent())
+//	if err != nil { ... }
+//	value, err := c.Get(ctx, key)
+type Cache struct {
+	kv          rawkv.RawKV
+	loader      Loader
+	ttl         uint64
+	putIfAbsent bool
+	loadTimeout time.Duration
+	rawOptions  []rawkv.RawOption
+
+	group singleflight.Group
+}
+
+// Option is an option of New.
+type Option func(*Cache)
+
+// WithPutIfAbsent writes the loaded values back by PutIfAbsent, so a value written by another process meanwhile
+// isn't overwritten, and Get returns the value in TiKV instead of the one loaded. It limits the damage of a
+// thundering herd of processes missing the same key: they all read the value written first. A rawkv.Client must be
+// created with SetAtomicForCAS(true).
+func WithPutIfAbsent() Option {
+	return func(c *Cache) {
+		c.putIfAbsent = true
+	}
+}
+
+// WithLoadTimeout bounds a load of a missed key, including the write back, by timeout. A load isn't canceled by the
+// callers of Get, as it's shared by them, so it's bounded only by the loader itself without a timeout.
+func WithLoadTimeout(timeout time.Duration) Option {
+	return func(c *Cache) {
+		c.loadTimeout = timeout
+	}
+}
+
+// WithRawOptions sets the RawOptions of the reads and the writes to TiKV, e.g. SetColumnFamily.
+func WithRawOptions(options ...rawkv.RawOption) Option {
+	return func(c *Cache) {
+		c.rawOptions = append(c.rawOptions, options...)
+	}
+}
+
+// New creates a cache on kv, which loads the missed keys by loader and keeps them for ttl, which is rounded up to
+// seconds.
+func New(kv rawkv.RawKV, loader Loader, ttl time.Duration, options ...Option) (*Cache, error) {
+	if loader == nil {
+		return nil, errors.New("the loader of the cache is nil")
+	}
+	if ttl <= 0 {
+		return nil, errors.Errorf("invalid cache ttl %v", ttl)
+	}
+	c := &Cache{
+		kv:     kv,
+		loader: loader,
+		ttl:    uint64((ttl + time.Second - 1) / time.Second),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c, nil
+}
+
+// Get returns the value of key in TiKV, or loads it from the source if it's missed, and returns nil if the key
+// doesn't exist in the source either. A failure to write the loaded value back is logged rather than returned, as
+// the value is loaded anyway.
+//
+// The concurrent misses of the same key share one load, which runs with the values of the ctx of the first caller
+// but isn't canceled by it, see WithLoadTimeout; every caller returns the error of its own ctx if it's done first.
+func (c *Cache) Get(ctx context.Context, key []byte) ([]byte, error) {
+	value, err := c.kv.Get(ctx, key, c.rawOptions...)
+	if err != nil {
+		return nil, err
+	}
+	if value != nil {
+		metrics.RawkvCacheCounterWithHit.Inc()
+		return value, nil
+	}
+	metrics.RawkvCacheCounterWithMiss.Inc()
+	ch := c.group.DoChan(string(key), func() (interface{}, error) {
+		loadCtx := context.Context(detachedContext{ctx})
+		if c.loadTimeout > 0 {
+			var cancel context.CancelFunc
+			loadCtx, cancel = context.WithTimeout(loadCtx, c.loadTimeout)
+			defer cancel()
+		}
+		return c.load(loadCtx, key)
+	})
+	select {
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		return r.Val.([]byte), nil
+	case <-ctx.Done():
+		return nil, errors.WithStack(ctx.Err())
+	}
+}
+
+// Invalidate deletes key from TiKV, so the next Get loads it again. A load of the key in progress may still write
+// its value back, but a Get after Invalidate returns doesn't share it.
+func (c *Cache) Invalidate(ctx context.Context, key []byte) error {
+	c.group.Forget(string(key))
+	return c.kv.Delete(ctx, key, c.rawOptions...)
+}
+
+// load loads key from the source and writes it back, and returns the value Get should return.
+func (c *Cache) load(ctx context.Context, key []byte) ([]byte, error) {
+	start := time.Now()
+	value, err := c.loader(ctx, key)
+	if err != nil {
+		metrics.RawkvCacheLoadHistogramWithError.Observe(time.Since(start).Seconds())
+		return nil, errors.WithMessagef(err, "failed to load key %q", key)
+	}
+	metrics.RawkvCacheLoadHistogramWithOK.Observe(time.Since(start).Seconds())
+	if value == nil {
+		return nil, nil
+	}
+
+	if c.putIfAbsent {
+		options := append(append([]rawkv.RawOption{}, c.rawOptions...), rawkv.WithTTL(c.ttl))
+		existing, inserted, err := c.kv.PutIfAbsent(ctx, key, value, options...)
+		if err != nil {
+			logutil.Logger(ctx).Warn("failed to write the loaded value back to the cache", zap.Error(err))
+			return value, nil
+		}
+		if !inserted {
+			return existing, nil
+		}
+		return value, nil
+	}
+	if err := c.kv.PutWithTTL(ctx, key, value, c.ttl, c.rawOptions...); err != nil {
+		logutil.Logger(ctx).Warn("failed to write the loaded value back to the cache", zap.Error(err))
+	}
+	return value, nil
+}
+
+// detachedContext keeps the values of a context but not its deadline or cancellation, so a load shared by the
+// callers of Get isn't failed by the first one giving up.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -0,0 +1,205 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/tikv/client-go/v2/metrics"
+	"github.com/tikv/client-go/v2/rawkv/mock"
+)
+
+func TestReadThrough(t *testing.T) {
+	ctx := context.Background()
+	kv := mock.NewClient()
+	source := map[string]string{"a": "1", "b": "2"}
+	var loads int32
+	c, err := New(kv, func(ctx context.Context, key []byte) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		if value, ok := source[string(key)]; ok {
+			return []byte(value), nil
+		}
+		return nil, nil
+	}, 1500*time.Millisecond)
+	require.Nil(t, err)
+
+	hits, misses := testutil.ToFloat64(metrics.RawkvCacheCounterWithHit), testutil.ToFloat64(metrics.RawkvCacheCounterWithMiss)
+	// The miss is loaded and written back with the TTL rounded up.
+	value, err := c.Get(ctx, []byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("1"), value)
+	ttl, err := kv.GetKeyTTL(ctx, []byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, uint64(2), *ttl)
+	value, err = c.Get(ctx, []byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("1"), value)
+	require.Equal(t, int32(1), atomic.LoadInt32(&loads))
+	require.Equal(t, hits+1, testutil.ToFloat64(metrics.RawkvCacheCounterWithHit))
+	require.Equal(t, misses+1, testutil.ToFloat64(metrics.RawkvCacheCounterWithMiss))
+
+	// The keys missing in the source aren't cached.
+	value, err = c.Get(ctx, []byte("x"))
+	require.Nil(t, err)
+	require.Nil(t, value)
+	value, err = kv.Get(ctx, []byte("x"))
+	require.Nil(t, err)
+	require.Nil(t, value)
+
+	// An invalidated key is loaded again.
+	source["a"] = "3"
+	require.Nil(t, c.Invalidate(ctx, []byte("a")))
+	value, err = c.Get(ctx, []byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("3"), value)
+
+	_, err = New(kv, nil, time.Second)
+	require.NotNil(t, err)
+	_, err = New(kv, c.loader, 0)
+	require.NotNil(t, err)
+}
+
+func TestLoadError(t *testing.T) {
+	ctx := context.Background()
+	kv := mock.NewClient()
+	cause := errors.New("source is down")
+	c, err := New(kv, func(ctx context.Context, key []byte) ([]byte, error) {
+		return nil, cause
+	}, time.Second)
+	require.Nil(t, err)
+	_, err = c.Get(ctx, []byte("a"))
+	require.Equal(t, cause, errors.Cause(err))
+	value, err := kv.Get(ctx, []byte("a"))
+	require.Nil(t, err)
+	require.Nil(t, value)
+}
+
+func TestPutIfAbsent(t *testing.T) {
+	ctx := context.Background()
+	kv := mock.NewClient()
+	// Another process writes the key while it's loaded.
+	c, err := New(kv, func(ctx context.Context, key []byte) ([]byte, error) {
+		require.Nil(t, kv.Put(ctx, key, []byte("other")))
+		return []byte("loaded"), nil
+	}, time.Second, WithPutIfAbsent())
+	require.Nil(t, err)
+	value, err := c.Get(ctx, []byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("other"), value)
+	value, err = kv.Get(ctx, []byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("other"), value)
+}
+
+func TestSingleflight(t *testing.T) {
+	ctx := context.Background()
+	kv := mock.NewClient()
+	var loads int32
+	release := make(chan struct{})
+	c, err := New(kv, func(ctx context.Context, key []byte) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return []byte("v"), nil
+	}, time.Second)
+	require.Nil(t, err)
+
+	var wg sync.WaitGroup
+	values := make([][]byte, 8)
+	for i := range values {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			values[i], err = c.Get(ctx, []byte("a"))
+			require.Nil(t, err)
+		}(i)
+	}
+	// Wait for the load to start, and give the other gets time to join it.
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&loads) > 0 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&loads))
+	for _, value := range values {
+		require.Equal(t, []byte("v"), value)
+	}
+
+	// A waiting get returns when its ctx is done.
+	release = make(chan struct{})
+	defer close(release)
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = c.Get(cctx, []byte("b"))
+	require.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+}
+
+func TestFirstCallerCancel(t *testing.T) {
+	kv := mock.NewClient()
+	started, release := make(chan struct{}), make(chan struct{})
+	var loadErr atomic.Value
+	c, err := New(kv, func(ctx context.Context, key []byte) ([]byte, error) {
+		close(started)
+		<-release
+		if ctx.Err() != nil {
+			loadErr.Store(ctx.Err())
+		}
+		return []byte("v"), nil
+	}, time.Second)
+	require.Nil(t, err)
+
+	// The first caller gives up while the load it started is in progress.
+	cctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Get(cctx, []byte("a"))
+		done <- err
+	}()
+	<-started
+	var value []byte
+	joined := make(chan error, 1)
+	go func() {
+		var err error
+		value, err = c.Get(context.Background(), []byte("a"))
+		joined <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	require.Equal(t, context.Canceled, errors.Cause(<-done))
+
+	// The other caller still gets the value loaded.
+	close(release)
+	require.Nil(t, <-joined)
+	require.Equal(t, []byte("v"), value)
+	require.Nil(t, loadErr.Load())
+	value, err = kv.Get(context.Background(), []byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("v"), value)
+
+	// A load is bounded by the timeout of the cache instead.
+	c, err = New(kv, func(ctx context.Context, key []byte) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, time.Second, WithLoadTimeout(10*time.Millisecond))
+	require.Nil(t, err)
+	_, err = c.Get(context.Background(), []byte("b"))
+	require.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+}
@@ -0,0 +1,245 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rawkv
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// copyPageSize is the number of the pairs read from the source of CopyRange at a time.
+const copyPageSize = defaultIterBatchSize
+
+// ErrChecksumMismatch is returned by CopyRange with WithCopyVerify if the range differs between the clusters.
+var ErrChecksumMismatch = errors.New("the checksums of the source and the destination mismatch")
+
+// CopyStats are the statistics of CopyRange.
+type CopyStats struct {
+	// Keys and Bytes are the number and the size of the pairs copied.
+	Keys  int64
+	Bytes int64
+	// ResumeToken is set if the copy fails. The pairs before it are copied, and a copy with WithCopyResumeToken
+	// copies the rest.
+	ResumeToken string
+}
+
+type copyOptions struct {
+	concurrency int
+	withTTL     bool
+	progress    func(CopyStats)
+	resumeToken string
+	verify      bool
+	rawOptions  []RawOption
+}
+
+// CopyOption is an option of CopyRange.
+type CopyOption func(*copyOptions)
+
+// WithCopyConcurrency sets the max number of the batches written to the destination at the same time, instead of
+// the batch concurrency of the destination client.
+func WithCopyConcurrency(n int) CopyOption {
+	return func(o *copyOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithCopyTTL copies the TTLs of the pairs, which costs a GetKeyTTL request to the source for every pair, sent
+// concurrently by BatchGetKeyTTL for every page. The pairs that expire after they are read are skipped. Otherwise
+// the pairs are copied without TTLs.
+func WithCopyTTL() CopyOption {
+	return func(o *copyOptions) {
+		o.withTTL = true
+	}
+}
+
+// WithCopyProgress calls f with the stats whenever the copy advances, whose ResumeToken is empty. The calls are
+// serialized, and they hold up the writes, so f should return soon.
+func WithCopyProgress(f func(CopyStats)) CopyOption {
+	return func(o *copyOptions) {
+		o.progress = f
+	}
+}
+
+// WithCopyResumeToken resumes the copy that fails with the resume token, i.e. it copies the pairs of the range after
+// the ones already copied.
+func WithCopyResumeToken(token string) CopyOption {
+	return func(o *copyOptions) {
+		o.resumeToken = token
+	}
+}
+
+// WithCopyVerify compares the checksums of the range copied in both clusters after the copy, and returns
+// ErrChecksumMismatch if they differ. The range must not be written during the copy, and its pairs must not expire,
+// otherwise the checksums differ.
+func WithCopyVerify() CopyOption {
+	return func(o *copyOptions) {
+		o.verify = true
+	}
+}
+
+// WithCopyRawOptions sets the RawOptions of the reads and the writes, e.g. SetColumnFamily.
+func WithCopyRawOptions(options ...RawOption) CopyOption {
+	return func(o *copyOptions) {
+		o.rawOptions = append(o.rawOptions, options...)
+	}
+}
+
+// CopyRange copies the pairs in range [startKey, endKey) from src to dst, e.g. to migrate a prefix to another
+// cluster. If endKey is empty, it means unbounded. The pairs are read from src with an Iterator, and written to dst
+// by Ingest, so the batches are written in parallel and retried on region errors. The pairs of the range in dst
+// that don't exist in src are kept. If the copy fails, the stats tell where to resume it.
+func CopyRange(ctx context.Context, src, dst *Client, startKey, endKey []byte, options ...CopyOption) (_ CopyStats, err error) {
+	ctx, span := dst.startSpan(ctx, "rawkv.CopyRange")
+	defer func() { endSpan(span, err) }()
+	o := copyOptions{concurrency: dst.batchConcurrency()}
+	for _, option := range options {
+		option(&o)
+	}
+	if o.resumeToken != "" {
+		cursor, err := ParseCursor(o.resumeToken)
+		if err != nil {
+			return CopyStats{}, err
+		}
+		if !bytes.Equal(cursor.endKey, endKey) {
+			return CopyStats{}, errors.New("the resume token is not of the range to copy")
+		}
+		startKey = cursor.startKey
+	}
+
+	it, err := src.Iter(ctx, startKey, endKey, copyPageSize, o.rawOptions...)
+	if err != nil {
+		return CopyStats{}, err
+	}
+	defer it.Close()
+	var (
+		stats    CopyStats
+		nextKey  = startKey
+		progress = func(p IngestProgress) {
+			stats.Keys, stats.Bytes = p.Keys, p.Bytes
+			nextKey = append(append([]byte{}, p.CurrentKey...), 0)
+			if o.progress != nil {
+				o.progress(stats)
+			}
+		}
+	)
+	copyIter := &copyIterator{ctx: ctx, src: src, it: it, withTTL: o.withTTL, options: o.rawOptions}
+	var iter KVIterator = copyIter
+	if o.withTTL {
+		iter = ttlCopyIterator{copyIter}
+	}
+	// The progress is called by Ingest before it returns, so stats and nextKey are read after it without a lock.
+	err = dst.Ingest(ctx, iter, WithIngestConcurrency(o.concurrency), WithIngestProgress(progress),
+		WithIngestRawOptions(o.rawOptions...))
+	if err != nil {
+		stats.ResumeToken = NewCursor(nextKey, endKey).String()
+		return stats, err
+	}
+
+	if o.verify {
+		srcChecksum, err := src.Checksum(ctx, startKey, endKey, o.rawOptions...)
+		if err != nil {
+			return stats, err
+		}
+		dstChecksum, err := dst.Checksum(ctx, startKey, endKey, o.rawOptions...)
+		if err != nil {
+			return stats, err
+		}
+		if srcChecksum != dstChecksum {
+			return stats, errors.Wrapf(ErrChecksumMismatch, "source %+v, destination %+v", srcChecksum, dstChecksum)
+		}
+	}
+	return stats, nil
+}
+
+// copyIterator reads the pairs of the source of CopyRange page by page, and the TTLs of each page if withTTL is set.
+type copyIterator struct {
+	ctx     context.Context
+	src     *Client
+	it      *Iterator
+	withTTL bool
+	options []RawOption
+
+	pairs []KvPair
+	ttls  []*uint64
+	idx   int
+	err   error
+}
+
+func (it *copyIterator) Next() bool {
+	it.idx++
+	if it.idx < len(it.pairs) {
+		return true
+	}
+	if it.err != nil {
+		return false
+	}
+	for {
+		// The pairs are written after Next, so a new page is read into new slices.
+		it.pairs, it.ttls, it.idx = nil, nil, 0
+		for len(it.pairs) < copyPageSize && it.it.Next() {
+			it.pairs = append(it.pairs, KvPair{Key: it.it.Key(), Value: it.it.Value()})
+		}
+		if it.err = it.it.Error(); it.err != nil || len(it.pairs) == 0 {
+			return false
+		}
+		if !it.withTTL {
+			return true
+		}
+		keys := make([][]byte, len(it.pairs))
+		for i, pair := range it.pairs {
+			keys[i] = pair.Key
+		}
+		ttls, err := it.src.BatchGetKeyTTL(it.ctx, keys, it.options...)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		// A pair without a TTL has expired or been deleted since it's read, so it's skipped rather than written
+		// without a TTL.
+		pairs := it.pairs[:0]
+		for i, pair := range it.pairs {
+			if ttls[i] != nil {
+				pairs = append(pairs, pair)
+				it.ttls = append(it.ttls, ttls[i])
+			}
+		}
+		if it.pairs = pairs; len(it.pairs) > 0 {
+			return true
+		}
+	}
+}
+
+func (it *copyIterator) Key() []byte {
+	return it.pairs[it.idx].Key
+}
+
+func (it *copyIterator) Value() []byte {
+	return it.pairs[it.idx].Value
+}
+
+func (it *copyIterator) Error() error {
+	return it.err
+}
+
+// ttlCopyIterator is a copyIterator with TTL, which makes Ingest write the pairs with their TTLs.
+type ttlCopyIterator struct {
+	*copyIterator
+}
+
+func (it ttlCopyIterator) TTL() uint64 {
+	return *it.ttls[it.idx]
+}
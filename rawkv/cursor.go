@@ -0,0 +1,117 @@
+// Copyright 2021 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rawkv
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// cursorVersion is the first byte of an encoded Cursor. Bump it when the encoding changes.
+const cursorVersion byte = 1
+
+// ErrInvalidCursor is returned when a string can't be parsed as a Cursor.
+var ErrInvalidCursor = errors.New("invalid scan cursor")
+
+// Cursor marks where the next page of a ScanPage starts.
+// It carries the whole remaining range, so a page can be resumed from the cursor alone.
+type Cursor struct {
+	// startKey is inclusive.
+	startKey []byte
+	// endKey is exclusive, and empty means unbounded.
+	endKey []byte
+}
+
+// NewCursor creates a cursor of range [startKey, endKey), where an empty endKey means unbounded.
+// It's for the implementations of RawKV other than Client, which return the cursors of their pages.
+func NewCursor(startKey, endKey []byte) *Cursor {
+	return &Cursor{startKey: startKey, endKey: endKey}
+}
+
+// Range returns the remaining range [startKey, endKey) of the cursor.
+func (c *Cursor) Range() (startKey, endKey []byte) {
+	return c.startKey, c.endKey
+}
+
+// String encodes the cursor into an opaque, URL-safe token which can be parsed by ParseCursor.
+func (c *Cursor) String() string {
+	buf := make([]byte, 1+binary.MaxVarintLen64, 1+binary.MaxVarintLen64+len(c.startKey)+len(c.endKey))
+	buf[0] = cursorVersion
+	n := binary.PutUvarint(buf[1:], uint64(len(c.startKey)))
+	buf = append(buf[:1+n], c.startKey...)
+	buf = append(buf, c.endKey...)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// ParseCursor decodes a token produced by Cursor.String.
+func ParseCursor(token string) (*Cursor, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(buf) == 0 || buf[0] != cursorVersion {
+		return nil, errors.WithStack(ErrInvalidCursor)
+	}
+	buf = buf[1:]
+	n, size := binary.Uvarint(buf)
+	if size <= 0 || n > uint64(len(buf)-size) {
+		return nil, errors.WithStack(ErrInvalidCursor)
+	}
+	buf = buf[size:]
+	return &Cursor{startKey: buf[:n:n], endKey: buf[n:]}, nil
+}
+
+// ScanPage queries a page of up to limit kv pairs in range [startKey, endKey), in lexicographical order.
+// If endKey is empty, it means unbounded.
+// The returned cursor points right after the last returned key and can be passed to ScanNextPage for
+// the next page. It is nil when there are no more pairs in the range.
+func (c *Client) ScanPage(ctx context.Context, startKey, endKey []byte, limit int, options ...RawOption) (_ []KvPair, _ *Cursor, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.ScanPage")
+	defer func() { endSpan(span, err) }()
+	if limit > c.scanLimit() {
+		return nil, nil, errors.WithStack(ErrMaxScanLimitExceeded)
+	}
+	if limit <= 0 {
+		return nil, nil, nil
+	}
+	opts := c.getRawKVOptions(options...)
+	defer func() { c.observeBreakdown(ctx, "scan_page", opts, err) }()
+	// Scan one more pair than needed to tell whether there is a next page.
+	keys, values, err := c.scan(ctx, startKey, endKey, limit+1, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	var next *Cursor
+	if len(keys) > limit {
+		next = &Cursor{startKey: keys[limit], endKey: endKey}
+		keys, values = keys[:limit], values[:limit]
+	}
+	pairs := make([]KvPair, 0, len(keys))
+	for i := range keys {
+		pairs = append(pairs, KvPair{Key: keys[i], Value: values[i]})
+	}
+	return pairs, next, nil
+}
+
+// ScanNextPage queries the page that the cursor points to. See ScanPage for details.
+func (c *Client) ScanNextPage(ctx context.Context, cursor *Cursor, limit int, options ...RawOption) (_ []KvPair, _ *Cursor, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.ScanNextPage")
+	defer func() { endSpan(span, err) }()
+	if cursor == nil || (len(cursor.endKey) > 0 && bytes.Compare(cursor.startKey, cursor.endKey) >= 0) {
+		return nil, nil, nil
+	}
+	return c.ScanPage(ctx, cursor.startKey, cursor.endKey, limit, options...)
+}
@@ -0,0 +1,177 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rawkv
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tikv/client-go/v2/internal/locate"
+	"github.com/tikv/client-go/v2/internal/retry"
+	"github.com/tikv/client-go/v2/tikvrpc"
+)
+
+// maxDebugErrorLen is the max length of the errors kept by the debug recorder.
+const maxDebugErrorLen = 256
+
+// DebugRecord is a request recorded by the debug recorder set by WithDebugRecorder. It keeps no values, and the keys
+// are shown as in the slow log, see WithSlowLogKeyRedaction.
+type DebugRecord struct {
+	// Time is when the request is sent.
+	Time time.Time `json:"time"`
+	Cmd  string    `json:"cmd"`
+	// StartKey is the key, the first key or the start key of the request, and EndKey is the end key of a range.
+	StartKey string `json:"startKey,omitempty"`
+	EndKey   string `json:"endKey,omitempty"`
+	// KeyCount is the number of the keys, the pairs or the ranges of a batch request.
+	KeyCount int    `json:"keyCount,omitempty"`
+	Region   uint64 `json:"region"`
+	Store    string `json:"store,omitempty"`
+	// Latency is the time until the request returns, including the backoffs and the retries of the region request
+	// sender.
+	Latency time.Duration `json:"latency"`
+	// Outcome is one of "ok", "region_error", "server_error" and "error", and Error is the kind of the region error
+	// or the error message.
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+	// Retries is the number of the backoffs of the request.
+	Retries int `json:"retries"`
+}
+
+// debugRing keeps the last records of a command. The rings of the commands have their own locks, so the requests of
+// different commands don't contend.
+type debugRing struct {
+	mu      sync.Mutex
+	records []DebugRecord
+	next    int
+}
+
+// debugRecorder keeps the last requests of each command. All its methods do nothing if it's nil.
+type debugRecorder struct {
+	rings [len(statsCmds)]debugRing
+}
+
+func newDebugRecorder(n int) *debugRecorder {
+	if n <= 0 {
+		return nil
+	}
+	r := &debugRecorder{}
+	for i := range r.rings {
+		r.rings[i].records = make([]DebugRecord, 0, n)
+	}
+	return r
+}
+
+// debugRequest is a request being recorded.
+type debugRequest struct {
+	start    time.Time
+	backoffs int
+}
+
+// begin starts recording a request sent with bo.
+func (r *debugRecorder) begin(bo *retry.Backoffer) debugRequest {
+	if r == nil {
+		return debugRequest{}
+	}
+	return debugRequest{start: time.Now(), backoffs: bo.GetTotalBackoffTimes()}
+}
+
+// record records req sent to the region by sender with bo, which returns resp and err. redaction is how the keys are
+// shown.
+func (r *debugRecorder) record(start debugRequest, bo *retry.Backoffer, sender *locate.RegionRequestSender, req *tikvrpc.Request, regionID locate.RegionVerID, resp *tikvrpc.Response, err error, redaction KeyRedaction) {
+	if r == nil {
+		return
+	}
+	ring := r.ring(req.Type)
+	if ring == nil {
+		return
+	}
+	rec := DebugRecord{
+		Time:    start.start,
+		Cmd:     req.Type.String(),
+		Region:  regionID.GetID(),
+		Store:   sender.GetStoreAddr(),
+		Latency: time.Since(start.start),
+		Outcome: "ok",
+		Retries: bo.GetTotalBackoffTimes() - start.backoffs,
+	}
+	startKey, endKey, count := requestKeys(req)
+	if startKey != nil {
+		rec.StartKey = redaction.redact(startKey)
+	}
+	if endKey != nil {
+		rec.EndKey = redaction.redact(endKey)
+	}
+	rec.KeyCount = count
+	switch {
+	case err != nil:
+		rec.Outcome, rec.Error = "error", truncateDebugError(err.Error())
+	case resp == nil:
+	default:
+		if regionErr, _ := resp.GetRegionError(); regionErr != nil {
+			rec.Outcome, rec.Error = "region_error", locate.RegionErrorToLabel(regionErr)
+		} else if m, ok := resp.Resp.(interface{ GetError() string }); ok && m.GetError() != "" {
+			rec.Outcome, rec.Error = "server_error", truncateDebugError(m.GetError())
+		}
+	}
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+	if len(ring.records) < cap(ring.records) {
+		ring.records = append(ring.records, rec)
+		return
+	}
+	ring.records[ring.next] = rec
+	ring.next = (ring.next + 1) % len(ring.records)
+}
+
+func truncateDebugError(msg string) string {
+	if len(msg) > maxDebugErrorLen {
+		return msg[:maxDebugErrorLen] + "..."
+	}
+	return msg
+}
+
+func (r *debugRecorder) ring(cmd tikvrpc.CmdType) *debugRing {
+	for i, c := range statsCmds {
+		if c == cmd {
+			return &r.rings[i]
+		}
+	}
+	return nil
+}
+
+// dump returns the records of all the commands, ordered by time.
+func (r *debugRecorder) dump() []DebugRecord {
+	if r == nil {
+		return nil
+	}
+	var records []DebugRecord
+	for i := range r.rings {
+		ring := &r.rings[i]
+		ring.mu.Lock()
+		records = append(records, ring.records[ring.next:]...)
+		records = append(records, ring.records[:ring.next]...)
+		ring.mu.Unlock()
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records
+}
+
+// DebugDump returns the requests recorded by the debug recorder set by WithDebugRecorder, ordered by the time they
+// are sent, or nil if the recorder isn't set. The records can be serialized to JSON.
+func (c *Client) DebugDump() []DebugRecord {
+	return c.debugRecorder.dump()
+}
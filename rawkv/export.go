@@ -0,0 +1,583 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rawkv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The export format written by Export and read by ExportReader is:
+//
+//	header:  the magic "TIKVRAWX" (8 bytes), the version (1 byte, currently 2), the time the export starts in
+//	         Unix seconds (8 bytes, big endian)
+//	record:  1 (1 byte), the length of the key (uvarint), the key, the length of the value (uvarint), the value,
+//	         the TTL in seconds (uvarint, 0 for none)
+//	time:    2 (1 byte), the time the TTLs of the records after it are read in Unix seconds (8 bytes, big endian)
+//	trailer: 0 (1 byte), the number of the records (uvarint), the CRC-32C of all the bytes before it (4 bytes,
+//	         big endian)
+//
+// The records are in ascending order of the keys. A time precedes every page of the records whose TTLs are
+// exported, and the TTLs of the records before the first time are relative to the export time in the header.
+// Version 1 is the same without the export time in the header or the times, and is still read.
+const (
+	exportMagic = "TIKVRAWX"
+	// exportVersion 2 adds the export time to the header of version 1, and the times.
+	exportVersion = 2
+
+	exportTrailerFlag = 0
+	exportRecordFlag  = 1
+	exportTimeFlag    = 2
+
+	// exportPageSize is the number of the pairs scanned by a request of Export.
+	exportPageSize = 1024
+	// maxExportFieldSize is the max length of a key or value read by ExportReader, beyond which the export is
+	// considered corrupted.
+	maxExportFieldSize = 1 << 30
+)
+
+var exportCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrInvalidExport is returned by ExportReader when the export is corrupted or in an unknown format.
+var ErrInvalidExport = errors.New("invalid export")
+
+// ExportStats are the statistics of Export.
+type ExportStats struct {
+	// Keys and Bytes are the number and the size of the pairs exported.
+	Keys  int64
+	Bytes int64
+	// Checksum is the CRC-32C in the trailer of the export, 0 if the export fails.
+	Checksum uint32
+	// ResumeToken is set if the export fails. The pairs before it are written to the io.Writer, and an export with
+	// WithExportResumeToken writes the rest.
+	ResumeToken string
+}
+
+type exportOptions struct {
+	concurrency int
+	withTTL     bool
+	resumeToken string
+	rawOptions  []RawOption
+}
+
+// ExportOption is an option of Export.
+type ExportOption func(*exportOptions)
+
+// WithExportConcurrency sets the max number of the regions scanned at the same time, 8 by default.
+func WithExportConcurrency(n int) ExportOption {
+	return func(o *exportOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithExportTTL exports the TTLs of the pairs, which costs a GetKeyTTL request for every pair, sent concurrently by
+// BatchGetKeyTTL for every page. The pairs that expire after they are read are skipped. Otherwise the TTLs of the
+// records are 0.
+func WithExportTTL() ExportOption {
+	return func(o *exportOptions) {
+		o.withTTL = true
+	}
+}
+
+// WithExportResumeToken resumes the export that fails with the resume token, i.e. it exports the pairs of the range
+// after the ones already written. The rest of the pairs are written as a new export.
+func WithExportResumeToken(token string) ExportOption {
+	return func(o *exportOptions) {
+		o.resumeToken = token
+	}
+}
+
+// WithExportRawOptions sets the RawOptions of the scans, e.g. SetColumnFamily.
+func WithExportRawOptions(options ...RawOption) ExportOption {
+	return func(o *exportOptions) {
+		o.rawOptions = append(o.rawOptions, options...)
+	}
+}
+
+// exportPage is a page of the pairs of a region, or the error of scanning it.
+type exportPage struct {
+	pairs []KvPair
+	ttls  []*uint64
+	// ttlTime is the time the TTLs are read.
+	ttlTime time.Time
+	err     error
+}
+
+// Export writes the pairs in range [startKey, endKey) to w in the export format, see ExportReader. If endKey is
+// empty, it means unbounded. The regions of the range are scanned in parallel and written in key order. The
+// records are flushed to w page by page, and if the export fails, the stats tell where to resume it.
+func (c *Client) Export(ctx context.Context, startKey, endKey []byte, w io.Writer, options ...ExportOption) (_ ExportStats, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Export")
+	defer func() { endSpan(span, err) }()
+	o := exportOptions{concurrency: defaultRangeConcurrency}
+	for _, option := range options {
+		option(&o)
+	}
+	if o.concurrency <= 0 {
+		return ExportStats{}, errors.Errorf("invalid export concurrency %d", o.concurrency)
+	}
+	if o.resumeToken != "" {
+		cursor, err := ParseCursor(o.resumeToken)
+		if err != nil {
+			return ExportStats{}, err
+		}
+		if !bytes.Equal(cursor.endKey, endKey) {
+			return ExportStats{}, errors.New("the resume token is not of the range to export")
+		}
+		startKey = cursor.startKey
+	}
+
+	opts := c.getRawKVOptions(o.rawOptions...)
+	ranges, err := c.splitRangeByRegion(c.newBackoffer(ctx, opts), startKey, endKey)
+	if err != nil {
+		return ExportStats{ResumeToken: NewCursor(startKey, endKey).String()}, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+	pageChs := make([]chan exportPage, len(ranges))
+	for i := range pageChs {
+		pageChs[i] = make(chan exportPage, 1)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// The regions are scanned in key order, so the region being written always has a slot.
+		slots := make(chan struct{}, o.concurrency)
+		for i, r := range ranges {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			wg.Add(1)
+			go func(r scanRange, pageCh chan<- exportPage) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				c.scanExportRange(ctx, r, o, pageCh)
+			}(r, pageChs[i])
+		}
+	}()
+
+	ew := newExportWriter(w)
+	var stats ExportStats
+	resume := func(err error) (ExportStats, error) {
+		stats.ResumeToken = NewCursor(ew.nextKey(startKey), endKey).String()
+		return stats, err
+	}
+	if err := ew.writeHeader(time.Now()); err != nil {
+		return resume(err)
+	}
+	for i := range ranges {
+		for {
+			var (
+				page exportPage
+				ok   bool
+			)
+			select {
+			case page, ok = <-pageChs[i]:
+			case <-ctx.Done():
+				return resume(errors.WithStack(ctx.Err()))
+			}
+			if !ok {
+				break
+			}
+			if page.err != nil {
+				return resume(page.err)
+			}
+			if page.ttls != nil {
+				ew.writeTime(page.ttlTime)
+			}
+			for j, pair := range page.pairs {
+				var ttl uint64
+				if page.ttls != nil {
+					// A pair without a TTL has expired or been deleted since it's read, so it's skipped rather
+					// than exported without a TTL.
+					if page.ttls[j] == nil {
+						continue
+					}
+					ttl = *page.ttls[j]
+				}
+				ew.writeRecord(pair.Key, pair.Value, ttl)
+			}
+			// The page is flushed, so the export can be resumed after it.
+			if err := ew.flush(); err != nil {
+				return resume(err)
+			}
+			stats.Keys, stats.Bytes = ew.keys, ew.bytes
+		}
+	}
+	// A scan stops without an error only if ctx is done.
+	if err := ctx.Err(); err != nil {
+		return resume(errors.WithStack(err))
+	}
+	checksum, err := ew.writeTrailer()
+	if err != nil {
+		return resume(err)
+	}
+	stats.Checksum = checksum
+	return stats, nil
+}
+
+// scanExportRange scans the range page by page to pageCh, which is closed after the last page or the error.
+func (c *Client) scanExportRange(ctx context.Context, r scanRange, o exportOptions, pageCh chan<- exportPage) {
+	defer close(pageCh)
+	cursor := NewCursor(r.startKey, r.endKey)
+	for cursor != nil {
+		var page exportPage
+		page.pairs, cursor, page.err = c.ScanNextPage(ctx, cursor, exportPageSize, o.rawOptions...)
+		if page.err == nil && o.withTTL && len(page.pairs) > 0 {
+			keys := make([][]byte, len(page.pairs))
+			for i, pair := range page.pairs {
+				keys[i] = pair.Key
+			}
+			page.ttlTime = time.Now()
+			page.ttls, page.err = c.BatchGetKeyTTL(ctx, keys, o.rawOptions...)
+		}
+		select {
+		case pageCh <- page:
+		case <-ctx.Done():
+			return
+		}
+		if page.err != nil {
+			return
+		}
+	}
+}
+
+// exportWriter writes the export format and computes the checksum.
+type exportWriter struct {
+	w       io.Writer
+	buf     *bufio.Writer
+	crc     hash.Hash32
+	scratch [binary.MaxVarintLen64]byte
+	err     error
+
+	keys    int64
+	bytes   int64
+	lastKey []byte
+	// flushedKey is the last key flushed to w.
+	flushedKey []byte
+}
+
+func newExportWriter(w io.Writer) *exportWriter {
+	crc := crc32.New(exportCRCTable)
+	return &exportWriter{w: w, buf: bufio.NewWriter(io.MultiWriter(w, crc)), crc: crc}
+}
+
+func (w *exportWriter) write(p []byte) {
+	if w.err == nil {
+		_, w.err = w.buf.Write(p)
+	}
+}
+
+func (w *exportWriter) writeUvarint(n uint64) {
+	w.write(w.scratch[:binary.PutUvarint(w.scratch[:], n)])
+}
+
+func (w *exportWriter) writeHeader(exportTime time.Time) error {
+	w.write([]byte(exportMagic))
+	w.write([]byte{exportVersion})
+	w.writeUnixTime(exportTime)
+	return w.flush()
+}
+
+// writeTime writes the time the TTLs of the records after it are read.
+func (w *exportWriter) writeTime(t time.Time) {
+	w.write([]byte{exportTimeFlag})
+	w.writeUnixTime(t)
+}
+
+func (w *exportWriter) writeUnixTime(t time.Time) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(t.Unix()))
+	w.write(buf[:])
+}
+
+func (w *exportWriter) writeRecord(key, value []byte, ttl uint64) {
+	w.write([]byte{exportRecordFlag})
+	w.writeUvarint(uint64(len(key)))
+	w.write(key)
+	w.writeUvarint(uint64(len(value)))
+	w.write(value)
+	w.writeUvarint(ttl)
+	w.keys++
+	w.bytes += int64(len(key) + len(value))
+	w.lastKey = key
+}
+
+// flush flushes the records to the underlying writer, and returns the first error of writing.
+func (w *exportWriter) flush() error {
+	if w.err == nil {
+		w.err = w.buf.Flush()
+	}
+	if w.err != nil {
+		return errors.WithStack(w.err)
+	}
+	w.flushedKey = w.lastKey
+	return nil
+}
+
+// nextKey returns the key right after the last key flushed, or startKey if no key is flushed.
+func (w *exportWriter) nextKey(startKey []byte) []byte {
+	if w.flushedKey == nil {
+		return startKey
+	}
+	return append(append([]byte{}, w.flushedKey...), 0)
+}
+
+func (w *exportWriter) writeTrailer() (uint32, error) {
+	w.write([]byte{exportTrailerFlag})
+	w.writeUvarint(uint64(w.keys))
+	if err := w.flush(); err != nil {
+		return 0, err
+	}
+	checksum := w.crc.Sum32()
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], checksum)
+	if _, err := w.w.Write(buf[:]); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return checksum, nil
+}
+
+// ExportReader reads the pairs written by Export, and checks the trailer after the last pair. It implements
+// KVIterator, so an export can be restored by Ingest.
+//
+// Usage:
+//
+//	r, err := rawkv.NewExportReader(f)
+//	if err != nil { ... }
+//	for r.Next() {
+//		use(r.Key(), r.Value(), r.TTL())
+//	}
+//	if err := r.Error(); err != nil { ... }
+type ExportReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+
+	version    byte
+	exportTime time.Time
+	// ttlTime is the time the TTLs of the current page are read.
+	ttlTime time.Time
+	// offset is the number of the bytes read.
+	offset int64
+
+	key   []byte
+	value []byte
+	ttl   uint64
+	count uint64
+	done  bool
+	err   error
+}
+
+// NewExportReader reads the header of the export from r.
+func NewExportReader(r io.Reader) (*ExportReader, error) {
+	er := &ExportReader{r: bufio.NewReader(r), crc: crc32.New(exportCRCTable)}
+	header := make([]byte, len(exportMagic)+1)
+	if err := er.readFull(header); err != nil {
+		return nil, errors.WithMessage(err, "the header at offset 0")
+	}
+	if string(header[:len(exportMagic)]) != exportMagic {
+		return nil, errors.Wrap(ErrInvalidExport, "the header at offset 0")
+	}
+	er.version = header[len(exportMagic)]
+	switch er.version {
+	case 1:
+	case exportVersion:
+		t, err := er.readUnixTime()
+		if err != nil {
+			return nil, errors.WithMessage(err, "the header at offset 0")
+		}
+		er.exportTime, er.ttlTime = t, t
+	default:
+		return nil, errors.Wrapf(ErrInvalidExport, "unsupported version %d at offset %d", er.version, len(exportMagic))
+	}
+	return er, nil
+}
+
+// ExportTime returns the time the export starts, which is zero for an export of version 1.
+func (r *ExportReader) ExportTime() time.Time {
+	return r.exportTime
+}
+
+// TTLTime returns the time the TTL of the current pair is read, to which the TTL is relative. It's zero if it's
+// unknown, i.e. for an export of version 1.
+func (r *ExportReader) TTLTime() time.Time {
+	return r.ttlTime
+}
+
+// Next moves to the next pair, and returns false after the last pair or if it fails.
+func (r *ExportReader) Next() bool {
+	if r.done || r.err != nil {
+		return false
+	}
+	start := r.offset
+	flag, err := r.readByte()
+	if err != nil {
+		return r.fail("record", start, err)
+	}
+	for flag == exportTimeFlag && r.version >= 2 {
+		if r.ttlTime, err = r.readUnixTime(); err != nil {
+			return r.fail("time", start, err)
+		}
+		start = r.offset
+		if flag, err = r.readByte(); err != nil {
+			return r.fail("record", start, err)
+		}
+	}
+	switch flag {
+	case exportRecordFlag:
+		if r.key, err = r.readField(); err != nil {
+			return r.fail("record", start, err)
+		}
+		if r.value, err = r.readField(); err != nil {
+			return r.fail("record", start, err)
+		}
+		if r.ttl, err = r.readUvarint(); err != nil {
+			return r.fail("record", start, err)
+		}
+		r.count++
+		return true
+	case exportTrailerFlag:
+		r.done = true
+		if err := r.readTrailer(); err != nil {
+			return r.fail("trailer", start, err)
+		}
+		return false
+	}
+	return r.fail("record", start, ErrInvalidExport)
+}
+
+// fail stops the reader with the error of reading the record or trailer at offset start.
+func (r *ExportReader) fail(part string, start int64, err error) bool {
+	r.err = errors.WithMessagef(err, "the %s at offset %d", part, start)
+	return false
+}
+
+// Key returns the key of the current pair.
+func (r *ExportReader) Key() []byte {
+	return r.key
+}
+
+// Value returns the value of the current pair.
+func (r *ExportReader) Value() []byte {
+	return r.value
+}
+
+// TTL returns the TTL of the current pair, 0 for none.
+func (r *ExportReader) TTL() uint64 {
+	return r.ttl
+}
+
+// Error returns the error that stops Next. A truncated export or a mismatched trailer fails with ErrInvalidExport,
+// and the error tells the offset of the record or trailer that fails.
+func (r *ExportReader) Error() error {
+	return r.err
+}
+
+func (r *ExportReader) readTrailer() error {
+	count, err := r.readUvarint()
+	if err != nil {
+		return err
+	}
+	checksum := r.crc.Sum32()
+	var buf [4]byte
+	if _, err := io.ReadFull(r.r, buf[:]); err != nil {
+		return invalidExport(err)
+	}
+	r.offset += int64(len(buf))
+	if count != r.count || binary.BigEndian.Uint32(buf[:]) != checksum {
+		return errors.WithStack(ErrInvalidExport)
+	}
+	return nil
+}
+
+func (r *ExportReader) readUnixTime() (time.Time, error) {
+	var buf [8]byte
+	if err := r.readFull(buf[:]); err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(binary.BigEndian.Uint64(buf[:])), 0), nil
+}
+
+func (r *ExportReader) readField() ([]byte, error) {
+	n, err := r.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > maxExportFieldSize {
+		return nil, errors.WithStack(ErrInvalidExport)
+	}
+	field := make([]byte, n)
+	if err := r.readFull(field); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+// byteReaderFunc adapts a func to io.ByteReader for binary.ReadUvarint.
+type byteReaderFunc func() (byte, error)
+
+func (f byteReaderFunc) ReadByte() (byte, error) {
+	return f()
+}
+
+func (r *ExportReader) readUvarint() (uint64, error) {
+	n, err := binary.ReadUvarint(byteReaderFunc(r.readByte))
+	return n, invalidExport(err)
+}
+
+func (r *ExportReader) readByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err != nil {
+		return 0, invalidExport(err)
+	}
+	r.crc.Write([]byte{b})
+	r.offset++
+	return b, nil
+}
+
+func (r *ExportReader) readFull(p []byte) error {
+	if _, err := io.ReadFull(r.r, p); err != nil {
+		return invalidExport(err)
+	}
+	r.crc.Write(p)
+	r.offset += int64(len(p))
+	return nil
+}
+
+// invalidExport returns ErrInvalidExport if the export ends unexpectedly, or err otherwise.
+func invalidExport(err error) error {
+	if err == nil {
+		return nil
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF || errors.Cause(err) == ErrInvalidExport {
+		return errors.WithStack(ErrInvalidExport)
+	}
+	return errors.WithStack(err)
+}
@@ -0,0 +1,243 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rawkv
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ImportStats are the statistics of Import.
+type ImportStats struct {
+	// Keys and Bytes are the number and the size of the pairs written.
+	Keys  int64
+	Bytes int64
+	// Skipped is the number of the pairs not written as their keys exist, see WithImportSkipExisting.
+	Skipped int64
+	// Expired is the number of the pairs not written as they have expired, see ImportTTLPreserveExpiry.
+	Expired int64
+}
+
+// ImportTTLMode is how Import applies the TTLs recorded in the export.
+type ImportTTLMode int
+
+const (
+	// ImportTTLReapply writes the pairs with the TTLs recorded, so they expire the TTLs after they are imported.
+	ImportTTLReapply ImportTTLMode = iota
+	// ImportTTLPreserveExpiry writes the pairs with the TTLs left since they are read by the export, so they expire
+	// when they would in the exported cluster. The pairs that have expired are skipped. The TTLs of an export of
+	// version 1, which doesn't record when they are read, are reapplied.
+	ImportTTLPreserveExpiry
+)
+
+type importOptions struct {
+	concurrency  int
+	skipExisting bool
+	ttlMode      ImportTTLMode
+	rawOptions   []RawOption
+}
+
+// ImportOption is an option of Import.
+type ImportOption func(*importOptions)
+
+// WithImportConcurrency sets the max number of the batches written at the same time, instead of the batch
+// concurrency of the client.
+func WithImportConcurrency(n int) ImportOption {
+	return func(o *importOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithImportSkipExisting writes the pairs by PutIfAbsent, so the keys that exist keep their values. The pairs of a
+// batch are written by BatchCompareAndSwap, which costs an RPC per pair, though the RPCs are sent concurrently. Like
+// PutIfAbsent, it requires SetAtomicForCAS(true), otherwise ErrAtomicModeRequired is returned.
+func WithImportSkipExisting() ImportOption {
+	return func(o *importOptions) {
+		o.skipExisting = true
+	}
+}
+
+// WithImportTTLMode sets how the TTLs recorded in the export are applied, ImportTTLReapply by default.
+func WithImportTTLMode(mode ImportTTLMode) ImportOption {
+	return func(o *importOptions) {
+		o.ttlMode = mode
+	}
+}
+
+// WithImportRawOptions sets the RawOptions of the writes, e.g. SetColumnFamily.
+func WithImportRawOptions(options ...RawOption) ImportOption {
+	return func(o *importOptions) {
+		o.rawOptions = append(o.rawOptions, options...)
+	}
+}
+
+// importBatch is a batch of the records to write.
+type importBatch struct {
+	keys, values [][]byte
+	ttls         []uint64
+	size         int
+	withTTL      bool
+}
+
+// Import writes the pairs of an export written by Export, which is read from r, to TiKV. The records are written in
+// batches like BatchPutWithTTL, which are written in parallel. The export is checked as it's read, and the
+// malformed input fails with ErrInvalidExport telling its offset, see ExportReader. As the checksum is in the
+// trailer, the records before the malformed input may be written. It returns the first error, with the stats of
+// the pairs known to be written before it.
+func (c *Client) Import(ctx context.Context, r io.Reader, options ...ImportOption) (_ ImportStats, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Import")
+	defer func() { endSpan(span, err) }()
+	o := importOptions{concurrency: c.batchConcurrency()}
+	for _, option := range options {
+		option(&o)
+	}
+	if o.concurrency <= 0 {
+		return ImportStats{}, errors.Errorf("invalid import concurrency %d", o.concurrency)
+	}
+	if o.skipExisting && !c.atomic {
+		return ImportStats{}, errors.WithStack(ErrAtomicModeRequired)
+	}
+	er, err := NewExportReader(r)
+	if err != nil {
+		return ImportStats{}, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		stats    ImportStats
+		firstErr error
+	)
+	batchCh := make(chan importBatch)
+	for i := 0; i < o.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batchCh {
+				written, err := c.writeImportBatch(ctx, batch, o)
+				mu.Lock()
+				stats.Keys += int64(len(written))
+				for _, i := range written {
+					stats.Bytes += int64(len(batch.keys[i]) + len(batch.values[i]))
+				}
+				if o.skipExisting && err == nil {
+					stats.Skipped += int64(len(batch.keys) - len(written))
+				}
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	expired, err := c.fillImportBatches(ctx, er, o, batchCh)
+	close(batchCh)
+	wg.Wait()
+	stats.Expired = expired
+	if err != nil && errors.Cause(err) != context.Canceled {
+		return stats, err
+	}
+	if firstErr != nil {
+		return stats, firstErr
+	}
+	return stats, err
+}
+
+// fillImportBatches reads the records of er into batches up to the size and count limits of the batches, and sends
+// them to batchCh. It returns the number of the records skipped as they have expired.
+func (c *Client) fillImportBatches(ctx context.Context, er *ExportReader, o importOptions, batchCh chan<- importBatch) (int64, error) {
+	var (
+		batch   importBatch
+		expired int64
+	)
+	send := func() error {
+		select {
+		case batchCh <- batch:
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		}
+		batch = importBatch{}
+		return nil
+	}
+	for er.Next() {
+		key, value, ttl := er.Key(), er.Value(), er.TTL()
+		if ttl > 0 && o.ttlMode == ImportTTLPreserveExpiry && !er.TTLTime().IsZero() {
+			elapsed := uint64(time.Since(er.TTLTime()) / time.Second)
+			if elapsed >= ttl {
+				expired++
+				continue
+			}
+			ttl -= elapsed
+		}
+		if len(batch.keys) > 0 && (len(batch.keys) >= c.batchPairCount() ||
+			batch.size+len(key)+len(value) > c.batchPutSize()) {
+			if err := send(); err != nil {
+				return expired, err
+			}
+		}
+		batch.keys = append(batch.keys, key)
+		batch.values = append(batch.values, value)
+		batch.ttls = append(batch.ttls, ttl)
+		batch.size += len(key) + len(value)
+		batch.withTTL = batch.withTTL || ttl > 0
+	}
+	if err := er.Error(); err != nil {
+		return expired, err
+	}
+	if len(batch.keys) > 0 {
+		return expired, send()
+	}
+	return expired, nil
+}
+
+// writeImportBatch writes the batch, and returns the indexes of the records written. The records not written
+// without an error are skipped as their keys exist.
+func (c *Client) writeImportBatch(ctx context.Context, batch importBatch, o importOptions) ([]int, error) {
+	if o.skipExisting {
+		ops := make([]CASOp, len(batch.keys))
+		for i, key := range batch.keys {
+			ops[i] = CASOp{Key: key, New: batch.values[i], TTL: batch.ttls[i]}
+		}
+		results, err := c.BatchCompareAndSwap(ctx, ops, o.rawOptions...)
+		var written []int
+		for i, result := range results {
+			if result.Succeed {
+				written = append(written, i)
+			}
+		}
+		return written, err
+	}
+
+	ttls := batch.ttls
+	if !batch.withTTL {
+		ttls = nil
+	}
+	if err := c.BatchPutWithTTL(ctx, batch.keys, batch.values, ttls, o.rawOptions...); err != nil {
+		return nil, err
+	}
+	written := make([]int, len(batch.keys))
+	for i := range written {
+		written[i] = i
+	}
+	return written, nil
+}
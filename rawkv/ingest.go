@@ -0,0 +1,260 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rawkv
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/tikv/client-go/v2/internal/kvrpc"
+	"github.com/tikv/client-go/v2/internal/locate"
+	"github.com/tikv/client-go/v2/tikvrpc"
+)
+
+// KVIterator is a stream of kv pairs in ascending order of the keys, which is consumed by Ingest. Iterator
+// implements it, so the pairs of a range can be copied from another cluster. If it also has a method TTL() uint64,
+// like ExportReader, the pairs are written with the TTLs it returns, 0 for none.
+type KVIterator interface {
+	// Next moves to the next pair, and returns false if there are no more pairs or it fails.
+	Next() bool
+	Key() []byte
+	Value() []byte
+	// Error returns the error that stops Next, if any.
+	Error() error
+}
+
+// IngestProgress is the progress of Ingest.
+type IngestProgress struct {
+	// Keys and Bytes are the number and the size of the pairs written.
+	Keys  int64
+	Bytes int64
+	// CurrentKey is the last key written, and all the pairs before it are written too, so an interrupted ingest can
+	// be resumed after it.
+	CurrentKey []byte
+}
+
+type ingestOptions struct {
+	concurrency int
+	progress    func(IngestProgress)
+	rawOptions  []RawOption
+}
+
+// IngestOption is an option of Ingest.
+type IngestOption func(*ingestOptions)
+
+// WithIngestConcurrency sets the max number of the batches written at the same time, instead of the batch
+// concurrency of the client.
+func WithIngestConcurrency(n int) IngestOption {
+	return func(o *ingestOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithIngestProgress calls f with the progress whenever it advances. The calls are serialized, and they hold up the
+// writes, so f should return soon.
+func WithIngestProgress(f func(IngestProgress)) IngestOption {
+	return func(o *ingestOptions) {
+		o.progress = f
+	}
+}
+
+// WithIngestRawOptions sets the RawOptions of the writes, e.g. WithTTL or SetColumnFamily.
+func WithIngestRawOptions(options ...RawOption) IngestOption {
+	return func(o *ingestOptions) {
+		o.rawOptions = append(o.rawOptions, options...)
+	}
+}
+
+// ingestBatch is a batch of pairs to a region, and seq is its order in the ingest.
+type ingestBatch struct {
+	kvrpc.Batch
+	seq int
+}
+
+// Ingest writes the pairs of iter, which must be sorted by the keys, to TiKV. Instead of grouping the keys by
+// region like BatchPut, it walks the regions in key order and fills each batch with the pairs of a region up to the
+// size and count limits of the batches, which are written in parallel. If a region has changed since its batch was
+// filled, e.g. it's split, the pairs of the batch are written to the refreshed regions, and the next batch locates
+// its region again. The slices returned by Key and Value must not be modified after Next, as they are written
+// later. It returns the first error, in which case some of the pairs may not be written, see WithIngestProgress.
+func (c *Client) Ingest(ctx context.Context, iter KVIterator, options ...IngestOption) (err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Ingest")
+	defer func() { endSpan(span, err) }()
+	o := ingestOptions{concurrency: c.batchConcurrency()}
+	for _, option := range options {
+		option(&o)
+	}
+	if o.concurrency <= 0 {
+		return errors.Errorf("invalid ingest concurrency %d", o.concurrency)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+	tracker := newIngestTracker(o.progress)
+	batchCh := make(chan ingestBatch)
+	for i := 0; i < o.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batchCh {
+				if err := c.writeIngestBatch(ctx, batch.Batch, o.rawOptions); err != nil {
+					fail(err)
+					continue
+				}
+				tracker.done(batch)
+			}
+		}()
+	}
+
+	err = c.fillIngestBatches(ctx, iter, o.rawOptions, batchCh)
+	close(batchCh)
+	wg.Wait()
+	if err != nil && errors.Cause(err) != context.Canceled {
+		return err
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	return err
+}
+
+// fillIngestBatches fills the batches of the pairs of iter region by region, and sends them to batchCh.
+func (c *Client) fillIngestBatches(ctx context.Context, iter KVIterator, rawOptions []RawOption, batchCh chan<- ingestBatch) error {
+	opts := c.getRawKVOptions(rawOptions...)
+	ttlIter, withTTL := iter.(interface{ TTL() uint64 })
+	var (
+		loc     *locate.KeyLocation
+		batch   ingestBatch
+		lastKey []byte
+	)
+	send := func() error {
+		select {
+		case batchCh <- batch:
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		}
+		batch = ingestBatch{seq: batch.seq + 1}
+		return nil
+	}
+	for iter.Next() {
+		key, value := iter.Key(), iter.Value()
+		if lastKey != nil && bytes.Compare(key, lastKey) <= 0 {
+			return errors.Errorf("the keys to ingest are not in ascending order, %q is after %q", key, lastKey)
+		}
+		lastKey = key
+		if len(batch.Keys) > 0 && (!loc.Contains(key) || len(batch.Keys) >= c.batchPairCount() ||
+			batch.Size+len(key)+len(value) > c.batchPutSize()) {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+		if len(batch.Keys) == 0 {
+			// Every batch locates its region again, which finds the new regions once a batch meets a split.
+			var err error
+			loc, err = c.regionCache.LocateKey(c.newBackoffer(ctx, opts), key)
+			if err != nil {
+				return err
+			}
+			batch.RegionID = loc.Region
+		}
+		batch.Keys = append(batch.Keys, key)
+		batch.Values = append(batch.Values, value)
+		if withTTL {
+			batch.TTLs = append(batch.TTLs, ttlIter.TTL())
+		}
+		batch.Size += len(key) + len(value)
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if len(batch.Keys) > 0 {
+		return send()
+	}
+	return nil
+}
+
+// writeIngestBatch writes a batch to its region. If the region has changed, the pairs are grouped by the refreshed
+// regions and written again.
+func (c *Client) writeIngestBatch(ctx context.Context, batch kvrpc.Batch, rawOptions []RawOption) error {
+	opts := c.getRawKVOptions(rawOptions...)
+	bo := c.newBackoffer(ctx, opts)
+	result, regionErr := c.doBatchPut(bo, batch, opts)
+	if regionErr == nil {
+		if len(result.Failures) > 0 {
+			return annotateBatchErr(result.Failures[0].Err, batch.RegionID.GetID(), batch.Keys[0])
+		}
+		return nil
+	}
+	opts.breakdown.onBatchRetry(1)
+	if err := c.backoffOnRegionError(bo, tikvrpc.CmdRawBatchPut, batch.RegionID, regionErr, opts); err != nil {
+		return err
+	}
+	return c.sendBatchPut(bo, batch.Keys, batch.Values, batch.TTLs, opts)
+}
+
+// ingestTracker tracks the progress of an ingest. The batches may be written out of order, so the progress only
+// advances when all the batches before are written.
+type ingestTracker struct {
+	progress func(IngestProgress)
+
+	mu      sync.Mutex
+	current IngestProgress
+	next    int
+	written map[int]kvrpc.Batch
+}
+
+func newIngestTracker(progress func(IngestProgress)) *ingestTracker {
+	return &ingestTracker{progress: progress, written: make(map[int]kvrpc.Batch)}
+}
+
+func (t *ingestTracker) done(batch ingestBatch) {
+	if t.progress == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.written[batch.seq] = batch.Batch
+	advanced := false
+	for {
+		b, ok := t.written[t.next]
+		if !ok {
+			break
+		}
+		delete(t.written, t.next)
+		t.next++
+		t.current.Keys += int64(len(b.Keys))
+		t.current.Bytes += int64(b.Size)
+		t.current.CurrentKey = b.Keys[len(b.Keys)-1]
+		advanced = true
+	}
+	if advanced {
+		t.progress(t.current)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rawkv
+
+import (
+	"context"
+)
+
+// RawKV is the key-value API of Client, so that code using it can be tested against another implementation,
+// such as the in-memory one in package rawkv/mock.
+// The methods about the cluster rather than the data, such as CompactRange, RegionCache and GetPDClient, are
+// left out, as are the setters of Client.
+type RawKV interface {
+	// ClusterID returns the TiKV cluster ID.
+	ClusterID() uint64
+	// Close closes the client.
+	Close() error
+
+	Get(ctx context.Context, key []byte, options ...RawOption) ([]byte, error)
+	GetWithTTL(ctx context.Context, key []byte, options ...RawOption) ([]byte, *uint64, error)
+	GetKeyTTL(ctx context.Context, key []byte, options ...RawOption) (*uint64, error)
+	Exists(ctx context.Context, key []byte, options ...RawOption) (bool, error)
+	BatchGet(ctx context.Context, keys [][]byte, options ...RawOption) ([][]byte, error)
+	BatchGetWithExistence(ctx context.Context, keys [][]byte, options ...RawOption) ([][]byte, []bool, error)
+	BatchGetPairs(ctx context.Context, keys [][]byte, options ...RawOption) ([]KvPair, error)
+	BatchGetKeyTTL(ctx context.Context, keys [][]byte, options ...RawOption) ([]*uint64, error)
+	BatchExists(ctx context.Context, keys [][]byte, options ...RawOption) ([]bool, error)
+
+	Put(ctx context.Context, key, value []byte, options ...RawOption) error
+	PutWithTTL(ctx context.Context, key, value []byte, ttl uint64, options ...RawOption) error
+	BatchPut(ctx context.Context, keys, values [][]byte, options ...RawOption) error
+	BatchPutWithTTL(ctx context.Context, keys, values [][]byte, ttls []uint64, options ...RawOption) error
+	BatchPutWithResult(ctx context.Context, keys, values [][]byte, ttls []uint64, options ...RawOption) (*BatchPutResult, error)
+
+	Delete(ctx context.Context, key []byte, options ...RawOption) error
+	BatchDelete(ctx context.Context, keys [][]byte, options ...RawOption) error
+	DeleteRange(ctx context.Context, startKey []byte, endKey []byte, options ...RawOption) error
+	BatchDeleteRange(ctx context.Context, startKey []byte, endKey []byte, options ...RawOption) error
+	DeleteRangeWithDetail(ctx context.Context, startKey []byte, endKey []byte, options ...RawOption) (DeleteRangeResult, error)
+
+	Scan(ctx context.Context, startKey, endKey []byte, limit int, options ...RawOption) ([][]byte, [][]byte, error)
+	ReverseScan(ctx context.Context, startKey, endKey []byte, limit int, options ...RawOption) ([][]byte, [][]byte, error)
+	ScanKeys(ctx context.Context, startKey, endKey []byte, limit int, options ...RawOption) ([][]byte, error)
+	ReverseScanKeys(ctx context.Context, startKey, endKey []byte, limit int, options ...RawOption) ([][]byte, error)
+	PrefixScan(ctx context.Context, prefix []byte, limit int, options ...RawOption) ([][]byte, [][]byte, error)
+	ReversePrefixScan(ctx context.Context, prefix []byte, limit int, options ...RawOption) ([][]byte, [][]byte, error)
+	BatchScan(ctx context.Context, startKeys, endKeys [][]byte, eachLimit int, options ...RawOption) ([][][]byte, [][][]byte, error)
+	ScanPage(ctx context.Context, startKey, endKey []byte, limit int, options ...RawOption) ([]KvPair, *Cursor, error)
+	ScanNextPage(ctx context.Context, cursor *Cursor, limit int, options ...RawOption) ([]KvPair, *Cursor, error)
+	ScanStream(ctx context.Context, startKey, endKey []byte, options ...RawOption) (<-chan KvPair, <-chan error)
+	Iter(ctx context.Context, startKey, endKey []byte, batchSize int, options ...RawOption) (*Iterator, error)
+	ReverseIter(ctx context.Context, startKey, endKey []byte, batchSize int, options ...RawOption) (*Iterator, error)
+	Checksum(ctx context.Context, startKey, endKey []byte, options ...RawOption) (RawChecksum, error)
+	Count(ctx context.Context, startKey, endKey []byte, options ...RawOption) (uint64, error)
+
+	CompareAndSwap(ctx context.Context, key, previousValue, newValue []byte, options ...RawOption) ([]byte, bool, error)
+	BatchCompareAndSwap(ctx context.Context, ops []CASOp, options ...RawOption) ([]CASResult, error)
+	PutIfAbsent(ctx context.Context, key, value []byte, options ...RawOption) ([]byte, bool, error)
+	GetAndPut(ctx context.Context, key, value []byte, options ...RawOption) ([]byte, error)
+	Incr(ctx context.Context, key []byte, delta int64, options ...RawOption) (int64, error)
+	Decr(ctx context.Context, key []byte, delta int64, options ...RawOption) (int64, error)
+	Append(ctx context.Context, key, suffix []byte, maxValueSize int, options ...RawOption) ([]byte, error)
+	UpdateTTL(ctx context.Context, key []byte, ttl uint64, options ...RawOption) (bool, error)
+	Persist(ctx context.Context, key []byte, options ...RawOption) (bool, error)
+}
+
+var _ RawKV = (*Client)(nil)
+
+// CallOptions holds the RawOptions of a call that change its result rather than how it's sent to TiKV.
+// It's for the implementations of RawKV other than Client.
+type CallOptions struct {
+	// ColumnFamily is the column family set by SetColumnFamily, empty for the default one.
+	ColumnFamily string
+	// KeyOnly is set by ScanKeyOnly.
+	KeyOnly bool
+	// CountKeys is set by DeleteRangeCountKeys.
+	CountKeys bool
+	// TTL is set by WithTTL.
+	TTL uint64
+}
+
+// ResolveOptions applies the options and returns the CallOptions they set.
+func ResolveOptions(options ...RawOption) CallOptions {
+	opts := rawOptions{}
+	for _, op := range options {
+		op.apply(&opts)
+	}
+	return CallOptions{
+		ColumnFamily: opts.ColumnFamily,
+		KeyOnly:      opts.KeyOnly,
+		CountKeys:    opts.CountKeys,
+		TTL:          opts.TTL,
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2021 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rawkv
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultIterBatchSize is the number of pairs fetched by one page of an Iterator
+// when the caller doesn't specify a batch size.
+const defaultIterBatchSize = 256
+
+// Iterator walks the kv pairs of a key range page by page.
+// It's created by Client.Iter, Client.ReverseIter or NewIterator, and is not safe for concurrent use.
+//
+// Usage:
+//
+//	it, err := client.Iter(ctx, startKey, endKey, 0)
+//	if err != nil { ... }
+//	defer it.Close()
+//	for it.Next() {
+//		use(it.Key(), it.Value())
+//	}
+//	if err := it.Error(); err != nil { ... }
+type Iterator struct {
+	kv        RawKV
+	ctx       context.Context
+	options   []RawOption
+	batchSize int
+	reverse   bool
+
+	// [startKey, endKey) for a forward iterator or [endKey, startKey) for a reverse
+	// iterator is the range that hasn't been fetched yet.
+	startKey []byte
+	endKey   []byte
+
+	keys      [][]byte
+	values    [][]byte
+	idx       int
+	exhausted bool
+	closed    bool
+	err       error
+	// span is the span of Iter or ReverseIter, which ends when the iterator is closed.
+	span trace.Span
+}
+
+// Iter creates an iterator over the kv pairs in range [startKey, endKey).
+// If endKey is empty, it means unbounded.
+// Each page sent to TiKV fetches at most batchSize pairs; a non-positive batchSize uses a default value.
+// Pages are fetched by Scan, so region splits or merges between pages are handled by re-locating the next key.
+// If the client is traced, the span of Iter lasts until the iterator is closed, and the Scans are its children.
+func (c *Client) Iter(ctx context.Context, startKey, endKey []byte, batchSize int, options ...RawOption) (*Iterator, error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Iter")
+	return c.newIterator(ctx, span, startKey, endKey, batchSize, false, options)
+}
+
+// ReverseIter creates an iterator over the kv pairs in range [endKey, startKey), in reversed order.
+// If startKey or endKey is empty, it means unbounded.
+func (c *Client) ReverseIter(ctx context.Context, startKey, endKey []byte, batchSize int, options ...RawOption) (*Iterator, error) {
+	ctx, span := c.startSpan(ctx, "rawkv.ReverseIter")
+	return c.newIterator(ctx, span, startKey, endKey, batchSize, true, options)
+}
+
+func (c *Client) newIterator(ctx context.Context, span trace.Span, startKey, endKey []byte, batchSize int, reverse bool, options []RawOption) (*Iterator, error) {
+	if batchSize > c.scanLimit() {
+		err := errors.WithStack(ErrMaxScanLimitExceeded)
+		endSpan(span, err)
+		return nil, err
+	}
+	it := NewIterator(ctx, c, startKey, endKey, batchSize, reverse, options...)
+	it.span = span
+	return it, nil
+}
+
+// NewIterator creates an iterator which fetches the pages by the Scan, or ReverseScan if reverse is set, of kv.
+// The range is [startKey, endKey) for a forward iterator or [endKey, startKey) for a reverse one.
+// A non-positive batchSize uses a default value. It's for the implementations of RawKV other than Client,
+// whose Iter is built on their own scans.
+func NewIterator(ctx context.Context, kv RawKV, startKey, endKey []byte, batchSize int, reverse bool, options ...RawOption) *Iterator {
+	if batchSize <= 0 {
+		batchSize = defaultIterBatchSize
+	}
+	return &Iterator{
+		kv:        kv,
+		ctx:       ctx,
+		options:   options,
+		batchSize: batchSize,
+		reverse:   reverse,
+		startKey:  startKey,
+		endKey:    endKey,
+		idx:       -1,
+	}
+}
+
+// Next advances the iterator to the next pair, fetching a new page from TiKV when the current one is used up.
+// It returns false when the range is exhausted, an error occurs or the iterator is closed.
+func (it *Iterator) Next() bool {
+	if it.closed || it.err != nil {
+		return false
+	}
+	it.idx++
+	for it.idx >= len(it.keys) {
+		if it.exhausted {
+			return false
+		}
+		if err := it.fetch(); err != nil {
+			it.err = err
+			return false
+		}
+	}
+	return true
+}
+
+// Key returns the key of the current pair.
+func (it *Iterator) Key() []byte {
+	if it.idx < 0 || it.idx >= len(it.keys) {
+		return nil
+	}
+	return it.keys[it.idx]
+}
+
+// Value returns the value of the current pair.
+func (it *Iterator) Value() []byte {
+	if it.idx < 0 || it.idx >= len(it.values) {
+		return nil
+	}
+	return it.values[it.idx]
+}
+
+// Error returns the error that stopped the iteration, if any.
+func (it *Iterator) Error() error {
+	return it.err
+}
+
+// Close releases the buffered page. Next always returns false after Close.
+func (it *Iterator) Close() {
+	it.closed = true
+	it.keys, it.values = nil, nil
+	if it.span != nil {
+		endSpan(it.span, it.err)
+		it.span = nil
+	}
+}
+
+// fetch loads the next page and moves the unfetched range past it.
+func (it *Iterator) fetch() error {
+	var (
+		keys, values [][]byte
+		err          error
+	)
+	if it.reverse {
+		keys, values, err = it.kv.ReverseScan(it.ctx, it.startKey, it.endKey, it.batchSize, it.options...)
+	} else {
+		keys, values, err = it.kv.Scan(it.ctx, it.startKey, it.endKey, it.batchSize, it.options...)
+	}
+	if err != nil {
+		return err
+	}
+	it.keys, it.values, it.idx = keys, values, 0
+	if len(keys) < it.batchSize {
+		it.exhausted = true
+		return nil
+	}
+	lastKey := keys[len(keys)-1]
+	if it.reverse {
+		// The start key of a reverse scan is exclusive.
+		it.startKey = lastKey
+	} else {
+		it.startKey = append(append(make([]byte, 0, len(lastKey)+1), lastKey...), 0)
+	}
+	return nil
+}
+
+// KvPair is a key-value pair produced by ScanStream.
+type KvPair struct {
+	Key   []byte
+	Value []byte
+}
+
+// ScanStream streams the kv pairs in range [startKey, endKey) through the returned channel as pages
+// arrive from TiKV. If endKey is empty, it means unbounded.
+// The pair channel is buffered for one page, so a slow consumer stops the producer from fetching more
+// pages instead of growing memory. The pair channel is closed when the range is exhausted, an error
+// occurs or ctx is done; then at most one error is sent to the error channel, which is closed afterwards.
+// Cancelling ctx also aborts the in-flight request to TiKV.
+func (c *Client) ScanStream(ctx context.Context, startKey, endKey []byte, options ...RawOption) (<-chan KvPair, <-chan error) {
+	ctx, span := c.startSpan(ctx, "rawkv.ScanStream")
+	it, err := c.Iter(ctx, startKey, endKey, defaultIterBatchSize, options...)
+	return streamIterator(ctx, span, it, err)
+}
+
+// streamIterator sends the pairs of it through the returned channel for ScanStream, or err if it fails to be created.
+// span ends with the error of the stream when the stream ends.
+func streamIterator(ctx context.Context, span trace.Span, it *Iterator, err error) (<-chan KvPair, <-chan error) {
+	pairCh := make(chan KvPair, defaultIterBatchSize)
+	errCh := make(chan error, 1)
+	if err != nil {
+		endSpan(span, err)
+		close(pairCh)
+		errCh <- err
+		close(errCh)
+		return pairCh, errCh
+	}
+	go func() {
+		var err error
+		defer func() { endSpan(span, err) }()
+		defer close(errCh)
+		defer close(pairCh)
+		defer it.Close()
+		for it.Next() {
+			select {
+			case pairCh <- KvPair{Key: it.Key(), Value: it.Value()}:
+			case <-ctx.Done():
+				err = errors.WithStack(ctx.Err())
+				errCh <- err
+				return
+			}
+		}
+		if err = it.Error(); err != nil {
+			errCh <- err
+		}
+	}()
+	return pairCh, errCh
+}
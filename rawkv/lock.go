@@ -0,0 +1,302 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rawkv
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// lockFenceSuffix is appended to the key of a lock to store its fencing counter.
+	lockFenceSuffix = "\x00fence"
+	// lockRetryInterval is the max interval Acquire waits between the attempts to acquire the lock.
+	lockRetryInterval = 100 * time.Millisecond
+)
+
+var (
+	// ErrLockHeld is returned by TryAcquire if the lock is held by another owner.
+	ErrLockHeld = errors.New("the lock is held by another owner")
+	// ErrLockLost is returned if the lock isn't held any more, e.g. it expires and is acquired by another owner.
+	ErrLockLost = errors.New("the lock is lost")
+)
+
+// Lock is a distributed lock on a key, which is held by an owner until it's released or its TTL expires. The value
+// of the key is the fencing token and the owner. The fencing token is taken from a counter stored at the key
+// followed by "\x00fence", which increases every time the lock is acquired, so a resource guarded by the lock can
+// reject the requests of a stale holder with a smaller token. The owners of a lock must be unique, and a Lock must
+// not be copied. It's safe for concurrent use.
+//
+// Usage:
+//
+//	lock, err := rawkv.NewLock(client, []byte("lock"), 10*time.Second, []byte(hostname))
+//	if err != nil { ... }
+//	err = lock.Do(ctx, func(ctx context.Context) error {
+//		return guarded(ctx, lock.Token())
+//	})
+type Lock struct {
+	client   *Client
+	key      []byte
+	fenceKey []byte
+	owner    []byte
+	ttl      time.Duration
+
+	mu sync.Mutex
+	// value is the value of the key written by the holder, which is nil if the lock isn't held.
+	value []byte
+	token uint64
+}
+
+// NewLock creates a lock on key held by owner for ttl at a time, which is rounded up to seconds. The client must be
+// in the atomic mode, see SetAtomicForCAS.
+func NewLock(client *Client, key []byte, ttl time.Duration, owner []byte) (*Lock, error) {
+	if !client.atomic {
+		return nil, errors.WithStack(ErrAtomicModeRequired)
+	}
+	if len(key) == 0 {
+		return nil, errors.New("the key of the lock is empty")
+	}
+	if len(owner) == 0 {
+		return nil, errors.New("the owner of the lock is empty")
+	}
+	if ttl <= 0 {
+		return nil, errors.Errorf("invalid lock ttl %v", ttl)
+	}
+	return &Lock{
+		client:   client,
+		key:      key,
+		fenceKey: append(append([]byte{}, key...), lockFenceSuffix...),
+		owner:    owner,
+		ttl:      (ttl + time.Second - 1) / time.Second * time.Second,
+	}, nil
+}
+
+// Token returns the fencing token of the lock, which is 0 if it isn't held.
+func (l *Lock) Token() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.token
+}
+
+// Acquire acquires the lock, and waits until the lock is released or expires if it's held by another owner. It
+// returns the error of ctx if ctx is done first.
+func (l *Lock) Acquire(ctx context.Context) error {
+	interval := l.ttl / 4
+	if interval > lockRetryInterval {
+		interval = lockRetryInterval
+	}
+	for {
+		err := l.TryAcquire(ctx)
+		if errors.Cause(err) != ErrLockHeld {
+			return err
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		}
+	}
+}
+
+// TryAcquire acquires the lock, and returns ErrLockHeld without waiting if it's held by another owner, or if this
+// Lock holds it already.
+func (l *Lock) TryAcquire(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.value != nil {
+		return errors.WithStack(ErrLockHeld)
+	}
+	opts := l.client.getRawKVOptions(WithTTL(l.ttlSeconds()))
+	// The lock is free if the key doesn't exist or it's released, i.e. its owner is empty.
+	prev, err := l.client.Get(ctx, l.key)
+	if err != nil {
+		return err
+	}
+	if prev != nil {
+		_, owner, err := decodeLockValue(prev)
+		if err != nil {
+			return err
+		}
+		if len(owner) > 0 {
+			return errors.WithStack(ErrLockHeld)
+		}
+	}
+	// The lock is taken with token 0 first, so that only its holder increases the fencing counter, and the tokens
+	// increase in the order the lock is acquired.
+	taken := encodeLockValue(0, l.owner)
+	_, swapped, err := l.client.compareAndSwap(ctx, l.key, prev, taken, opts)
+	if err != nil {
+		return err
+	}
+	if !swapped {
+		return errors.WithStack(ErrLockHeld)
+	}
+	token, err := l.nextToken(ctx)
+	if err != nil {
+		l.release(ctx, taken, 0)
+		return err
+	}
+	value := encodeLockValue(token, l.owner)
+	_, swapped, err = l.client.compareAndSwap(ctx, l.key, taken, value, opts)
+	if err != nil {
+		l.release(ctx, taken, 0)
+		return err
+	}
+	if !swapped {
+		return errors.WithStack(ErrLockLost)
+	}
+	l.value, l.token = value, token
+	return nil
+}
+
+// Renew resets the TTL of the lock, and returns ErrLockLost if it isn't held any more.
+func (l *Lock) Renew(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.value == nil {
+		return errors.WithStack(ErrLockLost)
+	}
+	opts := l.client.getRawKVOptions(WithTTL(l.ttlSeconds()))
+	_, swapped, err := l.client.compareAndSwap(ctx, l.key, l.value, l.value, opts)
+	if err != nil {
+		return err
+	}
+	if !swapped {
+		l.value, l.token = nil, 0
+		return errors.WithStack(ErrLockLost)
+	}
+	return nil
+}
+
+// Release releases the lock, and returns ErrLockLost if it isn't held any more.
+func (l *Lock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.value == nil {
+		return errors.WithStack(ErrLockLost)
+	}
+	swapped, err := l.release(ctx, l.value, l.token)
+	if err != nil {
+		return err
+	}
+	l.value, l.token = nil, 0
+	if !swapped {
+		return errors.WithStack(ErrLockLost)
+	}
+	return nil
+}
+
+// release replaces value of the holder with a released value, which keeps the token and expires with the TTL of the
+// lock. TiKV can't delete a key by CAS, so the released value tells the lock is free instead.
+func (l *Lock) release(ctx context.Context, value []byte, token uint64) (bool, error) {
+	opts := l.client.getRawKVOptions(WithTTL(l.ttlSeconds()))
+	_, swapped, err := l.client.compareAndSwap(ctx, l.key, value, encodeLockValue(token, nil), opts)
+	return swapped, err
+}
+
+// Do acquires the lock, calls f, and releases the lock after f returns. The lock is renewed every third of its TTL
+// while f runs, and if it's lost or fails to be renewed, the ctx passed to f is canceled. It returns ErrLockLost if
+// the lock is lost, otherwise the error of f, of renewing or of releasing the lock.
+func (l *Lock) Do(ctx context.Context, f func(ctx context.Context) error) error {
+	if err := l.Acquire(ctx); err != nil {
+		return err
+	}
+	fctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg      sync.WaitGroup
+		renewed = make(chan error, 1)
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(l.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := l.Renew(fctx); err != nil && fctx.Err() == nil {
+					renewed <- err
+					cancel()
+					return
+				}
+			case <-fctx.Done():
+				return
+			}
+		}
+	}()
+	err := f(fctx)
+	cancel()
+	wg.Wait()
+	select {
+	case renewErr := <-renewed:
+		if errors.Cause(renewErr) == ErrLockLost {
+			return renewErr
+		}
+		// The lock may still be held if the renewal fails to be sent.
+		if err == nil {
+			err = renewErr
+		}
+	default:
+	}
+	// ctx may be done, but the lock should be released anyway.
+	if releaseErr := l.Release(context.Background()); err == nil {
+		err = releaseErr
+	}
+	return err
+}
+
+// nextToken increases the fencing counter by CAS, and returns the increased value. The CAS retries back off on
+// conflicts like Incr.
+func (l *Lock) nextToken(ctx context.Context) (uint64, error) {
+	next, err := l.client.casUpdate(ctx, l.fenceKey, func(current []byte) ([]byte, error) {
+		var token uint64
+		if current != nil {
+			if len(current) != 8 {
+				return nil, errors.Errorf("invalid fencing counter %q of lock %q", current, l.key)
+			}
+			token = binary.BigEndian.Uint64(current)
+		}
+		next := make([]byte, 8)
+		binary.BigEndian.PutUint64(next, token+1)
+		return next, nil
+	}, l.client.getRawKVOptions())
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(next), nil
+}
+
+func (l *Lock) ttlSeconds() uint64 {
+	return uint64(l.ttl / time.Second)
+}
+
+// encodeLockValue encodes the value of a lock, which is the token in 8 bytes big endian followed by the owner.
+func encodeLockValue(token uint64, owner []byte) []byte {
+	value := make([]byte, 8, 8+len(owner))
+	binary.BigEndian.PutUint64(value, token)
+	return append(value, owner...)
+}
+
+func decodeLockValue(value []byte) (uint64, []byte, error) {
+	if len(value) < 8 {
+		return 0, nil, errors.Errorf("invalid lock value %q", value)
+	}
+	return binary.BigEndian.Uint64(value), value[8:], nil
+}
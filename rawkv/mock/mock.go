@@ -0,0 +1,751 @@
+// Copyright 2021 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mock implements rawkv.RawKV in memory, so that code using rawkv can be unit tested without TiKV.
+package mock
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc64"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tikv/client-go/v2/rawkv"
+)
+
+// defaultCF is the column family of the keys written without SetColumnFamily, like TiKV does.
+const defaultCF = "default"
+
+type entry struct {
+	value []byte
+	// expireAt is zero if the entry never expires.
+	expireAt time.Time
+}
+
+// Client is an in-memory rawkv.RawKV. It behaves like rawkv.Client against a single TiKV region, including the
+// results for missing keys, empty values, TTLs and scan limits. Unlike rawkv.Client, the atomic operations such
+// as CompareAndSwap are always enabled, since every operation of the mock is atomic.
+// It's safe for concurrent use.
+type Client struct {
+	mu  sync.Mutex
+	cfs map[string]map[string]*entry
+	cf  string
+	now func() time.Time
+}
+
+var _ rawkv.RawKV = (*Client)(nil)
+
+// NewClient creates an empty mock client.
+func NewClient() *Client {
+	return &Client{
+		cfs: make(map[string]map[string]*entry),
+		now: time.Now,
+	}
+}
+
+// SetColumnFamily sets the column family used by the operations without SetColumnFamily, like
+// rawkv.Client.SetColumnFamily.
+func (c *Client) SetColumnFamily(columnFamily string) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cf = columnFamily
+	return c
+}
+
+// SetClock sets the function that tells the current time, which decides when the keys with TTL expire.
+// Tests can use it to expire keys without waiting.
+func (c *Client) SetClock(now func() time.Time) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+	return c
+}
+
+// ClusterID returns 0, the mock belongs to no cluster.
+func (c *Client) ClusterID() uint64 {
+	return 0
+}
+
+// Close does nothing, the data stays readable.
+func (c *Client) Close() error {
+	return nil
+}
+
+// Get queries value with the key. When the key does not exist, it returns `nil, nil`.
+func (c *Client) Get(ctx context.Context, key []byte, options ...rawkv.RawOption) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(c.columnFamily(options), key), nil
+}
+
+// GetWithTTL queries the value and the remaining TTL of the key. It returns nil, nil, nil if the key doesn't exist,
+// and a zero TTL if the key never expires.
+func (c *Client) GetWithTTL(ctx context.Context, key []byte, options ...rawkv.RawOption) ([]byte, *uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cf := c.columnFamily(options)
+	value := c.get(cf, key)
+	if value == nil {
+		return nil, nil, nil
+	}
+	return value, c.ttl(cf, key), nil
+}
+
+// GetKeyTTL get the TTL of a raw key if key exists.
+func (c *Client) GetKeyTTL(ctx context.Context, key []byte, options ...rawkv.RawOption) (*uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ttl(c.columnFamily(options), key), nil
+}
+
+// Exists checks whether the key exists.
+func (c *Client) Exists(ctx context.Context, key []byte, options ...rawkv.RawOption) (bool, error) {
+	value, err := c.Get(ctx, key, options...)
+	return value != nil, err
+}
+
+// BatchGet queries values with the keys.
+// The values are in the same order as keys, nil for a missing key and []byte{} for a key with an empty value.
+func (c *Client) BatchGet(ctx context.Context, keys [][]byte, options ...rawkv.RawOption) ([][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cf := c.columnFamily(options)
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = c.get(cf, key)
+	}
+	return values, nil
+}
+
+// BatchGetWithExistence queries values with the keys like BatchGet, and also tells whether each key exists.
+func (c *Client) BatchGetWithExistence(ctx context.Context, keys [][]byte, options ...rawkv.RawOption) ([][]byte, []bool, error) {
+	values, err := c.BatchGet(ctx, keys, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	exists := make([]bool, len(values))
+	for i, value := range values {
+		exists[i] = value != nil
+	}
+	return values, exists, nil
+}
+
+// BatchGetPairs queries the keys and returns only the pairs found. Duplicated keys aren't removed.
+func (c *Client) BatchGetPairs(ctx context.Context, keys [][]byte, options ...rawkv.RawOption) ([]rawkv.KvPair, error) {
+	values, err := c.BatchGet(ctx, keys, options...)
+	if err != nil {
+		return nil, err
+	}
+	pairs := make([]rawkv.KvPair, 0, len(keys))
+	for i, value := range values {
+		if value != nil {
+			pairs = append(pairs, rawkv.KvPair{Key: clone(keys[i]), Value: value})
+		}
+	}
+	return pairs, nil
+}
+
+// BatchGetKeyTTL gets the TTLs of the keys, in the same order as keys, with nil for absent keys and a zero TTL
+// for keys that never expire.
+func (c *Client) BatchGetKeyTTL(ctx context.Context, keys [][]byte, options ...rawkv.RawOption) ([]*uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cf := c.columnFamily(options)
+	ttls := make([]*uint64, len(keys))
+	for i, key := range keys {
+		ttls[i] = c.ttl(cf, key)
+	}
+	return ttls, nil
+}
+
+// BatchExists checks whether the keys exist. The result is aligned with keys.
+func (c *Client) BatchExists(ctx context.Context, keys [][]byte, options ...rawkv.RawOption) ([]bool, error) {
+	_, exists, err := c.BatchGetWithExistence(ctx, keys, options...)
+	return exists, err
+}
+
+// Put stores a key-value pair.
+func (c *Client) Put(ctx context.Context, key, value []byte, options ...rawkv.RawOption) error {
+	return c.PutWithTTL(ctx, key, value, 0, options...)
+}
+
+// PutWithTTL stores a key-value pair with a time-to-live duration in seconds.
+func (c *Client) PutWithTTL(ctx context.Context, key, value []byte, ttl uint64, options ...rawkv.RawOption) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.put(c.columnFamily(options), key, value, ttl)
+	return nil
+}
+
+// BatchPut stores key-value pairs. Use WithTTL to give all the pairs the same TTL.
+func (c *Client) BatchPut(ctx context.Context, keys, values [][]byte, options ...rawkv.RawOption) error {
+	return c.BatchPutWithTTL(ctx, keys, values, nil, options...)
+}
+
+// BatchPutWithTTL stores key-values pairs with time-to-live durations.
+func (c *Client) BatchPutWithTTL(ctx context.Context, keys, values [][]byte, ttls []uint64, options ...rawkv.RawOption) error {
+	_, err := c.BatchPutWithResult(ctx, keys, values, ttls, options...)
+	return err
+}
+
+// BatchPutWithResult stores key-value pairs like BatchPutWithTTL. All the keys succeed together.
+func (c *Client) BatchPutWithResult(ctx context.Context, keys, values [][]byte, ttls []uint64, options ...rawkv.RawOption) (*rawkv.BatchPutResult, error) {
+	if len(keys) != len(values) {
+		return nil, errors.New("the len of keys is not equal to the len of values")
+	}
+	if len(ttls) > 0 && len(keys) != len(ttls) {
+		return nil, errors.New("the len of ttls is not equal to the len of values")
+	}
+	if err := ctx.Err(); err != nil {
+		return &rawkv.BatchPutResult{Failures: []rawkv.BatchPutFailure{{FailedKeys: keys, Err: errors.WithStack(err)}}}, errors.WithStack(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cf := c.columnFamily(options)
+	ttl := rawkv.ResolveOptions(options...).TTL
+	for i, key := range keys {
+		if len(ttls) > 0 {
+			ttl = ttls[i]
+		}
+		c.put(cf, key, values[i], ttl)
+	}
+	result := &rawkv.BatchPutResult{}
+	if len(keys) > 0 {
+		result.SucceededKeys = keys
+	}
+	return result, nil
+}
+
+// Delete deletes a key-value pair.
+func (c *Client) Delete(ctx context.Context, key []byte, options ...rawkv.RawOption) error {
+	return c.BatchDelete(ctx, [][]byte{key}, options...)
+}
+
+// BatchDelete deletes key-value pairs.
+func (c *Client) BatchDelete(ctx context.Context, keys [][]byte, options ...rawkv.RawOption) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cf := c.columnFamily(options)
+	for _, key := range keys {
+		delete(c.cfs[cf], string(key))
+	}
+	return nil
+}
+
+// DeleteRange deletes all key-value pairs in the [startKey, endKey) range.
+// If endKey is empty, it means unbounded.
+func (c *Client) DeleteRange(ctx context.Context, startKey []byte, endKey []byte, options ...rawkv.RawOption) error {
+	_, err := c.DeleteRangeWithDetail(ctx, startKey, endKey, options...)
+	return err
+}
+
+// BatchDeleteRange deletes all key-value pairs in the [startKey, endKey) range like DeleteRange.
+func (c *Client) BatchDeleteRange(ctx context.Context, startKey []byte, endKey []byte, options ...rawkv.RawOption) error {
+	return c.DeleteRange(ctx, startKey, endKey, options...)
+}
+
+// DeleteRangeWithDetail deletes all key-value pairs in the [startKey, endKey) range like DeleteRange.
+// The whole range lies in a single region whose ID is 0.
+func (c *Client) DeleteRangeWithDetail(ctx context.Context, startKey []byte, endKey []byte, options ...rawkv.RawOption) (rawkv.DeleteRangeResult, error) {
+	var result rawkv.DeleteRangeResult
+	if err := ctx.Err(); err != nil {
+		return result, errors.WithStack(err)
+	}
+	if len(endKey) > 0 && bytes.Compare(startKey, endKey) >= 0 {
+		return result, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cf := c.columnFamily(options)
+	keys := c.rangeKeys(cf, startKey, endKey)
+	if rawkv.ResolveOptions(options...).CountKeys {
+		result.Keys = uint64(len(keys))
+	}
+	for _, key := range keys {
+		delete(c.cfs[cf], key)
+	}
+	result.Regions = 1
+	result.Ranges = []rawkv.DeletedRange{{StartKey: startKey, EndKey: endKey}}
+	return result, nil
+}
+
+// Scan queries continuous kv pairs in range [startKey, endKey), up to limit pairs.
+// The limit should be positive, otherwise rawkv.ErrInvalidScanLimit is returned.
+// If endKey is empty, it means unbounded.
+func (c *Client) Scan(ctx context.Context, startKey, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error) {
+	if err := checkScanLimit(limit); err != nil {
+		return nil, nil, err
+	}
+	return c.scan(ctx, startKey, endKey, limit, false, options)
+}
+
+// ReverseScan queries continuous kv pairs in range [endKey, startKey), up to limit pairs, in reversed order.
+// If startKey is empty, it scans from the end of the keyspace; if endKey is empty, it means unbounded.
+func (c *Client) ReverseScan(ctx context.Context, startKey, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error) {
+	if err := checkScanLimit(limit); err != nil {
+		return nil, nil, err
+	}
+	return c.scan(ctx, startKey, endKey, limit, true, options)
+}
+
+// ScanKeys queries continuous keys in range [startKey, endKey), up to limit keys.
+func (c *Client) ScanKeys(ctx context.Context, startKey, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, error) {
+	keys, _, err := c.Scan(ctx, startKey, endKey, limit, append(options, rawkv.ScanKeyOnly())...)
+	return keys, err
+}
+
+// ReverseScanKeys queries continuous keys in range [endKey, startKey), up to limit keys, in reversed order.
+func (c *Client) ReverseScanKeys(ctx context.Context, startKey, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, error) {
+	keys, _, err := c.ReverseScan(ctx, startKey, endKey, limit, append(options, rawkv.ScanKeyOnly())...)
+	return keys, err
+}
+
+// PrefixScan queries continuous kv pairs whose keys start with prefix, up to limit pairs.
+func (c *Client) PrefixScan(ctx context.Context, prefix []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error) {
+	return c.Scan(ctx, prefix, prefixEndKey(prefix), limit, options...)
+}
+
+// ReversePrefixScan queries continuous kv pairs whose keys start with prefix, up to limit pairs, in reversed order.
+func (c *Client) ReversePrefixScan(ctx context.Context, prefix []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error) {
+	return c.ReverseScan(ctx, prefixEndKey(prefix), prefix, limit, options...)
+}
+
+// BatchScan queries continuous kv pairs in the ranges [startKeys[i], endKeys[i]), up to eachLimit pairs for each range.
+func (c *Client) BatchScan(ctx context.Context, startKeys, endKeys [][]byte, eachLimit int, options ...rawkv.RawOption) ([][][]byte, [][][]byte, error) {
+	if len(startKeys) != len(endKeys) {
+		return nil, nil, errors.New("the len of startKeys is not equal to the len of endKeys")
+	}
+	if eachLimit > rawkv.MaxRawKVScanLimit {
+		return nil, nil, errors.WithStack(rawkv.ErrMaxScanLimitExceeded)
+	}
+	keys := make([][][]byte, len(startKeys))
+	values := make([][][]byte, len(startKeys))
+	if eachLimit <= 0 {
+		return keys, values, nil
+	}
+	for i := range startKeys {
+		var err error
+		keys[i], values[i], err = c.scan(ctx, startKeys[i], endKeys[i], eachLimit, false, options)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return keys, values, nil
+}
+
+// ScanPage queries a page of up to limit kv pairs in range [startKey, endKey), and the cursor of the next page,
+// which is nil when there are no more pairs in the range.
+func (c *Client) ScanPage(ctx context.Context, startKey, endKey []byte, limit int, options ...rawkv.RawOption) ([]rawkv.KvPair, *rawkv.Cursor, error) {
+	if limit > rawkv.MaxRawKVScanLimit {
+		return nil, nil, errors.WithStack(rawkv.ErrMaxScanLimitExceeded)
+	}
+	if limit <= 0 {
+		return nil, nil, nil
+	}
+	keys, values, err := c.scan(ctx, startKey, endKey, limit+1, false, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	var next *rawkv.Cursor
+	if len(keys) > limit {
+		next = rawkv.NewCursor(keys[limit], endKey)
+		keys, values = keys[:limit], values[:limit]
+	}
+	pairs := make([]rawkv.KvPair, 0, len(keys))
+	for i := range keys {
+		pairs = append(pairs, rawkv.KvPair{Key: keys[i], Value: values[i]})
+	}
+	return pairs, next, nil
+}
+
+// ScanNextPage queries the page that the cursor points to. See ScanPage for details.
+func (c *Client) ScanNextPage(ctx context.Context, cursor *rawkv.Cursor, limit int, options ...rawkv.RawOption) ([]rawkv.KvPair, *rawkv.Cursor, error) {
+	if cursor == nil {
+		return nil, nil, nil
+	}
+	startKey, endKey := cursor.Range()
+	if len(endKey) > 0 && bytes.Compare(startKey, endKey) >= 0 {
+		return nil, nil, nil
+	}
+	return c.ScanPage(ctx, startKey, endKey, limit, options...)
+}
+
+// ScanStream streams the kv pairs in range [startKey, endKey) through the returned channel, like
+// rawkv.Client.ScanStream.
+func (c *Client) ScanStream(ctx context.Context, startKey, endKey []byte, options ...rawkv.RawOption) (<-chan rawkv.KvPair, <-chan error) {
+	it := rawkv.NewIterator(ctx, c, startKey, endKey, 0, false, options...)
+	pairCh := make(chan rawkv.KvPair)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(errCh)
+		defer close(pairCh)
+		defer it.Close()
+		for it.Next() {
+			select {
+			case pairCh <- rawkv.KvPair{Key: it.Key(), Value: it.Value()}:
+			case <-ctx.Done():
+				errCh <- errors.WithStack(ctx.Err())
+				return
+			}
+		}
+		if err := it.Error(); err != nil {
+			errCh <- err
+		}
+	}()
+	return pairCh, errCh
+}
+
+// Iter creates an iterator over the kv pairs in range [startKey, endKey).
+func (c *Client) Iter(ctx context.Context, startKey, endKey []byte, batchSize int, options ...rawkv.RawOption) (*rawkv.Iterator, error) {
+	if batchSize > rawkv.MaxRawKVScanLimit {
+		return nil, errors.WithStack(rawkv.ErrMaxScanLimitExceeded)
+	}
+	return rawkv.NewIterator(ctx, c, startKey, endKey, batchSize, false, options...), nil
+}
+
+// ReverseIter creates an iterator over the kv pairs in range [endKey, startKey), in reversed order.
+func (c *Client) ReverseIter(ctx context.Context, startKey, endKey []byte, batchSize int, options ...rawkv.RawOption) (*rawkv.Iterator, error) {
+	if batchSize > rawkv.MaxRawKVScanLimit {
+		return nil, errors.WithStack(rawkv.ErrMaxScanLimitExceeded)
+	}
+	return rawkv.NewIterator(ctx, c, startKey, endKey, batchSize, true, options...), nil
+}
+
+// Checksum computes the checksum of the kv pairs in range [startKey, endKey) like TiKV does.
+func (c *Client) Checksum(ctx context.Context, startKey, endKey []byte, options ...rawkv.RawOption) (rawkv.RawChecksum, error) {
+	var check rawkv.RawChecksum
+	if err := ctx.Err(); err != nil {
+		return check, errors.WithStack(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cf := c.columnFamily(options)
+	digest := crc64.New(crc64.MakeTable(crc64.ECMA))
+	for _, key := range c.rangeKeys(cf, startKey, endKey) {
+		value := c.cfs[cf][key].value
+		digest.Reset()
+		digest.Write([]byte(key))
+		digest.Write(value)
+		check.Crc64Xor ^= digest.Sum64()
+		check.TotalKvs++
+		check.TotalBytes += uint64(len(key) + len(value))
+	}
+	return check, nil
+}
+
+// Count returns the number of keys in range [startKey, endKey).
+func (c *Client) Count(ctx context.Context, startKey, endKey []byte, options ...rawkv.RawOption) (uint64, error) {
+	check, err := c.Checksum(ctx, startKey, endKey, options...)
+	return check.TotalKvs, err
+}
+
+// CompareAndSwap writes newValue if the value of the key is equal to previousValue, where a nil previousValue
+// means the key is expected to be absent. It returns the previous value and whether the value is swapped.
+// The TTL of newValue can be set by WithTTL.
+func (c *Client) CompareAndSwap(ctx context.Context, key, previousValue, newValue []byte, options ...rawkv.RawOption) ([]byte, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	actual, swapped := c.compareAndSwap(c.columnFamily(options), key, previousValue, newValue, rawkv.ResolveOptions(options...).TTL)
+	return actual, swapped, nil
+}
+
+// BatchCompareAndSwap executes each of ops as an independent CompareAndSwap, and returns the results in the
+// order of ops.
+func (c *Client) BatchCompareAndSwap(ctx context.Context, ops []rawkv.CASOp, options ...rawkv.RawOption) ([]rawkv.CASResult, error) {
+	if err := ctx.Err(); err != nil {
+		return make([]rawkv.CASResult, len(ops)), errors.WithStack(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cf := c.columnFamily(options)
+	results := make([]rawkv.CASResult, len(ops))
+	for i, op := range ops {
+		results[i].PreviousValue, results[i].Succeed = c.compareAndSwap(cf, op.Key, op.Previous, op.New, op.TTL)
+	}
+	return results, nil
+}
+
+// PutIfAbsent writes the key-value pair only if the key doesn't exist. It returns whether the pair is inserted,
+// and the existing value if it isn't.
+func (c *Client) PutIfAbsent(ctx context.Context, key, value []byte, options ...rawkv.RawOption) ([]byte, bool, error) {
+	existing, inserted, err := c.CompareAndSwap(ctx, key, nil, value, options...)
+	if err != nil || inserted {
+		return nil, inserted, err
+	}
+	return existing, false, nil
+}
+
+// GetAndPut writes the value and returns the value it replaces, or nil if the key was absent.
+func (c *Client) GetAndPut(ctx context.Context, key, value []byte, options ...rawkv.RawOption) ([]byte, error) {
+	return c.update(ctx, key, func(current []byte) ([]byte, []byte, error) {
+		return value, current, nil
+	}, options)
+}
+
+// Incr atomically adds delta to the counter stored in key and returns the new value. The counter is encoded
+// as an 8-byte big-endian integer, and rawkv.ErrInvalidCounter is returned if the existing value isn't 8 bytes.
+func (c *Client) Incr(ctx context.Context, key []byte, delta int64, options ...rawkv.RawOption) (int64, error) {
+	newValue, err := c.update(ctx, key, func(current []byte) ([]byte, []byte, error) {
+		var n int64
+		if current != nil {
+			if len(current) != 8 {
+				return nil, nil, errors.WithStack(rawkv.ErrInvalidCounter)
+			}
+			n = int64(binary.BigEndian.Uint64(current))
+		}
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(n+delta))
+		return buf, buf, nil
+	}, options)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(newValue)), nil
+}
+
+// Decr atomically subtracts delta from the counter stored in key and returns the new value. See Incr for details.
+func (c *Client) Decr(ctx context.Context, key []byte, delta int64, options ...rawkv.RawOption) (int64, error) {
+	return c.Incr(ctx, key, -delta, options...)
+}
+
+// Append atomically appends suffix to the value of key and returns the new value. rawkv.ErrValueTooLarge is
+// returned if the new value would be larger than a positive maxValueSize.
+func (c *Client) Append(ctx context.Context, key, suffix []byte, maxValueSize int, options ...rawkv.RawOption) ([]byte, error) {
+	return c.update(ctx, key, func(current []byte) ([]byte, []byte, error) {
+		if maxValueSize > 0 && len(current)+len(suffix) > maxValueSize {
+			return nil, nil, errors.Wrapf(rawkv.ErrValueTooLarge, "%d bytes exceeds the limit %d", len(current)+len(suffix), maxValueSize)
+		}
+		newValue := make([]byte, 0, len(current)+len(suffix))
+		newValue = append(append(newValue, current...), suffix...)
+		return newValue, newValue, nil
+	}, options)
+}
+
+// UpdateTTL refreshes the TTL of the key without changing its value, and returns whether the key exists.
+func (c *Client) UpdateTTL(ctx context.Context, key []byte, ttl uint64, options ...rawkv.RawOption) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, errors.WithStack(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cf := c.columnFamily(options)
+	value := c.get(cf, key)
+	if value == nil {
+		return false, nil
+	}
+	c.put(cf, key, value, ttl)
+	return true, nil
+}
+
+// Persist removes the TTL of the key so that it never expires, and returns whether the key exists.
+func (c *Client) Persist(ctx context.Context, key []byte, options ...rawkv.RawOption) (bool, error) {
+	return c.UpdateTTL(ctx, key, 0, options...)
+}
+
+// columnFamily returns the column family of an operation. It's called with c.mu locked.
+func (c *Client) columnFamily(options []rawkv.RawOption) string {
+	cf := rawkv.ResolveOptions(options...).ColumnFamily
+	if cf == "" {
+		cf = c.cf
+	}
+	if cf == "" {
+		cf = defaultCF
+	}
+	return cf
+}
+
+// live returns the entry of the key if it exists and hasn't expired. It's called with c.mu locked.
+func (c *Client) live(cf string, key string) *entry {
+	e := c.cfs[cf][key]
+	if e == nil {
+		return nil
+	}
+	if !e.expireAt.IsZero() && !c.now().Before(e.expireAt) {
+		delete(c.cfs[cf], key)
+		return nil
+	}
+	return e
+}
+
+// get returns a copy of the value of the key, or nil if it doesn't exist. It's called with c.mu locked.
+func (c *Client) get(cf string, key []byte) []byte {
+	e := c.live(cf, string(key))
+	if e == nil {
+		return nil
+	}
+	return clone(e.value)
+}
+
+// ttl returns the remaining TTL of the key in seconds, or nil if it doesn't exist. It's called with c.mu locked.
+func (c *Client) ttl(cf string, key []byte) *uint64 {
+	e := c.live(cf, string(key))
+	if e == nil {
+		return nil
+	}
+	var ttl uint64
+	if !e.expireAt.IsZero() {
+		// Like TiKV, the remaining TTL is rounded up to seconds.
+		ttl = uint64((e.expireAt.Sub(c.now()) + time.Second - 1) / time.Second)
+	}
+	return &ttl
+}
+
+// put writes the value with a TTL in seconds, 0 means no TTL. It's called with c.mu locked.
+func (c *Client) put(cf string, key, value []byte, ttl uint64) {
+	e := &entry{value: clone(value)}
+	if ttl > 0 {
+		e.expireAt = c.now().Add(time.Duration(ttl) * time.Second)
+	}
+	if c.cfs[cf] == nil {
+		c.cfs[cf] = make(map[string]*entry)
+	}
+	c.cfs[cf][string(key)] = e
+}
+
+// compareAndSwap swaps the value of the key if it's equal to previousValue, where nil means absent.
+// It's called with c.mu locked.
+func (c *Client) compareAndSwap(cf string, key, previousValue, newValue []byte, ttl uint64) ([]byte, bool) {
+	actual := c.get(cf, key)
+	if (previousValue == nil) != (actual == nil) || !bytes.Equal(actual, previousValue) {
+		return actual, false
+	}
+	c.put(cf, key, newValue, ttl)
+	return actual, true
+}
+
+// update replaces the value of the key by the first value returned by f atomically, and returns the second one.
+// The current value passed to f is nil if the key is absent. The TTL of the new value is set by WithTTL.
+func (c *Client) update(ctx context.Context, key []byte, f func(current []byte) ([]byte, []byte, error), options []rawkv.RawOption) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cf := c.columnFamily(options)
+	newValue, result, err := f(c.get(cf, key))
+	if err != nil {
+		return nil, err
+	}
+	c.put(cf, key, newValue, rawkv.ResolveOptions(options...).TTL)
+	return result, nil
+}
+
+// rangeKeys returns the sorted live keys in [startKey, endKey). It's called with c.mu locked.
+func (c *Client) rangeKeys(cf string, startKey, endKey []byte) []string {
+	var keys []string
+	for key := range c.cfs[cf] {
+		if key < string(startKey) || (len(endKey) > 0 && key >= string(endKey)) {
+			continue
+		}
+		if c.live(cf, key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (c *Client) scan(ctx context.Context, startKey, endKey []byte, limit int, reverse bool, options []rawkv.RawOption) (keys [][]byte, values [][]byte, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cf := c.columnFamily(options)
+	keyOnly := rawkv.ResolveOptions(options...).KeyOnly
+	var rangeKeys []string
+	if reverse {
+		if len(startKey) > 0 && bytes.Compare(startKey, endKey) <= 0 {
+			return nil, nil, nil
+		}
+		rangeKeys = c.rangeKeys(cf, endKey, startKey)
+		for i, j := 0, len(rangeKeys)-1; i < j; i, j = i+1, j-1 {
+			rangeKeys[i], rangeKeys[j] = rangeKeys[j], rangeKeys[i]
+		}
+	} else {
+		if len(endKey) > 0 && bytes.Compare(startKey, endKey) >= 0 {
+			return nil, nil, nil
+		}
+		rangeKeys = c.rangeKeys(cf, startKey, endKey)
+	}
+	if len(rangeKeys) > limit {
+		rangeKeys = rangeKeys[:limit]
+	}
+	for _, key := range rangeKeys {
+		keys = append(keys, []byte(key))
+		if keyOnly {
+			values = append(values, []byte{})
+		} else {
+			values = append(values, clone(c.cfs[cf][key].value))
+		}
+	}
+	return keys, values, nil
+}
+
+func checkScanLimit(limit int) error {
+	if limit > rawkv.MaxRawKVScanLimit {
+		return errors.WithStack(rawkv.ErrMaxScanLimitExceeded)
+	}
+	if limit <= 0 {
+		return errors.WithStack(rawkv.ErrInvalidScanLimit)
+	}
+	return nil
+}
+
+// prefixEndKey returns the smallest key that is greater than all keys with the given prefix, or an empty key
+// (meaning unbounded) if the prefix consists of 0xFF bytes only.
+func prefixEndKey(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xFF {
+			end := make([]byte, i+1)
+			copy(end, prefix)
+			end[i]++
+			return end
+		}
+	}
+	return []byte{}
+}
+
+// clone copies b, keeping an empty value non-nil.
+func clone(b []byte) []byte {
+	return append([]byte{}, b...)
+}
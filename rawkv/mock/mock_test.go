@@ -0,0 +1,196 @@
+// Copyright 2021 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mock
+
+import (
+	"context"
+	"hash/crc64"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/tikv/client-go/v2/internal/mockstore/mocktikv"
+	"github.com/tikv/client-go/v2/rawkv"
+)
+
+// script runs the same operations on a rawkv.RawKV and collects their results, with errors replaced by their causes.
+func script(ctx context.Context, kv rawkv.RawKV) []interface{} {
+	var results []interface{}
+	record := func(rs ...interface{}) {
+		for _, r := range rs {
+			if err, ok := r.(error); ok {
+				r = errors.Cause(err)
+			}
+			results = append(results, r)
+		}
+	}
+	b := func(s string) []byte { return []byte(s) }
+
+	record(kv.Get(ctx, b("a")))
+	record(kv.Put(ctx, b("a"), b("1")))
+	record(kv.Put(ctx, b("b"), b("")))
+	record(kv.BatchPut(ctx, [][]byte{b("c"), b("d/1"), b("d/2"), b("e")}, [][]byte{b("3"), b("4"), b("5"), b("6")}))
+	record(kv.Get(ctx, b("b")))
+	record(kv.Exists(ctx, b("b")))
+	record(kv.BatchGet(ctx, [][]byte{b("a"), b("x"), b("b"), b("a")}))
+	record(kv.BatchGetWithExistence(ctx, [][]byte{b("x"), b("b")}))
+	record(kv.BatchExists(ctx, [][]byte{b("a"), b("x")}))
+
+	record(kv.Scan(ctx, b("a"), nil, 10))
+	record(kv.Scan(ctx, b("b"), b("d/2"), 10))
+	record(kv.Scan(ctx, b("a"), nil, 2, rawkv.ScanKeyOnly()))
+	record(kv.Scan(ctx, b("c"), b("a"), 10))
+	record(kv.Scan(ctx, b("a"), nil, 0))
+	record(kv.Scan(ctx, b("a"), nil, rawkv.MaxRawKVScanLimit+1))
+	record(kv.ReverseScan(ctx, nil, nil, 10))
+	record(kv.ReverseScan(ctx, b("d/2"), b("b"), 10))
+	record(kv.ReverseScanKeys(ctx, b("e"), nil, 2))
+	record(kv.PrefixScan(ctx, b("d/"), 10))
+	record(kv.ReversePrefixScan(ctx, b("d/"), 10))
+	record(kv.BatchScan(ctx, [][]byte{b("a"), b("d")}, [][]byte{b("c"), nil}, 2))
+	record(kv.BatchScan(ctx, [][]byte{b("a")}, [][]byte{nil}, 0))
+	pairs, cursor, err := kv.ScanPage(ctx, b("a"), b("e"), 2)
+	record(pairs, cursor.String(), err)
+	for cursor != nil {
+		pairs, cursor, err = kv.ScanNextPage(ctx, cursor, 2)
+		record(pairs, err)
+	}
+	it, err := kv.ReverseIter(ctx, nil, b("b"), 2)
+	record(err)
+	for it.Next() {
+		record(it.Key(), it.Value())
+	}
+	record(it.Error())
+
+	record(kv.CompareAndSwap(ctx, b("x"), b("1"), b("2")))
+	record(kv.CompareAndSwap(ctx, b("x"), nil, b("2")))
+	record(kv.CompareAndSwap(ctx, b("b"), nil, b("2")))
+	record(kv.CompareAndSwap(ctx, b("b"), b(""), b("2")))
+	record(kv.PutIfAbsent(ctx, b("a"), b("9")))
+	record(kv.PutIfAbsent(ctx, b("y"), b("9")))
+	record(kv.GetAndPut(ctx, b("y"), b("10")))
+	record(kv.BatchCompareAndSwap(ctx, []rawkv.CASOp{{Key: b("y"), Previous: b("10"), New: b("11")}, {Key: b("z"), Previous: b("1"), New: b("2")}}))
+	record(kv.Incr(ctx, b("n"), 5))
+	record(kv.Decr(ctx, b("n"), 2))
+	record(kv.Incr(ctx, b("a"), 1))
+	record(kv.Append(ctx, b("a"), b("23"), 0))
+	record(kv.Append(ctx, b("a"), b("45"), 4))
+
+	record(kv.Delete(ctx, b("a")))
+	record(kv.Delete(ctx, b("a")))
+	record(kv.BatchDelete(ctx, [][]byte{b("b"), b("x")}))
+	record(kv.DeleteRange(ctx, b("d"), b("e")))
+	record(kv.Scan(ctx, nil, nil, 10))
+	record(kv.BatchDeleteRange(ctx, nil, nil))
+	record(kv.Scan(ctx, nil, nil, 10))
+	return results
+}
+
+func TestSameAsClient(t *testing.T) {
+	ctx := context.Background()
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+	cluster := mocktikv.NewCluster(mvccStore)
+	mocktikv.BootstrapWithMultiRegions(cluster, []byte("b"), []byte("d/2"))
+	rpcClient := mocktikv.NewRPCClient(cluster, mvccStore, nil)
+	defer rpcClient.Close()
+	client, err := rawkv.NewClientWithRPC(ctx, mocktikv.NewPDClient(cluster), rpcClient)
+	require.Nil(t, err)
+	defer client.Close()
+	client.SetAtomicForCAS(true)
+
+	require.Equal(t, script(ctx, client), script(ctx, NewClient()))
+}
+
+func TestTTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	kv := NewClient().SetClock(func() time.Time { return now })
+	ttl := func(key string) *uint64 {
+		ttl, err := kv.GetKeyTTL(ctx, []byte(key))
+		require.Nil(t, err)
+		return ttl
+	}
+	u := func(n uint64) *uint64 { return &n }
+
+	require.Nil(t, kv.PutWithTTL(ctx, []byte("a"), []byte("1"), 10))
+	require.Nil(t, kv.BatchPut(ctx, [][]byte{[]byte("b"), []byte("c")}, [][]byte{[]byte("2"), []byte("3")}, rawkv.WithTTL(20)))
+	require.Nil(t, kv.Put(ctx, []byte("d"), []byte("4")))
+	require.Equal(t, u(10), ttl("a"))
+	require.Equal(t, u(0), ttl("d"))
+	require.Nil(t, ttl("x"))
+
+	now = now.Add(5500 * time.Millisecond)
+	require.Equal(t, u(5), ttl("a"))
+	value, valueTTL, err := kv.GetWithTTL(ctx, []byte("b"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("2"), value)
+	require.Equal(t, u(15), valueTTL)
+
+	now = now.Add(5 * time.Second)
+	value, err = kv.Get(ctx, []byte("a"))
+	require.Nil(t, err)
+	require.Nil(t, value)
+	ok, err := kv.UpdateTTL(ctx, []byte("a"), 10)
+	require.Nil(t, err)
+	require.False(t, ok)
+	ok, err = kv.UpdateTTL(ctx, []byte("b"), 100)
+	require.Nil(t, err)
+	require.True(t, ok)
+	ok, err = kv.Persist(ctx, []byte("c"))
+	require.Nil(t, err)
+	require.True(t, ok)
+	_, inserted, err := kv.PutIfAbsent(ctx, []byte("a"), []byte("5"), rawkv.WithTTL(1))
+	require.Nil(t, err)
+	require.True(t, inserted)
+
+	now = now.Add(50 * time.Second)
+	ttls, err := kv.BatchGetKeyTTL(ctx, [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")})
+	require.Nil(t, err)
+	require.Equal(t, []*uint64{nil, u(50), u(0), u(0)}, ttls)
+	keys, err := kv.ScanKeys(ctx, nil, nil, 10)
+	require.Nil(t, err)
+	require.Equal(t, [][]byte{[]byte("b"), []byte("c"), []byte("d")}, keys)
+}
+
+func TestColumnFamily(t *testing.T) {
+	ctx := context.Background()
+	kv := NewClient()
+	require.Nil(t, kv.Put(ctx, []byte("a"), []byte("1")))
+	require.Nil(t, kv.Put(ctx, []byte("a"), []byte("2"), rawkv.SetColumnFamily("write")))
+
+	value, err := kv.Get(ctx, []byte("a"), rawkv.SetColumnFamily("default"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("1"), value)
+	value, err = kv.SetColumnFamily("write").Get(ctx, []byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("2"), value)
+}
+
+func TestChecksum(t *testing.T) {
+	ctx := context.Background()
+	kv := NewClient()
+	require.Nil(t, kv.BatchPut(ctx, [][]byte{[]byte("a"), []byte("b"), []byte("c")}, [][]byte{[]byte("1"), []byte("22"), []byte("")}))
+
+	digest := crc64.New(crc64.MakeTable(crc64.ECMA))
+	digest.Write([]byte("b22"))
+	check, err := kv.Checksum(ctx, []byte("b"), []byte("c"))
+	require.Nil(t, err)
+	require.Equal(t, rawkv.RawChecksum{Crc64Xor: digest.Sum64(), TotalKvs: 1, TotalBytes: 3}, check)
+	count, err := kv.Count(ctx, []byte("b"), nil)
+	require.Nil(t, err)
+	require.Equal(t, uint64(2), count)
+}
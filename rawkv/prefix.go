@@ -0,0 +1,376 @@
+// Copyright 2021 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rawkv
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// PrefixClient is a view of a Client in which every key is under a prefix, so that services sharing a cluster
+// can't touch the keys of each other. The prefix is prepended to the keys passed in and stripped from the keys
+// returned. Ranges are mapped into the prefix, where an empty end key means the end of the prefix rather than
+// the end of the keyspace, so an operation never reaches a key outside the prefix.
+// Checksum is computed over the prefixed keys, as stored in TiKV.
+type PrefixClient struct {
+	client *Client
+	prefix []byte
+	// end is the end of the keys with the prefix, empty if it's the end of the keyspace.
+	end []byte
+}
+
+var _ RawKV = (*PrefixClient)(nil)
+
+// WithPrefix returns a view of the client in which every key is under prefix. See PrefixClient for details.
+// The view shares the connections of the client.
+func (c *Client) WithPrefix(prefix []byte) *PrefixClient {
+	prefix = append([]byte{}, prefix...)
+	return &PrefixClient{client: c, prefix: prefix, end: prefixEndKey(prefix)}
+}
+
+// Prefix returns the prefix of the keys of the view.
+func (p *PrefixClient) Prefix() []byte {
+	return p.prefix
+}
+
+// ClusterID returns the TiKV cluster ID.
+func (p *PrefixClient) ClusterID() uint64 {
+	return p.client.ClusterID()
+}
+
+// Close closes the underlying client, which is shared by all of its views.
+func (p *PrefixClient) Close() error {
+	return p.client.Close()
+}
+
+func (p *PrefixClient) key(key []byte) []byte {
+	return append(append(make([]byte, 0, len(p.prefix)+len(key)), p.prefix...), key...)
+}
+
+func (p *PrefixClient) keys(keys [][]byte) [][]byte {
+	prefixed := make([][]byte, len(keys))
+	for i, key := range keys {
+		prefixed[i] = p.key(key)
+	}
+	return prefixed
+}
+
+// endKey maps the exclusive end of a range, where empty means the end of the prefix.
+func (p *PrefixClient) endKey(key []byte) []byte {
+	if len(key) == 0 {
+		return p.end
+	}
+	return p.key(key)
+}
+
+func (p *PrefixClient) strip(key []byte) []byte {
+	return key[len(p.prefix):]
+}
+
+func (p *PrefixClient) stripKeys(keys [][]byte) [][]byte {
+	for i, key := range keys {
+		keys[i] = p.strip(key)
+	}
+	return keys
+}
+
+func (p *PrefixClient) stripPairs(pairs []KvPair) []KvPair {
+	for i := range pairs {
+		pairs[i].Key = p.strip(pairs[i].Key)
+	}
+	return pairs
+}
+
+// stripEndKey strips the exclusive end of a range, which is empty if it's at or after the end of the prefix.
+func (p *PrefixClient) stripEndKey(key []byte) []byte {
+	if len(key) == 0 || !bytes.HasPrefix(key, p.prefix) {
+		return nil
+	}
+	return p.strip(key)
+}
+
+// Get queries value with the key. When the key does not exist, it returns `nil, nil`.
+func (p *PrefixClient) Get(ctx context.Context, key []byte, options ...RawOption) ([]byte, error) {
+	return p.client.Get(ctx, p.key(key), options...)
+}
+
+// GetWithTTL queries value and its remaining TTL with the key. See Client.GetWithTTL.
+func (p *PrefixClient) GetWithTTL(ctx context.Context, key []byte, options ...RawOption) ([]byte, *uint64, error) {
+	return p.client.GetWithTTL(ctx, p.key(key), options...)
+}
+
+// GetKeyTTL returns the TTL of the key. See Client.GetKeyTTL.
+func (p *PrefixClient) GetKeyTTL(ctx context.Context, key []byte, options ...RawOption) (*uint64, error) {
+	return p.client.GetKeyTTL(ctx, p.key(key), options...)
+}
+
+// Exists tells whether the key exists.
+func (p *PrefixClient) Exists(ctx context.Context, key []byte, options ...RawOption) (bool, error) {
+	return p.client.Exists(ctx, p.key(key), options...)
+}
+
+// BatchGet queries values with the keys. See Client.BatchGet.
+func (p *PrefixClient) BatchGet(ctx context.Context, keys [][]byte, options ...RawOption) ([][]byte, error) {
+	return p.client.BatchGet(ctx, p.keys(keys), options...)
+}
+
+// BatchGetWithExistence queries values with the keys and tells which of them exist. See Client.BatchGetWithExistence.
+func (p *PrefixClient) BatchGetWithExistence(ctx context.Context, keys [][]byte, options ...RawOption) ([][]byte, []bool, error) {
+	return p.client.BatchGetWithExistence(ctx, p.keys(keys), options...)
+}
+
+// BatchGetPairs queries the pairs of the existing keys. See Client.BatchGetPairs.
+func (p *PrefixClient) BatchGetPairs(ctx context.Context, keys [][]byte, options ...RawOption) ([]KvPair, error) {
+	pairs, err := p.client.BatchGetPairs(ctx, p.keys(keys), options...)
+	return p.stripPairs(pairs), err
+}
+
+// BatchGetKeyTTL returns the TTLs of the keys. See Client.BatchGetKeyTTL.
+func (p *PrefixClient) BatchGetKeyTTL(ctx context.Context, keys [][]byte, options ...RawOption) ([]*uint64, error) {
+	return p.client.BatchGetKeyTTL(ctx, p.keys(keys), options...)
+}
+
+// BatchExists tells whether each of the keys exists. See Client.BatchExists.
+func (p *PrefixClient) BatchExists(ctx context.Context, keys [][]byte, options ...RawOption) ([]bool, error) {
+	return p.client.BatchExists(ctx, p.keys(keys), options...)
+}
+
+// Put stores a key-value pair to TiKV.
+func (p *PrefixClient) Put(ctx context.Context, key, value []byte, options ...RawOption) error {
+	return p.client.Put(ctx, p.key(key), value, options...)
+}
+
+// PutWithTTL stores a key-value pair to TiKV with a time-to-live duration.
+func (p *PrefixClient) PutWithTTL(ctx context.Context, key, value []byte, ttl uint64, options ...RawOption) error {
+	return p.client.PutWithTTL(ctx, p.key(key), value, ttl, options...)
+}
+
+// BatchPut stores key-value pairs to TiKV. See Client.BatchPut.
+func (p *PrefixClient) BatchPut(ctx context.Context, keys, values [][]byte, options ...RawOption) error {
+	return p.client.BatchPut(ctx, p.keys(keys), values, options...)
+}
+
+// BatchPutWithTTL stores key-value pairs to TiKV with time-to-live durations. See Client.BatchPutWithTTL.
+func (p *PrefixClient) BatchPutWithTTL(ctx context.Context, keys, values [][]byte, ttls []uint64, options ...RawOption) error {
+	return p.client.BatchPutWithTTL(ctx, p.keys(keys), values, ttls, options...)
+}
+
+// BatchPutWithResult stores key-value pairs to TiKV and reports which keys are written. See Client.BatchPutWithResult.
+func (p *PrefixClient) BatchPutWithResult(ctx context.Context, keys, values [][]byte, ttls []uint64, options ...RawOption) (*BatchPutResult, error) {
+	result, err := p.client.BatchPutWithResult(ctx, p.keys(keys), values, ttls, options...)
+	if result != nil {
+		p.stripKeys(result.SucceededKeys)
+		for i := range result.Failures {
+			p.stripKeys(result.Failures[i].FailedKeys)
+		}
+	}
+	return result, err
+}
+
+// Delete deletes a key-value pair from TiKV.
+func (p *PrefixClient) Delete(ctx context.Context, key []byte, options ...RawOption) error {
+	return p.client.Delete(ctx, p.key(key), options...)
+}
+
+// BatchDelete deletes key-value pairs from TiKV.
+func (p *PrefixClient) BatchDelete(ctx context.Context, keys [][]byte, options ...RawOption) error {
+	return p.client.BatchDelete(ctx, p.keys(keys), options...)
+}
+
+// DeleteRange deletes all key-value pairs in the [startKey, endKey) range from TiKV.
+// If endKey is empty, it means the end of the prefix.
+func (p *PrefixClient) DeleteRange(ctx context.Context, startKey []byte, endKey []byte, options ...RawOption) error {
+	return p.client.DeleteRange(ctx, p.key(startKey), p.endKey(endKey), options...)
+}
+
+// BatchDeleteRange deletes the range [startKey, endKey) like DeleteRange. See Client.BatchDeleteRange.
+func (p *PrefixClient) BatchDeleteRange(ctx context.Context, startKey []byte, endKey []byte, options ...RawOption) error {
+	return p.client.BatchDeleteRange(ctx, p.key(startKey), p.endKey(endKey), options...)
+}
+
+// DeleteRangeWithDetail deletes the range [startKey, endKey) like DeleteRange and reports what is deleted.
+// See Client.DeleteRangeWithDetail.
+func (p *PrefixClient) DeleteRangeWithDetail(ctx context.Context, startKey []byte, endKey []byte, options ...RawOption) (DeleteRangeResult, error) {
+	result, err := p.client.DeleteRangeWithDetail(ctx, p.key(startKey), p.endKey(endKey), options...)
+	for i := range result.Ranges {
+		result.Ranges[i].StartKey = p.strip(result.Ranges[i].StartKey)
+		result.Ranges[i].EndKey = p.stripEndKey(result.Ranges[i].EndKey)
+	}
+	return result, err
+}
+
+// Scan queries continuous kv pairs in range [startKey, endKey), up to limit pairs.
+// If endKey is empty, it means the end of the prefix. See Client.Scan.
+func (p *PrefixClient) Scan(ctx context.Context, startKey, endKey []byte, limit int, options ...RawOption) ([][]byte, [][]byte, error) {
+	keys, values, err := p.client.Scan(ctx, p.key(startKey), p.endKey(endKey), limit, options...)
+	return p.stripKeys(keys), values, err
+}
+
+// ReverseScan queries continuous kv pairs in range [endKey, startKey), up to limit pairs, in reversed order.
+// If startKey is empty, it scans from the end of the prefix. See Client.ReverseScan.
+func (p *PrefixClient) ReverseScan(ctx context.Context, startKey, endKey []byte, limit int, options ...RawOption) ([][]byte, [][]byte, error) {
+	keys, values, err := p.client.ReverseScan(ctx, p.endKey(startKey), p.key(endKey), limit, options...)
+	return p.stripKeys(keys), values, err
+}
+
+// ScanKeys is like Scan but returns the keys only.
+func (p *PrefixClient) ScanKeys(ctx context.Context, startKey, endKey []byte, limit int, options ...RawOption) ([][]byte, error) {
+	keys, _, err := p.Scan(ctx, startKey, endKey, limit, append(options, ScanKeyOnly())...)
+	return keys, err
+}
+
+// ReverseScanKeys is like ReverseScan but returns the keys only.
+func (p *PrefixClient) ReverseScanKeys(ctx context.Context, startKey, endKey []byte, limit int, options ...RawOption) ([][]byte, error) {
+	keys, _, err := p.ReverseScan(ctx, startKey, endKey, limit, append(options, ScanKeyOnly())...)
+	return keys, err
+}
+
+// PrefixScan queries continuous kv pairs whose keys start with prefix, up to limit pairs.
+func (p *PrefixClient) PrefixScan(ctx context.Context, prefix []byte, limit int, options ...RawOption) ([][]byte, [][]byte, error) {
+	keys, values, err := p.client.PrefixScan(ctx, p.key(prefix), limit, options...)
+	return p.stripKeys(keys), values, err
+}
+
+// ReversePrefixScan queries continuous kv pairs whose keys start with prefix, up to limit pairs, in reversed order.
+func (p *PrefixClient) ReversePrefixScan(ctx context.Context, prefix []byte, limit int, options ...RawOption) ([][]byte, [][]byte, error) {
+	keys, values, err := p.client.ReversePrefixScan(ctx, p.key(prefix), limit, options...)
+	return p.stripKeys(keys), values, err
+}
+
+// BatchScan queries continuous kv pairs in the ranges [startKeys[i], endKeys[i]), up to eachLimit pairs for each
+// range. If endKeys[i] is empty, it means the end of the prefix. See Client.BatchScan.
+func (p *PrefixClient) BatchScan(ctx context.Context, startKeys, endKeys [][]byte, eachLimit int, options ...RawOption) ([][][]byte, [][][]byte, error) {
+	if len(startKeys) != len(endKeys) {
+		return nil, nil, errors.New("the len of startKeys is not equal to the len of endKeys")
+	}
+	ends := make([][]byte, len(endKeys))
+	for i, endKey := range endKeys {
+		ends[i] = p.endKey(endKey)
+	}
+	keys, values, err := p.client.BatchScan(ctx, p.keys(startKeys), ends, eachLimit, options...)
+	for _, k := range keys {
+		p.stripKeys(k)
+	}
+	return keys, values, err
+}
+
+// ScanPage queries a page of up to limit kv pairs in range [startKey, endKey). If endKey is empty, it means the
+// end of the prefix. The keys of the returned cursor are stripped as well. See Client.ScanPage.
+func (p *PrefixClient) ScanPage(ctx context.Context, startKey, endKey []byte, limit int, options ...RawOption) ([]KvPair, *Cursor, error) {
+	pairs, cursor, err := p.client.ScanPage(ctx, p.key(startKey), p.endKey(endKey), limit, options...)
+	if cursor != nil {
+		cursor = &Cursor{startKey: p.strip(cursor.startKey), endKey: endKey}
+	}
+	return p.stripPairs(pairs), cursor, err
+}
+
+// ScanNextPage queries the page that the cursor points to. See ScanPage for details.
+func (p *PrefixClient) ScanNextPage(ctx context.Context, cursor *Cursor, limit int, options ...RawOption) ([]KvPair, *Cursor, error) {
+	if cursor == nil || (len(cursor.endKey) > 0 && bytes.Compare(cursor.startKey, cursor.endKey) >= 0) {
+		return nil, nil, nil
+	}
+	return p.ScanPage(ctx, cursor.startKey, cursor.endKey, limit, options...)
+}
+
+// ScanStream streams the kv pairs in range [startKey, endKey) through the returned channel.
+// If endKey is empty, it means the end of the prefix. See Client.ScanStream.
+func (p *PrefixClient) ScanStream(ctx context.Context, startKey, endKey []byte, options ...RawOption) (<-chan KvPair, <-chan error) {
+	ctx, span := p.client.startSpan(ctx, "rawkv.ScanStream")
+	it, err := p.Iter(ctx, startKey, endKey, defaultIterBatchSize, options...)
+	return streamIterator(ctx, span, it, err)
+}
+
+// Iter creates an iterator over the kv pairs in range [startKey, endKey).
+// If endKey is empty, it means the end of the prefix. See Client.Iter.
+func (p *PrefixClient) Iter(ctx context.Context, startKey, endKey []byte, batchSize int, options ...RawOption) (*Iterator, error) {
+	return p.newIterator(ctx, startKey, endKey, batchSize, false, options)
+}
+
+// ReverseIter creates an iterator over the kv pairs in range [endKey, startKey), in reversed order.
+// If startKey is empty, it starts from the end of the prefix. See Client.ReverseIter.
+func (p *PrefixClient) ReverseIter(ctx context.Context, startKey, endKey []byte, batchSize int, options ...RawOption) (*Iterator, error) {
+	return p.newIterator(ctx, startKey, endKey, batchSize, true, options)
+}
+
+func (p *PrefixClient) newIterator(ctx context.Context, startKey, endKey []byte, batchSize int, reverse bool, options []RawOption) (*Iterator, error) {
+	if batchSize > p.client.scanLimit() {
+		return nil, errors.WithStack(ErrMaxScanLimitExceeded)
+	}
+	return NewIterator(ctx, p, startKey, endKey, batchSize, reverse, options...), nil
+}
+
+// Checksum computes the checksum of the kv pairs in range [startKey, endKey), with the keys prefixed.
+// If endKey is empty, it means the end of the prefix. See Client.Checksum.
+func (p *PrefixClient) Checksum(ctx context.Context, startKey, endKey []byte, options ...RawOption) (RawChecksum, error) {
+	return p.client.Checksum(ctx, p.key(startKey), p.endKey(endKey), options...)
+}
+
+// Count returns the number of keys in range [startKey, endKey).
+// If endKey is empty, it means the end of the prefix. See Client.Count.
+func (p *PrefixClient) Count(ctx context.Context, startKey, endKey []byte, options ...RawOption) (uint64, error) {
+	return p.client.Count(ctx, p.key(startKey), p.endKey(endKey), options...)
+}
+
+// CompareAndSwap sets the value of the key to newValue if its value is previousValue. See Client.CompareAndSwap.
+func (p *PrefixClient) CompareAndSwap(ctx context.Context, key, previousValue, newValue []byte, options ...RawOption) ([]byte, bool, error) {
+	return p.client.CompareAndSwap(ctx, p.key(key), previousValue, newValue, options...)
+}
+
+// BatchCompareAndSwap executes each of ops as an independent CompareAndSwap. See Client.BatchCompareAndSwap.
+func (p *PrefixClient) BatchCompareAndSwap(ctx context.Context, ops []CASOp, options ...RawOption) ([]CASResult, error) {
+	prefixed := make([]CASOp, len(ops))
+	for i, op := range ops {
+		prefixed[i] = op
+		prefixed[i].Key = p.key(op.Key)
+	}
+	return p.client.BatchCompareAndSwap(ctx, prefixed, options...)
+}
+
+// PutIfAbsent stores the pair if the key doesn't exist. See Client.PutIfAbsent.
+func (p *PrefixClient) PutIfAbsent(ctx context.Context, key, value []byte, options ...RawOption) ([]byte, bool, error) {
+	return p.client.PutIfAbsent(ctx, p.key(key), value, options...)
+}
+
+// GetAndPut stores the pair and returns the previous value. See Client.GetAndPut.
+func (p *PrefixClient) GetAndPut(ctx context.Context, key, value []byte, options ...RawOption) ([]byte, error) {
+	return p.client.GetAndPut(ctx, p.key(key), value, options...)
+}
+
+// Incr adds delta to the counter of the key. See Client.Incr.
+func (p *PrefixClient) Incr(ctx context.Context, key []byte, delta int64, options ...RawOption) (int64, error) {
+	return p.client.Incr(ctx, p.key(key), delta, options...)
+}
+
+// Decr subtracts delta from the counter of the key. See Client.Decr.
+func (p *PrefixClient) Decr(ctx context.Context, key []byte, delta int64, options ...RawOption) (int64, error) {
+	return p.client.Decr(ctx, p.key(key), delta, options...)
+}
+
+// Append appends suffix to the value of the key. See Client.Append.
+func (p *PrefixClient) Append(ctx context.Context, key, suffix []byte, maxValueSize int, options ...RawOption) ([]byte, error) {
+	return p.client.Append(ctx, p.key(key), suffix, maxValueSize, options...)
+}
+
+// UpdateTTL sets the TTL of the key if it exists. See Client.UpdateTTL.
+func (p *PrefixClient) UpdateTTL(ctx context.Context, key []byte, ttl uint64, options ...RawOption) (bool, error) {
+	return p.client.UpdateTTL(ctx, p.key(key), ttl, options...)
+}
+
+// Persist removes the TTL of the key if it exists. See Client.Persist.
+func (p *PrefixClient) Persist(ctx context.Context, key []byte, options ...RawOption) (bool, error) {
+	return p.client.Persist(ctx, p.key(key), options...)
+}
@@ -37,34 +37,207 @@ package rawkv
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/pingcap/kvproto/pkg/debugpb"
+	"github.com/pingcap/kvproto/pkg/errorpb"
+	"github.com/pingcap/kvproto/pkg/keyspacepb"
 	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/pingcap/kvproto/pkg/pdpb"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tikv/client-go/v2/config"
 	tikverr "github.com/tikv/client-go/v2/error"
 	"github.com/tikv/client-go/v2/internal/client"
 	"github.com/tikv/client-go/v2/internal/kvrpc"
 	"github.com/tikv/client-go/v2/internal/locate"
+	"github.com/tikv/client-go/v2/internal/logutil"
 	"github.com/tikv/client-go/v2/internal/retry"
+	"github.com/tikv/client-go/v2/kv"
 	"github.com/tikv/client-go/v2/metrics"
 	"github.com/tikv/client-go/v2/tikvrpc"
+	"github.com/tikv/client-go/v2/tikvrpc/interceptor"
 	pd "github.com/tikv/pd/client"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
 )
 
 var (
 	// MaxRawKVScanLimit is the maximum scan limit for rawkv Scan.
+	//
+	// Deprecated: Changing it affects all the clients in the process. Use WithMaxScanLimit to set the limit of a
+	// client instead; MaxRawKVScanLimit is only the default limit of the clients without it.
 	MaxRawKVScanLimit = 10240
 	// ErrMaxScanLimitExceeded is returned when the limit for rawkv Scan is to large.
 	ErrMaxScanLimitExceeded = errors.New("limit should be less than MaxRawKVScanLimit")
+	// ErrInvalidScanLimit is returned when the limit for rawkv Scan is not positive.
+	ErrInvalidScanLimit = errors.New("limit should be positive")
+	// ErrAtomicModeRequired is returned when an atomic operation such as PutIfAbsent is used
+	// without SetAtomicForCAS(true).
+	ErrAtomicModeRequired = errors.New("atomic mode is required, enable it by SetAtomicForCAS(true)")
+	// ErrTTLNotEnabled is returned when a write with TTL is rejected because TTL is disabled in TiKV.
+	ErrTTLNotEnabled = errors.New("ttl is not enabled in TiKV")
+	// ErrAPIVersionMismatch is returned when the API version of a request doesn't match the storage of TiKV.
+	ErrAPIVersionMismatch = errors.New("api version mismatch")
+	// ErrInvalidKeyMode is returned when a key doesn't fit the key mode required by the API version of TiKV.
+	ErrInvalidKeyMode = errors.New("invalid key mode")
+	// ErrKeyspaceNotFound is returned when the keyspace set by WithKeyspace doesn't exist in PD.
+	ErrKeyspaceNotFound = errors.New("keyspace not found")
+	// ErrKeyspaceNotEnabled is returned when the keyspace set by WithKeyspace is disabled or archived.
+	ErrKeyspaceNotEnabled = errors.New("keyspace is not enabled")
 )
 
+// ServerError is an error reported by TiKV in the response of a request. Error returns the message from TiKV
+// as is. If the message is recognized, the error matches one of ErrTTLNotEnabled, ErrAPIVersionMismatch and
+// ErrInvalidKeyMode by errors.Is.
+type ServerError struct {
+	Msg string
+
+	kind error
+}
+
+func (e *ServerError) Error() string {
+	return e.Msg
+}
+
+// Unwrap returns the recognized error, or nil if the message isn't recognized.
+func (e *ServerError) Unwrap() error {
+	return e.kind
+}
+
+// extractKeyErr converts the error message in the response of a request into a ServerError.
+// It returns nil if msg is empty.
+func extractKeyErr(msg string) error {
+	if msg == "" {
+		return nil
+	}
+	err := &ServerError{Msg: msg}
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.Contains(lower, "ttl is not enabled"):
+		err.kind = ErrTTLNotEnabled
+	case strings.Contains(lower, "api version"):
+		err.kind = ErrAPIVersionMismatch
+	case strings.Contains(lower, "key mode"):
+		err.kind = ErrInvalidKeyMode
+	}
+	return errors.WithStack(err)
+}
+
+// BatchError is returned by a batch operation, such as BatchPut or BatchGet, when more than one of its batches
+// fail. Each error is annotated with the region and the first key of its batch.
+type BatchError struct {
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d batches failed", len(e.Errors))
+	for _, err := range e.Errors {
+		b.WriteString("; ")
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+// Unwrap returns the errors of the failed batches.
+func (e *BatchError) Unwrap() []error {
+	return e.Errors
+}
+
+// Is reports whether the error of any failed batch matches target. errors.Is before Go 1.20 doesn't
+// support Unwrap() []error, so it's implemented explicitly.
+func (e *BatchError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error of the failed batches that matches target.
+func (e *BatchError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrRetriesExhausted is returned by a call that meets a region error after it has retried as many times as
+// WithMaxRetries allows.
+type ErrRetriesExhausted struct {
+	// Retries is the number of the retries of the call.
+	Retries int
+	// Backoff is the total time the call has backed off before the retries.
+	Backoff time.Duration
+	// RegionErr is the last region error.
+	RegionErr *errorpb.Error
+}
+
+func (e *ErrRetriesExhausted) Error() string {
+	return fmt.Sprintf("region error retries exhausted after %d retries, backoff %v: %s", e.Retries, e.Backoff, e.RegionErr)
+}
+
+// newBatchError returns nil if errs is empty, the only error if there is one, or a BatchError of errs.
+// The errors of a BatchError in errs are flattened.
+func newBatchError(errs []error) error {
+	var flattened []error
+	for _, err := range errs {
+		if batchErr, ok := err.(*BatchError); ok {
+			flattened = append(flattened, batchErr.Errors...)
+		} else {
+			flattened = append(flattened, err)
+		}
+	}
+	switch len(flattened) {
+	case 0:
+		return nil
+	case 1:
+		return flattened[0]
+	}
+	return &BatchError{Errors: flattened}
+}
+
+// annotateBatchErr attaches the region and the first key of a failed batch to err.
+func annotateBatchErr(err error, regionID uint64, key []byte) error {
+	if err == nil {
+		return nil
+	}
+	return errors.WithMessagef(err, "batch of region %d from key %s", regionID, kv.StrKey(key))
+}
+
 const (
 	// rawBatchPutSize is the maximum size limit for rawkv each batch put request.
 	rawBatchPutSize = 16 * 1024
-	// rawBatchPairCount is the maximum limit for rawkv each batch get/delete request.
+	// rawBatchPairCount is the maximum limit for rawkv each batch put/get/delete request.
 	rawBatchPairCount = 512
+	// rawBatchKeysSize is the maximum size limit of the keys of rawkv each batch get/delete request,
+	// which keeps requests with large keys far below the gRPC message size limit.
+	rawBatchKeysSize = 1024 * 1024
+	// rawBatchTTLKeyCount is the maximum number of keys of each batch of BatchGetKeyTTL. TiKV has no batch TTL
+	// request, so the keys of a batch are queried one by one, and a small batch keeps more requests concurrent.
+	rawBatchTTLKeyCount = 32
+	// defaultRangeConcurrency is the default number of regions that Count()/Checksum() work on at the same time.
+	defaultRangeConcurrency = 8
+	// defaultBatchConcurrency is the default number of requests a batch operation sends at the same time.
+	defaultBatchConcurrency = 16
 )
 
 type rawOptions struct {
@@ -73,6 +246,348 @@ type rawOptions struct {
 
 	// This field is used for Scan()/ReverseScan().
 	KeyOnly bool
+
+	// ScanConcurrency is the max number of regions Scan()/Count()/Checksum() read at the same time.
+	ScanConcurrency int
+
+	// CountKeys is used for DeleteRangeWithDetail().
+	CountKeys bool
+
+	// DeleteConcurrency is the max number of regions BatchDeleteRange() deletes at the same time.
+	DeleteConcurrency int
+
+	// TTL is the time-to-live of the value written by the atomic writes, such as PutIfAbsent()/CompareAndSwap(),
+	// or of all the pairs written by BatchPut().
+	TTL uint64
+
+	// CallTimeout is the timeout of each request sent to TiKV.
+	CallTimeout time.Duration
+
+	// MaxBackoff is the max total sleep time in milliseconds of retries.
+	MaxBackoff int
+
+	// ReplicaRead is the replica that the reads are sent to.
+	ReplicaRead kv.ReplicaReadType
+
+	// RequestSource and ResourceGroupTag override the ones set on the client.
+	RequestSource    string
+	ResourceGroupTag []byte
+
+	// Priority is the priority for TiKV to execute the requests.
+	Priority Priority
+
+	// MaxRetries caps the retries of a call on region errors, which are counted by retries. retries is nil unless
+	// WithMaxRetries is set, so the retries are only bounded by MaxBackoff by default.
+	MaxRetries int
+	retries    *int32
+
+	// stats collects the RPCs sent by the call if it is set.
+	stats *RuntimeStats
+
+	// breakdown collects where the time of the call goes. It's shared by the copies of the options.
+	breakdown *callBreakdown
+}
+
+// Priority is the priority for TiKV to execute a command.
+type Priority kvrpcpb.CommandPri
+
+// Priority values of the requests.
+const (
+	PriorityNormal = Priority(kvrpcpb.CommandPri_Normal)
+	PriorityLow    = Priority(kvrpcpb.CommandPri_Low)
+	PriorityHigh   = Priority(kvrpcpb.CommandPri_High)
+)
+
+// RuntimeStats collects the number and the time of the RPCs of each command sent by the calls it is set on by
+// WithRuntimeStats. It is safe for concurrent use.
+type RuntimeStats struct {
+	mu        sync.Mutex
+	stats     locate.RegionRequestRuntimeStats
+	breakdown CallBreakdown
+}
+
+// RPCStats are the number and the total time of the RPCs of a command collected by RuntimeStats.
+type RPCStats struct {
+	Count int64
+	Time  time.Duration
+}
+
+// Stats returns the stats collected so far, keyed by the commands.
+func (s *RuntimeStats) Stats() map[tikvrpc.CmdType]RPCStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make(map[tikvrpc.CmdType]RPCStats, len(s.stats.Stats))
+	for cmd, rpc := range s.stats.Stats {
+		stats[cmd] = RPCStats{Count: rpc.Count, Time: time.Duration(rpc.Consume)}
+	}
+	return stats
+}
+
+// String implements fmt.Stringer interface.
+func (s *RuntimeStats) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats.String()
+}
+
+// Breakdown returns the breakdown of the calls collected so far.
+func (s *RuntimeStats) Breakdown() CallBreakdown {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	breakdown := s.breakdown
+	breakdown.Retries = make(map[string]int, len(s.breakdown.Retries))
+	for typ, n := range s.breakdown.Retries {
+		breakdown.Retries[typ] = n
+	}
+	return breakdown
+}
+
+func (s *RuntimeStats) mergeBreakdown(breakdown CallBreakdown) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breakdown.RPCTime += breakdown.RPCTime
+	s.breakdown.BackoffTime += breakdown.BackoffTime
+	s.breakdown.RegionTime += breakdown.RegionTime
+	s.breakdown.Batches += breakdown.Batches
+	s.breakdown.Regions += breakdown.Regions
+	s.breakdown.RetriedBatches += breakdown.RetriedBatches
+	if breakdown.MaxBatchTime > s.breakdown.MaxBatchTime {
+		s.breakdown.MaxBatchTime = breakdown.MaxBatchTime
+	}
+	for typ, n := range breakdown.Retries {
+		if s.breakdown.Retries == nil {
+			s.breakdown.Retries = make(map[string]int)
+		}
+		s.breakdown.Retries[typ] += n
+	}
+}
+
+// CallBreakdown splits the duration of calls into the time spent in the RPCs, the backoffs and the region
+// resolution, and counts the retries on region errors and the sub-batches of the batch calls. The times of the
+// sub-batches sent concurrently add up, so they may exceed the duration of a batch call.
+type CallBreakdown struct {
+	// RPCTime is the time sending the requests to TiKV, including the wait for the rate limiters.
+	RPCTime time.Duration
+	// BackoffTime is the time sleeping before the retries.
+	BackoffTime time.Duration
+	// RegionTime is the time locating the regions of the keys in the region cache, or loading them from PD.
+	RegionTime time.Duration
+	// Retries are the numbers of the retries on region errors, keyed by the types of the errors, e.g. "not_leader".
+	// The errors retried by the region request sender in place, which cost no backoff, aren't counted.
+	Retries map[string]int
+	// Batches is the number of the sub-batches the batch calls are split into.
+	Batches int
+	// MaxBatchTime is the processing time of the slowest sub-batch, including its retries.
+	MaxBatchTime time.Duration
+	// Regions is the number of the regions the keys of the batch calls are grouped by. The regions of the keys
+	// regrouped after region errors are counted again.
+	Regions int
+	// RetriedBatches is the number of the sub-batches that meet region errors and are sent again.
+	RetriedBatches int
+}
+
+// callBreakdown collects the CallBreakdown of a call. It's updated concurrently by the batches of the call, and
+// all its methods do nothing if it's nil.
+type callBreakdown struct {
+	rpc, backoff, region    int64
+	batches, maxBatch       int64
+	regions, retriedBatches int64
+
+	// start is the start of the call, which is only set if the slow calls are logged.
+	start time.Time
+
+	mu      sync.Mutex
+	retries map[string]int
+	// last is the last request the call has sent, which is only kept if the slow calls are logged.
+	last *sentRequest
+	// batchSizes are the sizes of the sub-batches, which are observed when the call returns.
+	batchSizes []batchSize
+
+	// client are the stats of the client, which count the retries and the batches of the call too.
+	client *clientStats
+}
+
+// sentRequest is a request sent by a call, which is logged if the call is slow.
+type sentRequest struct {
+	cmd      tikvrpc.CmdType
+	key      []byte
+	region   uint64
+	store    string
+	backoffs map[string]int
+}
+
+// onSent keeps req as the last request of the call if the slow calls are logged.
+func (b *callBreakdown) onSent(bo *retry.Backoffer, sender *locate.RegionRequestSender, req *tikvrpc.Request, regionID locate.RegionVerID) {
+	if b == nil || b.start.IsZero() {
+		return
+	}
+	key, _, _ := requestKeys(req)
+	last := &sentRequest{
+		cmd:      req.Type,
+		key:      key,
+		region:   regionID.GetID(),
+		store:    sender.GetStoreAddr(),
+		backoffs: bo.GetBackoffTimes(),
+	}
+	b.mu.Lock()
+	b.last = last
+	b.mu.Unlock()
+}
+
+func (b *callBreakdown) lastSent() *sentRequest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.last
+}
+
+// phaseStart is the time and the total backoff of a backoffer at the start of a phase of a call.
+type phaseStart struct {
+	time  time.Time
+	sleep int
+}
+
+func startPhase(bo *retry.Backoffer) phaseStart {
+	return phaseStart{time: time.Now(), sleep: bo.GetTotalSleep()}
+}
+
+// onRPC adds the time since start to the RPC time, except the backoff of bo, which is added to the backoff time.
+func (b *callBreakdown) onRPC(bo *retry.Backoffer, start phaseStart) {
+	if b != nil {
+		b.addPhase(&b.rpc, bo, start)
+	}
+}
+
+// onRegion adds the time since start to the region time, except the backoff of bo, which is added to the backoff
+// time.
+func (b *callBreakdown) onRegion(bo *retry.Backoffer, start phaseStart) {
+	if b != nil {
+		b.addPhase(&b.region, bo, start)
+	}
+}
+
+func (b *callBreakdown) addPhase(phase *int64, bo *retry.Backoffer, start phaseStart) {
+	sleep := time.Duration(bo.GetTotalSleep()-start.sleep) * time.Millisecond
+	atomic.AddInt64(phase, int64(time.Since(start.time)-sleep))
+	atomic.AddInt64(&b.backoff, int64(sleep))
+}
+
+// onBackoff adds the backoff of bo since sleep to the backoff time.
+func (b *callBreakdown) onBackoff(bo *retry.Backoffer, sleep int) {
+	if b != nil {
+		atomic.AddInt64(&b.backoff, int64(time.Duration(bo.GetTotalSleep()-sleep)*time.Millisecond))
+	}
+}
+
+// onRetry counts a retry on the region error.
+func (b *callBreakdown) onRetry(regionErr *errorpb.Error) {
+	if b == nil {
+		return
+	}
+	b.client.onRetry()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.retries == nil {
+		b.retries = make(map[string]int)
+	}
+	b.retries[locate.RegionErrorToLabel(regionErr)]++
+}
+
+// onBatch counts a sub-batch started at start.
+func (b *callBreakdown) onBatch(start time.Time) {
+	if b == nil {
+		return
+	}
+	b.client.onBatch()
+	atomic.AddInt64(&b.batches, 1)
+	elapsed := int64(time.Since(start))
+	for {
+		maxBatch := atomic.LoadInt64(&b.maxBatch)
+		if elapsed <= maxBatch || atomic.CompareAndSwapInt64(&b.maxBatch, maxBatch, elapsed) {
+			return
+		}
+	}
+}
+
+// batchSize is the number of the keys or pairs, and the size of the keys and values, of a sub-batch.
+type batchSize struct {
+	pairs, bytes int
+}
+
+// onSplit counts the regions the keys of a batch call are grouped by, and records the sizes of the sub-batches.
+func (b *callBreakdown) onSplit(regions int, sizes []batchSize) {
+	if b == nil {
+		return
+	}
+	atomic.AddInt64(&b.regions, int64(regions))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batchSizes = append(b.batchSizes, sizes...)
+}
+
+// kvBatchSizes returns the sizes of the batches.
+func kvBatchSizes(batches []kvrpc.Batch) []batchSize {
+	sizes := make([]batchSize, len(batches))
+	for i, batch := range batches {
+		sizes[i] = batchSize{pairs: len(batch.Keys), bytes: batch.Size}
+	}
+	return sizes
+}
+
+// onBatchRetry counts n sub-batches that meet region errors and are sent again.
+func (b *callBreakdown) onBatchRetry(n int) {
+	if b != nil {
+		atomic.AddInt64(&b.retriedBatches, int64(n))
+	}
+}
+
+// getBatchSizes returns the sizes of the sub-batches.
+func (b *callBreakdown) getBatchSizes() []batchSize {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.batchSizes
+}
+
+// onRegroup counts a regrouping of the keys of the batches that meet region errors.
+func (b *callBreakdown) onRegroup() {
+	if b != nil {
+		b.client.onRegroup()
+	}
+}
+
+func (b *callBreakdown) get() CallBreakdown {
+	if b == nil {
+		return CallBreakdown{}
+	}
+	breakdown := CallBreakdown{
+		RPCTime:        time.Duration(atomic.LoadInt64(&b.rpc)),
+		BackoffTime:    time.Duration(atomic.LoadInt64(&b.backoff)),
+		RegionTime:     time.Duration(atomic.LoadInt64(&b.region)),
+		Batches:        int(atomic.LoadInt64(&b.batches)),
+		MaxBatchTime:   time.Duration(atomic.LoadInt64(&b.maxBatch)),
+		Regions:        int(atomic.LoadInt64(&b.regions)),
+		RetriedBatches: int(atomic.LoadInt64(&b.retriedBatches)),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.retries) > 0 {
+		breakdown.Retries = make(map[string]int, len(b.retries))
+		for typ, n := range b.retries {
+			breakdown.Retries[typ] = n
+		}
+	}
+	return breakdown
+}
+
+func (s *RuntimeStats) merge(stats locate.RegionRequestRuntimeStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats.Stats == nil {
+		s.stats = locate.NewRegionRequestRuntimeStats()
+	}
+	s.stats.Merge(stats)
 }
 
 // RawChecksum represents the checksum result of raw kv pairs in TiKV cluster.
@@ -91,6 +606,18 @@ type RawChecksum struct {
 // Available options are:
 // - ScanColumnFamily
 // - ScanKeyOnly
+// - ScanWithConcurrency
+// - DeleteRangeCountKeys
+// - DeleteRangeWithConcurrency
+// - WithTTL
+// - WithCallTimeout
+// - WithMaxBackoff
+// - WithReplicaRead
+// - WithRequestSource
+// - WithResourceGroupTag
+// - WithPriority
+// - WithMaxRetries
+// - WithRuntimeStats
 type RawOption interface {
 	apply(opts *rawOptions)
 }
@@ -110,30 +637,251 @@ func SetColumnFamily(cf string) RawOption {
 
 // ScanKeyOnly is a rawkvOptions that tells the scanner to only returns
 // keys and omit the values.
-// It can work only in API scan().
+// It can work only in the scan APIs: Scan(), ReverseScan() and BatchScan().
 func ScanKeyOnly() RawOption {
 	return rawOptionFunc(func(opts *rawOptions) {
 		opts.KeyOnly = true
 	})
 }
 
+// ScanWithConcurrency is a RawOption that makes Scan() read up to n regions of the range concurrently
+// instead of one after another. The results are still returned in key order.
+// It can work only in Scan(), Count() and Checksum().
+func ScanWithConcurrency(n int) RawOption {
+	return rawOptionFunc(func(opts *rawOptions) {
+		opts.ScanConcurrency = n
+	})
+}
+
+// DeleteRangeCountKeys is a RawOption that makes DeleteRangeWithDetail() count the keys of the range
+// with key-only scans before deleting it.
+// It can work only in DeleteRangeWithDetail().
+func DeleteRangeCountKeys() RawOption {
+	return rawOptionFunc(func(opts *rawOptions) {
+		opts.CountKeys = true
+	})
+}
+
+// DeleteRangeWithConcurrency is a RawOption that limits the number of regions BatchDeleteRange() deletes
+// at the same time, so that bulk cleanup jobs can throttle their impact on the cluster.
+// It can work only in BatchDeleteRange().
+func DeleteRangeWithConcurrency(n int) RawOption {
+	return rawOptionFunc(func(opts *rawOptions) {
+		opts.DeleteConcurrency = n
+	})
+}
+
+// WithTTL is a RawOption that sets the time-to-live, in seconds, of the value written by an atomic write.
+// It can work in PutIfAbsent(), CompareAndSwap(), GetAndPut(), Incr(), Decr() and Append(). The TTL is carried
+// by the CAS request itself, so the value and its expiry are applied atomically.
+// It also works in BatchPut() to apply the same TTL to all the pairs without a TTL per key. 0 means no TTL.
+func WithTTL(ttl uint64) RawOption {
+	return rawOptionFunc(func(opts *rawOptions) {
+		opts.TTL = ttl
+	})
+}
+
+// WithCallTimeout is a RawOption that sets the timeout of each request sent to TiKV, instead of the default
+// 30 seconds. The deadline of ctx still bounds the whole call.
+func WithCallTimeout(d time.Duration) RawOption {
+	return rawOptionFunc(func(opts *rawOptions) {
+		opts.CallTimeout = d
+	})
+}
+
+// WithReplicaRead is a RawOption that sends the reads to the replicas of mode instead of the leader, so that the
+// load is spread over the followers or learners. kv.ReplicaReadFollower reads from the followers and learners,
+// and kv.ReplicaReadMixed also from the leader. A read falls back to the other replicas and then the leader when
+// a replica fails, e.g. with DataIsNotReady. The reads are still linearizable, because TiKV reads by ReadIndex.
+// It can work in Get(), BatchGet(), Exists(), GetKeyTTL(), BatchGetKeyTTL() and the scans; the writes and the
+// atomic operations, such as CompareAndSwap(), are always sent to the leader. The replicas nearby are preferred
+// with WithPreferredLabels.
+func WithReplicaRead(mode kv.ReplicaReadType) RawOption {
+	return rawOptionFunc(func(opts *rawOptions) {
+		opts.ReplicaRead = mode
+	})
+}
+
+// WithRequestSource is a RawOption that sets the source of the requests of a call, which TiKV uses to tell the
+// traffic apart in its metrics and read pool. It overrides the source set by Client.SetRequestSource.
+func WithRequestSource(source string) RawOption {
+	return rawOptionFunc(func(opts *rawOptions) {
+		opts.RequestSource = source
+	})
+}
+
+// WithResourceGroupTag is a RawOption that sets the resource group tag of the requests of a call, which TiKV uses
+// to attribute the resource usage. It overrides the tag set by Client.SetResourceGroupTag.
+func WithResourceGroupTag(tag []byte) RawOption {
+	return rawOptionFunc(func(opts *rawOptions) {
+		opts.ResourceGroupTag = tag
+	})
+}
+
+// WithPriority is a RawOption that sets the priority for TiKV to execute the requests of a call, e.g.
+// PriorityLow for the bulk writes that should not compete with the online traffic. The default is PriorityNormal.
+func WithPriority(pri Priority) RawOption {
+	return rawOptionFunc(func(opts *rawOptions) {
+		opts.Priority = pri
+	})
+}
+
+// WithMaxRetries is a RawOption that caps how many times a call retries on region errors, including the retries
+// of the batches of a batch operation or DeleteRange, so that it fails fast with an ErrRetriesExhausted instead of
+// backing off until the retry budget runs out. 0 fails the call at the first region error. The retries that the
+// region request sender makes in place, e.g. to the new leader, are bounded by WithMaxBackoff instead.
+func WithMaxRetries(n int) RawOption {
+	return rawOptionFunc(func(opts *rawOptions) {
+		opts.MaxRetries = n
+		opts.retries = new(int32)
+	})
+}
+
+// WithRuntimeStats is a RawOption that counts the RPCs sent by a call, including the retries, and the time they
+// take in stats. A RuntimeStats can be shared by concurrent calls to sum up their RPCs.
+func WithRuntimeStats(stats *RuntimeStats) RawOption {
+	return rawOptionFunc(func(opts *rawOptions) {
+		opts.stats = stats
+	})
+}
+
+// WithMaxBackoff is a RawOption that sets the max total sleep time in milliseconds of the retries of a call,
+// instead of the budget set by WithRetryBudget. The deadline of ctx still bounds the whole call.
+func WithMaxBackoff(ms int) RawOption {
+	return rawOptionFunc(func(opts *rawOptions) {
+		opts.MaxBackoff = ms
+	})
+}
+
+// DeleteRangeResult describes what DeleteRangeWithDetail has deleted.
+type DeleteRangeResult struct {
+	// Regions is the number of regions the range has been deleted from.
+	Regions int
+	// Ranges holds the part of the range deleted from each region, in key order.
+	Ranges []DeletedRange
+	// Keys is the number of keys in the range right before it was deleted.
+	// It's only counted with DeleteRangeCountKeys, and can be inaccurate if the range is written concurrently.
+	Keys uint64
+}
+
+// DeletedRange is the part of a deleted range that lies in a single region.
+type DeletedRange struct {
+	RegionID uint64
+	StartKey []byte
+	EndKey   []byte
+}
+
 // Client is a client of TiKV server which is used as a key-value storage,
 // only GET/PUT/DELETE commands are supported.
 type Client struct {
 	apiVersion  kvrpcpb.APIVersion
+	keyspaceID  uint32
 	clusterID   uint64
 	regionCache *locate.RegionCache
 	pdClient    pd.Client
 	rpcClient   client.Client
 	cf          string
 	atomic      bool
+
+	// externalRPCClient is set if rpcClient is passed in by WithRPCClient, which is left to the caller to close.
+	externalRPCClient bool
+	// externalPDClient is set if pdClient is passed in by NewClientWithPD, which is left to the caller to close.
+	externalPDClient bool
+	// pdSecurityBytes is set if pdClient is created with the PEM blocks of the security config, which it can't
+	// reload.
+	pdSecurityBytes bool
+	// externalRegionCache is set if regionCache is passed in by WithRegionCache, which is left to the caller to close.
+	externalRegionCache bool
+
+	// batchPutSizeLimit and batchPairCountLimit override rawBatchPutSize and rawBatchPairCount if they are positive.
+	batchPutSizeLimit   int
+	batchPairCountLimit int
+	// batchConcurrencyLimit overrides defaultBatchConcurrency if it is positive.
+	batchConcurrencyLimit int
+	// batchSlots are shared by the batches of all the calls, so that at most batchConcurrency batches run at the
+	// same time across the client. The batches are only limited per call if it's nil.
+	batchSlots chan struct{}
+	// maxBackoff overrides rawkvMaxBackoff if it is positive.
+	maxBackoff int
+	// maxScanLimit overrides MaxRawKVScanLimit if it is positive.
+	maxScanLimit int
+	// backoffFn replaces the sleeps of the backoffers if it is set.
+	backoffFn func(time.Duration)
+	// backoffFnCfg replaces the backoff of every kind of error if it is set.
+	backoffFnCfg *retry.BackoffFnCfg
+	// preferredLabels are the labels of the stores that replica reads prefer.
+	preferredLabels []*metapb.StoreLabel
+	// rateLimiter and byteRateLimiter limit the requests and the bytes per second sent to TiKV if they are set.
+	rateLimiter     *rate.Limiter
+	byteRateLimiter *rate.Limiter
+	// storeBreaker fails the requests to the unavailable stores at once if it is set.
+	storeBreaker *locate.StoreBreaker
+	// tracer traces the calls if it is set.
+	tracer trace.Tracer
+	// rawkvMetrics are the metrics of the client, or nil if it observes to the package-level metrics.
+	rawkvMetrics *metrics.RawkvMetrics
+	// The calls taking longer than slowLogThreshold are logged if it's positive.
+	slowLogThreshold    time.Duration
+	slowLogKeyRedaction KeyRedaction
+	// stats are the counters returned by Stats.
+	stats *clientStats
+	// retryHook is called on every retry if it is set.
+	retryHook func(event RetryEvent)
+	// rpcInterceptor wraps the requests sent to the regions if it is set.
+	rpcInterceptor interceptor.RPCInterceptor
+	// debugRecorder keeps the last requests if it is set.
+	debugRecorder *debugRecorder
+	// Puts and Deletes are coalesced for up to coalesceDelay or coalesceBatch writes if they are positive.
+	coalesceDelay time.Duration
+	coalesceBatch int
+	// requestSource and resourceGroupTag are set on the requests to TiKV.
+	requestSource    string
+	resourceGroupTag []byte
+
+	// asyncOps are the writes of AsyncPut and AsyncDelete waiting to be sent by the dispatcher, which is started by
+	// the first of them and closes asyncDone when it exits. asyncMu guards asyncClosed, which is set by Close.
+	asyncOnce   sync.Once
+	asyncOps    chan *asyncOp
+	asyncDone   chan struct{}
+	asyncMu     sync.RWMutex
+	asyncClosed bool
 }
 
 type option struct {
 	apiVersion      kvrpcpb.APIVersion
+	keyspace        string
 	security        config.Security
 	gRPCDialOptions []grpc.DialOption
+	keepAlive       *keepalive.ClientParameters
+	compression     string
+	connectionCount uint
 	pdOptions       []pd.ClientOption
+	rpcClient       client.Client
+	regionCache     *locate.RegionCache
+
+	batchPutSizeLimit     int
+	batchPairCountLimit   int
+	batchConcurrencyLimit int
+	maxBackoff            int
+	maxScanLimit          int
+	backoffFn             func(time.Duration)
+	backoffPolicy         *BackoffPolicy
+	preferredLabels       map[string]string
+	rateLimiter           *rate.Limiter
+	byteRateLimiter       *rate.Limiter
+	breakerThreshold      int
+	breakerWindow         time.Duration
+	breakerCoolDown       time.Duration
+	tracerProvider        trace.TracerProvider
+	metricsRegisterer     prometheus.Registerer
+	metricsConstLabels    prometheus.Labels
+	slowLogThreshold      time.Duration
+	slowLogKeyRedaction   KeyRedaction
+	retryHook             func(event RetryEvent)
+	rpcInterceptors       []interceptor.RPCInterceptor
+	debugRecorderSize     int
+	coalesceDelay         time.Duration
+	coalesceBatch         int
 }
 
 // ClientOpt is factory to set the client options.
@@ -153,664 +901,3368 @@ func WithSecurity(security config.Security) ClientOpt {
 	}
 }
 
-// WithGRPCDialOptions is used to set the grpc.DialOption.
+// WithGRPCDialOptions is used to set the grpc.DialOption of the connections to TiKV.
+// They are applied after the default options, so they override the defaults, e.g. grpc.WithDefaultCallOptions
+// with grpc.MaxCallRecvMsgSize raises the limit of the response size. Interceptors should be added by
+// grpc.WithChainUnaryInterceptor and grpc.WithChainStreamInterceptor, which keep the interceptors of the client.
 func WithGRPCDialOptions(opts ...grpc.DialOption) ClientOpt {
 	return func(o *option) {
 		o.gRPCDialOptions = append(o.gRPCDialOptions, opts...)
 	}
 }
 
-// WithAPIVersion is used to set the api version.
-func WithAPIVersion(apiVersion kvrpcpb.APIVersion) ClientOpt {
+// WithGRPCKeepAlive sets the keepalive of the connections to PD and TiKV, which overrides grpc-keepalive-time and
+// grpc-keepalive-timeout of the TiKV client config. A ping is sent after the connection is idle for keepAliveTime,
+// and the connection is closed if the ping is not acknowledged within keepAliveTimeout.
+func WithGRPCKeepAlive(keepAliveTime, keepAliveTimeout time.Duration) ClientOpt {
+	return WithGRPCKeepAliveParams(keepalive.ClientParameters{
+		Time:    keepAliveTime,
+		Timeout: keepAliveTimeout,
+	})
+}
+
+// WithGRPCKeepAliveParams sets the keepalive of the connections to PD and TiKV, so that a connection dropped while
+// it's idle, e.g. by a NAT gateway, is detected before it's used. PermitWithoutStream makes the pings sent even if
+// there is no request in flight. The connections to PD are not affected if the PD client is created by the caller.
+func WithGRPCKeepAliveParams(params keepalive.ClientParameters) ClientOpt {
 	return func(o *option) {
-		o.apiVersion = apiVersion
+		o.keepAlive = &params
 	}
 }
 
-// SetAtomicForCAS sets atomic mode for CompareAndSwap
-func (c *Client) SetAtomicForCAS(b bool) *Client {
-	c.atomic = b
-	return c
+// WithGRPCCompression compresses the requests to TiKV by the gRPC compressor of the name, which trades CPU for the
+// bandwidth of large values and batches. Only gzip is accepted, because TiKV can't decompress the others, e.g. snappy.
+// The responses are compressed if server.grpc-compression-type of TiKV is set. The bytes before and after
+// compression are counted by the grpc_bytes_total metric. It's disabled by default.
+func WithGRPCCompression(name string) ClientOpt {
+	return func(o *option) {
+		o.compression = name
+	}
 }
 
-// SetColumnFamily sets columnFamily for client
-func (c *Client) SetColumnFamily(columnFamily string) *Client {
-	c.cf = columnFamily
-	return c
+// WithGRPCConnectionCount sets the number of connections to each TiKV store, which overrides grpc-connection-count
+// of the TiKV client config if it's positive. The requests are spread over the connections in round-robin, so that
+// more connections relieve the head-of-line blocking of a single connection under heavy load.
+func WithGRPCConnectionCount(count uint) ClientOpt {
+	return func(o *option) {
+		o.connectionCount = count
+	}
 }
 
-// NewClient creates a client with PD cluster addrs.
-func NewClient(ctx context.Context, pdAddrs []string, security config.Security, opts ...pd.ClientOption) (*Client, error) {
-	return NewClientWithOpts(ctx, pdAddrs, WithSecurity(security), WithPDOptions(opts...))
+// WithPreferredLabels makes the reads with WithReplicaRead prefer the replicas on the stores having all the labels,
+// e.g. {"zone": "us-east-1a"} for the replicas in the same zone as the client. A read falls back to the leader when
+// none of the preferred replicas can serve it. The reads served by the preferred stores or not are counted by the
+// rawkv_replica_read_total metric as local or remote.
+func WithPreferredLabels(labels map[string]string) ClientOpt {
+	return func(o *option) {
+		o.preferredLabels = labels
+	}
 }
 
-// NewClientWithOpts creates a client with PD cluster addrs and client options.
-func NewClientWithOpts(ctx context.Context, pdAddrs []string, opts ...ClientOpt) (*Client, error) {
-	opt := &option{}
-	for _, o := range opts {
-		o(opt)
+// WithRPCClient sets the client used to send requests to TiKV, instead of the one created with WithSecurity and
+// WithGRPCDialOptions. It's not closed by Client.Close, which is left to the caller.
+// Out of this module, the interface is available as tikv.Client.
+func WithRPCClient(rpcClient client.Client) ClientOpt {
+	return func(o *option) {
+		o.rpcClient = rpcClient
 	}
+}
 
-	pdCli, err := pd.NewClient(pdAddrs, pd.SecurityOption{
-		CAPath:   opt.security.ClusterSSLCA,
-		CertPath: opt.security.ClusterSSLCert,
-		KeyPath:  opt.security.ClusterSSLKey,
-	}, opt.pdOptions...)
-
-	if err != nil {
-		return nil, errors.WithStack(err)
+// WithRegionCache sets the region cache of the client, so that the region metadata is shared with other clients,
+// such as other rawkv clients or the KVStore of the transactional client. The cache must be built with a PD client
+// of the same cluster, API version and keyspace. It's not closed by Client.Close, which is left to the caller.
+// Out of this module, the type is available as tikv.RegionCache.
+func WithRegionCache(regionCache *locate.RegionCache) ClientOpt {
+	return func(o *option) {
+		o.regionCache = regionCache
 	}
+}
 
-	if opt.apiVersion == kvrpcpb.APIVersion_V2 {
-		pdCli = locate.NewCodecPDClientV2(pdCli, client.ModeRaw)
+// WithAPIVersion is used to set the api version.
+// It must match the api-version of TiKV, otherwise the requests fail with errors matching ErrAPIVersionMismatch
+// by errors.Is.
+func WithAPIVersion(apiVersion kvrpcpb.APIVersion) ClientOpt {
+	return func(o *option) {
+		o.apiVersion = apiVersion
 	}
-
-	return &Client{
-		apiVersion:  opt.apiVersion,
-		clusterID:   pdCli.GetClusterID(ctx),
-		regionCache: locate.NewRegionCache(pdCli),
-		pdClient:    pdCli,
-		rpcClient:   client.NewRPCClient(client.WithSecurity(opt.security), client.WithGRPCDialOptions(opt.gRPCDialOptions...)),
-	}, nil
 }
 
-// Close closes the client.
-func (c *Client) Close() error {
-	if c.pdClient != nil {
-		c.pdClient.Close()
-	}
-	if c.regionCache != nil {
-		c.regionCache.Close()
+// WithKeyspace sets the keyspace of the client, whose ID is loaded from PD when the client is created. The keys
+// are prefixed with the keyspace in the requests and unprefixed in the responses, so that the client only sees
+// the keys of the keyspace. It requires WithAPIVersion(kvrpcpb.APIVersion_V2).
+func WithKeyspace(name string) ClientOpt {
+	return func(o *option) {
+		o.keyspace = name
 	}
-	if c.rpcClient == nil {
-		return nil
+}
+
+// WithBatchPutSizeLimit sets the maximum size in bytes of the pairs of each request sent by BatchPut.
+// 0 means the default limit, 16KB.
+func WithBatchPutSizeLimit(bytes int) ClientOpt {
+	return func(o *option) {
+		o.batchPutSizeLimit = bytes
 	}
-	return c.rpcClient.Close()
 }
 
-// ClusterID returns the TiKV cluster ID.
-func (c *Client) ClusterID() uint64 {
-	return c.clusterID
+// WithBatchPairCountLimit sets the maximum number of keys of each request sent by BatchPut, BatchGet and BatchDelete,
+// and the maximum number of ranges of each request sent by BatchScan. 0 means the default limit, 512.
+func WithBatchPairCountLimit(n int) ClientOpt {
+	return func(o *option) {
+		o.batchPairCountLimit = n
+	}
 }
 
-// Get queries value with the key. When the key does not exist, it returns `nil, nil`.
-func (c *Client) Get(ctx context.Context, key []byte, options ...RawOption) ([]byte, error) {
-	start := time.Now()
-	defer func() { metrics.RawkvCmdHistogramWithGet.Observe(time.Since(start).Seconds()) }()
-
-	opts := c.getRawKVOptions(options...)
-	req := tikvrpc.NewRequest(
-		tikvrpc.CmdRawGet,
-		&kvrpcpb.RawGetRequest{
-			Key: key,
-			Cf:  c.getColumnFamily(opts),
-		})
-	resp, _, err := c.sendReq(ctx, key, req, false)
-	if err != nil {
-		return nil, err
-	}
-	if resp.Resp == nil {
-		return nil, errors.WithStack(tikverr.ErrBodyMissing)
+// WithBatchConcurrency sets the maximum number of requests the batch operations, such as BatchPut, BatchGet or
+// BatchDelete, send at the same time. The limit is shared by all the calls of the client, so a large batch call
+// can't starve the others of connections. 0 means the default limit, 16.
+func WithBatchConcurrency(n int) ClientOpt {
+	return func(o *option) {
+		o.batchConcurrencyLimit = n
 	}
-	cmdResp := resp.Resp.(*kvrpcpb.RawGetResponse)
-	if cmdResp.GetError() != "" {
-		return nil, errors.New(cmdResp.GetError())
+}
+
+// WithRetryBudget sets the max total sleep time in milliseconds of the retries of each call, which can be
+// overridden by WithMaxBackoff per call. 0 means the default budget, 20 seconds.
+func WithRetryBudget(maxBackoffMs int) ClientOpt {
+	return func(o *option) {
+		o.maxBackoff = maxBackoffMs
 	}
-	if cmdResp.NotFound {
-		return nil, nil
+}
+
+// WithMaxScanLimit sets the maximum limit of each scan of the client. 0 means the value of MaxRawKVScanLimit.
+func WithMaxScanLimit(n int) ClientOpt {
+	return func(o *option) {
+		o.maxScanLimit = n
 	}
-	return convertNilToEmptySlice(cmdResp.Value), nil
 }
 
-const rawkvMaxBackoff = 20000
+// WithBackoffFn sets the function called with the duration of each backoff of the client instead of sleeping, so
+// that tests of the retries don't wait in real time. It applies to every call, including the requests sent by the
+// batch operations and DeleteRange. The function can be called from multiple goroutines at the same time.
+func WithBackoffFn(fn func(d time.Duration)) ClientOpt {
+	return func(o *option) {
+		o.backoffFn = fn
+	}
+}
 
-// BatchGet queries values with the keys.
-func (c *Client) BatchGet(ctx context.Context, keys [][]byte, options ...RawOption) ([][]byte, error) {
-	start := time.Now()
-	defer func() {
-		metrics.RawkvCmdHistogramWithBatchGet.Observe(time.Since(start).Seconds())
-	}()
+// WithRateLimit limits the requests sent to TiKV by the client to opsPerSec per second, allowing bursts of up to
+// burst requests. Every request waits for the limit before it's sent, including the ones sent concurrently by the
+// batch operations and DeleteRange, and the wait ends with an error when the context of the call is done.
+func WithRateLimit(opsPerSec float64, burst int) ClientOpt {
+	return WithRateLimiter(rate.NewLimiter(rate.Limit(opsPerSec), burst))
+}
 
-	opts := c.getRawKVOptions(options...)
-	bo := retry.NewBackofferWithVars(ctx, rawkvMaxBackoff, nil)
-	resp, err := c.sendBatchReq(bo, keys, opts, tikvrpc.CmdRawBatchGet)
-	if err != nil {
-		return nil, err
+// WithRateLimiter is like WithRateLimit, but the limiter can be shared with other clients, so that the limit
+// applies to the requests of all of them. A limiter can also be changed while it's in use, e.g. by SetLimit.
+func WithRateLimiter(l *rate.Limiter) ClientOpt {
+	return func(o *option) {
+		o.rateLimiter = l
 	}
+}
 
-	if resp.Resp == nil {
-		return nil, errors.WithStack(tikverr.ErrBodyMissing)
+// WithByteRateLimit limits the bytes of the requests sent to TiKV by the client to bytesPerSec per second, allowing
+// bursts of up to burst bytes. A request larger than burst waits for the whole burst.
+func WithByteRateLimit(bytesPerSec float64, burst int) ClientOpt {
+	return WithByteRateLimiter(rate.NewLimiter(rate.Limit(bytesPerSec), burst))
+}
+
+// WithByteRateLimiter is like WithByteRateLimit, but the limiter can be shared with other clients.
+func WithByteRateLimiter(l *rate.Limiter) ClientOpt {
+	return func(o *option) {
+		o.byteRateLimiter = l
 	}
-	cmdResp := resp.Resp.(*kvrpcpb.RawBatchGetResponse)
+}
 
-	keyToValue := make(map[string][]byte, len(keys))
-	for _, pair := range cmdResp.Pairs {
-		keyToValue[string(pair.Key)] = pair.Value
+// WithStoreBreaker sets a circuit breaker for each store. After threshold consecutive failures to connect or send
+// requests to a store within window, the requests to the store fail at once with a *tikverr.ErrStoreUnavailable
+// instead of spending the retry budget on the dead store. After coolDown, one request is let through to probe
+// whether the store has recovered. Region errors, such as the ones that redirect the requests to a new leader, don't
+// trip the breaker. The state of the breakers is exported by the tikv_client_go_store_breaker_state metric and
+// Client.UnavailableStores.
+func WithStoreBreaker(threshold int, window, coolDown time.Duration) ClientOpt {
+	return func(o *option) {
+		o.breakerThreshold = threshold
+		o.breakerWindow = window
+		o.breakerCoolDown = coolDown
 	}
+}
 
-	values := make([][]byte, len(keys))
-	for i, key := range keys {
-		v, ok := keyToValue[string(key)]
-		if ok {
-			v = convertNilToEmptySlice(v)
-		}
-		values[i] = v
+// BackoffJitter is the randomization of the sleeps of a BackoffPolicy.
+type BackoffJitter int
+
+// BackoffJitter values.
+const (
+	// NoJitter sleeps exactly the exponential backoff.
+	NoJitter BackoffJitter = retry.NoJitter
+	// FullJitter sleeps a random time between 0 and the exponential backoff.
+	FullJitter BackoffJitter = retry.FullJitter
+	// EqualJitter sleeps half of the exponential backoff plus a random time up to the other half.
+	EqualJitter BackoffJitter = retry.EqualJitter
+)
+
+// BackoffPolicy is the exponential backoff before the retries of a client. The sleep before the n-th retry of a
+// kind of error is Base * 2^(n-1), capped by Cap and randomized by Jitter.
+// See http://www.awsarchitectureblog.com/2015/03/backoff.html
+type BackoffPolicy struct {
+	Base   time.Duration
+	Cap    time.Duration
+	Jitter BackoffJitter
+}
+
+// WithBackoffPolicy sets the backoff before every retry of the client, instead of the default ones which depend on
+// the kind of the error, e.g. a strict exponential backoff from 2ms to 500ms on region misses. A jitter spreads the
+// retries of many clients that meet the same error at once, such as a leader transfer, so that they don't hit TiKV
+// at the same instants. The policy applies to all the kinds of errors, so its cap should leave a busy TiKV time to
+// recover. The total sleep of a call is still bounded by WithRetryBudget.
+func WithBackoffPolicy(policy BackoffPolicy) ClientOpt {
+	return func(o *option) {
+		o.backoffPolicy = &policy
 	}
-	return values, nil
 }
 
-// PutWithTTL stores a key-value pair to TiKV with a time-to-live duration.
-func (c *Client) PutWithTTL(ctx context.Context, key, value []byte, ttl uint64, options ...RawOption) error {
-	start := time.Now()
-	defer func() { metrics.RawkvCmdHistogramWithBatchPut.Observe(time.Since(start).Seconds()) }()
-	metrics.RawkvSizeHistogramWithKey.Observe(float64(len(key)))
-	metrics.RawkvSizeHistogramWithValue.Observe(float64(len(value)))
+// WithTracerProvider traces the calls of the client with OpenTelemetry. Each call opens a span, which is a child of
+// the span in the context passed to the call, and each request sent to a region and each backoff opens a child span
+// of the call, annotated with the region, the store, the retries and the backoff time. The calls are not traced by
+// default, which costs nothing.
+func WithTracerProvider(tp trace.TracerProvider) ClientOpt {
+	return func(o *option) {
+		o.tracerProvider = tp
+	}
+}
 
-	opts := c.getRawKVOptions(options...)
-	req := tikvrpc.NewRequest(tikvrpc.CmdRawPut, &kvrpcpb.RawPutRequest{
-		Key:    key,
-		Value:  value,
-		Ttl:    ttl,
-		Cf:     c.getColumnFamily(opts),
-		ForCas: c.atomic,
-	})
-	resp, _, err := c.sendReq(ctx, key, req, false)
-	if err != nil {
-		return err
+// WithMetricsRegisterer registers the rawkv metrics of the client with the registerer, instead of observing to the
+// package-level metrics in the metrics package, which are shared by all the clients and registered with the default
+// registerer by metrics.RegisterMetrics. The clients with the same registerer and const labels share the metrics.
+func WithMetricsRegisterer(registerer prometheus.Registerer) ClientOpt {
+	return func(o *option) {
+		o.metricsRegisterer = registerer
 	}
-	if resp.Resp == nil {
-		return errors.WithStack(tikverr.ErrBodyMissing)
+}
+
+// WithConstLabels adds the const labels to the rawkv metrics of the client, e.g. the cluster the client talks to,
+// so that its observations go to its own series. It requires WithMetricsRegisterer, otherwise creating the client
+// fails: the labeled metrics can't be registered with the default registerer, where metrics.RegisterMetrics
+// registers the package-level ones of the same names without the labels.
+func WithConstLabels(labels prometheus.Labels) ClientOpt {
+	return func(o *option) {
+		o.metricsConstLabels = labels
 	}
-	cmdResp := resp.Resp.(*kvrpcpb.RawPutResponse)
-	if cmdResp.GetError() != "" {
-		return errors.New(cmdResp.GetError())
+}
+
+// WithSlowLogThreshold logs the calls taking longer than threshold when they return, with the command, the error if
+// the call fails, the key, the region and the store of the last request it has sent, the retries and the time spent
+// in the RPCs, the backoffs and the region resolution. The calls are not logged by default.
+func WithSlowLogThreshold(threshold time.Duration) ClientOpt {
+	return func(o *option) {
+		o.slowLogThreshold = threshold
 	}
-	return nil
 }
 
-// GetKeyTTL get the TTL of a raw key from TiKV if key exists
-func (c *Client) GetKeyTTL(ctx context.Context, key []byte, options ...RawOption) (*uint64, error) {
-	var ttl uint64
-	metrics.RawkvSizeHistogramWithKey.Observe(float64(len(key)))
+// KeyRedaction is how the keys are shown in the slow log and the debug records.
+type KeyRedaction int
 
-	opts := c.getRawKVOptions(options...)
-	req := tikvrpc.NewRequest(tikvrpc.CmdGetKeyTTL, &kvrpcpb.RawGetKeyTTLRequest{
-		Key: key,
-		Cf:  c.getColumnFamily(opts),
-	})
-	resp, _, err := c.sendReq(ctx, key, req, false)
+// KeyRedaction values.
+const (
+	// KeyRedactionNone shows the keys in hex, truncated to maxLoggedKeyLen bytes.
+	KeyRedactionNone KeyRedaction = iota
+	// KeyRedactionHash shows a hash of the keys, which tells whether the calls are on the same key without revealing
+	// the key.
+	KeyRedactionHash
+	// KeyRedactionFull hides the keys.
+	KeyRedactionFull
+)
 
-	if err != nil {
-		return nil, err
+// maxLoggedKeyLen is the max length of the keys shown in the slow log and the debug records.
+const maxLoggedKeyLen = 64
+
+func (r KeyRedaction) redact(key []byte) string {
+	switch r {
+	case KeyRedactionHash:
+		sum := sha256.Sum256(key)
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	case KeyRedactionFull:
+		return "?"
 	}
-	if resp.Resp == nil {
-		return nil, errors.WithStack(tikverr.ErrBodyMissing)
+	if len(key) > maxLoggedKeyLen {
+		return hex.EncodeToString(key[:maxLoggedKeyLen]) + "..."
 	}
+	return hex.EncodeToString(key)
+}
 
-	cmdResp := resp.Resp.(*kvrpcpb.RawGetKeyTTLResponse)
-	if cmdResp.GetError() != "" {
-		return nil, errors.New(cmdResp.GetError())
+// WithSlowLogKeyRedaction sets how the keys are shown in the slow log, which are shown in hex by default.
+func WithSlowLogKeyRedaction(redaction KeyRedaction) ClientOpt {
+	return func(o *option) {
+		o.slowLogKeyRedaction = redaction
 	}
+}
 
-	if cmdResp.GetNotFound() {
-		return nil, nil
+// RetryEvent describes a retry of a request, which is passed to the hook set by WithRetryHook.
+type RetryEvent struct {
+	// Cmd is the type of the request.
+	Cmd tikvrpc.CmdType
+	// RegionID is the region the request was sent to.
+	RegionID uint64
+	// RegionError is the kind of the region error that causes the retry, e.g. "not_leader", or empty if the request
+	// failed to be sent.
+	RegionError string
+	// Backoff is the type of the backoff before the retry, e.g. "regionMiss", or empty if the request is retried at
+	// once.
+	Backoff string
+	// Sleep is the time of the backoff.
+	Sleep time.Duration
+}
+
+// WithRetryHook sets the hook called synchronously every time a request is retried, whether by the region request
+// sender in place, or by a call after the region error is returned, including the batches of the batch calls and
+// DeleteRange. The hook runs on the path of the requests, so it must be fast and must not block.
+func WithRetryHook(hook func(event RetryEvent)) ClientOpt {
+	return func(o *option) {
+		o.retryHook = hook
 	}
+}
 
-	ttl = cmdResp.GetTtl()
-	return &ttl, nil
+// WithRPCInterceptor adds an interceptor that wraps every request sent to the regions by the calls of the client,
+// which gets the address of the target store and the request, whose region is set in its context. Each attempt of a
+// retried request goes through the interceptors again. The interceptors added by multiple WithRPCInterceptor are
+// chained in the order they are added, see interceptor.RPCInterceptorChain.
+func WithRPCInterceptor(it interceptor.RPCInterceptor) ClientOpt {
+	return func(o *option) {
+		o.rpcInterceptors = append(o.rpcInterceptors, it)
+	}
 }
 
-// GetPDClient returns the PD client.
-func (c *Client) GetPDClient() pd.Client {
-	return c.pdClient
+// WithDebugRecorder keeps the last n requests of each command, which are returned by Client.DebugDump, to help debug
+// the rare failures. The records keep no values, and the keys are shown as in the slow log. The requests are not
+// recorded by default.
+func WithDebugRecorder(n int) ClientOpt {
+	return func(o *option) {
+		o.debugRecorderSize = n
+	}
 }
 
-// Put stores a key-value pair to TiKV.
-func (c *Client) Put(ctx context.Context, key, value []byte, options ...RawOption) error {
-	return c.PutWithTTL(ctx, key, value, 0, options...)
+// WithWriteCoalescing coalesces the concurrent Puts and Deletes into RawBatchPut and RawBatchDelete requests to
+// their regions. A write waits up to maxDelay for the others, or until maxBatch writes to its region are waiting, and
+// is then sent with them by the dispatcher of AsyncPut and AsyncDelete, which sends the writes to different regions
+// concurrently. Each write fails only with the error of the keys of its region, and the writes to the same key are
+// applied in the order they are issued. A write is given up once its ctx is done, but it may still be applied, see
+// AsyncPut. The writes in atomic mode, see SetAtomicForCAS, and the ones with RawOptions are sent on their own. It
+// trades the latency of the writes for fewer requests when many goroutines write single keys, so it's disabled by
+// default.
+func WithWriteCoalescing(maxDelay time.Duration, maxBatch int) ClientOpt {
+	return func(o *option) {
+		o.coalesceDelay = maxDelay
+		o.coalesceBatch = maxBatch
+	}
 }
 
-// BatchPut stores key-value pairs to TiKV.
-func (c *Client) BatchPut(ctx context.Context, keys, values [][]byte, options ...RawOption) error {
-	return c.BatchPutWithTTL(ctx, keys, values, nil, options...)
+func (o *option) rpcInterceptor() interceptor.RPCInterceptor {
+	if len(o.rpcInterceptors) == 0 {
+		return nil
+	}
+	return interceptor.ChainRPCInterceptors(o.rpcInterceptors...)
 }
 
-// BatchPutWithTTL stores key-values pairs to TiKV with time-to-live durations.
-func (c *Client) BatchPutWithTTL(ctx context.Context, keys, values [][]byte, ttls []uint64, options ...RawOption) error {
-	start := time.Now()
-	defer func() {
-		metrics.RawkvCmdHistogramWithBatchPut.Observe(time.Since(start).Seconds())
-	}()
+// storeBreaker creates the store breaker, or returns nil if it's not set.
+func (o *option) storeBreaker() *locate.StoreBreaker {
+	if o.breakerThreshold == 0 {
+		return nil
+	}
+	return locate.NewStoreBreaker(o.breakerThreshold, o.breakerWindow, o.breakerCoolDown)
+}
 
-	if len(keys) != len(values) {
-		return errors.New("the len of keys is not equal to the len of values")
+// tracer creates the tracer of the client, or returns nil if the client is not traced.
+func (o *option) tracer() trace.Tracer {
+	if o.tracerProvider == nil {
+		return nil
 	}
-	if len(ttls) > 0 && len(keys) != len(ttls) {
-		return errors.New("the len of ttls is not equal to the len of values")
+	return o.tracerProvider.Tracer(tracerName)
+}
+
+// rawkvMetrics creates and registers the metrics of the client, or returns nil if the client observes to the
+// package-level metrics.
+func (o *option) rawkvMetrics() (*metrics.RawkvMetrics, error) {
+	if o.metricsRegisterer == nil {
+		if o.metricsConstLabels != nil {
+			return nil, errors.New("WithConstLabels requires WithMetricsRegisterer")
+		}
+		return nil, nil
 	}
-	bo := retry.NewBackofferWithVars(ctx, rawkvMaxBackoff, nil)
-	opts := c.getRawKVOptions(options...)
-	err := c.sendBatchPut(bo, keys, values, ttls, opts)
-	return err
+	return metrics.NewRawkvMetrics(o.metricsRegisterer, o.metricsConstLabels)
 }
 
-// Delete deletes a key-value pair from TiKV.
-func (c *Client) Delete(ctx context.Context, key []byte, options ...RawOption) error {
-	start := time.Now()
-	defer func() { metrics.RawkvCmdHistogramWithDelete.Observe(time.Since(start).Seconds()) }()
+// backoffFnCfg converts the backoff policy into the config of the backoffers, or returns nil if it's not set.
+func (o *option) backoffFnCfg() *retry.BackoffFnCfg {
+	if o.backoffPolicy == nil {
+		return nil
+	}
+	return retry.NewBackoffFnCfg(int(o.backoffPolicy.Base.Milliseconds()), int(o.backoffPolicy.Cap.Milliseconds()), int(o.backoffPolicy.Jitter))
+}
 
-	opts := c.getRawKVOptions(options...)
-	req := tikvrpc.NewRequest(tikvrpc.CmdRawDelete, &kvrpcpb.RawDeleteRequest{
-		Key:    key,
-		Cf:     c.getColumnFamily(opts),
-		ForCas: c.atomic,
-	})
-	req.MaxExecutionDurationMs = uint64(client.MaxWriteExecutionTime.Milliseconds())
-	resp, _, err := c.sendReq(ctx, key, req, false)
-	if err != nil {
-		return err
+// validate checks the options before any connection is made.
+func (o *option) validate() error {
+	if o.batchPutSizeLimit < 0 {
+		return errors.Errorf("invalid batch put size limit %d", o.batchPutSizeLimit)
 	}
-	if resp.Resp == nil {
-		return errors.WithStack(tikverr.ErrBodyMissing)
+	if o.batchPairCountLimit < 0 {
+		return errors.Errorf("invalid batch pair count limit %d", o.batchPairCountLimit)
 	}
-	cmdResp := resp.Resp.(*kvrpcpb.RawDeleteResponse)
-	if cmdResp.GetError() != "" {
-		return errors.New(cmdResp.GetError())
+	if o.batchConcurrencyLimit < 0 {
+		return errors.Errorf("invalid batch concurrency %d", o.batchConcurrencyLimit)
 	}
-	return nil
-}
-
-// BatchDelete deletes key-value pairs from TiKV.
-func (c *Client) BatchDelete(ctx context.Context, keys [][]byte, options ...RawOption) error {
-	start := time.Now()
-	defer func() {
-		metrics.RawkvCmdHistogramWithBatchDelete.Observe(time.Since(start).Seconds())
-	}()
-
-	bo := retry.NewBackofferWithVars(ctx, rawkvMaxBackoff, nil)
-	opts := c.getRawKVOptions(options...)
-	resp, err := c.sendBatchReq(bo, keys, opts, tikvrpc.CmdRawBatchDelete)
-	if err != nil {
-		return err
+	if o.maxBackoff < 0 {
+		return errors.Errorf("invalid retry budget %d", o.maxBackoff)
 	}
-	if resp.Resp == nil {
-		return errors.WithStack(tikverr.ErrBodyMissing)
+	if o.maxScanLimit < 0 {
+		return errors.Errorf("invalid max scan limit %d", o.maxScanLimit)
 	}
-	cmdResp := resp.Resp.(*kvrpcpb.RawBatchDeleteResponse)
-	if cmdResp.GetError() != "" {
-		return errors.New(cmdResp.GetError())
+	if o.debugRecorderSize < 0 {
+		return errors.Errorf("invalid debug recorder size %d", o.debugRecorderSize)
 	}
-	return nil
-}
-
-// DeleteRange deletes all key-value pairs in the [startKey, endKey) range from TiKV.
-func (c *Client) DeleteRange(ctx context.Context, startKey []byte, endKey []byte, options ...RawOption) error {
-	start := time.Now()
-	var err error
-	defer func() {
-		var label = "delete_range"
-		if err != nil {
-			label += "_error"
+	if o.coalesceDelay < 0 || o.coalesceBatch < 0 || (o.coalesceDelay > 0) != (o.coalesceBatch > 0) {
+		return errors.Errorf("invalid write coalescing delay %v and batch %d", o.coalesceDelay, o.coalesceBatch)
+	}
+	if o.rpcClient != nil && len(o.gRPCDialOptions) > 0 {
+		return errors.New("gRPC dial options can't be used with WithRPCClient")
+	}
+	if o.connectionCount > 0 && o.rpcClient != nil {
+		return errors.New("gRPC connection count can't be used with WithRPCClient")
+	}
+	if o.compression != "" {
+		if o.rpcClient != nil {
+			return errors.New("gRPC compression can't be used with WithRPCClient")
 		}
-		metrics.TiKVRawkvCmdHistogram.WithLabelValues(label).Observe(time.Since(start).Seconds())
-	}()
-
-	// Process each affected region respectively
-	for !bytes.Equal(startKey, endKey) {
-		opts := c.getRawKVOptions(options...)
-		var resp *tikvrpc.Response
-		var actualEndKey []byte
-		resp, actualEndKey, err = c.sendDeleteRangeReq(ctx, startKey, endKey, opts)
-		if err != nil {
-			return err
+		if o.compression != gzip.Name {
+			return errors.Errorf("gRPC compression %s is not supported by TiKV, only %s is", o.compression, gzip.Name)
 		}
-		if resp.Resp == nil {
-			return errors.WithStack(tikverr.ErrBodyMissing)
+	}
+	if o.keepAlive != nil {
+		if o.rpcClient != nil {
+			return errors.New("gRPC keepalive can't be used with WithRPCClient")
 		}
-		cmdResp := resp.Resp.(*kvrpcpb.RawDeleteRangeResponse)
-		if cmdResp.GetError() != "" {
-			return errors.New(cmdResp.GetError())
+		if o.keepAlive.Time < 0 || o.keepAlive.Timeout < 0 {
+			return errors.Errorf("invalid gRPC keepalive %v", *o.keepAlive)
 		}
-		startKey = actualEndKey
 	}
-
+	for _, l := range []*rate.Limiter{o.rateLimiter, o.byteRateLimiter} {
+		if l != nil && l.Limit() != rate.Inf && (l.Limit() <= 0 || l.Burst() <= 0) {
+			return errors.Errorf("invalid rate limit %v with burst %d", l.Limit(), l.Burst())
+		}
+	}
+	if o.breakerThreshold < 0 || o.breakerWindow < 0 || o.breakerCoolDown < 0 {
+		return errors.Errorf("invalid store breaker threshold %d, window %v and cool-down %v", o.breakerThreshold, o.breakerWindow, o.breakerCoolDown)
+	}
+	if p := o.backoffPolicy; p != nil {
+		if p.Base < time.Millisecond || p.Cap < p.Base {
+			return errors.Errorf("invalid backoff base %v and cap %v", p.Base, p.Cap)
+		}
+		if p.Jitter != NoJitter && p.Jitter != FullJitter && p.Jitter != EqualJitter {
+			return errors.Errorf("invalid backoff jitter %d", p.Jitter)
+		}
+	}
+	if o.keyspace != "" && o.apiVersion != kvrpcpb.APIVersion_V2 {
+		return errors.Errorf("keyspace %s requires API V2", o.keyspace)
+	}
 	return nil
 }
 
-// Scan queries continuous kv pairs in range [startKey, endKey), up to limit pairs.
-// The returned keys are in lexicographical order.
-// If endKey is empty, it means unbounded.
-// If you want to exclude the startKey or include the endKey, push a '\0' to the key. For example, to scan
-// (startKey, endKey], you can write:
-// `Scan(ctx, push(startKey, '\0'), push(endKey, '\0'), limit)`.
-func (c *Client) Scan(ctx context.Context, startKey, endKey []byte, limit int, options ...RawOption,
-) (keys [][]byte, values [][]byte, err error) {
-	start := time.Now()
-	defer func() { metrics.RawkvCmdHistogramWithRawScan.Observe(time.Since(start).Seconds()) }()
+// SetAtomicForCAS sets atomic mode for CompareAndSwap
+func (c *Client) SetAtomicForCAS(b bool) *Client {
+	c.atomic = b
+	return c
+}
 
-	if limit > MaxRawKVScanLimit {
-		return nil, nil, errors.WithStack(ErrMaxScanLimitExceeded)
+// SetColumnFamily sets columnFamily for client
+func (c *Client) SetColumnFamily(columnFamily string) *Client {
+	c.cf = columnFamily
+	return c
+}
+
+// SetRequestSource sets the source of the requests to TiKV, e.g. the name of the application, which TiKV uses to
+// tell the traffic apart in its metrics and read pool. It can be overridden per call by WithRequestSource.
+// It should be called before the client is used.
+func (c *Client) SetRequestSource(source string) *Client {
+	c.requestSource = source
+	return c
+}
+
+// SetResourceGroupTag sets the resource group tag of the requests to TiKV, which TiKV uses to attribute the
+// resource usage. It can be overridden per call by WithResourceGroupTag. It should be called before the client
+// is used.
+func (c *Client) SetResourceGroupTag(tag []byte) *Client {
+	c.resourceGroupTag = tag
+	return c
+}
+
+// NewClient creates a client with PD cluster addrs.
+func NewClient(ctx context.Context, pdAddrs []string, security config.Security, opts ...pd.ClientOption) (*Client, error) {
+	return NewClientWithOpts(ctx, pdAddrs, WithSecurity(security), WithPDOptions(opts...))
+}
+
+// NewClientWithOpts creates a client with PD cluster addrs and client options.
+func NewClientWithOpts(ctx context.Context, pdAddrs []string, opts ...ClientOpt) (*Client, error) {
+	opt := &option{}
+	for _, o := range opts {
+		o(opt)
+	}
+	if err := opt.validate(); err != nil {
+		return nil, err
 	}
 
-	opts := c.getRawKVOptions(options...)
+	pdOptions := opt.pdOptions
+	if opt.keepAlive != nil {
+		// The keepalive comes first so that it's overridden by the dial options in the PD options.
+		pdOptions = append([]pd.ClientOption{pd.WithGRPCDialOptions(grpc.WithKeepaliveParams(*opt.keepAlive))}, pdOptions...)
+	}
+	pdCli, err := pd.NewClient(pdAddrs, pd.SecurityOption{
+		CAPath:   opt.security.ClusterSSLCA,
+		CertPath: opt.security.ClusterSSLCert,
+		KeyPath:  opt.security.ClusterSSLKey,
 
-	for len(keys) < limit && (len(endKey) == 0 || bytes.Compare(startKey, endKey) < 0) {
+		SSLCABytes:   opt.security.ClusterSSLCABytes,
+		SSLCertBytes: opt.security.ClusterSSLCertBytes,
+		SSLKEYBytes:  opt.security.ClusterSSLKeyBytes,
+	}, pdOptions...)
+
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	c, err := newClient(ctx, pdCli, opt)
+	if err != nil {
+		pdCli.Close()
+		return nil, err
+	}
+	c.pdSecurityBytes = len(opt.security.ClusterSSLCABytes) > 0 || len(opt.security.ClusterSSLCertBytes) > 0 ||
+		len(opt.security.ClusterSSLKeyBytes) > 0
+	return c, nil
+}
+
+// NewClientWithPD creates a client with an existing PD client, so that the connections to PD are shared with the
+// caller. The PD client isn't closed by Client.Close, which is left to the caller.
+func NewClientWithPD(ctx context.Context, pdCli pd.Client, security config.Security, opts ...ClientOpt) (*Client, error) {
+	opt := &option{security: security}
+	for _, o := range opts {
+		o(opt)
+	}
+	if err := opt.validate(); err != nil {
+		return nil, err
+	}
+	if len(opt.pdOptions) > 0 {
+		return nil, errors.New("PD options can't be used with an existing PD client")
+	}
+
+	c, err := newClient(ctx, pdCli, opt)
+	if err != nil {
+		return nil, err
+	}
+	c.externalPDClient = true
+	return c, nil
+}
+
+// NewClientWithRPC creates a client which sends the requests to TiKV through rpcClient and locates the regions with
+// pdCli, so that the requests can be wrapped, proxied or faked by the caller, e.g. in deterministic tests.
+// Neither client is closed by Client.Close.
+func NewClientWithRPC(ctx context.Context, pdCli pd.Client, rpcClient client.Client, opts ...ClientOpt) (*Client, error) {
+	if rpcClient == nil {
+		return nil, errors.New("rpc client is nil")
+	}
+	return NewClientWithPD(ctx, pdCli, config.Security{}, append(opts, WithRPCClient(rpcClient))...)
+}
+
+// storeLabels converts labels to store labels sorted by key.
+func storeLabels(labels map[string]string) []*metapb.StoreLabel {
+	storeLabels := make([]*metapb.StoreLabel, 0, len(labels))
+	for key, value := range labels {
+		storeLabels = append(storeLabels, &metapb.StoreLabel{Key: key, Value: value})
+	}
+	sort.Slice(storeLabels, func(i, j int) bool { return storeLabels[i].Key < storeLabels[j].Key })
+	return storeLabels
+}
+
+func newClient(ctx context.Context, pdCli pd.Client, opt *option) (*Client, error) {
+	var keyspaceID uint32
+	if opt.keyspace != "" {
+		var err error
+		if keyspaceID, err = loadKeyspaceID(ctx, pdCli, opt.keyspace); err != nil {
+			return nil, err
+		}
+	}
+	if opt.apiVersion == kvrpcpb.APIVersion_V2 {
+		pdCli = locate.NewCodecPDClientV2WithKeyspace(pdCli, client.ModeRaw, keyspaceID)
+	}
+
+	rpcClient := opt.rpcClient
+	if rpcClient == nil {
+		dialOptions := opt.gRPCDialOptions
+		if opt.keepAlive != nil {
+			dialOptions = append([]grpc.DialOption{grpc.WithKeepaliveParams(*opt.keepAlive)}, dialOptions...)
+		}
+		if opt.compression != "" {
+			dialOptions = append([]grpc.DialOption{grpc.WithDefaultCallOptions(grpc.UseCompressor(opt.compression))}, dialOptions...)
+		}
+		// The connections may be dropped while the client is idle, so the first request after that is retried
+		// rather than failed.
+		rpcClient = client.NewRPCClient(client.WithSecurity(opt.security), client.WithGRPCDialOptions(dialOptions...),
+			client.WithGRPCConnectionCount(opt.connectionCount), client.WithRetryOnConnectionError())
+	}
+
+	rawkvMetrics, err := opt.rawkvMetrics()
+	if err != nil {
+		return nil, err
+	}
+
+	regionCache := opt.regionCache
+	if regionCache == nil {
+		regionCache = locate.NewRegionCache(pdCli)
+	}
+
+	return &Client{
+		apiVersion:          opt.apiVersion,
+		keyspaceID:          keyspaceID,
+		clusterID:           pdCli.GetClusterID(ctx),
+		regionCache:         regionCache,
+		pdClient:            pdCli,
+		rpcClient:           rpcClient,
+		externalRPCClient:   opt.rpcClient != nil,
+		externalRegionCache: opt.regionCache != nil,
+
+		batchPutSizeLimit:     opt.batchPutSizeLimit,
+		batchPairCountLimit:   opt.batchPairCountLimit,
+		batchConcurrencyLimit: opt.batchConcurrencyLimit,
+		batchSlots:            newBatchSlots(opt.batchConcurrencyLimit),
+		maxBackoff:            opt.maxBackoff,
+		maxScanLimit:          opt.maxScanLimit,
+		backoffFn:             opt.backoffFn,
+		backoffFnCfg:          opt.backoffFnCfg(),
+		preferredLabels:       storeLabels(opt.preferredLabels),
+		rateLimiter:           opt.rateLimiter,
+		byteRateLimiter:       opt.byteRateLimiter,
+		storeBreaker:          opt.storeBreaker(),
+		tracer:                opt.tracer(),
+		rawkvMetrics:          rawkvMetrics,
+		slowLogThreshold:      opt.slowLogThreshold,
+		slowLogKeyRedaction:   opt.slowLogKeyRedaction,
+		stats:                 newClientStats(),
+		retryHook:             opt.retryHook,
+		rpcInterceptor:        opt.rpcInterceptor(),
+		debugRecorder:         newDebugRecorder(opt.debugRecorderSize),
+		coalesceDelay:         opt.coalesceDelay,
+		coalesceBatch:         opt.coalesceBatch,
+	}, nil
+}
+
+// loadKeyspaceID loads the ID of the keyspace from PD.
+func loadKeyspaceID(ctx context.Context, pdCli pd.Client, name string) (uint32, error) {
+	meta, err := pdCli.LoadKeyspace(ctx, name)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if meta == nil {
+		return 0, errors.Wrapf(ErrKeyspaceNotFound, "keyspace %s", name)
+	}
+	if meta.GetState() != keyspacepb.KeyspaceState_ENABLED {
+		return 0, errors.Wrapf(ErrKeyspaceNotEnabled, "keyspace %s is %s", name, meta.GetState())
+	}
+	if meta.GetId() > client.MaxKeyspaceID {
+		return 0, errors.Errorf("invalid ID %d of keyspace %s", meta.GetId(), name)
+	}
+	return meta.GetId(), nil
+}
+
+// Close closes the client. The writes issued by AsyncPut and AsyncDelete before it are sent before it returns.
+func (c *Client) Close() error {
+	c.closeAsync()
+	if c.pdClient != nil && !c.externalPDClient {
+		c.pdClient.Close()
+	}
+	if c.regionCache != nil && !c.externalRegionCache {
+		c.regionCache.Close()
+	}
+	if c.rpcClient == nil || c.externalRPCClient {
+		return nil
+	}
+	return c.rpcClient.Close()
+}
+
+// ReloadSecurity replaces the security config of the connections to TiKV, e.g. after the certificates are rotated.
+// The requests sent afterwards connect with the new config, while the requests in flight finish on the old
+// connections, which are closed later.
+//
+// The connections to PD are not reloaded, as the PD client can't replace its config. The connections it has made
+// keep the certificates they are made with, even when they reconnect, and only a connection to a PD member it
+// hasn't connected to reads the files of the config passed to NewClient again. So the certificates of PD should
+// stay valid until the client is recreated. If the client is created with the PEM blocks of a config, which the PD
+// client never reads again, ReloadSecurity fails without reloading anything.
+//
+// It also fails if the config is invalid, or the RPC client set by WithRPCClient doesn't support it.
+func (c *Client) ReloadSecurity(security config.Security) error {
+	if c.pdSecurityBytes {
+		return errors.New("the PD client can't reload the security config of PEM blocks, recreate the client instead")
+	}
+	reloader, ok := c.rpcClient.(interface {
+		SetSecurity(config.Security) error
+	})
+	if !ok {
+		return errors.New("the RPC client doesn't support reloading security")
+	}
+	return reloader.SetSecurity(security)
+}
+
+// ClusterID returns the TiKV cluster ID.
+func (c *Client) ClusterID() uint64 {
+	return c.clusterID
+}
+
+// KeyspaceID returns the ID of the keyspace set by WithKeyspace, or 0 for the default keyspace.
+func (c *Client) KeyspaceID() uint32 {
+	return c.keyspaceID
+}
+
+// RegionCache returns the region cache of the client, which can be shared with other clients by WithRegionCache.
+func (c *Client) RegionCache() *locate.RegionCache {
+	return c.regionCache
+}
+
+// RegionCacheStats is a snapshot of the statistics of the region cache, which can be marshaled to JSON.
+type RegionCacheStats = locate.RegionCacheStats
+
+// RegionCacheStats returns the statistics of the region cache: the number of the cached regions, the hits and
+// misses of the lookups, the invalidations by the cause and the last time a region is loaded. The statistics are
+// shared by the clients that share the region cache by WithRegionCache.
+func (c *Client) RegionCacheStats() RegionCacheStats {
+	return c.regionCache.Stats()
+}
+
+// InvalidateRegionCache drops the cached regions that intersect with range [startKey, endKey), so that the calls
+// over the range load the regions from PD again. If endKey is empty, it means unbounded.
+func (c *Client) InvalidateRegionCache(startKey, endKey []byte) {
+	c.regionCache.InvalidateCachedRegionsInRange(startKey, endKey)
+}
+
+// ReloadRegionCache reloads all the cached regions from PD, for example after the regions are rebalanced at large
+// or PD fails over, so that the calls don't pay a region miss on the stale regions one by one.
+func (c *Client) ReloadRegionCache(ctx context.Context) (err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.ReloadRegionCache")
+	defer func() { endSpan(span, err) }()
+	_, err = c.regionCache.ReloadCachedRegions(c.newBackoffer(ctx, c.getRawKVOptions()))
+	return err
+}
+
+// UnavailableStores returns the IDs of the stores whose circuit breakers set by WithStoreBreaker are tripped, in
+// ascending order.
+func (c *Client) UnavailableStores() []uint64 {
+	if c.storeBreaker == nil {
+		return nil
+	}
+	return c.storeBreaker.OpenStores()
+}
+
+// RetryBudget returns the max total sleep time in milliseconds of the retries of each call.
+func (c *Client) RetryBudget() int {
+	if c.maxBackoff > 0 {
+		return c.maxBackoff
+	}
+	return rawkvMaxBackoff
+}
+
+// Get queries value with the key. When the key does not exist, it returns `nil, nil`.
+func (c *Client) Get(ctx context.Context, key []byte, options ...RawOption) (_ []byte, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Get")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	defer func() {
+		c.metrics().CmdHistogramWithGet.Observe(time.Since(start).Seconds())
+		c.observeBreakdown(ctx, "get", opts, err)
+	}()
+
+	req := tikvrpc.NewRequest(
+		tikvrpc.CmdRawGet,
+		&kvrpcpb.RawGetRequest{
+			Key: key,
+			Cf:  c.getColumnFamily(opts),
+		})
+	resp, _, err := c.sendReq(ctx, key, req, false, opts)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Resp == nil {
+		return nil, errors.WithStack(tikverr.ErrBodyMissing)
+	}
+	cmdResp := resp.Resp.(*kvrpcpb.RawGetResponse)
+	if err := extractKeyErr(cmdResp.GetError()); err != nil {
+		return nil, err
+	}
+	if cmdResp.NotFound {
+		return nil, nil
+	}
+	return convertNilToEmptySlice(cmdResp.Value), nil
+}
+
+// Exists checks whether the key exists. Unlike Get, only the key is read from TiKV, so the value is never
+// transferred no matter how large it is.
+func (c *Client) Exists(ctx context.Context, key []byte, options ...RawOption) (_ bool, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Exists")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	defer func() {
+		c.metrics().CmdHistogramWithExists.Observe(time.Since(start).Seconds())
+		c.observeBreakdown(ctx, "exists", opts, err)
+	}()
+
+	req := tikvrpc.NewRequest(tikvrpc.CmdRawScan, &kvrpcpb.RawScanRequest{
+		StartKey: key,
+		EndKey:   append(append([]byte{}, key...), 0),
+		Limit:    1,
+		KeyOnly:  true,
+		Cf:       c.getColumnFamily(opts),
+	})
+	resp, _, err := c.sendReq(ctx, key, req, false, opts)
+	if err != nil {
+		return false, err
+	}
+	if resp.Resp == nil {
+		return false, errors.WithStack(tikverr.ErrBodyMissing)
+	}
+	cmdResp := resp.Resp.(*kvrpcpb.RawScanResponse)
+	return len(cmdResp.Kvs) > 0, nil
+}
+
+// BatchExists checks whether the keys exist. The result is aligned with keys. Like Exists, values are never
+// transferred. Keys are grouped by regions and the requests of different regions are sent concurrently.
+func (c *Client) BatchExists(ctx context.Context, keys [][]byte, options ...RawOption) (_ []bool, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.BatchExists")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	defer func() {
+		c.metrics().CmdHistogramWithBatchExists.Observe(time.Since(start).Seconds())
+		c.observeBreakdown(ctx, "batch_exists", opts, err)
+	}()
+
+	// Each key is checked by a single key range, so duplicated keys get their own results.
+	ranges := make([]scanRange, 0, len(keys))
+	for i, key := range keys {
+		ranges = append(ranges, scanRange{idx: i, startKey: key, endKey: append(append([]byte{}, key...), 0)})
+	}
+	opts.KeyOnly = true
+	bo := c.newBackoffer(ctx, opts)
+	results, err := c.sendBatchScanReq(bo, ranges, 1, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	exists := make([]bool, len(keys))
+	for _, result := range results {
+		if len(result.kvs) > 0 {
+			exists[result.idx] = true
+		}
+	}
+	return exists, nil
+}
+
+const rawkvMaxBackoff = 20000
+
+func (c *Client) newBackoffer(ctx context.Context, opts *rawOptions) *retry.Backoffer {
+	maxBackoff := c.RetryBudget()
+	if opts.MaxBackoff > 0 {
+		maxBackoff = opts.MaxBackoff
+	}
+	return retry.NewBackofferWithVars(ctx, maxBackoff, nil).WithSleepFn(c.backoffFn).WithFnCfg(c.backoffFnCfg).WithTracer(c.tracer)
+}
+
+func (c *Client) callTimeout(opts *rawOptions) time.Duration {
+	if opts.CallTimeout > 0 {
+		return opts.CallTimeout
+	}
+	return client.ReadTimeoutShort
+}
+
+// BatchGet queries values with the keys.
+// The values are in the same order as keys, nil for a missing key and []byte{} for a key with an empty value.
+// A repeated key is only queried once, and its value is filled in all its positions.
+func (c *Client) BatchGet(ctx context.Context, keys [][]byte, options ...RawOption) (_ [][]byte, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.BatchGet")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	defer func() {
+		c.metrics().CmdHistogramWithBatchGet.Observe(time.Since(start).Seconds())
+		c.observeBreakdown(ctx, "batch_get", opts, err)
+	}()
+
+	bo := c.newBackoffer(ctx, opts)
+	// The values are written into the positions of the sorted keys directly, so no map from keys to values is built.
+	sortedKeys, idxs := sortKeys(keys)
+	sortedValues := make([][]byte, len(sortedKeys))
+	if err := c.sendBatchGet(bo, sortedKeys, sortedValues, opts); err != nil {
+		return nil, err
+	}
+
+	values := make([][]byte, len(keys))
+	for i, idx := range idxs {
+		values[i] = sortedValues[idx]
+	}
+	return values, nil
+}
+
+// BatchGetWithExistence queries values with the keys like BatchGet, and also tells whether each key exists,
+// so that a missing key can be told from a key with an empty value without checking for nil.
+func (c *Client) BatchGetWithExistence(ctx context.Context, keys [][]byte, options ...RawOption) (_ [][]byte, _ []bool, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.BatchGetWithExistence")
+	defer func() { endSpan(span, err) }()
+	values, err := c.BatchGet(ctx, keys, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	exists := make([]bool, len(values))
+	for i, value := range values {
+		exists[i] = value != nil
+	}
+	return values, exists, nil
+}
+
+// BatchGetPairs queries the keys and returns only the pairs found, in no particular order.
+// It's cheaper than BatchGet for sparse lookups since no positional result is built.
+// Duplicated keys aren't removed, so the caller should deduplicate them if needed.
+func (c *Client) BatchGetPairs(ctx context.Context, keys [][]byte, options ...RawOption) (_ []KvPair, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.BatchGetPairs")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	defer func() {
+		c.metrics().CmdHistogramWithBatchGet.Observe(time.Since(start).Seconds())
+		c.observeBreakdown(ctx, "batch_get", opts, err)
+	}()
+
+	bo := c.newBackoffer(ctx, opts)
+	resp, err := c.sendBatchReq(bo, keys, opts, tikvrpc.CmdRawBatchGet)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Resp == nil {
+		return nil, errors.WithStack(tikverr.ErrBodyMissing)
+	}
+	cmdResp := resp.Resp.(*kvrpcpb.RawBatchGetResponse)
+
+	pairs := make([]KvPair, 0, len(cmdResp.Pairs))
+	for _, pair := range cmdResp.Pairs {
+		pairs = append(pairs, KvPair{Key: pair.Key, Value: convertNilToEmptySlice(pair.Value)})
+	}
+	return pairs, nil
+}
+
+// PutWithTTL stores a key-value pair to TiKV with a time-to-live duration.
+func (c *Client) PutWithTTL(ctx context.Context, key, value []byte, ttl uint64, options ...RawOption) (err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.PutWithTTL")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	defer func() {
+		c.metrics().CmdHistogramWithPut.Observe(time.Since(start).Seconds())
+		c.observeBreakdown(ctx, "put", opts, err)
+	}()
+	c.metrics().SizeHistogramWithKey.Observe(float64(len(key)))
+	c.metrics().SizeHistogramWithValue.Observe(float64(len(value)))
+	if c.coalesceWrite(options) {
+		return c.issueAsync(ctx, &asyncOp{ctx: ctx, key: key, value: value, ttl: ttl, done: make(chan struct{})}).Wait(ctx)
+	}
+
+	req := tikvrpc.NewRequest(tikvrpc.CmdRawPut, &kvrpcpb.RawPutRequest{
+		Key:    key,
+		Value:  value,
+		Ttl:    ttl,
+		Cf:     c.getColumnFamily(opts),
+		ForCas: c.atomic,
+	})
+	resp, _, err := c.sendReq(ctx, key, req, false, opts)
+	if err != nil {
+		return err
+	}
+	if resp.Resp == nil {
+		return errors.WithStack(tikverr.ErrBodyMissing)
+	}
+	cmdResp := resp.Resp.(*kvrpcpb.RawPutResponse)
+	return extractKeyErr(cmdResp.GetError())
+}
+
+// GetKeyTTL get the TTL of a raw key from TiKV if key exists
+func (c *Client) GetKeyTTL(ctx context.Context, key []byte, options ...RawOption) (_ *uint64, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.GetKeyTTL")
+	defer func() { endSpan(span, err) }()
+	var ttl uint64
+	c.metrics().SizeHistogramWithKey.Observe(float64(len(key)))
+
+	opts := c.getRawKVOptions(options...)
+	defer func() { c.observeBreakdown(ctx, "get_key_ttl", opts, err) }()
+	req := tikvrpc.NewRequest(tikvrpc.CmdGetKeyTTL, &kvrpcpb.RawGetKeyTTLRequest{
+		Key: key,
+		Cf:  c.getColumnFamily(opts),
+	})
+	resp, _, err := c.sendReq(ctx, key, req, false, opts)
+
+	if err != nil {
+		return nil, err
+	}
+	if resp.Resp == nil {
+		return nil, errors.WithStack(tikverr.ErrBodyMissing)
+	}
+
+	cmdResp := resp.Resp.(*kvrpcpb.RawGetKeyTTLResponse)
+	if err := extractKeyErr(cmdResp.GetError()); err != nil {
+		return nil, err
+	}
+
+	if cmdResp.GetNotFound() {
+		return nil, nil
+	}
+
+	ttl = cmdResp.GetTtl()
+	return &ttl, nil
+}
+
+// BatchGetKeyTTL gets the TTLs of the keys. The returned TTLs are in the same order as keys,
+// with nil for absent keys and a zero TTL for keys that never expire.
+// The keys are grouped by region, and the groups are queried concurrently.
+func (c *Client) BatchGetKeyTTL(ctx context.Context, keys [][]byte, options ...RawOption) (_ []*uint64, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.BatchGetKeyTTL")
+	defer func() { endSpan(span, err) }()
+	opts := c.getRawKVOptions(options...)
+	defer func() { c.observeBreakdown(ctx, "batch_get_key_ttl", opts, err) }()
+	bo := c.newBackoffer(ctx, opts)
+
+	keyToTTL, err := c.sendBatchGetKeyTTL(bo, dedupKeys(keys), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ttls := make([]*uint64, len(keys))
+	for i, key := range keys {
+		ttls[i] = keyToTTL[string(key)]
+	}
+	return ttls, nil
+}
+
+// GetWithTTL queries the value and the remaining TTL of the key. It returns nil, nil, nil if the key doesn't exist,
+// and a zero TTL if the key never expires.
+// TiKV has no request returning both, so they're read by two requests sent one after another to the region of the key.
+// If the key expires or is deleted between the requests, it's reported as missing; if it's overwritten in between,
+// the TTL of the new value is returned.
+func (c *Client) GetWithTTL(ctx context.Context, key []byte, options ...RawOption) (_ []byte, _ *uint64, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.GetWithTTL")
+	defer func() { endSpan(span, err) }()
+	value, err := c.Get(ctx, key, options...)
+	if err != nil || value == nil {
+		return nil, nil, err
+	}
+	ttl, err := c.GetKeyTTL(ctx, key, options...)
+	if err != nil || ttl == nil {
+		return nil, nil, err
+	}
+	return value, ttl, nil
+}
+
+// GetPDClient returns the PD client.
+func (c *Client) GetPDClient() pd.Client {
+	return c.pdClient
+}
+
+// Put stores a key-value pair to TiKV.
+func (c *Client) Put(ctx context.Context, key, value []byte, options ...RawOption) (err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Put")
+	defer func() { endSpan(span, err) }()
+	return c.PutWithTTL(ctx, key, value, 0, options...)
+}
+
+// BatchPut stores key-value pairs to TiKV. Use WithTTL to give all the pairs the same TTL.
+func (c *Client) BatchPut(ctx context.Context, keys, values [][]byte, options ...RawOption) (err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.BatchPut")
+	defer func() { endSpan(span, err) }()
+	return c.BatchPutWithTTL(ctx, keys, values, nil, options...)
+}
+
+// BatchPutWithTTL stores key-values pairs to TiKV with time-to-live durations.
+func (c *Client) BatchPutWithTTL(ctx context.Context, keys, values [][]byte, ttls []uint64, options ...RawOption) (err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.BatchPutWithTTL")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	defer func() {
+		c.metrics().CmdHistogramWithBatchPut.Observe(time.Since(start).Seconds())
+		c.observeBreakdown(ctx, "batch_put", opts, err)
+	}()
+
+	if len(keys) != len(values) {
+		return errors.New("the len of keys is not equal to the len of values")
+	}
+	if len(ttls) > 0 && len(keys) != len(ttls) {
+		return errors.New("the len of ttls is not equal to the len of values")
+	}
+	bo := c.newBackoffer(ctx, opts)
+	err = c.sendBatchPut(bo, keys, values, ttls, opts)
+	return err
+}
+
+// BatchPutFailure is a group of keys that BatchPutWithResult failed to write.
+// The keys may or may not have been written.
+type BatchPutFailure struct {
+	// RegionID is the region the keys were sent to, 0 if the keys failed to be grouped by region.
+	RegionID   uint64
+	FailedKeys [][]byte
+	Err        error
+}
+
+// BatchPutResult is the outcome of BatchPutWithResult.
+type BatchPutResult struct {
+	// SucceededKeys are the keys definitely written.
+	SucceededKeys [][]byte
+	// Failures are the groups of keys whose request failed, each with its error.
+	Failures []BatchPutFailure
+}
+
+// BatchPutWithResult stores key-value pairs to TiKV like BatchPutWithTTL, and ttls can be nil for no TTL.
+// Instead of one error, it reports which keys are written and which groups of keys failed with what error,
+// so that only the failed keys need to be retried. Unlike BatchPut, a failed batch doesn't cancel the others.
+// The returned error is the error of the failed batch, or a BatchError if more than one batch fails.
+func (c *Client) BatchPutWithResult(ctx context.Context, keys, values [][]byte, ttls []uint64, options ...RawOption) (_ *BatchPutResult, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.BatchPutWithResult")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	defer func() {
+		c.metrics().CmdHistogramWithBatchPut.Observe(time.Since(start).Seconds())
+		c.observeBreakdown(ctx, "batch_put", opts, err)
+	}()
+
+	if len(keys) != len(values) {
+		return nil, errors.New("the len of keys is not equal to the len of values")
+	}
+	if len(ttls) > 0 && len(keys) != len(ttls) {
+		return nil, errors.New("the len of ttls is not equal to the len of values")
+	}
+	bo := c.newBackoffer(ctx, opts)
+	result, err := c.sendBatchPutWithResult(bo, keys, values, ttls, opts, false)
+	return &result, errors.WithStack(err)
+}
+
+// Delete deletes a key-value pair from TiKV.
+func (c *Client) Delete(ctx context.Context, key []byte, options ...RawOption) (err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Delete")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	defer func() {
+		c.metrics().CmdHistogramWithDelete.Observe(time.Since(start).Seconds())
+		c.observeBreakdown(ctx, "delete", opts, err)
+	}()
+	if c.coalesceWrite(options) {
+		return c.issueAsync(ctx, &asyncOp{ctx: ctx, key: key, delete: true, done: make(chan struct{})}).Wait(ctx)
+	}
+
+	req := tikvrpc.NewRequest(tikvrpc.CmdRawDelete, &kvrpcpb.RawDeleteRequest{
+		Key:    key,
+		Cf:     c.getColumnFamily(opts),
+		ForCas: c.atomic,
+	})
+	req.MaxExecutionDurationMs = uint64(client.MaxWriteExecutionTime.Milliseconds())
+	resp, _, err := c.sendReq(ctx, key, req, false, opts)
+	if err != nil {
+		return err
+	}
+	if resp.Resp == nil {
+		return errors.WithStack(tikverr.ErrBodyMissing)
+	}
+	cmdResp := resp.Resp.(*kvrpcpb.RawDeleteResponse)
+	return extractKeyErr(cmdResp.GetError())
+}
+
+// BatchDelete deletes key-value pairs from TiKV.
+// A repeated key is only sent once.
+func (c *Client) BatchDelete(ctx context.Context, keys [][]byte, options ...RawOption) (err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.BatchDelete")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	defer func() {
+		c.metrics().CmdHistogramWithBatchDelete.Observe(time.Since(start).Seconds())
+		c.observeBreakdown(ctx, "batch_delete", opts, err)
+	}()
+
+	bo := c.newBackoffer(ctx, opts)
+	resp, err := c.sendBatchReq(bo, dedupKeys(keys), opts, tikvrpc.CmdRawBatchDelete)
+	if err != nil {
+		return err
+	}
+	if resp.Resp == nil {
+		return errors.WithStack(tikverr.ErrBodyMissing)
+	}
+	cmdResp := resp.Resp.(*kvrpcpb.RawBatchDeleteResponse)
+	return extractKeyErr(cmdResp.GetError())
+}
+
+// DeleteRange deletes all key-value pairs in the [startKey, endKey) range from TiKV.
+// If endKey is empty, it means unbounded.
+func (c *Client) DeleteRange(ctx context.Context, startKey []byte, endKey []byte, options ...RawOption) (err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.DeleteRange")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	defer func() {
+		var label = "delete_range"
+		c.observeBreakdown(ctx, label, opts, err)
+		if err != nil {
+			label += "_error"
+		}
+		c.metrics().CmdHistogram.WithLabelValues(label).Observe(time.Since(start).Seconds())
+	}()
+
+	_, err = c.deleteRange(ctx, startKey, endKey, opts)
+	return err
+}
+
+// BatchDeleteRange deletes all key-value pairs in the [startKey, endKey) range from TiKV like DeleteRange,
+// but the range is split by regions first, and the regions are deleted concurrently, up to the concurrency
+// set by DeleteRangeWithConcurrency.
+// If endKey is empty, it means unbounded.
+// If deleting any region fails, the first error is returned, and the other regions may be partially deleted.
+func (c *Client) BatchDeleteRange(ctx context.Context, startKey []byte, endKey []byte, options ...RawOption) (err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.BatchDeleteRange")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	defer func() {
+		var label = "batch_delete_range"
+		c.observeBreakdown(ctx, label, opts, err)
+		if err != nil {
+			label += "_error"
+		}
+		c.metrics().CmdHistogram.WithLabelValues(label).Observe(time.Since(start).Seconds())
+	}()
+
+	bo := c.newBackoffer(ctx, opts)
+	var ranges []scanRange
+	locateStart := startPhase(bo)
+	ranges, err = c.splitRangeByRegion(bo, startKey, endKey)
+	opts.breakdown.onRegion(bo, locateStart)
+	if err != nil {
+		return err
+	}
+	err = runOnRanges(ctx, ranges, opts.DeleteConcurrency, opts.breakdown, func(ctx context.Context, r scanRange) error {
+		_, err := c.deleteRange(ctx, r.startKey, r.endKey, opts)
+		return err
+	})
+	return err
+}
+
+// DeleteRangeWithDetail deletes all key-value pairs in the [startKey, endKey) range from TiKV like DeleteRange,
+// and reports the regions it has deleted from. With DeleteRangeCountKeys, the keys in the range are counted
+// before the deletion.
+func (c *Client) DeleteRangeWithDetail(ctx context.Context, startKey []byte, endKey []byte, options ...RawOption) (_ DeleteRangeResult, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.DeleteRangeWithDetail")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	var (
+		result DeleteRangeResult
+	)
+	defer func() {
+		var label = "delete_range"
+		c.observeBreakdown(ctx, label, opts, err)
+		if err != nil {
+			label += "_error"
+		}
+		c.metrics().CmdHistogram.WithLabelValues(label).Observe(time.Since(start).Seconds())
+	}()
+
+	if opts.CountKeys {
+		result.Keys, err = c.countKeys(ctx, startKey, endKey, opts)
+		if err != nil {
+			return result, err
+		}
+	}
+	result.Ranges, err = c.deleteRange(ctx, startKey, endKey, opts)
+	result.Regions = len(result.Ranges)
+	return result, err
+}
+
+// deleteRange deletes [startKey, endKey) region by region, and returns the parts deleted so far.
+func (c *Client) deleteRange(ctx context.Context, startKey []byte, endKey []byte, opts *rawOptions) ([]DeletedRange, error) {
+	var deleted []DeletedRange
+	// Process each affected region respectively
+	for len(endKey) == 0 || bytes.Compare(startKey, endKey) < 0 {
+		resp, loc, actualEndKey, err := c.sendDeleteRangeReq(ctx, startKey, endKey, opts)
+		if err != nil {
+			return deleted, err
+		}
+		if resp.Resp == nil {
+			return deleted, errors.WithStack(tikverr.ErrBodyMissing)
+		}
+		cmdResp := resp.Resp.(*kvrpcpb.RawDeleteRangeResponse)
+		if err := extractKeyErr(cmdResp.GetError()); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, DeletedRange{RegionID: loc.Region.GetID(), StartKey: startKey, EndKey: actualEndKey})
+		startKey = actualEndKey
+		if len(startKey) == 0 {
+			break
+		}
+	}
+	return deleted, nil
+}
+
+// countKeys counts the keys in [startKey, endKey) with key-only scans.
+func (c *Client) countKeys(ctx context.Context, startKey, endKey []byte, opts *rawOptions) (uint64, error) {
+	scanOpts := *opts
+	scanOpts.KeyOnly = true
+	var count uint64
+	limit := c.scanLimit()
+	for {
+		keys, _, err := c.scan(ctx, startKey, endKey, limit, &scanOpts)
+		if err != nil {
+			return count, err
+		}
+		count += uint64(len(keys))
+		if len(keys) < limit {
+			return count, nil
+		}
+		lastKey := keys[len(keys)-1]
+		startKey = append(append(make([]byte, 0, len(lastKey)+1), lastKey...), 0)
+	}
+}
+
+// Scan queries continuous kv pairs in range [startKey, endKey), up to limit pairs.
+// The limit should be positive, otherwise ErrInvalidScanLimit is returned.
+// The returned keys are in lexicographical order.
+// If endKey is empty, it means unbounded.
+// If you want to exclude the startKey or include the endKey, push a '\0' to the key. For example, to scan
+// (startKey, endKey], you can write:
+// `Scan(ctx, push(startKey, '\0'), push(endKey, '\0'), limit)`.
+func (c *Client) Scan(ctx context.Context, startKey, endKey []byte, limit int, options ...RawOption,
+) (keys [][]byte, values [][]byte, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Scan")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	defer func() {
+		c.metrics().CmdHistogramWithRawScan.Observe(time.Since(start).Seconds())
+		c.observeBreakdown(ctx, "raw_scan", opts, err)
+	}()
+
+	if limit > c.scanLimit() {
+		return nil, nil, errors.WithStack(ErrMaxScanLimitExceeded)
+	}
+	if limit <= 0 {
+		return nil, nil, errors.WithStack(ErrInvalidScanLimit)
+	}
+
+	if opts.ScanConcurrency > 1 {
+		return c.parallelScan(ctx, startKey, endKey, limit, opts)
+	}
+	return c.scan(ctx, startKey, endKey, limit, opts)
+}
+
+func (c *Client) scan(ctx context.Context, startKey, endKey []byte, limit int, opts *rawOptions) (keys [][]byte, values [][]byte, err error) {
+	for len(keys) < limit && (len(endKey) == 0 || bytes.Compare(startKey, endKey) < 0) {
+		req := tikvrpc.NewRequest(tikvrpc.CmdRawScan, &kvrpcpb.RawScanRequest{
+			StartKey: startKey,
+			EndKey:   endKey,
+			Limit:    uint32(limit - len(keys)),
+			KeyOnly:  opts.KeyOnly,
+			Cf:       c.getColumnFamily(opts),
+		})
+		resp, loc, err := c.sendReq(ctx, startKey, req, false, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.Resp == nil {
+			return nil, nil, errors.WithStack(tikverr.ErrBodyMissing)
+		}
+		cmdResp := resp.Resp.(*kvrpcpb.RawScanResponse)
+		for _, pair := range cmdResp.Kvs {
+			keys = append(keys, pair.Key)
+			values = append(values, convertNilToEmptySlice(pair.Value))
+		}
+		startKey = loc.EndKey
+		if len(startKey) == 0 {
+			break
+		}
+	}
+	return
+}
+
+// parallelScan splits [startKey, endKey) by regions and scans up to opts.ScanConcurrency of them at the same
+// time. Sub-ranges are dispatched in key order, and no more are dispatched once the merged prefix reaches limit.
+func (c *Client) parallelScan(ctx context.Context, startKey, endKey []byte, limit int, opts *rawOptions) (keys [][]byte, values [][]byte, err error) {
+	bo := c.newBackoffer(ctx, opts)
+	start := startPhase(bo)
+	ranges, err := c.splitRangeByRegion(bo, startKey, endKey)
+	opts.breakdown.onRegion(bo, start)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type subScanResult struct {
+		idx          int
+		keys, values [][]byte
+		err          error
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// The channel is large enough for all sub-ranges, so in-flight goroutines never block after we return.
+	ch := make(chan subScanResult, len(ranges))
+	results := make([]*subScanResult, len(ranges))
+	next, merged, inflight := 0, 0, 0
+	for merged < len(ranges) && len(keys) < limit {
+		for inflight < opts.ScanConcurrency && next < len(ranges) {
+			go func(r scanRange) {
+				start := time.Now()
+				keys, values, err := c.scan(ctx, r.startKey, r.endKey, limit, opts)
+				opts.breakdown.onBatch(start)
+				ch <- subScanResult{idx: r.idx, keys: keys, values: values, err: err}
+			}(ranges[next])
+			next++
+			inflight++
+		}
+		res := <-ch
+		inflight--
+		if res.err != nil {
+			return nil, nil, res.err
+		}
+		results[res.idx] = &res
+		for merged < next && results[merged] != nil {
+			keys = append(keys, results[merged].keys...)
+			values = append(values, results[merged].values...)
+			results[merged] = nil
+			merged++
+		}
+	}
+	if len(keys) > limit {
+		keys, values = keys[:limit], values[:limit]
+	}
+	return keys, values, nil
+}
+
+// splitRangeByRegion splits [startKey, endKey) into sub-ranges that each lie in a single region,
+// according to the region cache.
+func (c *Client) splitRangeByRegion(bo *retry.Backoffer, startKey, endKey []byte) ([]scanRange, error) {
+	var ranges []scanRange
+	for len(endKey) == 0 || bytes.Compare(startKey, endKey) < 0 {
+		loc, err := c.regionCache.LocateKey(bo, startKey)
+		if err != nil {
+			return nil, err
+		}
+		r := scanRange{idx: len(ranges), startKey: startKey, endKey: loc.EndKey}
+		if len(endKey) > 0 && (len(loc.EndKey) == 0 || bytes.Compare(loc.EndKey, endKey) > 0) {
+			r.endKey = endKey
+		}
+		ranges = append(ranges, r)
+		if len(r.endKey) == 0 {
+			break
+		}
+		startKey = r.endKey
+	}
+	return ranges, nil
+}
+
+// ReverseScan queries continuous kv pairs in range [endKey, startKey), up to limit pairs.
+// The limit should be positive, otherwise ErrInvalidScanLimit is returned.
+// The returned keys are in reversed lexicographical order.
+// If endKey is empty, it means unbounded.
+// If you want to include the startKey or exclude the endKey, push a '\0' to the key. For example, to scan
+// (endKey, startKey], you can write:
+// `ReverseScan(ctx, push(startKey, '\0'), push(endKey, '\0'), limit)`.
+// If startKey is empty, it scans from the end of the keyspace.
+func (c *Client) ReverseScan(ctx context.Context, startKey, endKey []byte, limit int, options ...RawOption) (keys [][]byte, values [][]byte, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.ReverseScan")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	defer func() {
+		c.metrics().CmdHistogramWithRawReversScan.Observe(time.Since(start).Seconds())
+		c.observeBreakdown(ctx, "raw_reverse_scan", opts, err)
+	}()
+
+	if limit > c.scanLimit() {
+		return nil, nil, errors.WithStack(ErrMaxScanLimitExceeded)
+	}
+	if limit <= 0 {
+		return nil, nil, errors.WithStack(ErrInvalidScanLimit)
+	}
+
+	for len(keys) < limit && (len(startKey) == 0 || bytes.Compare(startKey, endKey) > 0) {
 		req := tikvrpc.NewRequest(tikvrpc.CmdRawScan, &kvrpcpb.RawScanRequest{
 			StartKey: startKey,
 			EndKey:   endKey,
 			Limit:    uint32(limit - len(keys)),
+			Reverse:  true,
 			KeyOnly:  opts.KeyOnly,
 			Cf:       c.getColumnFamily(opts),
 		})
-		resp, loc, err := c.sendReq(ctx, startKey, req, false)
+		resp, loc, err := c.sendReq(ctx, startKey, req, true, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.Resp == nil {
+			return nil, nil, errors.WithStack(tikverr.ErrBodyMissing)
+		}
+		cmdResp := resp.Resp.(*kvrpcpb.RawScanResponse)
+		for _, pair := range cmdResp.Kvs {
+			keys = append(keys, pair.Key)
+			values = append(values, convertNilToEmptySlice(pair.Value))
+		}
+		startKey = loc.StartKey
+		if len(startKey) == 0 {
+			break
+		}
+	}
+	return
+}
+
+// ScanKeys queries continuous keys in range [startKey, endKey), up to limit keys.
+// It works like Scan with ScanKeyOnly, so values are never read from TiKV.
+func (c *Client) ScanKeys(ctx context.Context, startKey, endKey []byte, limit int, options ...RawOption) (_ [][]byte, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.ScanKeys")
+	defer func() { endSpan(span, err) }()
+	keys, _, err := c.Scan(ctx, startKey, endKey, limit, append(options, ScanKeyOnly())...)
+	return keys, err
+}
+
+// ReverseScanKeys queries continuous keys in range [endKey, startKey), up to limit keys.
+// It works like ReverseScan with ScanKeyOnly, so values are never read from TiKV.
+func (c *Client) ReverseScanKeys(ctx context.Context, startKey, endKey []byte, limit int, options ...RawOption) (_ [][]byte, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.ReverseScanKeys")
+	defer func() { endSpan(span, err) }()
+	keys, _, err := c.ReverseScan(ctx, startKey, endKey, limit, append(options, ScanKeyOnly())...)
+	return keys, err
+}
+
+// PrefixScan queries continuous kv pairs whose keys start with prefix, up to limit pairs.
+// The returned keys are in lexicographical order.
+// If prefix consists of 0xFF bytes only, keys are scanned to the end of the keyspace.
+func (c *Client) PrefixScan(ctx context.Context, prefix []byte, limit int, options ...RawOption) (keys [][]byte, values [][]byte, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.PrefixScan")
+	defer func() { endSpan(span, err) }()
+	return c.Scan(ctx, prefix, prefixEndKey(prefix), limit, options...)
+}
+
+// ReversePrefixScan queries continuous kv pairs whose keys start with prefix, up to limit pairs.
+// The returned keys are in reversed lexicographical order.
+func (c *Client) ReversePrefixScan(ctx context.Context, prefix []byte, limit int, options ...RawOption) (keys [][]byte, values [][]byte, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.ReversePrefixScan")
+	defer func() { endSpan(span, err) }()
+	return c.ReverseScan(ctx, prefixEndKey(prefix), prefix, limit, options...)
+}
+
+// prefixEndKey returns the smallest key that is greater than all keys with the given prefix.
+// Trailing 0xFF bytes are dropped before incrementing, and an empty key (meaning unbounded)
+// is returned if the prefix consists of 0xFF bytes only.
+func prefixEndKey(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xFF {
+			end := make([]byte, i+1)
+			copy(end, prefix)
+			end[i]++
+			return end
+		}
+	}
+	return []byte{}
+}
+
+// BatchScan queries continuous kv pairs in the ranges [startKeys[i], endKeys[i]), up to eachLimit pairs for each range.
+// keys[i] and values[i] are the result of the i-th range, and the returned keys of each range are in lexicographical order.
+// If endKeys[i] is empty, it means unbounded.
+// Ranges are split by regions and the requests of different regions are sent concurrently.
+func (c *Client) BatchScan(ctx context.Context, startKeys, endKeys [][]byte, eachLimit int, options ...RawOption,
+) (keys [][][]byte, values [][][]byte, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.BatchScan")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	defer func() {
+		c.metrics().CmdHistogramWithRawBatchScan.Observe(time.Since(start).Seconds())
+		c.observeBreakdown(ctx, "raw_batch_scan", opts, err)
+	}()
+
+	if len(startKeys) != len(endKeys) {
+		return nil, nil, errors.New("the len of startKeys is not equal to the len of endKeys")
+	}
+	if eachLimit > c.scanLimit() {
+		return nil, nil, errors.WithStack(ErrMaxScanLimitExceeded)
+	}
+
+	keys = make([][][]byte, len(startKeys))
+	values = make([][][]byte, len(startKeys))
+	if eachLimit <= 0 {
+		return keys, values, nil
+	}
+
+	ranges := make([]scanRange, 0, len(startKeys))
+	for i := range startKeys {
+		ranges = append(ranges, scanRange{idx: i, startKey: startKeys[i], endKey: endKeys[i]})
+	}
+	bo := c.newBackoffer(ctx, opts)
+	results, err := c.sendBatchScanReq(bo, ranges, eachLimit, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The sub ranges of an input range don't overlap, so ordering them by the start key keeps the keys in order.
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].idx != results[j].idx {
+			return results[i].idx < results[j].idx
+		}
+		return bytes.Compare(results[i].startKey, results[j].startKey) < 0
+	})
+	for _, result := range results {
+		for _, pair := range result.kvs {
+			if len(keys[result.idx]) >= eachLimit {
+				break
+			}
+			keys[result.idx] = append(keys[result.idx], pair.Key)
+			values[result.idx] = append(values[result.idx], convertNilToEmptySlice(pair.Value))
+		}
+	}
+	return keys, values, nil
+}
+
+// Checksum do checksum of continuous kv pairs in range [startKey, endKey).
+// If endKey is empty, it means unbounded.
+// If you want to exclude the startKey or include the endKey, push a '\0' to the key. For example, to scan
+// (startKey, endKey], you can write:
+// `Checksum(ctx, push(startKey, '\0'), push(endKey, '\0'))`.
+// The range is split by regions, which are checksummed concurrently up to the concurrency set by
+// ScanWithConcurrency. The results are combined like TiKV does: Crc64Xor is xor-ed, and the totals are summed.
+func (c *Client) Checksum(ctx context.Context, startKey, endKey []byte, options ...RawOption,
+) (check RawChecksum, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Checksum")
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	defer func() {
+		c.metrics().CmdHistogramWithRawChecksum.Observe(time.Since(start).Seconds())
+		c.observeBreakdown(ctx, "raw_checksum", opts, err)
+	}()
+
+	check, err = c.checksumByRegions(ctx, startKey, endKey, opts)
+	if err != nil {
+		return RawChecksum{0, 0, 0}, err
+	}
+	return check, nil
+}
+
+// Count returns the number of keys in range [startKey, endKey).
+// If endKey is empty, it means unbounded.
+// The keys are counted by TiKV with the checksum RPC, so neither keys nor values are sent back to the client.
+// Regions are counted concurrently, up to the concurrency set by ScanWithConcurrency.
+// If it fails halfway, for example ctx is cancelled, the keys counted so far are returned along with the error.
+func (c *Client) Count(ctx context.Context, startKey, endKey []byte, options ...RawOption) (_ uint64, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Count")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	opts := c.getRawKVOptions(options...)
+	defer func() {
+		c.metrics().CmdHistogramWithCount.Observe(time.Since(start).Seconds())
+		c.observeBreakdown(ctx, "count", opts, err)
+	}()
+
+	check, err := c.checksumByRegions(ctx, startKey, endKey, opts)
+	return check.TotalKvs, err
+}
+
+// defaultCompactTimeout is the time a store is given to compact a range in CompactRange by default.
+const defaultCompactTimeout = 10 * time.Minute
+
+// CompactResult reports how each store handled the compaction of CompactRange.
+type CompactResult struct {
+	// Succeeded holds the IDs of the stores that have compacted the range.
+	Succeeded []uint64
+	// Failed maps the IDs of the stores that failed to compact the range to their errors.
+	Failed map[uint64]error
+}
+
+// CompactRange asks every TiKV store to compact range [startKey, endKey) of the column family,
+// so that the space taken by deleted keys, for example by DeleteRange, is reclaimed.
+// If endKey is empty, it means unbounded.
+// Compaction is slow, so each store is given storeTimeout to finish it, or 10 minutes if storeTimeout is not positive.
+// Stores are compacted concurrently, and the outcome of each store is reported in the result. An error is
+// returned only if the stores can't be listed from PD.
+func (c *Client) CompactRange(ctx context.Context, startKey, endKey []byte, storeTimeout time.Duration, options ...RawOption) (_ *CompactResult, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.CompactRange")
+	defer func() { endSpan(span, err) }()
+	if storeTimeout <= 0 {
+		storeTimeout = defaultCompactTimeout
+	}
+	stores, err := c.pdClient.GetAllStores(ctx, pd.WithExcludeTombstone())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	opts := c.getRawKVOptions(options...)
+	cf := c.getColumnFamily(opts)
+	if cf == "" {
+		cf = "default"
+	}
+	if c.apiVersion == kvrpcpb.APIVersion_V2 {
+		startKey, endKey = client.EncodeV2Range(client.ModeRaw, c.keyspaceID, startKey, endKey)
+	}
+	req := tikvrpc.NewRequest(tikvrpc.CmdDebugCompact, &debugpb.CompactRequest{
+		Db:      debugpb.DB_KV,
+		Cf:      cf,
+		FromKey: dataKey(startKey),
+		ToKey:   dataEndKey(endKey),
+	})
+
+	result := &CompactResult{Failed: make(map[uint64]error)}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, store := range stores {
+		if tikvrpc.GetStoreTypeByMeta(store) != tikvrpc.TiKV {
+			continue
+		}
+		wg.Add(1)
+		go func(store *metapb.Store) {
+			defer wg.Done()
+			_, err := c.rpcClient.SendRequest(ctx, store.GetAddress(), req, storeTimeout)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				result.Failed[store.GetId()] = err
+				return
+			}
+			result.Succeeded = append(result.Succeeded, store.GetId())
+		}(store)
+	}
+	wg.Wait()
+	sort.Slice(result.Succeeded, func(i, j int) bool { return result.Succeeded[i] < result.Succeeded[j] })
+	return result, nil
+}
+
+// healthCheckTimeout bounds Ping and CheckStores, which don't retry, regardless of the retry budget.
+const healthCheckTimeout = 2 * time.Second
+
+// StoreHealth is the health of a TiKV store reported by CheckStores.
+type StoreHealth struct {
+	StoreID uint64
+	Address string
+	// State is the state of the store in PD. A store that is not Up may still be reachable, for example while
+	// it's being taken offline.
+	State metapb.StoreState
+	// Reachable tells whether the store has answered the probe.
+	Reachable bool
+	// Latency is the round-trip time of the probe.
+	Latency time.Duration
+	// Err is the error of the probe if the store is not reachable.
+	Err error
+}
+
+// Ping checks that PD is alive and at least one TiKV store is reachable. It sends lightweight requests that don't
+// touch any data, and returns as soon as a store answers. It doesn't retry, and fails after 2 seconds, or when ctx
+// is done if that's earlier.
+func (c *Client) Ping(ctx context.Context) (err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Ping")
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	stores, err := c.getTiKVStores(ctx)
+	if err != nil {
+		return err
+	}
+	if len(stores) == 0 {
+		return errors.New("no TiKV store in the cluster")
+	}
+	errCh := make(chan error, len(stores))
+	for _, store := range stores {
+		go func(addr string) {
+			_, err := c.probeStore(ctx, addr)
+			errCh <- err
+		}(store.GetAddress())
+	}
+	for range stores {
+		if err = <-errCh; err == nil {
+			return nil
+		}
+	}
+	return errors.WithMessage(err, "no TiKV store is reachable")
+}
+
+// CheckStores probes every TiKV store concurrently with a lightweight request that doesn't touch any data, and
+// reports the health of the stores in ascending order of their IDs. Like Ping, it doesn't retry and is bounded by
+// 2 seconds. An error is returned only if the stores can't be listed from PD.
+func (c *Client) CheckStores(ctx context.Context) (_ []StoreHealth, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.CheckStores")
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	stores, err := c.getTiKVStores(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]StoreHealth, len(stores))
+	var wg sync.WaitGroup
+	for i, store := range stores {
+		result[i] = StoreHealth{StoreID: store.GetId(), Address: store.GetAddress(), State: store.GetState()}
+		wg.Add(1)
+		go func(h *StoreHealth) {
+			defer wg.Done()
+			h.Latency, h.Err = c.probeStore(ctx, h.Address)
+			h.Reachable = h.Err == nil
+		}(&result[i])
+	}
+	wg.Wait()
+	sort.Slice(result, func(i, j int) bool { return result[i].StoreID < result[j].StoreID })
+	return result, nil
+}
+
+// getTiKVStores lists the TiKV stores that are not tombstones from PD, which also tells whether PD is alive.
+func (c *Client) getTiKVStores(ctx context.Context) ([]*metapb.Store, error) {
+	stores, err := c.pdClient.GetAllStores(ctx, pd.WithExcludeTombstone())
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to get stores from PD")
+	}
+	var tikvStores []*metapb.Store
+	for _, store := range stores {
+		if tikvrpc.GetStoreTypeByMeta(store) == tikvrpc.TiKV {
+			tikvStores = append(tikvStores, store)
+		}
+	}
+	return tikvStores, nil
+}
+
+// probeStore asks the store for its safe ts, which is served from memory without reading any data.
+func (c *Client) probeStore(ctx context.Context, addr string) (time.Duration, error) {
+	req := tikvrpc.NewRequest(tikvrpc.CmdStoreSafeTS, &kvrpcpb.StoreSafeTSRequest{KeyRange: &kvrpcpb.KeyRange{}},
+		kvrpcpb.Context{RequestSource: c.requestSource})
+	start := time.Now()
+	_, err := c.rpcClient.SendRequest(ctx, addr, req, healthCheckTimeout)
+	return time.Since(start), errors.WithStack(err)
+}
+
+// scanRegionsLimit is the max number of regions ClusterInfo and PrefetchRegions get from PD at a time.
+const scanRegionsLimit = 1024
+
+// ClusterInfo describes the cluster the client is connected to.
+type ClusterInfo struct {
+	ClusterID uint64
+	// PDLeader is the address of the PD leader, and PDMembers are all the PD members.
+	PDLeader  string
+	PDMembers []*pdpb.Member
+	// Stores are the TiKV stores that are not tombstones, in ascending order of their IDs.
+	Stores []StoreInfo
+	// RegionCount is the number of regions in the key range set by WithRegionRange, or in the whole key space.
+	// It's approximate since the regions may split or merge while they are counted.
+	RegionCount int
+}
+
+// StoreInfo describes a TiKV store in ClusterInfo.
+type StoreInfo struct {
+	StoreID uint64
+	Address string
+	// Version is the version of TiKV running on the store, such as "6.4.0".
+	Version string
+	State   metapb.StoreState
+	Labels  map[string]string
+}
+
+// ClusterInfoOption is an option of ClusterInfo.
+type ClusterInfoOption func(*clusterInfoOptions)
+
+type clusterInfoOptions struct {
+	startKey []byte
+	endKey   []byte
+}
+
+// WithRegionRange makes ClusterInfo count the regions of range [startKey, endKey). If endKey is empty, it means
+// unbounded.
+func WithRegionRange(startKey, endKey []byte) ClusterInfoOption {
+	return func(o *clusterInfoOptions) {
+		o.startKey = startKey
+		o.endKey = endKey
+	}
+}
+
+// ClusterInfo gets the PD members, the TiKV stores with their versions and labels, and the number of regions from
+// PD. It doesn't send any request to TiKV. Tools can check the versions of the stores before relying on features
+// that are missing in old versions, such as CompareAndSwap and TTL.
+func (c *Client) ClusterInfo(ctx context.Context, options ...ClusterInfoOption) (_ ClusterInfo, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.ClusterInfo")
+	defer func() { endSpan(span, err) }()
+	var opts clusterInfoOptions
+	for _, o := range options {
+		o(&opts)
+	}
+	info := ClusterInfo{
+		ClusterID: c.pdClient.GetClusterID(ctx),
+		PDLeader:  c.pdClient.GetLeaderAddr(),
+	}
+	if info.PDMembers, err = c.pdClient.GetAllMembers(ctx); err != nil {
+		return ClusterInfo{}, errors.WithMessage(err, "failed to get members from PD")
+	}
+
+	stores, err := c.getTiKVStores(ctx)
+	if err != nil {
+		return ClusterInfo{}, err
+	}
+	for _, store := range stores {
+		labels := make(map[string]string, len(store.GetLabels()))
+		for _, label := range store.GetLabels() {
+			labels[label.GetKey()] = label.GetValue()
+		}
+		info.Stores = append(info.Stores, StoreInfo{
+			StoreID: store.GetId(),
+			Address: store.GetAddress(),
+			Version: store.GetVersion(),
+			State:   store.GetState(),
+			Labels:  labels,
+		})
+	}
+	sort.Slice(info.Stores, func(i, j int) bool { return info.Stores[i].StoreID < info.Stores[j].StoreID })
+
+	key := opts.startKey
+	for {
+		regions, err := c.pdClient.ScanRegions(ctx, key, opts.endKey, scanRegionsLimit)
+		if err != nil {
+			return ClusterInfo{}, errors.WithMessage(err, "failed to scan regions from PD")
+		}
+		if len(regions) == 0 {
+			break
+		}
+		info.RegionCount += len(regions)
+		key = regions[len(regions)-1].Meta.GetEndKey()
+		if len(key) == 0 || (len(opts.endKey) > 0 && bytes.Compare(key, opts.endKey) >= 0) {
+			break
+		}
+	}
+	return info, nil
+}
+
+// PrefetchOption is an option of PrefetchRegions.
+type PrefetchOption func(*prefetchOptions)
+
+type prefetchOptions struct {
+	connect bool
+}
+
+// PrefetchConnections makes PrefetchRegions also connect to the stores of the leaders of the regions, so that the
+// first requests to them don't wait for the connections.
+func PrefetchConnections() PrefetchOption {
+	return func(o *prefetchOptions) {
+		o.connect = true
+	}
+}
+
+// PrefetchRegions loads the regions of range [startKey, endKey) from PD into the region cache in batches, so that
+// the calls over the range, such as BatchPut, BatchGet and BatchDeleteRange, find the regions in the cache instead
+// of loading them from PD one by one. If endKey is empty, it means unbounded. It returns the number of regions
+// cached. The regions without a leader are skipped, and loaded when they are used.
+func (c *Client) PrefetchRegions(ctx context.Context, startKey, endKey []byte, options ...PrefetchOption) (_ int, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.PrefetchRegions")
+	defer func() { endSpan(span, err) }()
+	var opts prefetchOptions
+	for _, o := range options {
+		o(&opts)
+	}
+	bo := c.newBackoffer(ctx, c.getRawKVOptions())
+	count := 0
+	leaderStores := make(map[uint64]struct{})
+	for {
+		regions, err := c.regionCache.BatchLoadRegionsWithKeyRange(bo, startKey, endKey, scanRegionsLimit)
+		if err != nil {
+			return count, err
+		}
+		count += len(regions)
+		for _, region := range regions {
+			leaderStores[region.GetLeaderStoreID()] = struct{}{}
+		}
+		startKey = regions[len(regions)-1].EndKey()
+		if len(startKey) == 0 || (len(endKey) > 0 && bytes.Compare(startKey, endKey) >= 0) {
+			break
+		}
+	}
+
+	if opts.connect {
+		stores, err := c.getTiKVStores(ctx)
+		if err != nil {
+			return count, err
+		}
+		var wg sync.WaitGroup
+		for _, store := range stores {
+			if _, ok := leaderStores[store.GetId()]; !ok {
+				continue
+			}
+			wg.Add(1)
+			go func(store *metapb.Store) {
+				defer wg.Done()
+				// The store that can't be connected is left to the calls to handle.
+				if _, err := c.probeStore(ctx, store.GetAddress()); err != nil {
+					logutil.Logger(ctx).Warn("failed to connect to store when prefetching regions",
+						zap.Uint64("store", store.GetId()), zap.String("addr", store.GetAddress()), zap.Error(err))
+				}
+			}(store)
+		}
+		wg.Wait()
+	}
+	return count, nil
+}
+
+// dataKey converts a key to the key TiKV stores in RocksDB, which has a 'z' prefix.
+func dataKey(key []byte) []byte {
+	return append([]byte{'z'}, key...)
+}
+
+// dataEndKey is like dataKey, but an empty key means the end of all data keys.
+func dataEndKey(key []byte) []byte {
+	if len(key) == 0 {
+		return []byte{'z' + 1}
+	}
+	return dataKey(key)
+}
+
+// CompareAndSwap results in an atomic compare-and-set operation for the given key while SetAtomicForCAS(true)
+// If the value retrieved is equal to previousValue, newValue is written.
+// It returns the previous value and whether the value is successfully swapped.
+// The TTL of newValue can be set by WithTTL; ErrTTLNotEnabled is returned if TTL is disabled in TiKV.
+//
+// If SetAtomicForCAS(false), it will returns an error because
+// CAS operations enforce the client should operate in atomic mode.
+//
+// NOTE: This feature is experimental. It depends on the single-row transaction mechanism of TiKV which is conflict
+// with the normal write operation in rawkv mode. If multiple clients exist, it's up to the clients the sync the atomic mode flag.
+// If some clients write in atomic mode but the other don't, the linearizability of TiKV will be violated.
+func (c *Client) CompareAndSwap(ctx context.Context, key, previousValue, newValue []byte, options ...RawOption) (_ []byte, _ bool, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.CompareAndSwap")
+	defer func() { endSpan(span, err) }()
+	if !c.atomic {
+		return nil, false, errors.New("using CompareAndSwap without enable atomic mode")
+	}
+	opts := c.getRawKVOptions(options...)
+	defer func() { c.observeBreakdown(ctx, "cas", opts, err) }()
+	return c.compareAndSwap(ctx, key, previousValue, newValue, opts)
+}
+
+// PutIfAbsent writes the key-value pair only if the key doesn't exist, in one atomic operation.
+// It returns whether the pair is inserted, and the existing value if it isn't.
+// The TTL of the inserted value can be set by WithTTL.
+//
+// Like CompareAndSwap, it requires SetAtomicForCAS(true), otherwise ErrAtomicModeRequired is returned.
+func (c *Client) PutIfAbsent(ctx context.Context, key, value []byte, options ...RawOption) (existingValue []byte, inserted bool, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.PutIfAbsent")
+	defer func() { endSpan(span, err) }()
+	if !c.atomic {
+		return nil, false, errors.WithStack(ErrAtomicModeRequired)
+	}
+	opts := c.getRawKVOptions(options...)
+	defer func() { c.observeBreakdown(ctx, "put_if_absent", opts, err) }()
+	existingValue, inserted, err = c.compareAndSwap(ctx, key, nil, value, opts)
+	if err != nil || inserted {
+		return nil, inserted, err
+	}
+	return existingValue, false, nil
+}
+
+// GetAndPut writes the value and returns the value it replaces, or nil if the key was absent.
+// The swap is done by CAS requests: a failed CAS returns the current value, which is expected by the next one,
+// until one succeeds. So it's atomic even with concurrent writers. The retries back off on conflicts, and
+// ErrCASConflict is returned if the backoff is exhausted. The TTL of the value can be set by WithTTL.
+//
+// Like CompareAndSwap, it requires SetAtomicForCAS(true), otherwise ErrAtomicModeRequired is returned.
+func (c *Client) GetAndPut(ctx context.Context, key, value []byte, options ...RawOption) (_ []byte, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.GetAndPut")
+	defer func() { endSpan(span, err) }()
+	if !c.atomic {
+		return nil, errors.WithStack(ErrAtomicModeRequired)
+	}
+	var previous []byte
+	opts := c.getRawKVOptions(options...)
+	defer func() { c.observeBreakdown(ctx, "get_and_put", opts, err) }()
+	_, err = c.casUpdate(ctx, key, func(current []byte) ([]byte, error) {
+		previous = current
+		return value, nil
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// CASOp is a compare-and-swap operation of BatchCompareAndSwap.
+type CASOp struct {
+	Key []byte
+	// Previous is the expected value of Key. A nil Previous means Key is expected to be absent.
+	Previous []byte
+	New      []byte
+	// TTL is the time-to-live of New, 0 means no TTL.
+	TTL uint64
+}
+
+// CASResult is the result of a CASOp.
+type CASResult struct {
+	// Succeed tells whether New is written.
+	Succeed bool
+	// PreviousValue is the value before the operation, it's nil if the key didn't exist.
+	PreviousValue []byte
+	// Err is the error of the operation, if any.
+	Err error
+}
+
+// BatchCompareAndSwap executes each of ops as an independent CompareAndSwap; no atomicity across keys is promised.
+// TiKV has no batch CAS request, so every op is an RPC of its own. The ops of different keys are sent concurrently,
+// at most WithBatchConcurrency at a time, across and within regions, and the ops of the same key are executed in order.
+// Results are returned in the order of ops. If some ops fail, the others still have their results, and the first
+// error is returned as well.
+//
+// Like CompareAndSwap, it requires SetAtomicForCAS(true), otherwise ErrAtomicModeRequired is returned.
+func (c *Client) BatchCompareAndSwap(ctx context.Context, ops []CASOp, options ...RawOption) (_ []CASResult, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.BatchCompareAndSwap")
+	defer func() { endSpan(span, err) }()
+	if !c.atomic {
+		return nil, errors.WithStack(ErrAtomicModeRequired)
+	}
+
+	opts := c.getRawKVOptions(options...)
+	defer func() { c.observeBreakdown(ctx, "batch_cas", opts, err) }()
+	bo := c.newBackoffer(ctx, opts)
+	// groupIdxs are the indexes of the ops grouped by key, in the order of ops.
+	groups := make(map[string]int)
+	var groupIdxs [][]int
+	for i, op := range ops {
+		g, ok := groups[string(op.Key)]
+		if !ok {
+			g = len(groupIdxs)
+			groups[string(op.Key)] = g
+			groupIdxs = append(groupIdxs, nil)
+		}
+		groupIdxs[g] = append(groupIdxs[g], i)
+	}
+
+	results := make([]CASResult, len(ops))
+	// The ops fail one by one, so a failed op doesn't stop the others, and only a done ctx is returned here.
+	err = c.runBatches(bo, opts, len(groupIdxs), false, func(bo *retry.Backoffer, g int) error {
+		for _, i := range groupIdxs[g] {
+			opOpts := *opts
+			opOpts.TTL = ops[i].TTL
+			prev, succeed, err := c.compareAndSwap(bo.GetCtx(), ops[i].Key, ops[i].Previous, ops[i].New, &opOpts)
+			results[i] = CASResult{Succeed: succeed, PreviousValue: prev, Err: err}
+		}
+		return nil
+	})
+	if err != nil {
+		return results, err
+	}
+
+	for _, result := range results {
+		if result.Err != nil {
+			return results, result.Err
+		}
+	}
+	return results, nil
+}
+
+// compareAndSwap sends a RawCAS request. A nil previousValue means the key is expected to be absent.
+func (c *Client) compareAndSwap(ctx context.Context, key, previousValue, newValue []byte, opts *rawOptions) ([]byte, bool, error) {
+	reqArgs := kvrpcpb.RawCASRequest{
+		Key:   key,
+		Value: newValue,
+		Cf:    c.getColumnFamily(opts),
+		Ttl:   opts.TTL,
+	}
+	if previousValue == nil {
+		reqArgs.PreviousNotExist = true
+	} else {
+		reqArgs.PreviousValue = previousValue
+	}
+
+	req := tikvrpc.NewRequest(tikvrpc.CmdRawCompareAndSwap, &reqArgs)
+	req.MaxExecutionDurationMs = uint64(client.MaxWriteExecutionTime.Milliseconds())
+	resp, _, err := c.sendReq(ctx, key, req, false, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.Resp == nil {
+		return nil, false, errors.WithStack(tikverr.ErrBodyMissing)
+	}
+
+	cmdResp := resp.Resp.(*kvrpcpb.RawCASResponse)
+	if err := extractKeyErr(cmdResp.GetError()); err != nil {
+		return nil, false, err
+	}
+
+	if cmdResp.PreviousNotExist {
+		return nil, cmdResp.Succeed, nil
+	}
+	return convertNilToEmptySlice(cmdResp.PreviousValue), cmdResp.Succeed, nil
+}
+
+// sendToRegion sends req to the region by sender after waiting for the rate limits, tagged with the request source,
+// the resource group tag and the priority.
+// A read is sent to the replicas set by WithReplicaRead, preferring the stores matching the labels set by
+// WithPreferredLabels.
+func (c *Client) sendToRegion(bo *retry.Backoffer, sender *locate.RegionRequestSender, req *tikvrpc.Request, regionID locate.RegionVerID, opts *rawOptions) (*tikvrpc.Response, error) {
+	start := startPhase(bo)
+	c.stats.onSend(req)
+	debugReq := c.debugRecorder.begin(bo)
+	resp, err := c.traceSendToRegion(bo, sender, req, regionID, opts)
+	c.debugRecorder.record(debugReq, bo, sender, req, regionID, resp, err, c.slowLogKeyRedaction)
+	c.stats.onResponse(resp, err)
+	c.observeError(req.Type, resp, err)
+	opts.breakdown.onRPC(bo, start)
+	opts.breakdown.onSent(bo, sender, req, regionID)
+	return resp, err
+}
+
+// The kinds of the errors counted by the error counter of the rawkv metrics.
+const (
+	errorKindRegion           = "region_error"
+	errorKindRPC              = "rpc_error"
+	errorKindServerKey        = "server_key_error"
+	errorKindContextCanceled  = "context_canceled"
+	errorKindRetriesExhausted = "retries_exhausted"
+)
+
+// errorCmdLabels are the command labels of the error counter.
+var errorCmdLabels = map[tikvrpc.CmdType]string{
+	tikvrpc.CmdRawGet:            "get",
+	tikvrpc.CmdRawBatchGet:       "batch_get",
+	tikvrpc.CmdRawPut:            "put",
+	tikvrpc.CmdRawBatchPut:       "batch_put",
+	tikvrpc.CmdRawDelete:         "delete",
+	tikvrpc.CmdRawBatchDelete:    "batch_delete",
+	tikvrpc.CmdRawDeleteRange:    "delete_range",
+	tikvrpc.CmdRawScan:           "raw_scan",
+	tikvrpc.CmdRawBatchScan:      "raw_batch_scan",
+	tikvrpc.CmdGetKeyTTL:         "get_key_ttl",
+	tikvrpc.CmdRawCompareAndSwap: "compare_and_swap",
+	tikvrpc.CmdRawChecksum:       "raw_checksum",
+}
+
+// observeError counts the error of a request of cmd, which is either err or the error in resp:
+//   - "region_error": TiKV responds with a region error, whether the request is retried or not.
+//   - "server_key_error": TiKV responds with an error message, see ServerError.
+//   - "context_canceled": the context of the call is canceled or its deadline is exceeded.
+//   - "rpc_error": the request fails to be sent for any other reason.
+//
+// The calls that fail before they send any request, e.g. to locate the region of the key, aren't counted.
+func (c *Client) observeError(cmd tikvrpc.CmdType, resp *tikvrpc.Response, err error) {
+	switch {
+	case err != nil:
+		if sendErrorCategory(err) == errorCanceled {
+			c.countError(cmd, errorKindContextCanceled)
+		} else {
+			c.countError(cmd, errorKindRPC)
+		}
+	case resp == nil:
+	default:
+		if regionErr, _ := resp.GetRegionError(); regionErr != nil {
+			c.countError(cmd, errorKindRegion)
+		} else if m, ok := resp.Resp.(interface{ GetError() string }); ok && m.GetError() != "" {
+			c.countError(cmd, errorKindServerKey)
+		}
+	}
+}
+
+// countError increments the error counter of cmd and kind. The errors of the requests are counted by observeError
+// when the requests return, and the calls that give up retrying on region errors are counted by
+// backoffOnRegionError.
+func (c *Client) countError(cmd tikvrpc.CmdType, kind string) {
+	label, ok := errorCmdLabels[cmd]
+	if !ok {
+		label = cmd.String()
+	}
+	c.metrics().ErrorCounter.WithLabelValues(label, kind).Inc()
+}
+
+func (c *Client) traceSendToRegion(bo *retry.Backoffer, sender *locate.RegionRequestSender, req *tikvrpc.Request, regionID locate.RegionVerID, opts *rawOptions) (*tikvrpc.Response, error) {
+	if c.tracer == nil {
+		return c.doSendToRegion(bo, sender, req, regionID, opts)
+	}
+	_, span := c.tracer.Start(bo.GetCtx(), "rawkv.RegionRequest", trace.WithAttributes(
+		attribute.String("cmd", req.Type.String()),
+		attribute.Int64("region", int64(regionID.GetID())),
+	))
+	backoffs, totalSleep := bo.GetTotalBackoffTimes(), bo.GetTotalSleep()
+	resp, err := c.doSendToRegion(bo, sender, req, regionID, opts)
+	span.SetAttributes(
+		attribute.String("store", sender.GetStoreAddr()),
+		attribute.Int("retries", bo.GetTotalBackoffTimes()-backoffs),
+		attribute.Int("backoff_ms", bo.GetTotalSleep()-totalSleep),
+	)
+	if err == nil {
+		if regionErr, _ := resp.GetRegionError(); regionErr != nil {
+			span.SetAttributes(attribute.String("region_error", regionErr.String()))
+		}
+	}
+	endSpan(span, err)
+	return resp, err
+}
+
+// logSlowCall logs the call of cmd with ctx when it returns err if it has taken longer than the slow log threshold, along
+// with the last request it has sent. A call is logged whether it fails or not.
+func (c *Client) logSlowCall(ctx context.Context, cmd string, opts *rawOptions, err error) {
+	b := opts.breakdown
+	if b == nil || b.start.IsZero() {
+		return
+	}
+	elapsed := time.Since(b.start)
+	if elapsed < c.slowLogThreshold {
+		return
+	}
+	breakdown := b.get()
+	retries := 0
+	for _, n := range breakdown.Retries {
+		retries += n
+	}
+	fields := []zap.Field{zap.String("cmd", cmd)}
+	if last := b.lastSent(); last != nil {
+		fields = append(fields,
+			zap.String("request", last.cmd.String()),
+			zap.String("key", c.slowLogKeyRedaction.redact(last.key)),
+			zap.Uint64("region", last.region),
+			zap.String("store", last.store),
+			zap.Any("backoffs", last.backoffs))
+	}
+	fields = append(fields,
+		zap.Duration("elapsed", elapsed),
+		zap.Duration("rpcTime", breakdown.RPCTime),
+		zap.Duration("backoffTime", breakdown.BackoffTime),
+		zap.Duration("regionTime", breakdown.RegionTime),
+		zap.Int("retries", retries))
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	logutil.Logger(ctx).Warn("slow rawkv call", fields...)
+}
+
+// requestKeys returns the key, the first key or the start key of a rawkv request, the end key of a range request, and
+// the number of the keys, the pairs or the ranges of a batch request.
+func requestKeys(req *tikvrpc.Request) (startKey, endKey []byte, count int) {
+	switch req.Type {
+	case tikvrpc.CmdRawGet:
+		return req.RawGet().GetKey(), nil, 0
+	case tikvrpc.CmdRawBatchGet:
+		if keys := req.RawBatchGet().GetKeys(); len(keys) > 0 {
+			return keys[0], nil, len(keys)
+		}
+	case tikvrpc.CmdRawPut:
+		return req.RawPut().GetKey(), nil, 0
+	case tikvrpc.CmdRawBatchPut:
+		if pairs := req.RawBatchPut().GetPairs(); len(pairs) > 0 {
+			return pairs[0].GetKey(), nil, len(pairs)
+		}
+	case tikvrpc.CmdRawDelete:
+		return req.RawDelete().GetKey(), nil, 0
+	case tikvrpc.CmdRawBatchDelete:
+		if keys := req.RawBatchDelete().GetKeys(); len(keys) > 0 {
+			return keys[0], nil, len(keys)
+		}
+	case tikvrpc.CmdRawDeleteRange:
+		return req.RawDeleteRange().GetStartKey(), req.RawDeleteRange().GetEndKey(), 0
+	case tikvrpc.CmdRawScan:
+		return req.RawScan().GetStartKey(), req.RawScan().GetEndKey(), 0
+	case tikvrpc.CmdRawBatchScan:
+		if ranges := req.RawBatchScan().GetRanges(); len(ranges) > 0 {
+			return ranges[0].GetStartKey(), ranges[len(ranges)-1].GetEndKey(), len(ranges)
+		}
+	case tikvrpc.CmdGetKeyTTL:
+		return req.RawGetKeyTTL().GetKey(), nil, 0
+	case tikvrpc.CmdRawCompareAndSwap:
+		return req.RawCompareAndSwap().GetKey(), nil, 0
+	case tikvrpc.CmdRawChecksum:
+		if ranges := req.RawChecksum().GetRanges(); len(ranges) > 0 {
+			return ranges[0].GetStartKey(), ranges[len(ranges)-1].GetEndKey(), len(ranges)
+		}
+	}
+	return nil, nil, 0
+}
+
+func (c *Client) doSendToRegion(bo *retry.Backoffer, sender *locate.RegionRequestSender, req *tikvrpc.Request, regionID locate.RegionVerID, opts *rawOptions) (*tikvrpc.Response, error) {
+	if err := c.waitRateLimit(bo.GetCtx(), req); err != nil {
+		return nil, err
+	}
+	if c.storeBreaker != nil {
+		if !opts.ReplicaRead.IsFollowerRead() || !isReadCmd(req.Type) {
+			if err := c.checkLeaderStore(regionID); err != nil {
+				return nil, err
+			}
+		}
+		sender.SetStoreBreaker(c.storeBreaker)
+	}
+	req.RequestSource = c.requestSource
+	if opts.RequestSource != "" {
+		req.RequestSource = opts.RequestSource
+	}
+	req.ResourceGroupTag = c.resourceGroupTag
+	if opts.ResourceGroupTag != nil {
+		req.ResourceGroupTag = opts.ResourceGroupTag
+	}
+	req.Priority = kvrpcpb.CommandPri(opts.Priority)
+	if !opts.ReplicaRead.IsFollowerRead() || !isReadCmd(req.Type) {
+		return sender.SendReq(bo, req, regionID, c.callTimeout(opts))
+	}
+	req.ReplicaRead = true
+	req.ReplicaReadType = opts.ReplicaRead
+	if len(c.preferredLabels) == 0 {
+		return sender.SendReq(bo, req, regionID, c.callTimeout(opts))
+	}
+	resp, rpcCtx, err := sender.SendReqCtx(bo, req, regionID, c.callTimeout(opts), tikvrpc.TiKV, locate.WithMatchLabels(c.preferredLabels))
+	if err == nil && rpcCtx != nil && rpcCtx.Store != nil {
+		local := rpcCtx.Store.IsLabelsMatch(c.preferredLabels)
+		if local {
+			c.metrics().ReplicaReadLocal.Inc()
+		} else {
+			c.metrics().ReplicaReadRemote.Inc()
+		}
+		logutil.BgLogger().Debug("rawkv replica read",
+			zap.Uint64("region", regionID.GetID()),
+			zap.Uint64("store", rpcCtx.Store.StoreID()),
+			zap.String("addr", rpcCtx.Addr),
+			zap.Bool("local", local))
+	}
+	return resp, err
+}
+
+// tracerName is the name of the tracer of the client.
+const tracerName = "github.com/tikv/client-go/v2/rawkv"
+
+// metrics returns the metrics the client observes to.
+func (c *Client) metrics() *metrics.RawkvMetrics {
+	if c.rawkvMetrics == nil {
+		return metrics.DefaultRawkvMetrics
+	}
+	return c.rawkvMetrics
+}
+
+// observeBreakdown observes the breakdown of the call of cmd, which is labeled like the cmd histogram, adds it to
+// the stats set by WithRuntimeStats, and logs the call if it's slow.
+func (c *Client) observeBreakdown(ctx context.Context, cmd string, opts *rawOptions, err error) {
+	c.logSlowCall(ctx, cmd, opts, err)
+	breakdown := opts.breakdown.get()
+	m := c.metrics()
+	cmdMetrics := m.Cmd(cmd)
+	cmdMetrics.RPCDuration.Observe(breakdown.RPCTime.Seconds())
+	cmdMetrics.BackoffDuration.Observe(breakdown.BackoffTime.Seconds())
+	cmdMetrics.RegionDuration.Observe(breakdown.RegionTime.Seconds())
+	if breakdown.Batches > 0 {
+		cmdMetrics.BatchCount.Observe(float64(breakdown.Batches))
+		cmdMetrics.MaxBatchDuration.Observe(breakdown.MaxBatchTime.Seconds())
+	}
+	if breakdown.Regions > 0 {
+		cmdMetrics.BatchRegionCount.Observe(float64(breakdown.Regions))
+	}
+	for _, size := range opts.breakdown.getBatchSizes() {
+		cmdMetrics.BatchPairs.Observe(float64(size.pairs))
+		cmdMetrics.BatchBytes.Observe(float64(size.bytes))
+	}
+	if breakdown.RetriedBatches > 0 {
+		cmdMetrics.BatchRetry.Add(float64(breakdown.RetriedBatches))
+	}
+	for typ, n := range breakdown.Retries {
+		m.RetryCounter.WithLabelValues(typ).Add(float64(n))
+	}
+	if opts.stats != nil {
+		opts.stats.mergeBreakdown(breakdown)
+	}
+}
+
+// noopSpan is returned by startSpan if the client is not traced.
+var noopSpan = trace.SpanFromContext(context.Background())
+
+// startSpan starts the span of a call if the client is traced. Otherwise it returns ctx and a no-op span without
+// allocating anything.
+func (c *Client) startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	if c.tracer == nil {
+		return ctx, noopSpan
+	}
+	return c.tracer.Start(ctx, name)
+}
+
+// endSpan records err on the span if it's not nil, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil && span.IsRecording() {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// newSender creates a RegionRequestSender for a call. A sender keeps the state of the requests of the call, such as
+// the replicas that have been tried, so it's not shared with other calls. It doesn't escape, so it's cheap to create.
+func (c *Client) newSender(opts *rawOptions) *locate.RegionRequestSender {
+	rpcClient := c.rpcClient
+	if c.rpcInterceptor != nil {
+		rpcClient = &interceptedClient{Client: c.rpcClient, interceptor: c.rpcInterceptor}
+	}
+	sender := locate.NewRegionRequestSender(c.regionCache, rpcClient)
+	if opts.stats != nil {
+		sender.RegionRequestRuntimeStats = locate.NewRegionRequestRuntimeStats()
+	}
+	if c.retryHook != nil {
+		sender.SetRetryHook(c.onSenderRetry)
+	}
+	return sender
+}
+
+// interceptedClient sends the requests through the interceptor set by WithRPCInterceptor.
+type interceptedClient struct {
+	client.Client
+	interceptor interceptor.RPCInterceptor
+}
+
+func (c *interceptedClient) SendRequest(ctx context.Context, addr string, req *tikvrpc.Request, timeout time.Duration) (*tikvrpc.Response, error) {
+	return c.interceptor(func(target string, req *tikvrpc.Request) (*tikvrpc.Response, error) {
+		return c.Client.SendRequest(ctx, target, req, timeout)
+	})(addr, req)
+}
+
+// onSenderRetry passes a retry of the region request sender to the retry hook.
+func (c *Client) onSenderRetry(req *tikvrpc.Request, regionID locate.RegionVerID, regionErr *errorpb.Error, backoff string, sleep time.Duration) {
+	event := RetryEvent{Cmd: req.Type, RegionID: regionID.GetID(), Backoff: backoff, Sleep: sleep}
+	if regionErr != nil {
+		event.RegionError = locate.RegionErrorToLabel(regionErr)
+	}
+	c.retryHook(event)
+}
+
+// collectStats adds the RPCs sent by the sender to the stats set by WithRuntimeStats.
+func (c *Client) collectStats(sender *locate.RegionRequestSender, opts *rawOptions) {
+	if opts.stats != nil {
+		opts.stats.merge(sender.RegionRequestRuntimeStats)
+	}
+}
+
+// checkLeaderStore fails a request to the leader of the region at once if the breaker of the leader's store is
+// tripped, without trying the followers, which only redirect the request to the leader. The cached region is
+// invalidated, so that the next request reloads it from PD and finds a leader elected on another store.
+func (c *Client) checkLeaderStore(regionID locate.RegionVerID) error {
+	region := c.regionCache.GetCachedRegionWithRLock(regionID)
+	if region == nil {
+		return nil
+	}
+	storeID := region.GetLeaderStoreID()
+	if !c.storeBreaker.Unavailable(storeID) {
+		return nil
+	}
+	c.regionCache.InvalidateCachedRegion(regionID)
+	return errors.WithStack(&tikverr.ErrStoreUnavailable{StoreID: storeID})
+}
+
+// waitRateLimit blocks until the rate limiters of the client allow req to be sent, or ctx is done.
+func (c *Client) waitRateLimit(ctx context.Context, req *tikvrpc.Request) error {
+	if c.rateLimiter != nil {
+		if err := c.rateLimiter.Wait(ctx); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if c.byteRateLimiter != nil {
+		n := 0
+		if m, ok := req.Req.(interface{ Size() int }); ok {
+			n = m.Size()
+		}
+		// WaitN fails at once if n exceeds the burst.
+		if burst := c.byteRateLimiter.Burst(); n > burst {
+			n = burst
+		}
+		if err := c.byteRateLimiter.WaitN(ctx, n); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// isReadCmd tells whether the command only reads, so that it can be sent to the replicas other than the leader.
+func isReadCmd(cmd tikvrpc.CmdType) bool {
+	switch cmd {
+	case tikvrpc.CmdRawGet, tikvrpc.CmdRawBatchGet, tikvrpc.CmdGetKeyTTL, tikvrpc.CmdRawScan, tikvrpc.CmdRawBatchScan:
+		return true
+	}
+	return false
+}
+
+func (c *Client) sendReq(ctx context.Context, key []byte, req *tikvrpc.Request, reverse bool, opts *rawOptions) (*tikvrpc.Response, *locate.KeyLocation, error) {
+	bo := c.newBackoffer(ctx, opts)
+	sender := c.newSender(opts)
+	defer c.collectStats(sender, opts)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		var loc *locate.KeyLocation
+		var err error
+		start := startPhase(bo)
+		if reverse && len(key) == 0 {
+			loc, err = c.regionCache.LocateLastRegion(bo)
+		} else if reverse {
+			loc, err = c.regionCache.LocateEndKey(bo, key)
+		} else {
+			loc, err = c.regionCache.LocateKey(bo, key)
+		}
+		opts.breakdown.onRegion(bo, start)
 		if err != nil {
 			return nil, nil, err
 		}
-		if resp.Resp == nil {
-			return nil, nil, errors.WithStack(tikverr.ErrBodyMissing)
+		resp, err := c.sendToRegion(bo, sender, req, loc.Region, opts)
+		if err != nil {
+			return nil, nil, err
 		}
-		cmdResp := resp.Resp.(*kvrpcpb.RawScanResponse)
-		for _, pair := range cmdResp.Kvs {
-			keys = append(keys, pair.Key)
-			values = append(values, convertNilToEmptySlice(pair.Value))
+		regionErr, err := resp.GetRegionError()
+		if err != nil {
+			return nil, nil, err
 		}
-		startKey = loc.EndKey
-		if len(startKey) == 0 {
-			break
+		if regionErr != nil {
+			err := c.backoffOnRegionError(bo, req.Type, loc.Region, regionErr, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			continue
 		}
+		return resp, loc, nil
 	}
-	return
 }
 
-// ReverseScan queries continuous kv pairs in range [endKey, startKey), up to limit pairs.
-// The returned keys are in reversed lexicographical order.
-// If endKey is empty, it means unbounded.
-// If you want to include the startKey or exclude the endKey, push a '\0' to the key. For example, to scan
-// (endKey, startKey], you can write:
-// `ReverseScan(ctx, push(startKey, '\0'), push(endKey, '\0'), limit)`.
-// It doesn't support Scanning from "", because locating the last Region is not yet implemented.
-func (c *Client) ReverseScan(ctx context.Context, startKey, endKey []byte, limit int, options ...RawOption) (keys [][]byte, values [][]byte, err error) {
-	start := time.Now()
-	defer func() {
-		metrics.RawkvCmdHistogramWithRawReversScan.Observe(time.Since(start).Seconds())
-	}()
-
-	if limit > MaxRawKVScanLimit {
-		return nil, nil, errors.WithStack(ErrMaxScanLimitExceeded)
+// backoffOnRegionError backs off before a request that met a region error is sent again. The region request
+// sender has already retried the errors it can resolve in place and updated or invalidated the cached region
+// when the error warrants it, so only the wait before the next attempt is chosen here by the kind of the error.
+// If the ctx of bo is done, the ctx error is returned rather than the region error. If the call has retried as
+// many times as opts allows, an ErrRetriesExhausted is returned instead of backing off. The retry of the request of
+// cmd to the region is passed to the retry hook of the client, and giving up is counted by the error counter.
+func (c *Client) backoffOnRegionError(bo *retry.Backoffer, cmd tikvrpc.CmdType, regionID locate.RegionVerID, regionErr *errorpb.Error, opts *rawOptions) error {
+	opts.breakdown.onRetry(regionErr)
+	if opts.retries != nil && int(atomic.AddInt32(opts.retries, 1)) > opts.MaxRetries {
+		c.countError(cmd, errorKindRetriesExhausted)
+		return errors.WithStack(&ErrRetriesExhausted{
+			Retries:   opts.MaxRetries,
+			Backoff:   time.Duration(bo.GetTotalSleep()) * time.Millisecond,
+			RegionErr: regionErr,
+		})
+	}
+	cfg := retry.BoRegionMiss
+	switch {
+	case regionErr.GetEpochNotMatch() != nil && !locate.IsFakeRegionError(regionErr):
+		// The cache is updated with the current regions, so the request can be relocated at once.
+		if err := bo.GetCtx().Err(); err != nil {
+			c.countError(cmd, errorKindContextCanceled)
+			return errors.WithStack(err)
+		}
+		c.onRetry(cmd, regionID, regionErr, "", 0)
+		return nil
+	case regionErr.GetNotLeader() != nil:
+		// The leader is moving to another peer; retry soon instead of waiting for a region reload.
+		cfg = retry.BoRegionScheduling
+	case regionErr.GetServerIsBusy() != nil:
+		// The store is overloaded but the region is still valid; wait longer with jitter.
+		cfg = retry.BoTiKVServerBusy
 	}
+	sleep := bo.GetTotalSleep()
+	defer opts.breakdown.onBackoff(bo, sleep)
+	if err := bo.Backoff(cfg, errors.New(regionErr.String())); err != nil {
+		if ctxErr := bo.GetCtx().Err(); ctxErr != nil {
+			c.countError(cmd, errorKindContextCanceled)
+			return errors.WithStack(ctxErr)
+		}
+		// The backoffer has slept as long as it allows.
+		c.countError(cmd, errorKindRetriesExhausted)
+		return err
+	}
+	c.onRetry(cmd, regionID, regionErr, cfg.String(), time.Duration(bo.GetTotalSleep()-sleep)*time.Millisecond)
+	return nil
+}
 
-	opts := c.getRawKVOptions(options...)
+// onRetry passes a retry of a call to the retry hook if it's set.
+func (c *Client) onRetry(cmd tikvrpc.CmdType, regionID locate.RegionVerID, regionErr *errorpb.Error, backoff string, sleep time.Duration) {
+	if c.retryHook == nil {
+		return
+	}
+	c.retryHook(RetryEvent{
+		Cmd:         cmd,
+		RegionID:    regionID.GetID(),
+		RegionError: locate.RegionErrorToLabel(regionErr),
+		Backoff:     backoff,
+		Sleep:       sleep,
+	})
+}
 
-	for len(keys) < limit && bytes.Compare(startKey, endKey) > 0 {
-		req := tikvrpc.NewRequest(tikvrpc.CmdRawScan, &kvrpcpb.RawScanRequest{
-			StartKey: startKey,
-			EndKey:   endKey,
-			Limit:    uint32(limit - len(keys)),
-			Reverse:  true,
-			KeyOnly:  opts.KeyOnly,
-			Cf:       c.getColumnFamily(opts),
+func (c *Client) sendBatchReq(bo *retry.Backoffer, keys [][]byte, options *rawOptions, cmdType tikvrpc.CmdType) (*tikvrpc.Response, error) {
+	var resp *tikvrpc.Response
+	switch cmdType {
+	case tikvrpc.CmdRawBatchGet:
+		resp = &tikvrpc.Response{Resp: &kvrpcpb.RawBatchGetResponse{}}
+	case tikvrpc.CmdRawBatchDelete:
+		resp = &tikvrpc.Response{Resp: &kvrpcpb.RawBatchDeleteResponse{}}
+	}
+	for len(keys) > 0 {
+		if err := bo.GetCtx().Err(); err != nil {
+			return resp, errors.WithStack(err)
+		}
+		// split the keys
+		start := startPhase(bo)
+		groups, _, err := c.regionCache.GroupKeysByRegion(bo, keys, nil)
+		options.breakdown.onRegion(bo, start)
+		if err != nil {
+			return resp, err
+		}
+		var batches []kvrpc.Batch
+		for regionID, groupKeys := range groups {
+			batches = kvrpc.AppendKeyBatches(batches, regionID, groupKeys, rawBatchKeysSize, c.batchPairCount())
+		}
+		options.breakdown.onSplit(len(groups), kvBatchSizes(batches))
+		results := make([]kvrpc.BatchResult, len(batches))
+		regionErrs := make([]*errorpb.Error, len(batches))
+		err = c.runBatches(bo, options, len(batches), true, func(bo *retry.Backoffer, i int) error {
+			results[i], regionErrs[i] = c.doBatchReq(bo, batches[i], options, cmdType)
+			return annotateBatchErr(results[i].Error, batches[i].RegionID.GetID(), batches[i].Keys[0])
 		})
-		resp, loc, err := c.sendReq(ctx, startKey, req, true)
 		if err != nil {
-			return nil, nil, err
+			return resp, errors.WithStack(err)
+		}
+
+		// The keys of the batches that meet region errors are grouped by the refreshed regions and sent again.
+		var (
+			regionErr *errorpb.Error
+			regionID  locate.RegionVerID
+		)
+		keys = keys[:0:0]
+		for i, result := range results {
+			if regionErrs[i] != nil {
+				regionErr, regionID = regionErrs[i], batches[i].RegionID
+				keys = append(keys, batches[i].Keys...)
+				options.breakdown.onBatchRetry(1)
+			} else if cmdType == tikvrpc.CmdRawBatchGet {
+				cmdResp := result.Resp.(*kvrpcpb.RawBatchGetResponse)
+				resp.Resp.(*kvrpcpb.RawBatchGetResponse).Pairs = append(resp.Resp.(*kvrpcpb.RawBatchGetResponse).Pairs, cmdResp.Pairs...)
+			}
+		}
+		if regionErr != nil {
+			if err := c.backoffOnRegionError(bo, cmdType, regionID, regionErr, options); err != nil {
+				return resp, err
+			}
+			options.breakdown.onRegroup()
 		}
+	}
+	return resp, nil
+}
+
+// doBatchReq sends the request of a batch. If the region of the batch has changed, the region error is returned
+// for the caller to retry the batch.
+func (c *Client) doBatchReq(bo *retry.Backoffer, batch kvrpc.Batch, options *rawOptions, cmdType tikvrpc.CmdType) (kvrpc.BatchResult, *errorpb.Error) {
+	var req *tikvrpc.Request
+	switch cmdType {
+	case tikvrpc.CmdRawBatchGet:
+		req = tikvrpc.NewRequest(cmdType, &kvrpcpb.RawBatchGetRequest{
+			Keys: batch.Keys,
+			Cf:   c.getColumnFamily(options),
+		})
+	case tikvrpc.CmdRawBatchDelete:
+		req = tikvrpc.NewRequest(cmdType, &kvrpcpb.RawBatchDeleteRequest{
+			Keys:   batch.Keys,
+			Cf:     c.getColumnFamily(options),
+			ForCas: c.atomic,
+		})
+	}
+
+	sender := c.newSender(options)
+	defer c.collectStats(sender, options)
+	req.MaxExecutionDurationMs = uint64(client.MaxWriteExecutionTime.Milliseconds())
+	resp, err := c.sendToRegion(bo, sender, req, batch.RegionID, options)
+
+	batchResp := kvrpc.BatchResult{}
+	if err != nil {
+		batchResp.Error = err
+		return batchResp, nil
+	}
+	regionErr, err := resp.GetRegionError()
+	if err != nil {
+		batchResp.Error = err
+		return batchResp, nil
+	}
+	if regionErr != nil {
+		return batchResp, regionErr
+	}
+
+	switch cmdType {
+	case tikvrpc.CmdRawBatchGet:
+		batchResp.Response = resp
+	case tikvrpc.CmdRawBatchDelete:
 		if resp.Resp == nil {
-			return nil, nil, errors.WithStack(tikverr.ErrBodyMissing)
+			batchResp.Error = errors.WithStack(tikverr.ErrBodyMissing)
+			return batchResp, nil
 		}
-		cmdResp := resp.Resp.(*kvrpcpb.RawScanResponse)
-		for _, pair := range cmdResp.Kvs {
-			keys = append(keys, pair.Key)
-			values = append(values, convertNilToEmptySlice(pair.Value))
+		cmdResp := resp.Resp.(*kvrpcpb.RawBatchDeleteResponse)
+		if err := extractKeyErr(cmdResp.GetError()); err != nil {
+			batchResp.Error = err
+			return batchResp, nil
 		}
-		startKey = loc.StartKey
-		if len(startKey) == 0 {
-			break
+		batchResp.Response = resp
+	}
+	return batchResp, nil
+}
+
+// getBatch is a batch of sorted keys of a region for BatchGet. The value of keys[i] is written into values[i].
+type getBatch struct {
+	regionID locate.RegionVerID
+	keys     [][]byte
+	values   [][]byte
+	// size is the total size of the keys.
+	size int
+}
+
+// sendBatchGet gets the values of the sorted and unique keys into values, which has the same length as keys.
+func (c *Client) sendBatchGet(bo *retry.Backoffer, keys, values [][]byte, opts *rawOptions) error {
+	pending := []getBatch{{keys: keys, values: values}}
+	for len(pending) > 0 {
+		if err := bo.GetCtx().Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		var batches []getBatch
+		for _, p := range pending {
+			var err error
+			start := startPhase(bo)
+			batches, err = c.appendGetBatches(bo, batches, p.keys, p.values)
+			opts.breakdown.onRegion(bo, start)
+			if err != nil {
+				return err
+			}
+		}
+		// The keys are sorted, so the batches of a region are adjacent.
+		regions, sizes := 0, make([]batchSize, len(batches))
+		for i, batch := range batches {
+			if i == 0 || batch.regionID != batches[i-1].regionID {
+				regions++
+			}
+			sizes[i] = batchSize{pairs: len(batch.keys), bytes: batch.size}
+		}
+		opts.breakdown.onSplit(regions, sizes)
+		regionErrs := make([]*errorpb.Error, len(batches))
+		err := c.runBatches(bo, opts, len(batches), true, func(bo *retry.Backoffer, i int) error {
+			var err error
+			regionErrs[i], err = c.doBatchGet(bo, batches[i], opts)
+			return annotateBatchErr(err, batches[i].regionID.GetID(), batches[i].keys[0])
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		// The batches that meet region errors are split by the refreshed regions and sent again.
+		var (
+			regionErr *errorpb.Error
+			regionID  locate.RegionVerID
+		)
+		pending = pending[:0]
+		for i, batch := range batches {
+			if regionErrs[i] != nil {
+				regionErr, regionID = regionErrs[i], batch.regionID
+				pending = append(pending, batch)
+				opts.breakdown.onBatchRetry(1)
+			}
+		}
+		if regionErr != nil {
+			if err := c.backoffOnRegionError(bo, tikvrpc.CmdRawBatchGet, regionID, regionErr, opts); err != nil {
+				return err
+			}
+			opts.breakdown.onRegroup()
 		}
 	}
-	return
+	return nil
 }
 
-// Checksum do checksum of continuous kv pairs in range [startKey, endKey).
-// If endKey is empty, it means unbounded.
-// If you want to exclude the startKey or include the endKey, push a '\0' to the key. For example, to scan
-// (startKey, endKey], you can write:
-// `Checksum(ctx, push(startKey, '\0'), push(endKey, '\0'))`.
-func (c *Client) Checksum(ctx context.Context, startKey, endKey []byte, options ...RawOption,
-) (check RawChecksum, err error) {
+// appendGetBatches splits the sorted keys by regions and limits, and appends the batches to batches.
+func (c *Client) appendGetBatches(bo *retry.Backoffer, batches []getBatch, keys, values [][]byte) ([]getBatch, error) {
+	for start := 0; start < len(keys); {
+		loc, err := c.regionCache.LocateKey(bo, keys[start])
+		if err != nil {
+			return nil, err
+		}
+		end, size := start+1, len(keys[start])
+		for end < len(keys) && end-start < c.batchPairCount() && size+len(keys[end]) <= rawBatchKeysSize && loc.Contains(keys[end]) {
+			size += len(keys[end])
+			end++
+		}
+		batches = append(batches, getBatch{regionID: loc.Region, keys: keys[start:end], values: values[start:end], size: size})
+		start = end
+	}
+	return batches, nil
+}
 
-	start := time.Now()
-	defer func() { metrics.RawkvCmdHistogramWithRawChecksum.Observe(time.Since(start).Seconds()) }()
+// doBatchGet gets the values of a batch. If the region of the batch has changed, the region error is returned
+// for the caller to retry the batch.
+func (c *Client) doBatchGet(bo *retry.Backoffer, batch getBatch, opts *rawOptions) (*errorpb.Error, error) {
+	req := tikvrpc.NewRequest(tikvrpc.CmdRawBatchGet, &kvrpcpb.RawBatchGetRequest{
+		Keys: batch.keys,
+		Cf:   c.getColumnFamily(opts),
+	})
+	sender := c.newSender(opts)
+	defer c.collectStats(sender, opts)
+	resp, err := c.sendToRegion(bo, sender, req, batch.regionID, opts)
+	if err != nil {
+		return nil, err
+	}
+	regionErr, err := resp.GetRegionError()
+	if err != nil {
+		return nil, err
+	}
+	if regionErr != nil {
+		return regionErr, nil
+	}
+	if resp.Resp == nil {
+		return nil, errors.WithStack(tikverr.ErrBodyMissing)
+	}
 
-	for len(endKey) == 0 || bytes.Compare(startKey, endKey) < 0 {
-		req := tikvrpc.NewRequest(tikvrpc.CmdRawChecksum, &kvrpcpb.RawChecksumRequest{
-			Algorithm: kvrpcpb.ChecksumAlgorithm_Crc64_Xor,
-			Ranges: []*kvrpcpb.KeyRange{{
-				StartKey: startKey,
-				EndKey:   endKey,
-			}},
+	cmdResp := resp.Resp.(*kvrpcpb.RawBatchGetResponse)
+	i := 0
+	for _, pair := range cmdResp.Pairs {
+		// The pairs are returned in the order of the keys, fall back to binary search in case they aren't.
+		for i < len(batch.keys) && bytes.Compare(batch.keys[i], pair.Key) < 0 {
+			i++
+		}
+		if i >= len(batch.keys) || !bytes.Equal(batch.keys[i], pair.Key) {
+			i = sort.Search(len(batch.keys), func(j int) bool { return bytes.Compare(batch.keys[j], pair.Key) >= 0 })
+			if i >= len(batch.keys) || !bytes.Equal(batch.keys[i], pair.Key) {
+				i = 0
+				continue
+			}
+		}
+		batch.values[i] = convertNilToEmptySlice(pair.Value)
+	}
+	return nil, nil
+}
+
+func (c *Client) sendBatchGetKeyTTL(bo *retry.Backoffer, keys [][]byte, opts *rawOptions) (map[string]*uint64, error) {
+	ttls := make(map[string]*uint64, len(keys))
+	for len(keys) > 0 {
+		if err := bo.GetCtx().Err(); err != nil {
+			return ttls, errors.WithStack(err)
+		}
+		start := startPhase(bo)
+		groups, _, err := c.regionCache.GroupKeysByRegion(bo, keys, nil)
+		opts.breakdown.onRegion(bo, start)
+		if err != nil {
+			return ttls, err
+		}
+		var batches []kvrpc.Batch
+		for regionID, groupKeys := range groups {
+			batches = kvrpc.AppendKeyBatches(batches, regionID, groupKeys, rawBatchKeysSize, rawBatchTTLKeyCount)
+		}
+		opts.breakdown.onSplit(len(groups), kvBatchSizes(batches))
+		results := make([]batchTTLResult, len(batches))
+		err = c.runBatches(bo, opts, len(batches), true, func(bo *retry.Backoffer, i int) error {
+			var err error
+			results[i], err = c.doBatchGetKeyTTL(bo, batches[i], opts)
+			return annotateBatchErr(err, batches[i].RegionID.GetID(), batches[i].Keys[0])
 		})
-		resp, loc, err := c.sendReq(ctx, startKey, req, false)
 		if err != nil {
-			return RawChecksum{0, 0, 0}, err
+			return ttls, errors.WithStack(err)
 		}
-		if resp.Resp == nil {
-			return RawChecksum{0, 0, 0}, errors.WithStack(tikverr.ErrBodyMissing)
+
+		// Only the keys that haven't been queried are grouped by the refreshed regions and queried again.
+		var (
+			regionErr *errorpb.Error
+			regionID  locate.RegionVerID
+		)
+		keys = keys[:0:0]
+		for i, result := range results {
+			for key, ttl := range result.ttls {
+				ttls[key] = ttl
+			}
+			if result.regionErr != nil {
+				regionErr, regionID = result.regionErr, batches[i].RegionID
+				keys = append(keys, result.retryKeys...)
+				opts.breakdown.onBatchRetry(1)
+			}
 		}
-		cmdResp := resp.Resp.(*kvrpcpb.RawChecksumResponse)
-		check.Crc64Xor ^= cmdResp.GetChecksum()
-		check.TotalKvs += cmdResp.GetTotalKvs()
-		check.TotalBytes += cmdResp.GetTotalBytes()
-		startKey = loc.EndKey
-		if len(startKey) == 0 {
-			break
+		if regionErr != nil {
+			if err := c.backoffOnRegionError(bo, tikvrpc.CmdGetKeyTTL, regionID, regionErr, opts); err != nil {
+				return ttls, err
+			}
+			opts.breakdown.onRegroup()
+		}
+	}
+	return ttls, nil
+}
+
+// batchTTLResult is the result of a batch of BatchGetKeyTTL. If the batch meets a region error, retryKeys are
+// the keys that haven't been queried.
+type batchTTLResult struct {
+	ttls      map[string]*uint64
+	retryKeys [][]byte
+	regionErr *errorpb.Error
+}
+
+func (c *Client) doBatchGetKeyTTL(bo *retry.Backoffer, batch kvrpc.Batch, opts *rawOptions) (batchTTLResult, error) {
+	sender := c.newSender(opts)
+	defer c.collectStats(sender, opts)
+	result := batchTTLResult{ttls: make(map[string]*uint64, len(batch.Keys))}
+	for i, key := range batch.Keys {
+		req := tikvrpc.NewRequest(tikvrpc.CmdGetKeyTTL, &kvrpcpb.RawGetKeyTTLRequest{
+			Key: key,
+			Cf:  c.getColumnFamily(opts),
+		})
+		resp, err := c.sendToRegion(bo, sender, req, batch.RegionID, opts)
+		if err != nil {
+			return result, err
+		}
+		regionErr, err := resp.GetRegionError()
+		if err != nil {
+			return result, err
+		}
+		if regionErr != nil {
+			result.retryKeys, result.regionErr = batch.Keys[i:], regionErr
+			return result, nil
+		}
+		if resp.Resp == nil {
+			return result, errors.WithStack(tikverr.ErrBodyMissing)
+		}
+		cmdResp := resp.Resp.(*kvrpcpb.RawGetKeyTTLResponse)
+		if err := extractKeyErr(cmdResp.GetError()); err != nil {
+			return result, err
+		}
+		if !cmdResp.GetNotFound() {
+			ttl := cmdResp.GetTtl()
+			result.ttls[string(key)] = &ttl
 		}
 	}
-	return
+	return result, nil
 }
 
-// CompareAndSwap results in an atomic compare-and-set operation for the given key while SetAtomicForCAS(true)
-// If the value retrieved is equal to previousValue, newValue is written.
-// It returns the previous value and whether the value is successfully swapped.
-//
-// If SetAtomicForCAS(false), it will returns an error because
-// CAS operations enforce the client should operate in atomic mode.
-//
-// NOTE: This feature is experimental. It depends on the single-row transaction mechanism of TiKV which is conflict
-// with the normal write operation in rawkv mode. If multiple clients exist, it's up to the clients the sync the atomic mode flag.
-// If some clients write in atomic mode but the other don't, the linearizability of TiKV will be violated.
-func (c *Client) CompareAndSwap(ctx context.Context, key, previousValue, newValue []byte, options ...RawOption) ([]byte, bool, error) {
-	if !c.atomic {
-		return nil, false, errors.New("using CompareAndSwap without enable atomic mode")
-	}
-
-	opts := c.getRawKVOptions(options...)
-	reqArgs := kvrpcpb.RawCASRequest{
-		Key:   key,
-		Value: newValue,
-		Cf:    c.getColumnFamily(opts),
-	}
-	if previousValue == nil {
-		reqArgs.PreviousNotExist = true
-	} else {
-		reqArgs.PreviousValue = previousValue
-	}
+// scanRange is a range to be scanned by BatchScan. idx is the index of the input range it belongs to.
+type scanRange struct {
+	idx      int
+	startKey []byte
+	endKey   []byte
+}
 
-	req := tikvrpc.NewRequest(tikvrpc.CmdRawCompareAndSwap, &reqArgs)
-	req.MaxExecutionDurationMs = uint64(client.MaxWriteExecutionTime.Milliseconds())
-	resp, _, err := c.sendReq(ctx, key, req, false)
-	if err != nil {
-		return nil, false, err
-	}
-	if resp.Resp == nil {
-		return nil, false, errors.WithStack(tikverr.ErrBodyMissing)
-	}
+func (r *scanRange) contains(key []byte) bool {
+	return bytes.Compare(key, r.startKey) >= 0 && (len(r.endKey) == 0 || bytes.Compare(key, r.endKey) < 0)
+}
 
-	cmdResp := resp.Resp.(*kvrpcpb.RawCASResponse)
-	if cmdResp.GetError() != "" {
-		return nil, false, errors.New(cmdResp.GetError())
-	}
+type scanRangeResult struct {
+	scanRange
+	kvs []*kvrpcpb.KvPair
+}
 
-	if cmdResp.PreviousNotExist {
-		return nil, cmdResp.Succeed, nil
-	}
-	return convertNilToEmptySlice(cmdResp.PreviousValue), cmdResp.Succeed, nil
+type scanBatch struct {
+	regionID locate.RegionVerID
+	ranges   []scanRange
 }
 
-func (c *Client) sendReq(ctx context.Context, key []byte, req *tikvrpc.Request, reverse bool) (*tikvrpc.Response, *locate.KeyLocation, error) {
-	bo := retry.NewBackofferWithVars(ctx, rawkvMaxBackoff, nil)
-	sender := locate.NewRegionRequestSender(c.regionCache, c.rpcClient)
-	for {
-		var loc *locate.KeyLocation
-		var err error
-		if reverse {
-			loc, err = c.regionCache.LocateEndKey(bo, key)
-		} else {
-			loc, err = c.regionCache.LocateKey(bo, key)
+func (c *Client) sendBatchScanReq(bo *retry.Backoffer, ranges []scanRange, eachLimit int, options *rawOptions) ([]scanRangeResult, error) {
+	var results []scanRangeResult
+	for len(ranges) > 0 {
+		if err := bo.GetCtx().Err(); err != nil {
+			return results, errors.WithStack(err)
 		}
+		start := startPhase(bo)
+		batches, err := c.splitScanBatches(bo, ranges)
+		options.breakdown.onRegion(bo, start)
 		if err != nil {
-			return nil, nil, err
+			return results, err
 		}
-		resp, err := sender.SendReq(bo, req, loc.Region, client.ReadTimeoutShort)
+		batchResults := make([][]scanRangeResult, len(batches))
+		regionErrs := make([]*errorpb.Error, len(batches))
+		err = c.runBatches(bo, options, len(batches), true, func(bo *retry.Backoffer, i int) error {
+			var err error
+			batchResults[i], regionErrs[i], err = c.doBatchScanReq(bo, batches[i], eachLimit, options)
+			return annotateBatchErr(err, batches[i].regionID.GetID(), batches[i].ranges[0].startKey)
+		})
 		if err != nil {
-			return nil, nil, err
+			return results, errors.WithStack(err)
 		}
-		regionErr, err := resp.GetRegionError()
-		if err != nil {
-			return nil, nil, err
+
+		// Only the ranges of the batches that meet region errors are split by the refreshed regions and sent again.
+		var (
+			regionErr *errorpb.Error
+			regionID  locate.RegionVerID
+		)
+		ranges = ranges[:0:0]
+		for i, batchResult := range batchResults {
+			if regionErrs[i] != nil {
+				regionErr, regionID = regionErrs[i], batches[i].regionID
+				ranges = append(ranges, batches[i].ranges...)
+				continue
+			}
+			results = append(results, batchResult...)
 		}
 		if regionErr != nil {
-			err := bo.Backoff(retry.BoRegionMiss, errors.New(regionErr.String()))
-			if err != nil {
-				return nil, nil, err
+			if err := c.backoffOnRegionError(bo, tikvrpc.CmdRawBatchScan, regionID, regionErr, options); err != nil {
+				return results, err
 			}
-			continue
+			options.breakdown.onRegroup()
 		}
-		return resp, loc, nil
 	}
+	return results, nil
 }
 
-func (c *Client) sendBatchReq(bo *retry.Backoffer, keys [][]byte, options *rawOptions, cmdType tikvrpc.CmdType) (*tikvrpc.Response, error) { // split the keys
-	groups, _, err := c.regionCache.GroupKeysByRegion(bo, keys, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	var batches []kvrpc.Batch
-	for regionID, groupKeys := range groups {
-		batches = kvrpc.AppendKeyBatches(batches, regionID, groupKeys, rawBatchPairCount)
-	}
-	bo, cancel := bo.Fork()
-	ches := make(chan kvrpc.BatchResult, len(batches))
-	for _, batch := range batches {
-		batch1 := batch
-		go func() {
-			singleBatchBackoffer, singleBatchCancel := bo.Fork()
-			defer singleBatchCancel()
-			ches <- c.doBatchReq(singleBatchBackoffer, batch1, options, cmdType)
-		}()
+// splitScanBatches splits the ranges by regions, and puts the sub ranges of each region into batches.
+func (c *Client) splitScanBatches(bo *retry.Backoffer, ranges []scanRange) ([]scanBatch, error) {
+	groups := make(map[locate.RegionVerID][]scanRange)
+	for _, r := range ranges {
+		startKey := r.startKey
+		for len(r.endKey) == 0 || bytes.Compare(startKey, r.endKey) < 0 {
+			loc, err := c.regionCache.LocateKey(bo, startKey)
+			if err != nil {
+				return nil, err
+			}
+			sub := scanRange{idx: r.idx, startKey: startKey, endKey: r.endKey}
+			if len(loc.EndKey) > 0 && (len(r.endKey) == 0 || bytes.Compare(loc.EndKey, r.endKey) < 0) {
+				sub.endKey = loc.EndKey
+			}
+			groups[loc.Region] = append(groups[loc.Region], sub)
+			startKey = loc.EndKey
+			if len(startKey) == 0 {
+				break
+			}
+		}
 	}
 
-	var firstError error
-	var resp *tikvrpc.Response
-	switch cmdType {
-	case tikvrpc.CmdRawBatchGet:
-		resp = &tikvrpc.Response{Resp: &kvrpcpb.RawBatchGetResponse{}}
-	case tikvrpc.CmdRawBatchDelete:
-		resp = &tikvrpc.Response{Resp: &kvrpcpb.RawBatchDeleteResponse{}}
-	}
-	for i := 0; i < len(batches); i++ {
-		singleResp, ok := <-ches
-		if ok {
-			if singleResp.Error != nil {
-				cancel()
-				if firstError == nil {
-					firstError = errors.WithStack(singleResp.Error)
-				}
-			} else if cmdType == tikvrpc.CmdRawBatchGet {
-				cmdResp := singleResp.Resp.(*kvrpcpb.RawBatchGetResponse)
-				resp.Resp.(*kvrpcpb.RawBatchGetResponse).Pairs = append(resp.Resp.(*kvrpcpb.RawBatchGetResponse).Pairs, cmdResp.Pairs...)
+	var batches []scanBatch
+	for regionID, groupRanges := range groups {
+		for len(groupRanges) > 0 {
+			n := len(groupRanges)
+			if n > c.batchPairCount() {
+				n = c.batchPairCount()
 			}
+			batches = append(batches, scanBatch{regionID: regionID, ranges: groupRanges[:n]})
+			groupRanges = groupRanges[n:]
 		}
 	}
-
-	return resp, firstError
+	return batches, nil
 }
 
-func (c *Client) doBatchReq(bo *retry.Backoffer, batch kvrpc.Batch, options *rawOptions, cmdType tikvrpc.CmdType) kvrpc.BatchResult {
-	var req *tikvrpc.Request
-	switch cmdType {
-	case tikvrpc.CmdRawBatchGet:
-		req = tikvrpc.NewRequest(cmdType, &kvrpcpb.RawBatchGetRequest{
-			Keys: batch.Keys,
-			Cf:   c.getColumnFamily(options),
-		})
-	case tikvrpc.CmdRawBatchDelete:
-		req = tikvrpc.NewRequest(cmdType, &kvrpcpb.RawBatchDeleteRequest{
-			Keys:   batch.Keys,
-			Cf:     c.getColumnFamily(options),
-			ForCas: c.atomic,
-		})
+// doBatchScanReq scans the ranges of a batch. If the region of the batch has changed, the region error is returned
+// for the caller to retry the batch.
+func (c *Client) doBatchScanReq(bo *retry.Backoffer, batch scanBatch, eachLimit int, options *rawOptions) ([]scanRangeResult, *errorpb.Error, error) {
+	keyRanges := make([]*kvrpcpb.KeyRange, 0, len(batch.ranges))
+	for _, r := range batch.ranges {
+		keyRanges = append(keyRanges, &kvrpcpb.KeyRange{StartKey: r.startKey, EndKey: r.endKey})
 	}
+	req := tikvrpc.NewRequest(tikvrpc.CmdRawBatchScan, &kvrpcpb.RawBatchScanRequest{
+		Ranges:    keyRanges,
+		EachLimit: uint32(eachLimit),
+		KeyOnly:   options.KeyOnly,
+		Cf:        c.getColumnFamily(options),
+	})
 
-	sender := locate.NewRegionRequestSender(c.regionCache, c.rpcClient)
-	req.MaxExecutionDurationMs = uint64(client.MaxWriteExecutionTime.Milliseconds())
-	resp, err := sender.SendReq(bo, req, batch.RegionID, client.ReadTimeoutShort)
-
-	batchResp := kvrpc.BatchResult{}
+	sender := c.newSender(options)
+	defer c.collectStats(sender, options)
+	resp, err := c.sendToRegion(bo, sender, req, batch.regionID, options)
 	if err != nil {
-		batchResp.Error = err
-		return batchResp
+		return nil, nil, err
 	}
 	regionErr, err := resp.GetRegionError()
 	if err != nil {
-		batchResp.Error = err
-		return batchResp
+		return nil, nil, err
 	}
 	if regionErr != nil {
-		err := bo.Backoff(retry.BoRegionMiss, errors.New(regionErr.String()))
-		if err != nil {
-			batchResp.Error = err
-			return batchResp
+		return nil, regionErr, nil
+	}
+	if resp.Resp == nil {
+		return nil, nil, errors.WithStack(tikverr.ErrBodyMissing)
+	}
+	cmdResp := resp.Resp.(*kvrpcpb.RawBatchScanResponse)
+	return splitBatchScanPairs(batch.ranges, cmdResp.Kvs, eachLimit), nil, nil
+}
+
+// splitBatchScanPairs assigns the pairs returned by a RawBatchScan request to the requested ranges.
+// TiKV returns the pairs of all ranges in one list following the order of the ranges, and the keys of each range are
+// ascending. So a pair belongs to the next range once it is out of the current range, not greater than the previous
+// key, or the current range has got eachLimit pairs.
+func splitBatchScanPairs(ranges []scanRange, kvs []*kvrpcpb.KvPair, eachLimit int) []scanRangeResult {
+	results := make([]scanRangeResult, len(ranges))
+	i := 0
+	for j := range ranges {
+		result := &results[j]
+		result.scanRange = ranges[j]
+		for i < len(kvs) && len(result.kvs) < eachLimit && result.contains(kvs[i].Key) &&
+			(len(result.kvs) == 0 || bytes.Compare(kvs[i].Key, result.kvs[len(result.kvs)-1].Key) > 0) {
+			result.kvs = append(result.kvs, kvs[i])
+			i++
 		}
-		resp, err = c.sendBatchReq(bo, batch.Keys, options, cmdType)
-		batchResp.Response = resp
-		batchResp.Error = err
-		return batchResp
 	}
+	return results
+}
 
-	switch cmdType {
-	case tikvrpc.CmdRawBatchGet:
-		batchResp.Response = resp
-	case tikvrpc.CmdRawBatchDelete:
+// checksumByRegions splits [startKey, endKey) by regions and checksums them concurrently.
+// On error, the combined checksum of the sub-ranges that have been done is returned along with the error.
+func (c *Client) checksumByRegions(ctx context.Context, startKey, endKey []byte, opts *rawOptions) (RawChecksum, error) {
+	bo := c.newBackoffer(ctx, opts)
+	start := startPhase(bo)
+	ranges, err := c.splitRangeByRegion(bo, startKey, endKey)
+	opts.breakdown.onRegion(bo, start)
+	if err != nil {
+		return RawChecksum{}, err
+	}
+	var (
+		mu    sync.Mutex
+		check RawChecksum
+	)
+	err = runOnRanges(ctx, ranges, opts.ScanConcurrency, opts.breakdown, func(ctx context.Context, r scanRange) error {
+		rangeCheck, err := c.checksum(ctx, r.startKey, r.endKey, opts)
+		mu.Lock()
+		check.Crc64Xor ^= rangeCheck.Crc64Xor
+		check.TotalKvs += rangeCheck.TotalKvs
+		check.TotalBytes += rangeCheck.TotalBytes
+		mu.Unlock()
+		return err
+	})
+	return check, err
+}
+
+// checksum walks the regions of [startKey, endKey) one by one. On error, the checksum of the regions
+// that have been done is returned along with the error.
+func (c *Client) checksum(ctx context.Context, startKey, endKey []byte, opts *rawOptions) (check RawChecksum, err error) {
+	for len(endKey) == 0 || bytes.Compare(startKey, endKey) < 0 {
+		req := tikvrpc.NewRequest(tikvrpc.CmdRawChecksum, &kvrpcpb.RawChecksumRequest{
+			Algorithm: kvrpcpb.ChecksumAlgorithm_Crc64_Xor,
+			Ranges: []*kvrpcpb.KeyRange{{
+				StartKey: startKey,
+				EndKey:   endKey,
+			}},
+		})
+		resp, loc, err := c.sendReq(ctx, startKey, req, false, opts)
+		if err != nil {
+			return check, err
+		}
 		if resp.Resp == nil {
-			batchResp.Error = errors.WithStack(tikverr.ErrBodyMissing)
-			return batchResp
+			return check, errors.WithStack(tikverr.ErrBodyMissing)
 		}
-		cmdResp := resp.Resp.(*kvrpcpb.RawBatchDeleteResponse)
-		if cmdResp.GetError() != "" {
-			batchResp.Error = errors.New(cmdResp.GetError())
-			return batchResp
+		cmdResp := resp.Resp.(*kvrpcpb.RawChecksumResponse)
+		if err := extractKeyErr(cmdResp.GetError()); err != nil {
+			return check, err
 		}
-		batchResp.Response = resp
+		check.Crc64Xor ^= cmdResp.GetChecksum()
+		check.TotalKvs += cmdResp.GetTotalKvs()
+		check.TotalBytes += cmdResp.GetTotalBytes()
+		startKey = loc.EndKey
+		if len(startKey) == 0 {
+			break
+		}
+	}
+	return check, nil
+}
+
+// runOnRanges calls f on every range with at most concurrency goroutines, or defaultRangeConcurrency
+// if concurrency is not positive. After the first failure, no more ranges are dispatched and the ctx
+// passed to the running ones is cancelled. It returns the first error after all goroutines exit. The ranges are
+// counted as the batches in breakdown.
+func runOnRanges(ctx context.Context, ranges []scanRange, concurrency int, breakdown *callBreakdown, f func(ctx context.Context, r scanRange) error) error {
+	if concurrency <= 0 {
+		concurrency = defaultRangeConcurrency
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch := make(chan error, len(ranges))
+	var firstErr error
+	next, inflight := 0, 0
+	for inflight > 0 || (firstErr == nil && next < len(ranges)) {
+		for firstErr == nil && inflight < concurrency && next < len(ranges) {
+			go func(r scanRange) {
+				start := time.Now()
+				err := f(ctx, r)
+				breakdown.onBatch(start)
+				ch <- err
+			}(ranges[next])
+			next++
+			inflight++
+		}
+		err := <-ch
+		inflight--
+		if err != nil && firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	return firstErr
+}
+
+// runBatches calls f on the batches [0, n) with at most batchConcurrency goroutines, and every call gets its own
+// backoffer forked from bo. Every call takes one of the batchSlots of the client while it runs, so f must not call
+// runBatches again. If cancelOnError is set, the first failure cancels the running calls. The batches that haven't
+// started when bo is done are skipped. After all goroutines exit, it returns the errors of the failed
+// batches, aggregated by newBatchError. The batches are counted in the breakdown of opts.
+func (c *Client) runBatches(bo *retry.Backoffer, opts *rawOptions, n int, cancelOnError bool, f func(bo *retry.Backoffer, i int) error) error {
+	concurrency := c.batchConcurrency()
+	if concurrency > n {
+		concurrency = n
+	}
+	bo, cancel := bo.Fork()
+	defer cancel()
+	idxCh := make(chan int, n)
+	for i := 0; i < n; i++ {
+		idxCh <- i
+	}
+	close(idxCh)
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+		// cancelled is set once a failure cancels the others, whose cancellation errors are left out.
+		cancelled bool
+		// skipped is set once a batch is skipped because bo is done, which is reported only once.
+		skipped bool
+	)
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idxCh {
+				if err := c.acquireBatchSlot(bo.GetCtx()); err != nil {
+					mu.Lock()
+					if !cancelled && !skipped {
+						errs = append(errs, errors.WithStack(err))
+					}
+					skipped = true
+					mu.Unlock()
+					continue
+				}
+				singleBatchBackoffer, singleBatchCancel := bo.Fork()
+				start := time.Now()
+				err := f(singleBatchBackoffer, i)
+				opts.breakdown.onBatch(start)
+				singleBatchCancel()
+				c.releaseBatchSlot()
+				if err == nil {
+					continue
+				}
+				mu.Lock()
+				if !cancelled || errors.Cause(err) != context.Canceled {
+					errs = append(errs, err)
+				}
+				if cancelOnError {
+					cancelled = true
+				}
+				mu.Unlock()
+				if cancelOnError {
+					cancel()
+				}
+			}
+		}()
 	}
-	return batchResp
+	wg.Wait()
+	return newBatchError(errs)
 }
 
 // sendDeleteRangeReq sends a raw delete range request and returns the response and the actual endKey.
 // If the given range spans over more than one regions, the actual endKey is the end of the first region.
 // We can't use sendReq directly, because we need to know the end of the region before we send the request
 // TODO: Is there any better way to avoid duplicating code with func `sendReq` ?
-func (c *Client) sendDeleteRangeReq(ctx context.Context, startKey []byte, endKey []byte, opts *rawOptions) (*tikvrpc.Response, []byte, error) {
-	bo := retry.NewBackofferWithVars(ctx, rawkvMaxBackoff, nil)
-	sender := locate.NewRegionRequestSender(c.regionCache, c.rpcClient)
+func (c *Client) sendDeleteRangeReq(ctx context.Context, startKey []byte, endKey []byte, opts *rawOptions) (*tikvrpc.Response, *locate.KeyLocation, []byte, error) {
+	bo := c.newBackoffer(ctx, opts)
+	sender := c.newSender(opts)
+	defer c.collectStats(sender, opts)
 	for {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, nil, errors.WithStack(err)
+		}
+		start := startPhase(bo)
 		loc, err := c.regionCache.LocateKey(bo, startKey)
+		opts.breakdown.onRegion(bo, start)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 
 		actualEndKey := endKey
-		if len(loc.EndKey) > 0 && bytes.Compare(loc.EndKey, endKey) < 0 {
+		if len(loc.EndKey) > 0 && (len(endKey) == 0 || bytes.Compare(loc.EndKey, endKey) < 0) {
 			actualEndKey = loc.EndKey
 		}
 
@@ -821,26 +4273,33 @@ func (c *Client) sendDeleteRangeReq(ctx context.Context, startKey []byte, endKey
 		})
 
 		req.MaxExecutionDurationMs = uint64(client.MaxWriteExecutionTime.Milliseconds())
-		resp, err := sender.SendReq(bo, req, loc.Region, client.ReadTimeoutShort)
+		resp, err := c.sendToRegion(bo, sender, req, loc.Region, opts)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 		regionErr, err := resp.GetRegionError()
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 		if regionErr != nil {
-			err := bo.Backoff(retry.BoRegionMiss, errors.New(regionErr.String()))
+			err := c.backoffOnRegionError(bo, req.Type, loc.Region, regionErr, opts)
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, nil, err
 			}
 			continue
 		}
-		return resp, actualEndKey, nil
+		return resp, loc, actualEndKey, nil
 	}
 }
 
 func (c *Client) sendBatchPut(bo *retry.Backoffer, keys, values [][]byte, ttls []uint64, opts *rawOptions) error {
+	_, err := c.sendBatchPutWithResult(bo, keys, values, ttls, opts, true)
+	return errors.WithStack(err)
+}
+
+// sendBatchPutWithResult puts the pairs and reports the outcome of every batch, and the errors of the failed
+// batches aggregated by newBatchError. If cancelOnError is set, the first failed batch cancels the others.
+func (c *Client) sendBatchPutWithResult(bo *retry.Backoffer, keys, values [][]byte, ttls []uint64, opts *rawOptions, cancelOnError bool) (BatchPutResult, error) {
 	keyToValue := make(map[string][]byte, len(keys))
 	keyToTTL := make(map[string]uint64, len(keys))
 	for i, key := range keys {
@@ -849,85 +4308,214 @@ func (c *Client) sendBatchPut(bo *retry.Backoffer, keys, values [][]byte, ttls [
 			keyToTTL[string(key)] = ttls[i]
 		}
 	}
-	groups, _, err := c.regionCache.GroupKeysByRegion(bo, keys, nil)
-	if err != nil {
-		return err
-	}
-	var batches []kvrpc.Batch
-	// split the keys by size and RegionVerID
-	for regionID, groupKeys := range groups {
-		batches = kvrpc.AppendBatches(batches, regionID, groupKeys, keyToValue, keyToTTL, rawBatchPutSize)
-	}
-	bo, cancel := bo.Fork()
-	ch := make(chan error, len(batches))
-	for _, batch := range batches {
-		batch1 := batch
-		go func() {
-			singleBatchBackoffer, singleBatchCancel := bo.Fork()
-			defer singleBatchCancel()
-			ch <- c.doBatchPut(singleBatchBackoffer, batch1, opts)
-		}()
+
+	var (
+		result BatchPutResult
+		errs   []error
+	)
+	failBatches := func(batches []kvrpc.Batch, err error) {
+		for _, batch := range batches {
+			result.Failures = append(result.Failures, BatchPutFailure{RegionID: batch.RegionID.GetID(), FailedKeys: batch.Keys, Err: err})
+		}
 	}
+	for len(keys) > 0 {
+		if err := bo.GetCtx().Err(); err != nil {
+			err = errors.WithStack(err)
+			result.Failures = append(result.Failures, BatchPutFailure{FailedKeys: keys, Err: err})
+			errs = append(errs, err)
+			break
+		}
+		start := startPhase(bo)
+		groups, _, err := c.regionCache.GroupKeysByRegion(bo, keys, nil)
+		opts.breakdown.onRegion(bo, start)
+		if err != nil {
+			result.Failures = append(result.Failures, BatchPutFailure{FailedKeys: keys, Err: err})
+			errs = append(errs, err)
+			break
+		}
+		var batches []kvrpc.Batch
+		// split the keys by size and RegionVerID
+		for regionID, groupKeys := range groups {
+			batches = kvrpc.AppendBatches(batches, regionID, groupKeys, keyToValue, keyToTTL, c.batchPutSize(), c.batchPairCount())
+		}
+		opts.breakdown.onSplit(len(groups), kvBatchSizes(batches))
+		batchResults := make([]BatchPutResult, len(batches))
+		regionErrs := make([]*errorpb.Error, len(batches))
+		// firstFailed is the batch that fails first, whose failures are reported first, so that the cause isn't
+		// hidden behind the failures of the batches it cancels.
+		firstFailed := int32(-1)
+		err = c.runBatches(bo, opts, len(batches), cancelOnError, func(bo *retry.Backoffer, i int) error {
+			batchResults[i], regionErrs[i] = c.doBatchPut(bo, batches[i], opts)
+			if len(batchResults[i].Failures) > 0 {
+				atomic.CompareAndSwapInt32(&firstFailed, -1, int32(i))
+				return annotateBatchErr(batchResults[i].Failures[0].Err, batches[i].RegionID.GetID(), batches[i].Keys[0])
+			}
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if firstFailed > 0 {
+			batchResults[0], batchResults[firstFailed] = batchResults[firstFailed], batchResults[0]
+			regionErrs[0], regionErrs[firstFailed] = regionErrs[firstFailed], regionErrs[0]
+			batches[0], batches[firstFailed] = batches[firstFailed], batches[0]
+		}
 
-	for i := 0; i < len(batches); i++ {
-		if e := <-ch; e != nil {
-			cancel()
-			// catch the first error
-			if err == nil {
-				err = errors.WithStack(e)
+		var (
+			regionErr    *errorpb.Error
+			retryBatches []kvrpc.Batch
+		)
+		for i, batchResult := range batchResults {
+			if regionErrs[i] != nil {
+				regionErr = regionErrs[i]
+				retryBatches = append(retryBatches, batches[i])
+				continue
+			}
+			if len(batchResult.SucceededKeys) == 0 && len(batchResult.Failures) == 0 {
+				// The batch was skipped because bo was done.
+				failBatches(batches[i:i+1], err)
+				continue
 			}
+			result.SucceededKeys = append(result.SucceededKeys, batchResult.SucceededKeys...)
+			result.Failures = append(result.Failures, batchResult.Failures...)
+		}
+		if len(retryBatches) == 0 {
+			break
+		}
+		if cancelOnError && len(result.Failures) > 0 {
+			failBatches(retryBatches, result.Failures[0].Err)
+			break
+		}
+		// The keys of the batches that meet region errors are grouped by the refreshed regions and sent again.
+		opts.breakdown.onBatchRetry(len(retryBatches))
+		regionID := retryBatches[len(retryBatches)-1].RegionID
+		if err := c.backoffOnRegionError(bo, tikvrpc.CmdRawBatchPut, regionID, regionErr, opts); err != nil {
+			failBatches(retryBatches, err)
+			errs = append(errs, err)
+			break
+		}
+		opts.breakdown.onRegroup()
+		keys = keys[:0:0]
+		for _, batch := range retryBatches {
+			keys = append(keys, batch.Keys...)
 		}
 	}
-	return err
+	return result, newBatchError(errs)
 }
 
-func (c *Client) doBatchPut(bo *retry.Backoffer, batch kvrpc.Batch, opts *rawOptions) error {
+// doBatchPut puts the pairs of a batch. If the region of the batch has changed, the region error is returned
+// for the caller to retry the batch.
+func (c *Client) doBatchPut(bo *retry.Backoffer, batch kvrpc.Batch, opts *rawOptions) (BatchPutResult, *errorpb.Error) {
 	kvPair := make([]*kvrpcpb.KvPair, 0, len(batch.Keys))
 	for i, key := range batch.Keys {
 		kvPair = append(kvPair, &kvrpcpb.KvPair{Key: key, Value: batch.Values[i]})
 	}
 
+	ttls := batch.TTLs
+	if len(ttls) == 0 && opts.TTL > 0 {
+		// A single TTL is applied to all the keys by TiKV.
+		ttls = []uint64{opts.TTL}
+	}
 	var ttl uint64
-	if len(batch.TTLs) > 0 {
-		ttl = batch.TTLs[0]
+	if len(ttls) > 0 {
+		ttl = ttls[0]
 	}
 	req := tikvrpc.NewRequest(tikvrpc.CmdRawBatchPut,
 		&kvrpcpb.RawBatchPutRequest{
 			Pairs:  kvPair,
 			Cf:     c.getColumnFamily(opts),
 			ForCas: c.atomic,
-			Ttls:   batch.TTLs,
+			Ttls:   ttls,
 			Ttl:    ttl,
 		})
 
-	sender := locate.NewRegionRequestSender(c.regionCache, c.rpcClient)
+	failed := func(err error) BatchPutResult {
+		return BatchPutResult{Failures: []BatchPutFailure{{RegionID: batch.RegionID.GetID(), FailedKeys: batch.Keys, Err: err}}}
+	}
+	sender := c.newSender(opts)
+	defer c.collectStats(sender, opts)
 	req.MaxExecutionDurationMs = uint64(client.MaxWriteExecutionTime.Milliseconds())
 	req.ApiVersion = c.apiVersion
-	resp, err := sender.SendReq(bo, req, batch.RegionID, client.ReadTimeoutShort)
+	resp, err := c.sendToRegion(bo, sender, req, batch.RegionID, opts)
 	if err != nil {
-		return err
+		return failed(err), nil
 	}
 	regionErr, err := resp.GetRegionError()
 	if err != nil {
-		return err
+		return failed(err), nil
 	}
 	if regionErr != nil {
-		err := bo.Backoff(retry.BoRegionMiss, errors.New(regionErr.String()))
-		if err != nil {
-			return err
-		}
-		// recursive call
-		return c.sendBatchPut(bo, batch.Keys, batch.Values, batch.TTLs, opts)
+		return BatchPutResult{}, regionErr
 	}
 
 	if resp.Resp == nil {
-		return errors.WithStack(tikverr.ErrBodyMissing)
+		return failed(errors.WithStack(tikverr.ErrBodyMissing)), nil
 	}
 	cmdResp := resp.Resp.(*kvrpcpb.RawBatchPutResponse)
-	if cmdResp.GetError() != "" {
-		return errors.New(cmdResp.GetError())
+	if err := extractKeyErr(cmdResp.GetError()); err != nil {
+		return failed(err), nil
 	}
-	return nil
+	return BatchPutResult{SucceededKeys: batch.Keys}, nil
+}
+
+func (c *Client) batchPutSize() int {
+	if c.batchPutSizeLimit > 0 {
+		return c.batchPutSizeLimit
+	}
+	return rawBatchPutSize
+}
+
+func (c *Client) batchPairCount() int {
+	if c.batchPairCountLimit > 0 {
+		return c.batchPairCountLimit
+	}
+	return rawBatchPairCount
+}
+
+// scanLimit returns the maximum scan limit of the client. It should be read once per call, since
+// MaxRawKVScanLimit may be changed concurrently.
+func (c *Client) scanLimit() int {
+	if c.maxScanLimit > 0 {
+		return c.maxScanLimit
+	}
+	return MaxRawKVScanLimit
+}
+
+// newBatchSlots returns the batchSlots of a client whose batchConcurrencyLimit is limit.
+func newBatchSlots(limit int) chan struct{} {
+	if limit <= 0 {
+		limit = defaultBatchConcurrency
+	}
+	return make(chan struct{}, limit)
+}
+
+// acquireBatchSlot waits for a free slot of batchSlots, and returns the error of ctx if it's done first.
+func (c *Client) acquireBatchSlot(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.batchSlots == nil {
+		return nil
+	}
+	select {
+	case c.batchSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Client) releaseBatchSlot() {
+	if c.batchSlots != nil {
+		<-c.batchSlots
+	}
+}
+
+func (c *Client) batchConcurrency() int {
+	if c.batchConcurrencyLimit > 0 {
+		return c.batchConcurrencyLimit
+	}
+	return defaultBatchConcurrency
 }
 
 func (c *Client) getColumnFamily(options *rawOptions) string {
@@ -938,11 +4526,63 @@ func (c *Client) getColumnFamily(options *rawOptions) string {
 }
 
 func (c *Client) getRawKVOptions(options ...RawOption) *rawOptions {
-	opts := rawOptions{}
+	// The breakdown is allocated along with the options, which escape anyway.
+	o := &struct {
+		opts      rawOptions
+		breakdown callBreakdown
+	}{}
+	o.opts.breakdown = &o.breakdown
+	o.breakdown.client = c.stats
+	if c.slowLogThreshold > 0 {
+		o.breakdown.start = time.Now()
+	}
 	for _, op := range options {
-		op.apply(&opts)
+		op.apply(&o.opts)
+	}
+	return &o.opts
+}
+
+// sortKeys sorts keys and removes the repeated ones, without copying the keys.
+// keys[i] is sortedKeys[idxs[i]].
+func sortKeys(keys [][]byte) (sortedKeys [][]byte, idxs []int) {
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return bytes.Compare(keys[order[i]], keys[order[j]]) < 0 })
+
+	sortedKeys = make([][]byte, 0, len(keys))
+	idxs = make([]int, len(keys))
+	for _, i := range order {
+		if n := len(sortedKeys); n == 0 || !bytes.Equal(sortedKeys[n-1], keys[i]) {
+			sortedKeys = append(sortedKeys, keys[i])
+		}
+		idxs[i] = len(sortedKeys) - 1
+	}
+	return sortedKeys, idxs
+}
+
+// dedupKeys removes the repeated keys, keeping the order of their first occurrences.
+// keys is returned as is if there is no repeated key.
+func dedupKeys(keys [][]byte) [][]byte {
+	seen := make(map[string]struct{}, len(keys))
+	var unique [][]byte
+	for i, key := range keys {
+		if _, ok := seen[string(key)]; !ok {
+			seen[string(key)] = struct{}{}
+			if unique != nil {
+				unique = append(unique, key)
+			}
+			continue
+		}
+		if unique == nil {
+			unique = append(make([][]byte, 0, len(keys)), keys[:i]...)
+		}
+	}
+	if unique == nil {
+		return keys
 	}
-	return &opts
+	return unique
 }
 
 // convertNilToEmptySlice is used to convert value of existed key return from TiKV.
@@ -0,0 +1,93 @@
+// Copyright 2021 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rawkv
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/tikv/client-go/v2/internal/client"
+	"github.com/tikv/client-go/v2/internal/mockstore/mocktikv"
+	"github.com/tikv/client-go/v2/tikvrpc"
+)
+
+// fakeReads wraps a client.Client and answers every RawGet and RawBatchGet request with all the keys found, so that
+// benchmarks measure the client rather than the mock store.
+func fakeReads(inner client.Client, value []byte) *fakeClient {
+	return &fakeClient{
+		Client: inner,
+		send: func(ctx context.Context, addr string, req *tikvrpc.Request, next func() (*tikvrpc.Response, error)) (*tikvrpc.Response, error) {
+			if req.Type == tikvrpc.CmdRawGet {
+				return &tikvrpc.Response{Resp: &kvrpcpb.RawGetResponse{Value: value}}, nil
+			}
+			if req.Type != tikvrpc.CmdRawBatchGet {
+				return next()
+			}
+			keys := req.RawBatchGet().GetKeys()
+			pairs := make([]*kvrpcpb.KvPair, len(keys))
+			for i, key := range keys {
+				pairs[i] = &kvrpcpb.KvPair{Key: key, Value: value}
+			}
+			return &tikvrpc.Response{Resp: &kvrpcpb.RawBatchGetResponse{Pairs: pairs}}, nil
+		},
+	}
+}
+
+func BenchmarkBatchGet(b *testing.B) {
+	cluster := mocktikv.NewCluster(mocktikv.MustNewMVCCStore())
+	_, _, regionID := mocktikv.BootstrapWithSingleStore(cluster)
+	// split the cluster into 4 regions.
+	for _, splitKey := range []string{"key05000", "key10000", "key15000"} {
+		newRegionID, peerID := cluster.AllocID(), cluster.AllocID()
+		cluster.SplitRaw(regionID, newRegionID, []byte(splitKey), []uint64{peerID}, peerID)
+		regionID = newRegionID
+	}
+	client := newMockClient(cluster, fakeReads(mocktikv.NewRPCClient(cluster, nil, nil), []byte("value")))
+	defer client.Close()
+
+	keys := make([][]byte, 20000)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%05d", i))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		values, err := client.BatchGet(context.Background(), keys)
+		if err != nil || len(values) != len(keys) {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	cluster := mocktikv.NewCluster(mocktikv.MustNewMVCCStore())
+	mocktikv.BootstrapWithSingleStore(cluster)
+	client := newMockClient(cluster, fakeReads(mocktikv.NewRPCClient(cluster, nil, nil), []byte("value")))
+	defer client.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := client.Get(context.Background(), []byte("key")); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
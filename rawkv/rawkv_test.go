@@ -37,15 +37,50 @@ package rawkv
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"hash/crc32"
 	"hash/crc64"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/pingcap/kvproto/pkg/errorpb"
+	"github.com/pingcap/kvproto/pkg/keyspacepb"
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/suite"
+	"github.com/tikv/client-go/v2/config"
+	tikverr "github.com/tikv/client-go/v2/error"
+	"github.com/tikv/client-go/v2/internal/client"
 	"github.com/tikv/client-go/v2/internal/locate"
+	"github.com/tikv/client-go/v2/internal/logutil"
 	"github.com/tikv/client-go/v2/internal/mockstore/mocktikv"
 	"github.com/tikv/client-go/v2/internal/retry"
 	"github.com/tikv/client-go/v2/kv"
+	"github.com/tikv/client-go/v2/metrics"
+	"github.com/tikv/client-go/v2/tikvrpc"
+	"github.com/tikv/client-go/v2/tikvrpc/interceptor"
+	pd "github.com/tikv/pd/client"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/goleak"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
 )
 
 func TestRawKV(t *testing.T) {
@@ -83,6 +118,197 @@ func (s *testRawkvSuite) TearDownTest() {
 	s.mvccStore.Close()
 }
 
+// newClient creates a client on the mock cluster of the suite, which sends the requests by rpcClient.
+func (s *testRawkvSuite) newClient(rpcClient client.Client) *Client {
+	return newMockClient(s.cluster, rpcClient)
+}
+
+// newMockClient creates a client on cluster, which sends the requests by rpcClient.
+func newMockClient(cluster *mocktikv.Cluster, rpcClient client.Client) *Client {
+	return &Client{
+		clusterID:   0,
+		regionCache: locate.NewRegionCache(mocktikv.NewPDClient(cluster)),
+		rpcClient:   rpcClient,
+	}
+}
+
+// fakeClient wraps a client.Client for the tests. The requests of cmd, or all the requests if cmd is zero, are
+// recorded with the addresses they are sent to and their timeouts, and the ones succeeded are recorded again. Each
+// of them takes delay, and maxInflight records how many of them are sent at the same time. The first of them are
+// answered with regionErrs, one error per request, and the ones sent to errRegion, or to any region if errRegion is
+// zero, fail with keyErr if it's set. The requests sent to failAddr fail. Then every request is passed to send if
+// it's set, which fakes the response, or sends the request by next.
+type fakeClient struct {
+	client.Client
+	cmd       tikvrpc.CmdType
+	delay     time.Duration
+	errRegion uint64
+	keyErr    string
+	failAddr  string
+	send      func(ctx context.Context, addr string, req *tikvrpc.Request, next func() (*tikvrpc.Response, error)) (*tikvrpc.Response, error)
+
+	inflight    int32
+	maxInflight int32
+
+	mu         sync.Mutex
+	regionErrs []*errorpb.Error
+	reqs       []*tikvrpc.Request
+	addrs      []string
+	timeouts   []time.Duration
+	succeeded  []*tikvrpc.Request
+}
+
+func (c *fakeClient) SendRequest(ctx context.Context, addr string, req *tikvrpc.Request, timeout time.Duration) (*tikvrpc.Response, error) {
+	if c.cmd == 0 || req.Type == c.cmd {
+		n := atomic.AddInt32(&c.inflight, 1)
+		defer atomic.AddInt32(&c.inflight, -1)
+		for {
+			max := atomic.LoadInt32(&c.maxInflight)
+			if n <= max || atomic.CompareAndSwapInt32(&c.maxInflight, max, n) {
+				break
+			}
+		}
+		time.Sleep(c.delay)
+
+		c.mu.Lock()
+		c.reqs = append(c.reqs, req)
+		c.addrs = append(c.addrs, addr)
+		c.timeouts = append(c.timeouts, timeout)
+		var regionErr *errorpb.Error
+		if len(c.regionErrs) > 0 {
+			regionErr, c.regionErrs = c.regionErrs[0], c.regionErrs[1:]
+		}
+		c.mu.Unlock()
+		if regionErr != nil {
+			return tikvrpc.GenRegionErrorResp(req, regionErr)
+		}
+		if c.keyErr != "" && (c.errRegion == 0 || req.RegionId == c.errRegion) {
+			return keyErrorResp(req, c.keyErr), nil
+		}
+	}
+	if c.failAddr != "" && addr == c.failAddr {
+		return nil, errors.New("store unavailable")
+	}
+	next := func() (*tikvrpc.Response, error) {
+		return c.Client.SendRequest(ctx, addr, req, timeout)
+	}
+	var resp *tikvrpc.Response
+	var err error
+	if c.send == nil {
+		resp, err = next()
+	} else {
+		resp, err = c.send(ctx, addr, req, next)
+	}
+	if err == nil && (c.cmd == 0 || req.Type == c.cmd) {
+		if regionErr, _ := resp.GetRegionError(); regionErr == nil {
+			c.mu.Lock()
+			c.succeeded = append(c.succeeded, req)
+			c.mu.Unlock()
+		}
+	}
+	return resp, err
+}
+
+// keyErrorResp returns the response of req that fails with msg.
+func keyErrorResp(req *tikvrpc.Request, msg string) *tikvrpc.Response {
+	switch req.Type {
+	case tikvrpc.CmdRawBatchPut:
+		return &tikvrpc.Response{Resp: &kvrpcpb.RawBatchPutResponse{Error: msg}}
+	case tikvrpc.CmdRawDeleteRange:
+		return &tikvrpc.Response{Resp: &kvrpcpb.RawDeleteRangeResponse{Error: msg}}
+	case tikvrpc.CmdRawCompareAndSwap:
+		return &tikvrpc.Response{Resp: &kvrpcpb.RawCASResponse{Error: msg}}
+	case tikvrpc.CmdRawChecksum:
+		return &tikvrpc.Response{Resp: &kvrpcpb.RawChecksumResponse{Error: msg}}
+	default:
+		panic(fmt.Sprintf("no key error for %s", req.Type))
+	}
+}
+
+// resetInflight resets maxInflight, and records the requests of cmd from now on.
+func (c *fakeClient) resetInflight(cmd tikvrpc.CmdType) {
+	c.cmd = cmd
+	atomic.StoreInt32(&c.maxInflight, 0)
+}
+
+// requests returns the requests recorded so far.
+func (c *fakeClient) requests() []*tikvrpc.Request {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*tikvrpc.Request(nil), c.reqs...)
+}
+
+// lastRequest returns the last request of cmd recorded, or nil if there is none.
+func (c *fakeClient) lastRequest(cmd tikvrpc.CmdType) *tikvrpc.Request {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := len(c.reqs) - 1; i >= 0; i-- {
+		if c.reqs[i].Type == cmd {
+			return c.reqs[i]
+		}
+	}
+	return nil
+}
+
+// succeededRequests returns the requests succeeded so far.
+func (c *fakeClient) succeededRequests() []*tikvrpc.Request {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*tikvrpc.Request(nil), c.succeeded...)
+}
+
+// takeAddrs returns the addresses of the requests recorded since the last call.
+func (c *fakeClient) takeAddrs() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	addrs := c.addrs
+	c.reqs, c.addrs, c.timeouts, c.succeeded = nil, nil, nil, nil
+	return addrs
+}
+
+// reset forgets the requests recorded so far.
+func (c *fakeClient) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reqs, c.addrs, c.timeouts, c.succeeded = nil, nil, nil, nil
+}
+
+// countKeys counts the keys of the RawBatchGet, RawBatchPut and RawBatchDelete requests.
+func countKeys(reqs []*tikvrpc.Request) map[string]int {
+	keys := make(map[string]int)
+	for _, req := range reqs {
+		switch req.Type {
+		case tikvrpc.CmdRawBatchGet:
+			for _, key := range req.RawBatchGet().GetKeys() {
+				keys[string(key)]++
+			}
+		case tikvrpc.CmdRawBatchPut:
+			for _, pair := range req.RawBatchPut().GetPairs() {
+				keys[string(pair.Key)]++
+			}
+		case tikvrpc.CmdRawBatchDelete:
+			for _, key := range req.RawBatchDelete().GetKeys() {
+				keys[string(key)]++
+			}
+		}
+	}
+	return keys
+}
+
+// keyTTLs returns the TTLs of the keys written by the RawBatchPut requests with TTLs.
+func keyTTLs(reqs []*tikvrpc.Request) map[string]uint64 {
+	ttls := make(map[string]uint64)
+	for _, req := range reqs {
+		if req.Type != tikvrpc.CmdRawBatchPut || len(req.RawBatchPut().GetTtls()) == 0 {
+			continue
+		}
+		for i, pair := range req.RawBatchPut().GetPairs() {
+			ttls[string(pair.Key)] = req.RawBatchPut().GetTtls()[i]
+		}
+	}
+	return ttls
+}
+
 func (s *testRawkvSuite) storeAddr(id uint64) string {
 	return fmt.Sprintf("store%d", id)
 }
@@ -91,11 +317,7 @@ func (s *testRawkvSuite) TestReplaceAddrWithNewStore() {
 	mvccStore := mocktikv.MustNewMVCCStore()
 	defer mvccStore.Close()
 
-	client := &Client{
-		clusterID:   0,
-		regionCache: locate.NewRegionCache(mocktikv.NewPDClient(s.cluster)),
-		rpcClient:   mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
-	}
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
 	defer client.Close()
 	testKey := []byte("test_key")
 	testValue := []byte("test_value")
@@ -120,11 +342,7 @@ func (s *testRawkvSuite) TestUpdateStoreAddr() {
 	mvccStore := mocktikv.MustNewMVCCStore()
 	defer mvccStore.Close()
 
-	client := &Client{
-		clusterID:   0,
-		regionCache: locate.NewRegionCache(mocktikv.NewPDClient(s.cluster)),
-		rpcClient:   mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
-	}
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
 	defer client.Close()
 	testKey := []byte("test_key")
 	testValue := []byte("test_value")
@@ -145,11 +363,7 @@ func (s *testRawkvSuite) TestReplaceNewAddrAndOldOfflineImmediately() {
 	mvccStore := mocktikv.MustNewMVCCStore()
 	defer mvccStore.Close()
 
-	client := &Client{
-		clusterID:   0,
-		regionCache: locate.NewRegionCache(mocktikv.NewPDClient(s.cluster)),
-		rpcClient:   mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
-	}
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
 	defer client.Close()
 	testKey := []byte("test_key")
 	testValue := []byte("test_value")
@@ -181,11 +395,7 @@ func (s *testRawkvSuite) TestReplaceStore() {
 	mvccStore := mocktikv.MustNewMVCCStore()
 	defer mvccStore.Close()
 
-	client := &Client{
-		clusterID:   0,
-		regionCache: locate.NewRegionCache(mocktikv.NewPDClient(s.cluster)),
-		rpcClient:   mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
-	}
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
 	defer client.Close()
 	testKey := []byte("test_key")
 	testValue := []byte("test_value")
@@ -208,11 +418,7 @@ func (s *testRawkvSuite) TestColumnFamilyForClient() {
 	mvccStore := mocktikv.MustNewMVCCStore()
 	defer mvccStore.Close()
 
-	client := &Client{
-		clusterID:   0,
-		regionCache: locate.NewRegionCache(mocktikv.NewPDClient(s.cluster)),
-		rpcClient:   mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
-	}
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
 	defer client.Close()
 
 	testKeyCf1, testValueCf1, cf1 := []byte("test_key_cf1"), []byte("test_value_cf1"), "cf1"
@@ -279,11 +485,7 @@ func (s *testRawkvSuite) TestColumnFamilyForOptions() {
 	mvccStore := mocktikv.MustNewMVCCStore()
 	defer mvccStore.Close()
 
-	client := &Client{
-		clusterID:   0,
-		regionCache: locate.NewRegionCache(mocktikv.NewPDClient(s.cluster)),
-		rpcClient:   mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
-	}
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
 	defer client.Close()
 
 	keyInCf1, valueInCf1, cf1 := []byte("db"), []byte("TiDB"), "cf1"
@@ -336,11 +538,7 @@ func (s *testRawkvSuite) TestBatch() {
 	mvccStore := mocktikv.MustNewMVCCStore()
 	defer mvccStore.Close()
 
-	client := &Client{
-		clusterID:   0,
-		regionCache: locate.NewRegionCache(mocktikv.NewPDClient(s.cluster)),
-		rpcClient:   mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
-	}
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
 	defer client.Close()
 
 	cf := "test_cf"
@@ -391,11 +589,7 @@ func (s *testRawkvSuite) TestScan() {
 	mvccStore := mocktikv.MustNewMVCCStore()
 	defer mvccStore.Close()
 
-	client := &Client{
-		clusterID:   0,
-		regionCache: locate.NewRegionCache(mocktikv.NewPDClient(s.cluster)),
-		rpcClient:   mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
-	}
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
 	defer client.Close()
 
 	cf := "test_cf"
@@ -463,11 +657,7 @@ func (s *testRawkvSuite) TestDeleteRange() {
 	mvccStore := mocktikv.MustNewMVCCStore()
 	defer mvccStore.Close()
 
-	client := &Client{
-		clusterID:   0,
-		regionCache: locate.NewRegionCache(mocktikv.NewPDClient(s.cluster)),
-		rpcClient:   mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
-	}
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
 	defer client.Close()
 
 	cf := "test_cf"
@@ -513,11 +703,7 @@ func (s *testRawkvSuite) TestCompareAndSwap() {
 	mvccStore := mocktikv.MustNewMVCCStore()
 	defer mvccStore.Close()
 
-	client := &Client{
-		clusterID:   0,
-		regionCache: locate.NewRegionCache(mocktikv.NewPDClient(s.cluster)),
-		rpcClient:   mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
-	}
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
 	defer client.Close()
 
 	cf := "my_cf"
@@ -577,11 +763,7 @@ func (s *testRawkvSuite) TestRawChecksum() {
 	mvccStore := mocktikv.MustNewMVCCStore()
 	defer mvccStore.Close()
 
-	client := &Client{
-		clusterID:   0,
-		regionCache: locate.NewRegionCache(mocktikv.NewPDClient(s.cluster)),
-		rpcClient:   mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
-	}
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
 	defer client.Close()
 
 	cf := "CF_DEFAULT"
@@ -624,4 +806,4354 @@ func (s *testRawkvSuite) TestRawChecksum() {
 	s.Equal(expectCrc64Xor, check.Crc64Xor)
 	s.Equal(expectTotalKvs, check.TotalKvs)
 	s.Equal(expectTotalBytes, check.TotalBytes)
+
+	// The error of the checksum is returned rather than a partial checksum.
+	client.rpcClient = &fakeClient{Client: client.rpcClient, cmd: tikvrpc.CmdRawChecksum, keyErr: "injected error"}
+	_, err = client.Checksum(context.Background(), startKey, endKey, SetColumnFamily(cf))
+	s.EqualError(err, "injected error")
+	_, err = client.Count(context.Background(), startKey, endKey, SetColumnFamily(cf))
+	s.EqualError(err, "injected error")
+}
+
+func (s *testRawkvSuite) TestBatchScan() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	// split the cluster into regions ["", "key3"), ["key3", "key6"), ["key6", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+	region3 := s.cluster.AllocID()
+	peers3 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(region2, region3, []byte("key6"), peers3, peers3[0])
+
+	keys := make([]key, 0, 9)
+	values := make([]value, 0, 9)
+	for i := 1; i <= 9; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%d", i)))
+	}
+	err := client.BatchPut(context.Background(), keys, values)
+	s.Nil(err)
+
+	startKeys := [][]byte{[]byte("key2"), []byte("key1"), []byte("key5"), []byte("key8"), []byte("key4")}
+	endKeys := [][]byte{[]byte("key7"), []byte("key2"), nil, nil, []byte("key4")}
+	returnKeys, returnValues, err := client.BatchScan(context.Background(), startKeys, endKeys, 3)
+	s.Nil(err)
+	s.Equal(len(startKeys), len(returnKeys))
+	s.Equal(len(startKeys), len(returnValues))
+
+	expected := [][]string{
+		{"key2", "key3", "key4"},
+		{"key1"},
+		{"key5", "key6", "key7"},
+		{"key8", "key9"},
+		nil,
+	}
+	for i, expectedKeys := range expected {
+		s.Equal(len(expectedKeys), len(returnKeys[i]))
+		for j, k := range expectedKeys {
+			s.Equal(k, string(returnKeys[i][j]))
+			s.Equal("value"+k[len("key"):], string(returnValues[i][j]))
+		}
+	}
+
+	_, _, err = client.BatchScan(context.Background(), startKeys, endKeys[:1], 3)
+	s.Error(err)
+}
+
+func (s *testRawkvSuite) TestExists() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// sizes are the sizes of the scan responses.
+	var sizes []int
+	client := s.newClient(&fakeClient{
+		Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		send: func(ctx context.Context, addr string, req *tikvrpc.Request, next func() (*tikvrpc.Response, error)) (*tikvrpc.Response, error) {
+			resp, err := next()
+			if err == nil && req.Type == tikvrpc.CmdRawScan {
+				sizes = append(sizes, resp.Resp.(*kvrpcpb.RawScanResponse).Size())
+			}
+			return resp, err
+		},
+	})
+	defer client.Close()
+
+	smallKey, largeKey := []byte("key1"), []byte("key2")
+	s.Nil(client.Put(context.Background(), smallKey, []byte("v")))
+	s.Nil(client.Put(context.Background(), largeKey, bytes.Repeat([]byte("v"), 1024*1024)))
+	// the next key of largeKey must not be treated as largeKey
+	s.Nil(client.Put(context.Background(), append(largeKey, 0), []byte("v")))
+
+	exists, err := client.Exists(context.Background(), smallKey)
+	s.Nil(err)
+	s.True(exists)
+	exists, err = client.Exists(context.Background(), largeKey)
+	s.Nil(err)
+	s.True(exists)
+	s.Equal(2, len(sizes))
+	s.Equal(sizes[0], sizes[1])
+
+	exists, err = client.Exists(context.Background(), []byte("key"))
+	s.Nil(err)
+	s.False(exists)
+	s.Nil(client.Delete(context.Background(), smallKey))
+	exists, err = client.Exists(context.Background(), smallKey)
+	s.Nil(err)
+	s.False(exists)
+}
+
+func (s *testRawkvSuite) TestBatchExists() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+
+	err := client.BatchPut(context.Background(),
+		[][]byte{[]byte("key1"), []byte("key2"), []byte("key4")},
+		[][]byte{[]byte("value1"), []byte("value2"), []byte("value4")})
+	s.Nil(err)
+
+	keys := [][]byte{[]byte("key4"), []byte("key1"), []byte("key3"), []byte("key1"), []byte("key"), []byte("key4")}
+	exists, err := client.BatchExists(context.Background(), keys)
+	s.Nil(err)
+	s.Equal([]bool{true, true, false, true, false, true}, exists)
+
+	exists, err = client.BatchExists(context.Background(), nil)
+	s.Nil(err)
+	s.Equal(0, len(exists))
+}
+
+func (s *testRawkvSuite) TestScanKeyOnly() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	keys := [][]byte{[]byte("key1"), []byte("key2"), []byte("key3")}
+	values := [][]byte{[]byte("value1"), []byte("value2"), []byte("value3")}
+	err := client.BatchPut(context.Background(), keys, values)
+	s.Nil(err)
+
+	returnKeys, returnValues, err := client.Scan(context.Background(), []byte("key"), nil, 10, ScanKeyOnly())
+	s.Nil(err)
+	s.Equal(keys, returnKeys)
+	for _, v := range returnValues {
+		s.Equal(0, len(v))
+	}
+
+	returnKeys, err = client.ScanKeys(context.Background(), []byte("key2"), nil, 10)
+	s.Nil(err)
+	s.Equal(keys[1:], returnKeys)
+
+	returnKeys, err = client.ReverseScanKeys(context.Background(), []byte("key3"), []byte("key"), 10)
+	s.Nil(err)
+	s.Equal([][]byte{[]byte("key2"), []byte("key1")}, returnKeys)
+}
+
+func (s *testRawkvSuite) TestPrefixScan() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	keys := [][]byte{
+		[]byte("a"),
+		[]byte("ab"),
+		[]byte("ab\xff"),
+		[]byte("ab\xff\xff"),
+		[]byte("ac"),
+		[]byte("\xff\xff"),
+		[]byte("\xff\xff\x01"),
+	}
+	values := make([][]byte, 0, len(keys))
+	for i := range keys {
+		values = append(values, []byte(fmt.Sprintf("value%d", i)))
+	}
+	err := client.BatchPut(context.Background(), keys, values)
+	s.Nil(err)
+
+	returnKeys, returnValues, err := client.PrefixScan(context.Background(), []byte("ab"), 10)
+	s.Nil(err)
+	s.Equal(keys[1:4], returnKeys)
+	s.Equal(values[1:4], returnValues)
+
+	returnKeys, _, err = client.PrefixScan(context.Background(), []byte("ab\xff"), 10)
+	s.Nil(err)
+	s.Equal(keys[2:4], returnKeys)
+
+	returnKeys, _, err = client.PrefixScan(context.Background(), []byte("\xff\xff"), 10)
+	s.Nil(err)
+	s.Equal(keys[5:], returnKeys)
+
+	returnKeys, _, err = client.PrefixScan(context.Background(), []byte("a"), 2)
+	s.Nil(err)
+	s.Equal(keys[:2], returnKeys)
+
+	returnKeys, _, err = client.ReversePrefixScan(context.Background(), []byte("ab"), 10)
+	s.Nil(err)
+	s.Equal([][]byte{keys[3], keys[2], keys[1]}, returnKeys)
+
+	returnKeys, _, err = client.ReversePrefixScan(context.Background(), []byte("\xff\xff"), 10)
+	s.Nil(err)
+	s.Equal([][]byte{keys[6], keys[5]}, returnKeys)
+
+	_, _, err = client.PrefixScan(context.Background(), []byte("a"), MaxRawKVScanLimit+1)
+	s.Error(err)
+}
+
+func (s *testRawkvSuite) TestIterator() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	keys := make([]key, 0, 9)
+	values := make([]value, 0, 9)
+	for i := 1; i <= 9; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%d", i)))
+	}
+	err := client.BatchPut(context.Background(), keys, values)
+	s.Nil(err)
+
+	it, err := client.Iter(context.Background(), []byte("key1"), nil, 2)
+	s.Nil(err)
+	var returnKeys, returnValues [][]byte
+	for it.Next() {
+		returnKeys = append(returnKeys, it.Key())
+		returnValues = append(returnValues, it.Value())
+		if len(returnKeys) == 3 {
+			// split the region between pages, the iterator should neither skip nor duplicate keys.
+			region2 := s.cluster.AllocID()
+			peers2 := s.cluster.AllocIDs(2)
+			s.cluster.SplitRaw(s.region1, region2, []byte("key5"), peers2, peers2[0])
+		}
+	}
+	s.Nil(it.Error())
+	it.Close()
+	s.Equal([][]byte(keys), returnKeys)
+	s.Equal([][]byte(values), returnValues)
+
+	it, err = client.ReverseIter(context.Background(), []byte("key8"), []byte("key2"), 4)
+	s.Nil(err)
+	returnKeys = returnKeys[:0]
+	for it.Next() {
+		returnKeys = append(returnKeys, it.Key())
+	}
+	s.Nil(it.Error())
+	s.Equal([][]byte{keys[6], keys[5], keys[4], keys[3], keys[2], keys[1]}, returnKeys)
+
+	it, err = client.Iter(context.Background(), []byte("key1"), []byte("key9"), 2)
+	s.Nil(err)
+	s.True(it.Next())
+	it.Close()
+	s.False(it.Next())
+
+	_, err = client.Iter(context.Background(), []byte("key1"), nil, MaxRawKVScanLimit+1)
+	s.Error(err)
+}
+
+func (s *testRawkvSuite) TestScanStream() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	rpcClient := &fakeClient{Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil), cmd: tikvrpc.CmdRawScan}
+	client := s.newClient(rpcClient)
+	defer client.Close()
+
+	count := defaultIterBatchSize * 8
+	keys := make([][]byte, 0, count)
+	values := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%05d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%05d", i)))
+	}
+	err := client.BatchPut(context.Background(), keys, values)
+	s.Nil(err)
+
+	pairCh, errCh := client.ScanStream(context.Background(), []byte("key"), nil)
+	var i int
+	for pair := range pairCh {
+		s.Equal(keys[i], pair.Key)
+		s.Equal(values[i], pair.Value)
+		i++
+	}
+	s.Equal(count, i)
+	s.Nil(<-errCh)
+
+	// a slow consumer holds the producer back, so it never fetches more than the buffered pages.
+	ctx, cancel := context.WithCancel(context.Background())
+	requests := len(rpcClient.requests())
+	pairCh, errCh = client.ScanStream(ctx, []byte("key"), nil)
+	pair := <-pairCh
+	s.Equal(keys[0], pair.Key)
+	time.Sleep(100 * time.Millisecond)
+	s.LessOrEqual(len(rpcClient.requests())-requests, 2)
+
+	cancel()
+	for range pairCh {
+	}
+	s.ErrorIs(<-errCh, context.Canceled)
+	s.Less(len(rpcClient.requests())-requests, count/defaultIterBatchSize)
+}
+
+func (s *testRawkvSuite) TestScanWithConcurrency() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	// split the cluster into regions ["", "key3"), ["key3", "key5"), ["key5", "key7"), ["key7", "")
+	regionID := s.region1
+	for _, splitKey := range []string{"key3", "key5", "key7"} {
+		newRegionID := s.cluster.AllocID()
+		peers := s.cluster.AllocIDs(2)
+		s.cluster.SplitRaw(regionID, newRegionID, []byte(splitKey), peers, peers[0])
+		regionID = newRegionID
+	}
+
+	keys := make([]key, 0, 9)
+	values := make([]value, 0, 9)
+	for i := 1; i <= 9; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%d", i)))
+	}
+	err := client.BatchPut(context.Background(), keys, values)
+	s.Nil(err)
+
+	for _, c := range []struct {
+		startKey, endKey string
+		limit            int
+	}{
+		{"", "", 10},
+		{"key2", "", 10},
+		{"key2", "key8", 10},
+		{"key2", "key8", 3},
+		{"key4", "key5", 10},
+		{"key6", "key6", 10},
+	} {
+		expectedKeys, expectedValues, err := client.Scan(context.Background(), []byte(c.startKey), []byte(c.endKey), c.limit)
+		s.Nil(err)
+		returnKeys, returnValues, err := client.Scan(context.Background(), []byte(c.startKey), []byte(c.endKey), c.limit, ScanWithConcurrency(3))
+		s.Nil(err)
+		s.Equal(expectedKeys, returnKeys)
+		s.Equal(expectedValues, returnValues)
+	}
+	_, _, err = client.Scan(context.Background(), nil, nil, 0, ScanWithConcurrency(3))
+	s.Equal(ErrInvalidScanLimit, errors.Cause(err))
+
+	// a stale region cache makes sub-ranges fail with region errors, which are retried separately.
+	newRegionID := s.cluster.AllocID()
+	peers := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(regionID, newRegionID, []byte("key8"), peers, peers[0])
+	returnKeys, _, err := client.Scan(context.Background(), []byte("key6"), nil, 10, ScanWithConcurrency(2))
+	s.Nil(err)
+	s.Equal([][]byte(keys[5:]), returnKeys)
+}
+
+func (s *testRawkvSuite) TestReverseScanFromEnd() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	// empty cluster
+	returnKeys, _, err := client.ReverseScan(context.Background(), nil, nil, 10)
+	s.Nil(err)
+	s.Len(returnKeys, 0)
+
+	keys := make([]key, 0, 9)
+	values := make([]value, 0, 9)
+	for i := 1; i <= 9; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%d", i)))
+	}
+	err = client.BatchPut(context.Background(), keys, values)
+	s.Nil(err)
+
+	// single region
+	returnKeys, returnValues, err := client.ReverseScan(context.Background(), nil, []byte("key3"), 3)
+	s.Nil(err)
+	s.Equal([][]byte{keys[8], keys[7], keys[6]}, returnKeys)
+	s.Equal([][]byte{values[8], values[7], values[6]}, returnValues)
+
+	// split the cluster into regions ["", "key3"), ["key3", "key6"), ["key6", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+	region3 := s.cluster.AllocID()
+	peers3 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(region2, region3, []byte("key6"), peers3, peers3[0])
+
+	returnKeys, _, err = client.ReverseScan(context.Background(), nil, nil, 10)
+	s.Nil(err)
+	s.Len(returnKeys, 9)
+	for i := range returnKeys {
+		s.Equal(keys[8-i], returnKeys[i])
+	}
+
+	// the range ends exactly at a region boundary
+	returnKeys, _, err = client.ReverseScan(context.Background(), nil, []byte("key6"), 10)
+	s.Nil(err)
+	s.Equal([][]byte{keys[8], keys[7], keys[6], keys[5]}, returnKeys)
+	returnKeys, _, err = client.ReverseScan(context.Background(), nil, []byte("key3"), 10)
+	s.Nil(err)
+	s.Len(returnKeys, 7)
+	s.Equal(keys[2], returnKeys[6])
+}
+
+func (s *testRawkvSuite) TestScanPage() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	// split the cluster into regions ["", "key3"), ["key3", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+
+	keys := make([]key, 0, 7)
+	values := make([]value, 0, 7)
+	for i := 1; i <= 7; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%d", i)))
+	}
+	err := client.BatchPut(context.Background(), keys, values)
+	s.Nil(err)
+
+	var returnKeys [][]byte
+	pairs, next, err := client.ScanPage(context.Background(), []byte("key1"), []byte("key7"), 2)
+	s.Nil(err)
+	for next != nil {
+		for _, pair := range pairs {
+			returnKeys = append(returnKeys, pair.Key)
+		}
+		// the cursor survives a round trip through its token.
+		next, err = ParseCursor(next.String())
+		s.Nil(err)
+		pairs, next, err = client.ScanNextPage(context.Background(), next, 2)
+		s.Nil(err)
+	}
+	for _, pair := range pairs {
+		returnKeys = append(returnKeys, pair.Key)
+	}
+	s.Equal([][]byte(keys[:6]), returnKeys)
+
+	// the last page is full, but there is no next page.
+	pairs, next, err = client.ScanPage(context.Background(), []byte("key5"), nil, 3)
+	s.Nil(err)
+	s.Len(pairs, 3)
+	s.Equal(values[6], pairs[2].Value)
+	s.Nil(next)
+
+	_, err = ParseCursor("not a cursor")
+	s.ErrorIs(err, ErrInvalidCursor)
+	_, err = ParseCursor((&Cursor{startKey: []byte("a")}).String()[:2])
+	s.ErrorIs(err, ErrInvalidCursor)
+}
+
+func (s *testRawkvSuite) TestCount() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	// split the cluster into regions ["", "key3"), ["key3", "key6"), ["key6", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+	region3 := s.cluster.AllocID()
+	peers3 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(region2, region3, []byte("key6"), peers3, peers3[0])
+
+	keys := make([]key, 0, 9)
+	values := make([]value, 0, 9)
+	for i := 1; i <= 9; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%d", i)))
+	}
+	// the mock store computes checksums in the "CF_DEFAULT" column family.
+	err := client.BatchPut(context.Background(), keys, values, SetColumnFamily("CF_DEFAULT"))
+	s.Nil(err)
+
+	count, err := client.Count(context.Background(), nil, nil)
+	s.Nil(err)
+	s.Equal(uint64(9), count)
+
+	count, err = client.Count(context.Background(), []byte("key2"), []byte("key8"), ScanWithConcurrency(1))
+	s.Nil(err)
+	s.Equal(uint64(6), count)
+
+	// a stale region cache makes the sub-range fail with a region error, which is retried.
+	region4 := s.cluster.AllocID()
+	peers4 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(region3, region4, []byte("key8"), peers4, peers4[0])
+	count, err = client.Count(context.Background(), []byte("key5"), nil)
+	s.Nil(err)
+	s.Equal(uint64(5), count)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.Count(ctx, nil, nil)
+	s.Error(err)
+}
+
+func (s *testRawkvSuite) TestRawChecksumMultiRegions() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	cf := "CF_DEFAULT"
+	keys := make([]key, 0, 9)
+	values := make([]value, 0, 9)
+	for i := 1; i <= 9; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%d", i)))
+	}
+	err := client.BatchPut(context.Background(), keys, values, SetColumnFamily(cf))
+	s.Nil(err)
+
+	expected, err := client.Checksum(context.Background(), []byte("key2"), []byte("key9"))
+	s.Nil(err)
+	s.Equal(uint64(7), expected.TotalKvs)
+
+	// split the cluster into regions ["", "key3"), ["key3", "key6"), ["key6", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+	region3 := s.cluster.AllocID()
+	peers3 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(region2, region3, []byte("key6"), peers3, peers3[0])
+
+	for _, concurrency := range []int{0, 1, 2} {
+		check, err := client.Checksum(context.Background(), []byte("key2"), []byte("key9"), ScanWithConcurrency(concurrency))
+		s.Nil(err)
+		s.Equal(expected, check)
+	}
+}
+
+func (s *testRawkvSuite) TestStoreBreaker() {
+	_, err := NewClientWithOpts(context.Background(), nil, WithStoreBreaker(-1, time.Second, time.Second))
+	s.NotNil(err)
+
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(&fakeClient{Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil), failAddr: s.storeAddr(s.store1)})
+	client.backoffFn = func(time.Duration) {}
+	client.storeBreaker = locate.NewStoreBreaker(1, time.Minute, time.Minute)
+	defer client.Close()
+
+	// The leader is on the failing store, whose breaker is tripped by the first failure. The following calls fail
+	// at once without sending any request to the store.
+	_, err = client.Get(context.Background(), []byte("key"))
+	s.NotNil(err)
+	_, err = client.Get(context.Background(), []byte("key"))
+	var unavailableErr *tikverr.ErrStoreUnavailable
+	s.True(errors.As(err, &unavailableErr), "%v", err)
+	s.Equal(s.store1, unavailableErr.StoreID)
+	s.Equal([]uint64{s.store1}, client.UnavailableStores())
+	s.Equal(float64(1), testutil.ToFloat64(metrics.TiKVStoreBreakerStateGauge.WithLabelValues(strconv.FormatUint(s.store1, 10))))
+
+	// The requests go on once the leader moves to another store.
+	s.cluster.ChangeLeader(s.region1, s.peer2)
+	s.Nil(client.Put(context.Background(), []byte("key"), []byte("value")))
+	s.Equal([]uint64{s.store1}, client.UnavailableStores())
+}
+
+func (s *testRawkvSuite) TestReplicaRead() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	leader, follower := s.storeAddr(s.store1), s.storeAddr(s.store2)
+	// The reads sent to notReadyAddr fail with DataIsNotReady.
+	var notReadyAddr atomic.Value
+	notReadyAddr.Store("")
+	rpcClient := &fakeClient{
+		Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		send: func(ctx context.Context, addr string, req *tikvrpc.Request, next func() (*tikvrpc.Response, error)) (*tikvrpc.Response, error) {
+			if addr == notReadyAddr.Load().(string) {
+				return tikvrpc.GenRegionErrorResp(req, &errorpb.Error{DataIsNotReady: &errorpb.DataIsNotReady{}})
+			}
+			return next()
+		},
+	}
+	client := s.newClient(rpcClient)
+	defer client.Close()
+	ctx := context.Background()
+	followerRead := WithReplicaRead(kv.ReplicaReadFollower)
+
+	s.Nil(client.Put(ctx, []byte("key"), []byte("value"), followerRead))
+	s.Equal([]string{leader}, rpcClient.takeAddrs())
+	value, err := client.Get(ctx, []byte("key"))
+	s.Nil(err)
+	s.Equal([]byte("value"), value)
+	s.Equal([]string{leader}, rpcClient.takeAddrs())
+
+	value, err = client.Get(ctx, []byte("key"), followerRead)
+	s.Nil(err)
+	s.Equal([]byte("value"), value)
+	s.Equal([]string{follower}, rpcClient.takeAddrs())
+	values, err := client.BatchGet(ctx, [][]byte{[]byte("key")}, followerRead)
+	s.Nil(err)
+	s.Equal([][]byte{[]byte("value")}, values)
+	s.Equal([]string{follower}, rpcClient.takeAddrs())
+	keys, _, err := client.Scan(ctx, []byte("k"), nil, 10, followerRead)
+	s.Nil(err)
+	s.Equal([][]byte{[]byte("key")}, keys)
+	s.Equal([]string{follower}, rpcClient.takeAddrs())
+
+	// The atomic operations always go to the leader.
+	client.SetAtomicForCAS(true)
+	_, swapped, err := client.CompareAndSwap(ctx, []byte("key"), []byte("value"), []byte("value2"), followerRead)
+	s.Nil(err)
+	s.True(swapped)
+	s.Equal([]string{leader}, rpcClient.takeAddrs())
+
+	// The read falls back to the leader if the follower isn't ready.
+	notReadyAddr.Store(follower)
+	value, err = client.Get(ctx, []byte("key"), followerRead)
+	s.Nil(err)
+	s.Equal([]byte("value2"), value)
+	s.Equal([]string{follower, leader}, rpcClient.takeAddrs())
+}
+
+func (s *testRawkvSuite) TestPreferredLabels() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	s.cluster.UpdateStoreLabels(s.store1, []*metapb.StoreLabel{{Key: "zone", Value: "a"}})
+	s.cluster.UpdateStoreLabels(s.store2, []*metapb.StoreLabel{{Key: "zone", Value: "b"}})
+	leader, follower := s.storeAddr(s.store1), s.storeAddr(s.store2)
+	rpcClient := &fakeClient{Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil)}
+	client := s.newClient(rpcClient)
+	defer client.Close()
+	ctx := context.Background()
+	s.Nil(client.Put(ctx, []byte("key"), []byte("value")))
+	rpcClient.takeAddrs()
+
+	get := func(zone string, mode kv.ReplicaReadType) (addrs []string, local, remote float64) {
+		client.preferredLabels = storeLabels(map[string]string{"zone": zone})
+		local, remote = testutil.ToFloat64(metrics.RawkvReplicaReadLocal), testutil.ToFloat64(metrics.RawkvReplicaReadRemote)
+		value, err := client.Get(ctx, []byte("key"), WithReplicaRead(mode))
+		s.Nil(err)
+		s.Equal([]byte("value"), value)
+		return rpcClient.takeAddrs(), testutil.ToFloat64(metrics.RawkvReplicaReadLocal) - local, testutil.ToFloat64(metrics.RawkvReplicaReadRemote) - remote
+	}
+	addrs, local, remote := get("b", kv.ReplicaReadMixed)
+	s.Equal([]string{follower}, addrs)
+	s.Equal([]float64{1, 0}, []float64{local, remote})
+	addrs, local, remote = get("a", kv.ReplicaReadMixed)
+	s.Equal([]string{leader}, addrs)
+	s.Equal([]float64{1, 0}, []float64{local, remote})
+	// No replica matches, so the read falls back to the leader.
+	addrs, local, remote = get("c", kv.ReplicaReadMixed)
+	s.Equal([]string{leader}, addrs)
+	s.Equal([]float64{0, 1}, []float64{local, remote})
+}
+
+func (s *testRawkvSuite) TestRequestSource() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	rpcClient := &fakeClient{Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil)}
+	client := s.newClient(rpcClient)
+	defer client.Close()
+	client.SetRequestSource("app").SetResourceGroupTag([]byte("group")).SetAtomicForCAS(true)
+	ctx := context.Background()
+	keys := [][]byte{[]byte("a"), []byte("b")}
+
+	s.Nil(client.BatchPut(ctx, keys, keys))
+	_, err := client.BatchGet(ctx, keys)
+	s.Nil(err)
+	_, _, err = client.Scan(ctx, nil, nil, 10)
+	s.Nil(err)
+	_, _, err = client.CompareAndSwap(ctx, []byte("a"), []byte("a"), []byte("x"))
+	s.Nil(err)
+	s.Nil(client.DeleteRange(ctx, []byte("a"), []byte("b")))
+	s.Nil(client.BatchDelete(ctx, keys))
+	cmds := []tikvrpc.CmdType{tikvrpc.CmdRawBatchPut, tikvrpc.CmdRawBatchGet, tikvrpc.CmdRawScan,
+		tikvrpc.CmdRawCompareAndSwap, tikvrpc.CmdRawDeleteRange, tikvrpc.CmdRawBatchDelete}
+	for _, cmd := range cmds {
+		s.Equal("app", rpcClient.lastRequest(cmd).RequestSource, cmd.String())
+		s.Equal("group", string(rpcClient.lastRequest(cmd).ResourceGroupTag), cmd.String())
+	}
+
+	_, err = client.Get(ctx, []byte("b"), WithRequestSource("job"), WithResourceGroupTag([]byte("batch")))
+	s.Nil(err)
+	s.Equal("job", rpcClient.lastRequest(tikvrpc.CmdRawGet).RequestSource)
+	s.Equal("batch", string(rpcClient.lastRequest(tikvrpc.CmdRawGet).ResourceGroupTag))
+}
+
+func (s *testRawkvSuite) TestPriority() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	rpcClient := &fakeClient{Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil)}
+	client := s.newClient(rpcClient)
+	defer client.Close()
+	ctx := context.Background()
+	keys := [][]byte{[]byte("a"), []byte("b")}
+
+	s.Nil(client.BatchPut(ctx, keys, keys, WithPriority(PriorityLow), WithRequestSource("job")))
+	s.Equal(kvrpcpb.CommandPri_Low, rpcClient.lastRequest(tikvrpc.CmdRawBatchPut).Priority)
+	s.Equal("job", rpcClient.lastRequest(tikvrpc.CmdRawBatchPut).RequestSource)
+	s.Nil(client.DeleteRange(ctx, []byte("a"), []byte("c"), WithPriority(PriorityLow)))
+	s.Equal(kvrpcpb.CommandPri_Low, rpcClient.lastRequest(tikvrpc.CmdRawDeleteRange).Priority)
+	_, err := client.Get(ctx, []byte("a"), WithPriority(PriorityHigh))
+	s.Nil(err)
+	s.Equal(kvrpcpb.CommandPri_High, rpcClient.lastRequest(tikvrpc.CmdRawGet).Priority)
+	_, err = client.Get(ctx, []byte("a"))
+	s.Nil(err)
+	s.Equal(kvrpcpb.CommandPri_Normal, rpcClient.lastRequest(tikvrpc.CmdRawGet).Priority)
+}
+
+func (s *testRawkvSuite) TestRuntimeStats() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+	ctx := context.Background()
+
+	// split the cluster into regions ["", "b"), ["b", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("b"), peers2, peers2[0])
+
+	stats := &RuntimeStats{}
+	keys := [][]byte{[]byte("a"), []byte("b")}
+	s.Nil(client.BatchPut(ctx, keys, keys, WithRuntimeStats(stats)))
+	_, err := client.Get(ctx, []byte("a"), WithRuntimeStats(stats))
+	s.Nil(err)
+	_, err = client.Get(ctx, []byte("b"), WithRuntimeStats(stats))
+	s.Nil(err)
+	// The calls without the option don't count, although they reuse the same senders.
+	_, err = client.Get(ctx, []byte("a"))
+	s.Nil(err)
+
+	rpcStats := stats.Stats()
+	s.Len(rpcStats, 2)
+	s.Equal(int64(2), rpcStats[tikvrpc.CmdRawBatchPut].Count)
+	s.Equal(int64(2), rpcStats[tikvrpc.CmdRawGet].Count)
+	s.Greater(rpcStats[tikvrpc.CmdRawGet].Time, time.Duration(0))
+	s.Contains(stats.String(), "RawGet:{num_rpc:2")
+}
+
+func (s *testRawkvSuite) TestCallBreakdown() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	rawkvMetrics, err := metrics.NewRawkvMetrics(prometheus.NewRegistry(), nil)
+	s.Nil(err)
+	client := s.newClient(&fakeClient{
+		Client:     mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		cmd:        tikvrpc.CmdRawGet,
+		regionErrs: []*errorpb.Error{{EpochNotMatch: &errorpb.EpochNotMatch{}}},
+	})
+	client.rawkvMetrics = rawkvMetrics
+	defer client.Close()
+	ctx := context.Background()
+
+	// split the cluster into regions ["", "b"), ["b", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("b"), peers2, peers2[0])
+
+	// The Get meets a region error, and backs off before it's retried.
+	stats := &RuntimeStats{}
+	_, err = client.Get(ctx, []byte("a"), WithRuntimeStats(stats))
+	s.Nil(err)
+	breakdown := stats.Breakdown()
+	s.Greater(breakdown.RPCTime, time.Duration(0))
+	s.Greater(breakdown.BackoffTime, time.Duration(0))
+	s.Greater(breakdown.RegionTime, time.Duration(0))
+	s.Equal(map[string]int{"epoch_not_match": 1}, breakdown.Retries)
+	s.Zero(breakdown.Batches)
+	getMetrics := rawkvMetrics.Cmd("get")
+	s.Equal(uint64(1), sampleCount(getMetrics.RPCDuration))
+	s.Equal(uint64(1), sampleCount(getMetrics.BackoffDuration))
+	s.Equal(uint64(1), sampleCount(getMetrics.RegionDuration))
+	s.Equal(uint64(0), sampleCount(getMetrics.BatchCount))
+	s.Equal(float64(1), testutil.ToFloat64(rawkvMetrics.RetryCounter.WithLabelValues("epoch_not_match")))
+
+	// The keys of the BatchGet are split into a sub-batch for each region.
+	stats = &RuntimeStats{}
+	_, err = client.BatchGet(ctx, [][]byte{[]byte("a"), []byte("c")}, WithRuntimeStats(stats))
+	s.Nil(err)
+	breakdown = stats.Breakdown()
+	s.Equal(2, breakdown.Batches)
+	s.Greater(breakdown.MaxBatchTime, time.Duration(0))
+	s.Empty(breakdown.Retries)
+	batchGetMetrics := rawkvMetrics.Cmd("batch_get")
+	s.Equal(uint64(1), sampleCount(batchGetMetrics.BatchCount))
+	s.Equal(uint64(1), sampleCount(batchGetMetrics.MaxBatchDuration))
+
+	// The CAS commands are observed the same way.
+	client.SetAtomicForCAS(true)
+	client.rpcClient = &fakeClient{
+		Client:     client.rpcClient,
+		cmd:        tikvrpc.CmdRawCompareAndSwap,
+		regionErrs: []*errorpb.Error{{EpochNotMatch: &errorpb.EpochNotMatch{}}},
+	}
+	stats = &RuntimeStats{}
+	_, _, err = client.CompareAndSwap(ctx, []byte("a"), nil, []byte("1"), WithRuntimeStats(stats))
+	s.Nil(err)
+	breakdown = stats.Breakdown()
+	s.Greater(breakdown.BackoffTime, time.Duration(0))
+	s.Equal(map[string]int{"epoch_not_match": 1}, breakdown.Retries)
+	casMetrics := rawkvMetrics.Cmd("cas")
+	s.Equal(uint64(1), sampleCount(casMetrics.RPCDuration))
+	s.Equal(uint64(1), sampleCount(casMetrics.BackoffDuration))
+	s.Equal(float64(2), testutil.ToFloat64(rawkvMetrics.RetryCounter.WithLabelValues("epoch_not_match")))
+
+	stats = &RuntimeStats{}
+	_, err = client.BatchCompareAndSwap(ctx, []CASOp{{Key: []byte("a"), Previous: []byte("1"), New: []byte("2")}, {Key: []byte("c"), New: []byte("3")}}, WithRuntimeStats(stats))
+	s.Nil(err)
+	s.Equal(2, stats.Breakdown().Batches)
+	s.Equal(uint64(1), sampleCount(rawkvMetrics.Cmd("batch_cas").BatchCount))
+}
+
+func (s *testRawkvSuite) TestClientStats() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(&fakeClient{
+		Client:     mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		cmd:        tikvrpc.CmdRawBatchGet,
+		regionErrs: []*errorpb.Error{{EpochNotMatch: &errorpb.EpochNotMatch{}}},
+	})
+	client.stats = newClientStats()
+	defer client.Close()
+	ctx := context.Background()
+
+	// split the cluster into regions ["", "b"), ["b", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("b"), peers2, peers2[0])
+
+	s.Nil(client.Put(ctx, []byte("a"), []byte("1")))
+	s.Nil(client.Put(ctx, []byte("c"), []byte("3")))
+	// One of the sub-batches of the BatchGet meets a region error, so its keys are regrouped and sent again.
+	values, err := client.BatchGet(ctx, [][]byte{[]byte("a"), []byte("c")})
+	s.Nil(err)
+	s.Equal([][]byte{[]byte("1"), []byte("3")}, values)
+
+	stats := client.Stats(true)
+	s.Equal(map[string]int64{"RawPut": 2, "RawBatchGet": 3}, stats.Requests)
+	s.Equal(map[string]int64{"region": 1}, stats.Errors)
+	s.Equal(int64(1), stats.Retries)
+	s.Equal(int64(3), stats.Batches)
+	s.Equal(int64(1), stats.Regroupings)
+	s.Greater(stats.BytesSent, int64(0))
+	s.Greater(stats.BytesReceived, int64(0))
+	s.Zero(stats.InFlight)
+
+	// The counters are reset by the previous snapshot.
+	s.Equal(ClientStats{Requests: map[string]int64{}, Errors: map[string]int64{}}, client.Stats(false))
+
+	// A client without stats returns empty snapshots.
+	s.Equal(ClientStats{Requests: map[string]int64{}, Errors: map[string]int64{}}, (&Client{}).Stats(false))
+}
+
+func (s *testRawkvSuite) TestDebugRecorder() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(&fakeClient{
+		Client:     mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		cmd:        tikvrpc.CmdRawBatchPut,
+		regionErrs: []*errorpb.Error{{EpochNotMatch: &errorpb.EpochNotMatch{}}},
+	})
+	client.debugRecorder = newDebugRecorder(2)
+	defer client.Close()
+	ctx := context.Background()
+
+	// Only the last 2 Puts are kept.
+	for _, key := range []string{"a", "b", "c"} {
+		s.Nil(client.Put(ctx, []byte(key), []byte("1")))
+	}
+	// The BatchPut meets a region error and is sent again.
+	s.Nil(client.BatchPut(ctx, [][]byte{[]byte("d"), []byte("e")}, [][]byte{[]byte("4"), []byte("5")}))
+	_, _, err := client.Scan(ctx, []byte("a"), []byte("z"), 10)
+	s.Nil(err)
+
+	records := client.DebugDump()
+	s.Len(records, 5)
+	for i, rec := range records {
+		s.Equal(s.region1, rec.Region)
+		s.NotEmpty(rec.Store)
+		s.Greater(rec.Latency, time.Duration(0))
+		if i > 0 {
+			s.False(rec.Time.Before(records[i-1].Time))
+		}
+	}
+	s.Equal("RawPut", records[0].Cmd)
+	s.Equal(hex.EncodeToString([]byte("b")), records[0].StartKey)
+	s.Equal("ok", records[0].Outcome)
+	s.Equal(hex.EncodeToString([]byte("c")), records[1].StartKey)
+	s.Equal("RawBatchPut", records[2].Cmd)
+	s.Equal(2, records[2].KeyCount)
+	s.Equal("region_error", records[2].Outcome)
+	s.Equal("epoch_not_match", records[2].Error)
+	s.Equal("RawBatchPut", records[3].Cmd)
+	s.Equal("ok", records[3].Outcome)
+	s.Equal("RawScan", records[4].Cmd)
+	s.Equal(hex.EncodeToString([]byte("a")), records[4].StartKey)
+	s.Equal(hex.EncodeToString([]byte("z")), records[4].EndKey)
+	_, err = json.Marshal(records)
+	s.Nil(err)
+
+	s.Nil((&Client{}).DebugDump())
+}
+
+func (s *testRawkvSuite) TestBatchSplitMetrics() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	rawkvMetrics, err := metrics.NewRawkvMetrics(prometheus.NewRegistry(), nil)
+	s.Nil(err)
+	client := s.newClient(&fakeClient{
+		Client:     mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		cmd:        tikvrpc.CmdRawBatchPut,
+		regionErrs: []*errorpb.Error{{EpochNotMatch: &errorpb.EpochNotMatch{}}},
+	})
+	client.rawkvMetrics = rawkvMetrics
+	client.batchPairCountLimit = 2
+	defer client.Close()
+
+	// split the cluster into regions ["", "b"), ["b", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("b"), peers2, peers2[0])
+
+	// The pairs are split into a sub-batch of 2 pairs and 4 bytes in each region, and the one meeting the region error
+	// is regrouped and sent again.
+	stats := &RuntimeStats{}
+	keys := [][]byte{[]byte("a1"), []byte("a2"), []byte("c1"), []byte("c2")}
+	values := [][]byte{[]byte("1"), []byte("2"), []byte("3"), []byte("4")}
+	s.Nil(client.BatchPut(context.Background(), keys, values, WithRuntimeStats(stats)))
+	breakdown := stats.Breakdown()
+	s.Equal(3, breakdown.Batches)
+	s.Equal(3, breakdown.Regions)
+	s.Equal(1, breakdown.RetriedBatches)
+
+	batchPutMetrics := rawkvMetrics.Cmd("batch_put")
+	s.Equal(uint64(1), sampleCount(batchPutMetrics.BatchRegionCount))
+	s.Equal(uint64(3), sampleCount(batchPutMetrics.BatchPairs))
+	s.Equal(uint64(3), sampleCount(batchPutMetrics.BatchBytes))
+	s.Equal(float64(6), sampleSum(batchPutMetrics.BatchPairs))
+	s.Equal(float64(18), sampleSum(batchPutMetrics.BatchBytes))
+	s.Equal(float64(1), testutil.ToFloat64(batchPutMetrics.BatchRetry))
+}
+
+func (s *testRawkvSuite) TestErrorMetrics() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	rawkvMetrics, err := metrics.NewRawkvMetrics(prometheus.NewRegistry(), nil)
+	s.Nil(err)
+	client := s.newClient(&fakeClient{
+		Client:     mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		cmd:        tikvrpc.CmdRawGet,
+		regionErrs: []*errorpb.Error{{EpochNotMatch: &errorpb.EpochNotMatch{}}},
+	})
+	client.rawkvMetrics = rawkvMetrics
+	defer client.Close()
+	errorCount := func(command, kind string) float64 {
+		return testutil.ToFloat64(rawkvMetrics.ErrorCounter.WithLabelValues(command, kind))
+	}
+
+	// The region error is counted when the request returns, and giving up retrying is counted once for the call.
+	_, err = client.Get(context.Background(), []byte("key"), WithMaxRetries(0))
+	s.NotNil(err)
+	s.Equal(float64(1), errorCount("get", "region_error"))
+	s.Equal(float64(1), errorCount("get", "retries_exhausted"))
+
+	// Put is observed with its own label, not as a batch put.
+	s.Nil(client.Put(context.Background(), []byte("key"), []byte("value")))
+	s.Equal(uint64(1), sampleCount(rawkvMetrics.CmdHistogram.WithLabelValues("put")))
+	s.Zero(sampleCount(rawkvMetrics.CmdHistogram.WithLabelValues("batch_put")))
+
+	// The deadline is exceeded while the call backs off on the busy store.
+	client.rpcClient.(*fakeClient).regionErrs = []*errorpb.Error{{ServerIsBusy: &errorpb.ServerIsBusy{}}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = client.Get(ctx, []byte("key"))
+	s.ErrorIs(err, context.DeadlineExceeded)
+	s.Equal(float64(1), errorCount("get", "context_canceled"))
+	s.Zero(errorCount("get", "rpc_error"))
+}
+
+func (s *testRawkvSuite) TestSlowLog() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(&fakeClient{
+		Client:     mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		cmd:        tikvrpc.CmdRawGet,
+		regionErrs: []*errorpb.Error{{EpochNotMatch: &errorpb.EpochNotMatch{}}},
+	})
+	client.slowLogThreshold = time.Nanosecond
+	defer client.Close()
+	core, logs := observer.New(zap.WarnLevel)
+	ctx := context.WithValue(context.Background(), logutil.CtxLogKey, zap.New(core))
+
+	// split the cluster into regions ["", "b"), ["b", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("b"), peers2, peers2[0])
+
+	// A slow call is logged once when it returns, although it's retried.
+	_, err := client.Get(ctx, []byte("a"))
+	s.Nil(err)
+	entries := logs.TakeAll()
+	s.Len(entries, 1)
+	fields := entries[0].ContextMap()
+	s.Equal("slow rawkv call", entries[0].Message)
+	s.Equal("get", fields["cmd"])
+	s.Equal("RawGet", fields["request"])
+	s.Equal("61", fields["key"])
+	s.Equal(s.region1, fields["region"])
+	s.Equal(s.cluster.GetStore(s.store1).GetAddress(), fields["store"])
+	s.Contains(fields, "retries")
+	s.Contains(fields, "backoffTime")
+
+	// So is a call sending many requests.
+	_, err = client.BatchGet(ctx, [][]byte{[]byte("a"), []byte("c")})
+	s.Nil(err)
+	s.Equal(1, logs.Len())
+	logs.TakeAll()
+
+	client.slowLogKeyRedaction = KeyRedactionHash
+	_, err = client.Get(ctx, []byte("a"))
+	s.Nil(err)
+	s.Equal(KeyRedactionHash.redact([]byte("a")), logs.TakeAll()[0].ContextMap()["key"])
+	s.NotContains(KeyRedactionHash.redact([]byte("a")), "61")
+	s.Equal("?", KeyRedactionFull.redact([]byte("a")))
+	s.Equal(strings.Repeat("00", maxLoggedKeyLen)+"...", KeyRedactionNone.redact(make([]byte, maxLoggedKeyLen+1)))
+
+	// The calls faster than the threshold aren't logged.
+	client.slowLogThreshold = time.Hour
+	_, err = client.Get(ctx, []byte("a"))
+	s.Nil(err)
+	s.Zero(logs.Len())
+
+	client.slowLogThreshold, client.slowLogKeyRedaction = time.Nanosecond, KeyRedactionNone
+
+	// A call that fails is logged too, with its error and the last request it has sent.
+	client.rpcClient.(*fakeClient).regionErrs = []*errorpb.Error{{ServerIsBusy: &errorpb.ServerIsBusy{}}}
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = client.Get(cctx, []byte("c"))
+	s.ErrorIs(err, context.DeadlineExceeded)
+	entries = logs.TakeAll()
+	s.Len(entries, 1)
+	fields = entries[0].ContextMap()
+	s.Contains(fields["error"], context.DeadlineExceeded.Error())
+	s.Equal("63", fields["key"])
+	s.Equal(region2, fields["region"])
+
+	// So is a call that fails before sending any request.
+	client.atomic = true
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, _, err = client.CompareAndSwap(canceled, []byte("a"), nil, []byte("b"))
+	s.NotNil(err)
+	entries = logs.TakeAll()
+	s.Len(entries, 1)
+	s.Equal("cas", entries[0].ContextMap()["cmd"])
+	s.NotContains(entries[0].ContextMap(), "region")
+}
+
+// spanRecorder is a TracerProvider that records the spans.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (r *spanRecorder) Tracer(name string, options ...trace.TracerOption) trace.Tracer {
+	return r
+}
+
+func (r *spanRecorder) Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := &recordedSpan{
+		Span:     noopSpan,
+		recorder: r,
+		name:     name,
+		attrs:    make(map[attribute.Key]attribute.Value),
+	}
+	if parent, ok := trace.SpanFromContext(ctx).(*recordedSpan); ok {
+		span.parent = parent.name
+	}
+	cfg := trace.NewSpanStartConfig(options...)
+	span.SetAttributes(cfg.Attributes()...)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+// finished returns the ended spans in the order they ended.
+func (r *spanRecorder) finished() []*recordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*recordedSpan(nil), r.spans...)
+}
+
+type recordedSpan struct {
+	trace.Span
+	recorder *spanRecorder
+	name     string
+	parent   string
+	attrs    map[attribute.Key]attribute.Value
+	err      error
+}
+
+func (s *recordedSpan) IsRecording() bool { return true }
+
+func (s *recordedSpan) RecordError(err error, options ...trace.EventOption) { s.err = err }
+
+func (s *recordedSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, attr := range kv {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordedSpan) End(options ...trace.SpanEndOption) {
+	s.recorder.mu.Lock()
+	s.recorder.spans = append(s.recorder.spans, s)
+	s.recorder.mu.Unlock()
+}
+
+func (s *recordedSpan) TracerProvider() trace.TracerProvider { return s.recorder }
+
+func (s *testRawkvSuite) TestTracing() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	recorder := &spanRecorder{}
+	opt := &option{}
+	WithTracerProvider(recorder)(opt)
+	client := s.newClient(&fakeClient{
+		Client:     mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		cmd:        tikvrpc.CmdRawGet,
+		regionErrs: []*errorpb.Error{{EpochNotMatch: &errorpb.EpochNotMatch{}}},
+	})
+	client.tracer = opt.tracer()
+	defer client.Close()
+
+	// The span of the call is a child of the span of the caller.
+	ctx, parent := recorder.Start(context.Background(), "caller")
+	_, err := client.Get(ctx, []byte("key"))
+	s.Nil(err)
+	parent.End()
+
+	spans := recorder.finished()
+	s.Len(spans, 5)
+	var names []string
+	for _, span := range spans {
+		names = append(names, span.name)
+	}
+	s.Equal([]string{"rawkv.RegionRequest", "tikv.backoff.regionMiss", "rawkv.RegionRequest", "rawkv.Get", "caller"}, names)
+	s.Equal("caller", spans[3].parent)
+	for _, span := range spans[:3] {
+		s.Equal("rawkv.Get", span.parent)
+	}
+	// The first request meets a region error, and the call backs off before the second one.
+	s.Equal("RawGet", spans[0].attrs["cmd"].AsString())
+	s.Equal(int64(s.region1), spans[0].attrs["region"].AsInt64())
+	s.Equal(s.cluster.GetStore(s.store1).GetAddress(), spans[0].attrs["store"].AsString())
+	s.Contains(spans[0].attrs["region_error"].AsString(), "epoch_not_match")
+	s.Contains(spans[1].attrs, attribute.Key("sleep_ms"))
+	s.NotContains(spans[2].attrs, attribute.Key("region_error"))
+	s.Equal(int64(0), spans[2].attrs["retries"].AsInt64())
+	s.Nil(spans[3].err)
+
+	// The error of a call is recorded on its span.
+	recorder.spans = nil
+	_, err = client.Incr(ctx, []byte("counter"), 1)
+	s.ErrorIs(err, ErrAtomicModeRequired)
+	spans = recorder.finished()
+	s.Len(spans, 1)
+	s.Equal("rawkv.Incr", spans[0].name)
+	s.ErrorIs(spans[0].err, ErrAtomicModeRequired)
+
+	// The span of an iterator lasts until it's closed, and the scans are its children.
+	recorder.spans = nil
+	it, err := client.Iter(ctx, []byte("a"), []byte("z"), 10)
+	s.Nil(err)
+	for it.Next() {
+	}
+	s.Nil(it.Error())
+	spans = recorder.finished()
+	s.NotEmpty(spans)
+	for _, span := range spans {
+		s.NotEqual("rawkv.Iter", span.name)
+	}
+	it.Close()
+	spans = recorder.finished()
+	s.Equal("rawkv.Iter", spans[len(spans)-1].name)
+	s.Equal("rawkv.Iter", spans[len(spans)-2].parent)
+
+	// A client that isn't traced doesn't add backoff spans to the span of the caller.
+	recorder.spans = nil
+	client.tracer = nil
+	client.rpcClient.(*fakeClient).regionErrs = []*errorpb.Error{{EpochNotMatch: &errorpb.EpochNotMatch{}}}
+	_, err = client.Get(ctx, []byte("key"))
+	s.Nil(err)
+	s.Empty(recorder.finished())
+}
+
+func (s *testRawkvSuite) TestTracingDisabled() {
+	client := &Client{}
+	ctx := context.Background()
+	allocs := testing.AllocsPerRun(100, func() {
+		_, span := client.startSpan(ctx, "rawkv.Get")
+		endSpan(span, nil)
+	})
+	s.Zero(allocs)
+	spanCtx, span := client.startSpan(ctx, "rawkv.Get")
+	s.Equal(ctx, spanCtx)
+	s.False(span.IsRecording())
+}
+
+func (s *testRawkvSuite) TestCompactRange() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	stores := s.cluster.GetAllStores()
+	s.Len(stores, 2)
+	client := s.newClient(&fakeClient{
+		Client:   mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		failAddr: stores[1].GetAddress(),
+	})
+	client.pdClient = mocktikv.NewPDClient(s.cluster)
+	defer client.Close()
+
+	result, err := client.CompactRange(context.Background(), []byte("key1"), nil, time.Second)
+	s.Nil(err)
+	s.Equal([]uint64{stores[0].GetId()}, result.Succeeded)
+	s.Len(result.Failed, 1)
+	s.Error(result.Failed[stores[1].GetId()])
+}
+
+func (s *testRawkvSuite) TestHealthCheck() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	client.pdClient = mocktikv.NewPDClient(s.cluster)
+	defer client.Close()
+
+	s.Nil(client.Ping(context.Background()))
+	health, err := client.CheckStores(context.Background())
+	s.Nil(err)
+	s.Len(health, 2)
+	for _, h := range health {
+		s.True(h.Reachable)
+		s.Nil(h.Err)
+		s.Equal(metapb.StoreState_Up, h.State)
+	}
+
+	// Ping succeeds as long as one store is reachable.
+	s.cluster.StopStore(s.store1)
+	s.Nil(client.Ping(context.Background()))
+	health, err = client.CheckStores(context.Background())
+	s.Nil(err)
+	s.Equal([]uint64{s.store1, s.store2}, []uint64{health[0].StoreID, health[1].StoreID})
+	s.Equal(s.storeAddr(s.store1), health[0].Address)
+	s.False(health[0].Reachable)
+	s.Error(health[0].Err)
+	s.Equal(metapb.StoreState_Offline, health[0].State)
+	s.True(health[1].Reachable)
+
+	s.cluster.StopStore(s.store2)
+	s.Error(client.Ping(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.cluster.StartStore(s.store1)
+	s.Error(client.Ping(ctx))
+}
+
+func (s *testRawkvSuite) TestClusterInfo() {
+	client := &Client{
+		clusterID: 0,
+		pdClient:  mocktikv.NewPDClient(s.cluster),
+	}
+
+	s.cluster.UpdateStoreLabels(s.store2, []*metapb.StoreLabel{{Key: "zone", Value: "z2"}})
+	// split the cluster into regions ["", "key3"), ["key3", "key6"), ["key6", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+	region3 := s.cluster.AllocID()
+	peers3 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(region2, region3, []byte("key6"), peers3, peers3[0])
+
+	info, err := client.ClusterInfo(context.Background())
+	s.Nil(err)
+	s.Equal("mockpd", info.PDLeader)
+	s.Len(info.Stores, 2)
+	s.Equal(s.store1, info.Stores[0].StoreID)
+	s.Equal(s.storeAddr(s.store1), info.Stores[0].Address)
+	s.Equal(metapb.StoreState_Up, info.Stores[0].State)
+	s.NotContains(info.Stores[0].Labels, "zone")
+	s.Equal("z2", info.Stores[1].Labels["zone"])
+	s.Equal(3, info.RegionCount)
+
+	info, err = client.ClusterInfo(context.Background(), WithRegionRange([]byte("key3"), []byte("key6")))
+	s.Nil(err)
+	s.Equal(1, info.RegionCount)
+	info, err = client.ClusterInfo(context.Background(), WithRegionRange([]byte("key1"), []byte("key4")))
+	s.Nil(err)
+	s.Equal(2, info.RegionCount)
+	info, err = client.ClusterInfo(context.Background(), WithRegionRange([]byte("key4"), nil))
+	s.Nil(err)
+	s.Equal(2, info.RegionCount)
+}
+
+// regionLoadCounter counts the regions loaded one by one from PD.
+type regionLoadCounter struct {
+	pd.Client
+	loads int32
+}
+
+func (c *regionLoadCounter) GetRegion(ctx context.Context, key []byte, opts ...pd.GetRegionOption) (*pd.Region, error) {
+	atomic.AddInt32(&c.loads, 1)
+	return c.Client.GetRegion(ctx, key, opts...)
+}
+
+func (c *regionLoadCounter) GetPrevRegion(ctx context.Context, key []byte, opts ...pd.GetRegionOption) (*pd.Region, error) {
+	atomic.AddInt32(&c.loads, 1)
+	return c.Client.GetPrevRegion(ctx, key, opts...)
+}
+
+func (s *testRawkvSuite) TestPrefetchRegions() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// split the cluster into regions ["", "key3"), ["key3", "key6"), ["key6", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+	region3 := s.cluster.AllocID()
+	peers3 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(region2, region3, []byte("key6"), peers3, peers3[0])
+
+	pdClient := &regionLoadCounter{Client: mocktikv.NewPDClient(s.cluster)}
+	rpcClient := &fakeClient{Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil)}
+	client := &Client{
+		clusterID:   0,
+		pdClient:    pdClient,
+		regionCache: locate.NewRegionCache(pdClient),
+		rpcClient:   rpcClient,
+	}
+	defer client.Close()
+	ctx := context.Background()
+
+	count, err := client.PrefetchRegions(ctx, []byte("key4"), []byte("key7"))
+	s.Nil(err)
+	s.Equal(2, count)
+	count, err = client.PrefetchRegions(ctx, nil, nil, PrefetchConnections())
+	s.Nil(err)
+	s.Equal(3, count)
+	s.NotNil(rpcClient.lastRequest(tikvrpc.CmdStoreSafeTS))
+
+	keys := [][]byte{[]byte("key1"), []byte("key4"), []byte("key7")}
+	s.Nil(client.BatchPut(ctx, keys, keys))
+	values, err := client.BatchGet(ctx, keys)
+	s.Nil(err)
+	s.Equal(keys, values)
+	s.Nil(client.BatchDeleteRange(ctx, []byte("key0"), []byte("key9")))
+	s.Equal(int32(0), atomic.LoadInt32(&pdClient.loads))
+}
+
+func (s *testRawkvSuite) TestInvalidateAndReloadRegionCache() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	pdClient := &regionLoadCounter{Client: mocktikv.NewPDClient(s.cluster)}
+	client := &Client{
+		clusterID:   0,
+		pdClient:    pdClient,
+		regionCache: locate.NewRegionCache(pdClient),
+		rpcClient:   mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+	}
+	defer client.Close()
+	ctx := context.Background()
+
+	// split the cluster into regions ["", "key3"), ["key3", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+
+	s.Nil(client.Put(ctx, []byte("key1"), []byte("value1")))
+	loads := atomic.LoadInt32(&pdClient.loads)
+	client.InvalidateRegionCache([]byte("key5"), nil)
+	_, err := client.Get(ctx, []byte("key1"))
+	s.Nil(err)
+	s.Equal(loads, atomic.LoadInt32(&pdClient.loads))
+
+	// The Get after the invalidation locates the region from PD again.
+	client.InvalidateRegionCache([]byte("key0"), []byte("key2"))
+	value, err := client.Get(ctx, []byte("key1"))
+	s.Nil(err)
+	s.Equal([]byte("value1"), value)
+	s.Greater(atomic.LoadInt32(&pdClient.loads), loads)
+
+	// split the cluster into regions ["", "key3"), ["key3", "key6"), ["key6", "")
+	s.Nil(client.Put(ctx, []byte("key4"), []byte("value4")))
+	region3 := s.cluster.AllocID()
+	peers3 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(region2, region3, []byte("key6"), peers3, peers3[0])
+	s.Nil(client.ReloadRegionCache(ctx))
+	loads = atomic.LoadInt32(&pdClient.loads)
+	loc, err := client.regionCache.LocateKey(retry.NewNoopBackoff(ctx), []byte("key7"))
+	s.Nil(err)
+	s.Equal(region3, loc.Region.GetID())
+	value, err = client.Get(ctx, []byte("key4"))
+	s.Nil(err)
+	s.Equal([]byte("value4"), value)
+	s.Equal(loads, atomic.LoadInt32(&pdClient.loads))
+
+	stats := client.RegionCacheStats()
+	s.Equal(3, stats.Regions)
+	s.GreaterOrEqual(stats.Invalidations.Other, int64(2))
+	s.Equal(int64(loads), stats.Misses)
+	s.Positive(stats.Hits)
+}
+
+func (s *testRawkvSuite) TestDeleteRangeWithDetail() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	// split the cluster into regions ["", "key3"), ["key3", "key6"), ["key6", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+	region3 := s.cluster.AllocID()
+	peers3 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(region2, region3, []byte("key6"), peers3, peers3[0])
+
+	keys := make([]key, 0, 9)
+	values := make([]value, 0, 9)
+	for i := 1; i <= 9; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%d", i)))
+	}
+	err := client.BatchPut(context.Background(), keys, values)
+	s.Nil(err)
+
+	result, err := client.DeleteRangeWithDetail(context.Background(), []byte("key2"), []byte("key8"), DeleteRangeCountKeys())
+	s.Nil(err)
+	s.Equal(3, result.Regions)
+	s.Equal(uint64(6), result.Keys)
+	s.Equal([]DeletedRange{
+		{RegionID: s.region1, StartKey: []byte("key2"), EndKey: []byte("key3")},
+		{RegionID: region2, StartKey: []byte("key3"), EndKey: []byte("key6")},
+		{RegionID: region3, StartKey: []byte("key6"), EndKey: []byte("key8")},
+	}, result.Ranges)
+
+	returnKeys, _, err := client.Scan(context.Background(), nil, nil, 10)
+	s.Nil(err)
+	s.Equal([][]byte{keys[0], keys[7], keys[8]}, returnKeys)
+
+	// keys are not counted by default.
+	result, err = client.DeleteRangeWithDetail(context.Background(), []byte("key1"), []byte("key2"))
+	s.Nil(err)
+	s.Equal(1, result.Regions)
+	s.Equal(uint64(0), result.Keys)
+}
+
+func (s *testRawkvSuite) TestBatchDeleteRange() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// regions are the regions the ranges are deleted from.
+	var (
+		mu      sync.Mutex
+		regions []uint64
+	)
+	client := s.newClient(&fakeClient{
+		Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		send: func(ctx context.Context, addr string, req *tikvrpc.Request, next func() (*tikvrpc.Response, error)) (*tikvrpc.Response, error) {
+			if req.Type == tikvrpc.CmdRawDeleteRange {
+				mu.Lock()
+				regions = append(regions, req.RegionId)
+				mu.Unlock()
+			}
+			return next()
+		},
+	})
+	defer client.Close()
+
+	// split the cluster into regions ["", "key3"), ["key3", "key6"), ["key6", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+	region3 := s.cluster.AllocID()
+	peers3 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(region2, region3, []byte("key6"), peers3, peers3[0])
+
+	keys := make([]key, 0, 9)
+	values := make([]value, 0, 9)
+	for i := 1; i <= 9; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%d", i)))
+	}
+	err := client.BatchPut(context.Background(), keys, values)
+	s.Nil(err)
+
+	err = client.BatchDeleteRange(context.Background(), []byte("key2"), []byte("key8"))
+	s.Nil(err)
+	returnKeys, _, err := client.Scan(context.Background(), nil, nil, 10)
+	s.Nil(err)
+	s.Equal([][]byte{keys[0], keys[7], keys[8]}, returnKeys)
+
+	// each region is hit exactly once.
+	s.ElementsMatch([]uint64{s.region1, region2, region3}, regions)
+}
+
+func (s *testRawkvSuite) TestBatchDeleteRangeError() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// split the cluster into regions ["", "key3"), ["key3", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+
+	rpcClient := &fakeClient{
+		Client:    mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		cmd:       tikvrpc.CmdRawDeleteRange,
+		errRegion: region2,
+		keyErr:    "injected error",
+	}
+	client := s.newClient(rpcClient)
+	defer client.Close()
+
+	err := client.BatchDeleteRange(context.Background(), []byte("key1"), []byte("key5"))
+	s.EqualError(err, "injected error")
+
+	err = client.BatchDeleteRange(context.Background(), []byte("key1"), []byte("key2"))
+	s.Nil(err)
+
+	// A region error that persists until the backoff is exhausted is returned too.
+	rpcClient.keyErr = ""
+	rpcClient.send = func(ctx context.Context, addr string, req *tikvrpc.Request, next func() (*tikvrpc.Response, error)) (*tikvrpc.Response, error) {
+		if req.RegionId == region2 {
+			return tikvrpc.GenRegionErrorResp(req, &errorpb.Error{RegionNotFound: &errorpb.RegionNotFound{RegionId: region2}})
+		}
+		return next()
+	}
+	err = client.BatchDeleteRange(context.Background(), []byte("key1"), []byte("key5"), WithMaxBackoff(100))
+	s.Equal(tikverr.ErrRegionUnavailable, errors.Cause(err))
+}
+
+func (s *testRawkvSuite) TestBatchDeleteRangeBounds() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	// split the cluster into regions ["", "key3"), ["key3", "key6"), ["key6", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+	region3 := s.cluster.AllocID()
+	peers3 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(region2, region3, []byte("key6"), peers3, peers3[0])
+
+	keys := make([]key, 0, 9)
+	values := make([]value, 0, 9)
+	for i := 1; i <= 9; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%d", i)))
+	}
+
+	for _, deleteRange := range []func(ctx context.Context, startKey, endKey []byte, options ...RawOption) error{
+		client.DeleteRange,
+		client.BatchDeleteRange,
+	} {
+		for _, c := range []struct {
+			startKey, endKey string
+			remained         [][]byte
+		}{
+			// endKey inside the last region
+			{"key2", "key8", [][]byte{keys[0], keys[7], keys[8]}},
+			// endKey exactly at a region boundary
+			{"key1", "key6", keys[5:]},
+			// empty endKey
+			{"key5", "", keys[:4]},
+			{"", "", nil},
+		} {
+			err := client.BatchPut(context.Background(), keys, values)
+			s.Nil(err)
+			err = deleteRange(context.Background(), []byte(c.startKey), []byte(c.endKey))
+			s.Nil(err)
+			returnKeys, _, err := client.Scan(context.Background(), nil, nil, 10)
+			s.Nil(err)
+			s.Equal(c.remained, returnKeys)
+		}
+	}
+
+	// the last region is split after it's cached, so the unbounded delete must not cross the new boundary.
+	region4 := s.cluster.AllocID()
+	peers4 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(region3, region4, []byte("key8"), peers4, peers4[0])
+	err := client.BatchPut(context.Background(), keys, values)
+	s.Nil(err)
+	err = client.BatchDeleteRange(context.Background(), []byte("key7"), nil)
+	s.Nil(err)
+	returnKeys, _, err := client.Scan(context.Background(), nil, nil, 10)
+	s.Nil(err)
+	s.Equal([][]byte(keys[:6]), returnKeys)
+}
+
+func (s *testRawkvSuite) TestBatchDeleteRangeConcurrency() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	recorder := &fakeClient{
+		Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		cmd:    tikvrpc.CmdRawDeleteRange,
+		delay:  10 * time.Millisecond,
+	}
+	client := s.newClient(recorder)
+	defer client.Close()
+
+	regionID := s.region1
+	for i := 1; i <= 8; i++ {
+		newRegionID := s.cluster.AllocID()
+		peers := s.cluster.AllocIDs(2)
+		s.cluster.SplitRaw(regionID, newRegionID, []byte(fmt.Sprintf("key%d", i)), peers, peers[0])
+		regionID = newRegionID
+	}
+
+	err := client.BatchDeleteRange(context.Background(), nil, nil, DeleteRangeWithConcurrency(2))
+	s.Nil(err)
+	s.Equal(int32(2), atomic.LoadInt32(&recorder.maxInflight))
+
+	recorder.resetInflight(tikvrpc.CmdRawDeleteRange)
+	err = client.BatchDeleteRange(context.Background(), nil, nil, DeleteRangeWithConcurrency(1))
+	s.Nil(err)
+	s.Equal(int32(1), atomic.LoadInt32(&recorder.maxInflight))
+}
+
+func (s *testRawkvSuite) TestBatchConcurrency() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	recorder := &fakeClient{
+		Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		cmd:    tikvrpc.CmdRawBatchPut,
+		delay:  10 * time.Millisecond,
+	}
+	client := s.newClient(recorder)
+	client.batchConcurrencyLimit = 2
+	client.batchSlots = newBatchSlots(2)
+	defer client.Close()
+
+	regionID := s.region1
+	for i := 1; i <= 8; i++ {
+		newRegionID := s.cluster.AllocID()
+		peers := s.cluster.AllocIDs(2)
+		s.cluster.SplitRaw(regionID, newRegionID, []byte(fmt.Sprintf("key%d", i)), peers, peers[0])
+		regionID = newRegionID
+	}
+
+	var keys, values [][]byte
+	for i := 0; i <= 8; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%d", i)))
+	}
+	err := client.BatchPut(context.Background(), keys, values)
+	s.Nil(err)
+	s.Equal(int32(2), atomic.LoadInt32(&recorder.maxInflight))
+
+	// The limit is shared by the concurrent calls.
+	recorder.resetInflight(tikvrpc.CmdRawBatchPut)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Nil(client.BatchPut(context.Background(), keys, values))
+		}()
+	}
+	wg.Wait()
+	s.Equal(int32(2), atomic.LoadInt32(&recorder.maxInflight))
+
+	// BatchDeleteRange deletes defaultRangeConcurrency regions at the same time unless DeleteRangeWithConcurrency
+	// is set.
+	recorder.resetInflight(tikvrpc.CmdRawDeleteRange)
+	err = client.BatchDeleteRange(context.Background(), nil, nil)
+	s.Nil(err)
+	s.Equal(int32(defaultRangeConcurrency), atomic.LoadInt32(&recorder.maxInflight))
+
+	recorder.resetInflight(tikvrpc.CmdRawBatchPut)
+	client.batchConcurrencyLimit, client.batchSlots = 0, newBatchSlots(0)
+	err = client.BatchPut(context.Background(), keys, values)
+	s.Nil(err)
+	s.Greater(atomic.LoadInt32(&recorder.maxInflight), int32(2))
+}
+
+func (s *testRawkvSuite) TestPutIfAbsent() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	_, _, err := client.PutIfAbsent(context.Background(), []byte("key"), []byte("value"))
+	s.ErrorIs(err, ErrAtomicModeRequired)
+
+	client.SetAtomicForCAS(true)
+	existing, inserted, err := client.PutIfAbsent(context.Background(), []byte("key"), []byte("value1"), WithTTL(100))
+	s.Nil(err)
+	s.True(inserted)
+	s.Nil(existing)
+
+	existing, inserted, err = client.PutIfAbsent(context.Background(), []byte("key"), []byte("value2"))
+	s.Nil(err)
+	s.False(inserted)
+	s.Equal([]byte("value1"), existing)
+
+	// racing inserts from two clients, exactly one of them wins.
+	clients := []*Client{client, s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil)).SetAtomicForCAS(true)}
+	defer clients[1].Close()
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("race%d", i))
+		var (
+			wg       sync.WaitGroup
+			winners  int32
+			existing [2][]byte
+		)
+		for j, c := range clients {
+			wg.Add(1)
+			go func(j int, c *Client) {
+				defer wg.Done()
+				value, inserted, err := c.PutIfAbsent(context.Background(), key, []byte(fmt.Sprintf("value%d", j)))
+				s.Nil(err)
+				if inserted {
+					atomic.AddInt32(&winners, 1)
+				}
+				existing[j] = value
+			}(j, c)
+		}
+		wg.Wait()
+		s.Equal(int32(1), winners)
+
+		value, err := client.Get(context.Background(), key)
+		s.Nil(err)
+		// the loser sees the winner's value.
+		s.True(existing[0] == nil != (existing[1] == nil))
+		s.Contains([][]byte{existing[0], existing[1]}, value)
+	}
+}
+
+// casTTLs returns the TTLs of the RawCAS requests recorded by c.
+func casTTLs(c *fakeClient) []uint64 {
+	var ttls []uint64
+	for _, req := range c.requests() {
+		if req.Type == tikvrpc.CmdRawCompareAndSwap {
+			ttls = append(ttls, req.RawCompareAndSwap().GetTtl())
+		}
+	}
+	return ttls
+}
+
+func (s *testRawkvSuite) TestCompareAndSwapWithTTL() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	recorder := &fakeClient{Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil), cmd: tikvrpc.CmdRawCompareAndSwap}
+	client := s.newClient(recorder)
+	client.atomic = true
+	defer client.Close()
+
+	_, swapped, err := client.CompareAndSwap(context.Background(), []byte("lease"), nil, []byte("owner1"), WithTTL(10))
+	s.Nil(err)
+	s.True(swapped)
+	_, swapped, err = client.CompareAndSwap(context.Background(), []byte("lease"), []byte("owner1"), []byte("owner1"))
+	s.Nil(err)
+	s.True(swapped)
+	s.Equal([]uint64{10, 0}, casTTLs(recorder))
+
+	recorder.keyErr = "Ttl is not enabled, but get put request with ttl"
+	_, _, err = client.CompareAndSwap(context.Background(), []byte("lease"), []byte("owner1"), []byte("owner2"), WithTTL(10))
+	s.ErrorIs(err, ErrTTLNotEnabled)
+	var serverErr *ServerError
+	s.True(errors.As(err, &serverErr))
+	s.Equal(recorder.keyErr, serverErr.Msg)
+}
+
+func (s *testRawkvSuite) TestBatchCompareAndSwap() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// split the cluster into regions ["", "key3"), ["key3", "key6"), ["key6", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+	region3 := s.cluster.AllocID()
+	peers3 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(region2, region3, []byte("key6"), peers3, peers3[0])
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	_, err := client.BatchCompareAndSwap(context.Background(), []CASOp{{Key: []byte("key1"), New: []byte("v")}})
+	s.ErrorIs(err, ErrAtomicModeRequired)
+
+	client.SetAtomicForCAS(true)
+	s.Nil(client.Put(context.Background(), []byte("key1"), []byte("old1")))
+	s.Nil(client.Put(context.Background(), []byte("key4"), []byte("old4")))
+	s.Nil(client.Put(context.Background(), []byte("key7"), []byte("old7")))
+
+	ops := []CASOp{
+		{Key: []byte("key1"), Previous: []byte("old1"), New: []byte("new1")},
+		{Key: []byte("key2"), New: []byte("new2"), TTL: 10},
+		{Key: []byte("key4"), Previous: []byte("other"), New: []byte("new4")},
+		{Key: []byte("key7"), Previous: []byte("old7"), New: []byte("new7")},
+		{Key: []byte("key7"), Previous: []byte("new7"), New: []byte("newer7")},
+	}
+	results, err := client.BatchCompareAndSwap(context.Background(), ops)
+	s.Nil(err)
+	s.Equal([]CASResult{
+		{Succeed: true, PreviousValue: []byte("old1")},
+		{Succeed: true},
+		{Succeed: false, PreviousValue: []byte("old4")},
+		{Succeed: true, PreviousValue: []byte("old7")},
+		{Succeed: true, PreviousValue: []byte("new7")},
+	}, results)
+	value, err := client.Get(context.Background(), []byte("key7"))
+	s.Nil(err)
+	s.Equal([]byte("newer7"), value)
+
+	// the ops of different keys are sent concurrently, even if they are in the same region.
+	rpcClient := client.rpcClient
+	started := make(chan struct{}, 2)
+	client.rpcClient = fakeBlocking(rpcClient, tikvrpc.CmdRawCompareAndSwap, started)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := client.BatchCompareAndSwap(ctx, []CASOp{{Key: []byte("key1"), New: []byte("v")}, {Key: []byte("key2"), New: []byte("v")}})
+		done <- err
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			s.Fail("the ops are not sent concurrently")
+		}
+	}
+	cancel()
+	s.NotNil(<-done)
+	client.rpcClient = rpcClient
+
+	// an error of one region doesn't discard the results of the others.
+	client.rpcClient = &fakeClient{
+		Client:    client.rpcClient,
+		cmd:       tikvrpc.CmdRawCompareAndSwap,
+		errRegion: region2,
+		keyErr:    "injected error",
+	}
+	results, err = client.BatchCompareAndSwap(context.Background(), []CASOp{
+		{Key: []byte("key1"), Previous: []byte("new1"), New: []byte("v1")},
+		{Key: []byte("key4"), Previous: []byte("old4"), New: []byte("v4")},
+		{Key: []byte("key7"), Previous: []byte("newer7"), New: []byte("v7")},
+	})
+	s.NotNil(err)
+	s.Len(results, 3)
+	s.True(results[0].Succeed)
+	s.Nil(results[0].Err)
+	s.NotNil(results[1].Err)
+	s.True(results[2].Succeed)
+	s.Nil(results[2].Err)
+}
+
+func (s *testRawkvSuite) TestGetAndPut() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	_, err := client.GetAndPut(context.Background(), []byte("token"), []byte("v"))
+	s.ErrorIs(err, ErrAtomicModeRequired)
+
+	client.SetAtomicForCAS(true)
+	previous, err := client.GetAndPut(context.Background(), []byte("token"), []byte("token0"))
+	s.Nil(err)
+	s.Nil(previous)
+	previous, err = client.GetAndPut(context.Background(), []byte("token"), []byte("token1"), WithTTL(10))
+	s.Nil(err)
+	s.Equal([]byte("token0"), previous)
+
+	// concurrent swaps form a chain: every value but the last one is replaced exactly once.
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		replaced = map[string]int{}
+	)
+	for i := 2; i < 12; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			previous, err := client.GetAndPut(context.Background(), []byte("token"), []byte(fmt.Sprintf("token%d", i)))
+			s.Nil(err)
+			mu.Lock()
+			replaced[string(previous)]++
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	last, err := client.Get(context.Background(), []byte("token"))
+	s.Nil(err)
+	s.Len(replaced, 10)
+	s.NotContains(replaced, string(last))
+	for i := 1; i < 12; i++ {
+		if token := fmt.Sprintf("token%d", i); token != string(last) {
+			s.Equal(1, replaced[token])
+		}
+	}
+}
+
+func (s *testRawkvSuite) TestIncr() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	_, err := client.Incr(context.Background(), []byte("counter"), 1)
+	s.ErrorIs(err, ErrAtomicModeRequired)
+
+	client.SetAtomicForCAS(true)
+	n, err := client.Incr(context.Background(), []byte("counter"), 5)
+	s.Nil(err)
+	s.Equal(int64(5), n)
+	n, err = client.Decr(context.Background(), []byte("counter"), 7)
+	s.Nil(err)
+	s.Equal(int64(-2), n)
+	value, err := client.Get(context.Background(), []byte("counter"))
+	s.Nil(err)
+	s.Equal([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}, value)
+
+	s.Nil(client.Put(context.Background(), []byte("invalid"), []byte("1")))
+	_, err = client.Incr(context.Background(), []byte("invalid"), 1)
+	s.ErrorIs(err, ErrInvalidCounter)
+
+	// no update is lost with concurrent writers.
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Incr(context.Background(), []byte("hammered"), 2)
+			s.Nil(err)
+		}()
+	}
+	wg.Wait()
+	n, err = client.Incr(context.Background(), []byte("hammered"), 0)
+	s.Nil(err)
+	s.Equal(int64(100), n)
+}
+
+func (s *testRawkvSuite) TestAppend() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	client.atomic = true
+	defer client.Close()
+
+	value, err := client.Append(context.Background(), []byte("log"), []byte("a"), 4)
+	s.Nil(err)
+	s.Equal([]byte("a"), value)
+	value, err = client.Append(context.Background(), []byte("log"), []byte("bcd"), 4)
+	s.Nil(err)
+	s.Equal([]byte("abcd"), value)
+	_, err = client.Append(context.Background(), []byte("log"), []byte("e"), 4)
+	s.ErrorIs(err, ErrValueTooLarge)
+	value, err = client.Get(context.Background(), []byte("log"))
+	s.Nil(err)
+	s.Equal([]byte("abcd"), value)
+
+	// the retry loop respects the context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.Append(ctx, []byte("log"), []byte("e"), 0)
+	s.ErrorIs(err, context.Canceled)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Append(context.Background(), []byte("events"), []byte("x"), 0)
+			s.Nil(err)
+		}()
+	}
+	wg.Wait()
+	value, err = client.Get(context.Background(), []byte("events"))
+	s.Nil(err)
+	s.Equal(bytes.Repeat([]byte("x"), 20), value)
+}
+
+// fakeTTLs wraps a client.Client and answers the GetKeyTTL requests from ttls, since the mock store has no TTL. A
+// key not in ttls is not found.
+func fakeTTLs(inner client.Client, ttls map[string]uint64) *fakeClient {
+	return &fakeClient{
+		Client: inner,
+		cmd:    tikvrpc.CmdGetKeyTTL,
+		send: func(ctx context.Context, addr string, req *tikvrpc.Request, next func() (*tikvrpc.Response, error)) (*tikvrpc.Response, error) {
+			if req.Type != tikvrpc.CmdGetKeyTTL {
+				return next()
+			}
+			ttl, ok := ttls[string(req.RawGetKeyTTL().GetKey())]
+			return &tikvrpc.Response{Resp: &kvrpcpb.RawGetKeyTTLResponse{Ttl: ttl, NotFound: !ok}}, nil
+		},
+	}
+}
+
+// fakeRegionMiss wraps a client.Client and answers every request with a region error.
+func fakeRegionMiss(inner client.Client) *fakeClient {
+	return &fakeClient{
+		Client: inner,
+		send: func(ctx context.Context, addr string, req *tikvrpc.Request, next func() (*tikvrpc.Response, error)) (*tikvrpc.Response, error) {
+			return tikvrpc.GenRegionErrorResp(req, &errorpb.Error{EpochNotMatch: &errorpb.EpochNotMatch{}})
+		},
+	}
+}
+
+// fakeBlocking wraps a client.Client and blocks the requests of cmd until their ctx is done. started is signaled
+// when such a request arrives, so it should be buffered.
+func fakeBlocking(inner client.Client, cmd tikvrpc.CmdType, started chan struct{}) *fakeClient {
+	return &fakeClient{
+		Client: inner,
+		send: func(ctx context.Context, addr string, req *tikvrpc.Request, next func() (*tikvrpc.Response, error)) (*tikvrpc.Response, error) {
+			if req.Type != cmd {
+				return next()
+			}
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+}
+
+func (s *testRawkvSuite) TestGetWithTTL() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	ttls := map[string]uint64{}
+	client := s.newClient(fakeTTLs(mocktikv.NewRPCClient(s.cluster, mvccStore, nil), ttls))
+	defer client.Close()
+
+	s.Nil(client.Put(context.Background(), []byte("key1"), []byte("value1")))
+	ttls["key1"] = 30
+	s.Nil(client.Put(context.Background(), []byte("key2"), []byte("value2")))
+	ttls["key2"] = 0
+
+	value, ttl, err := client.GetWithTTL(context.Background(), []byte("key1"))
+	s.Nil(err)
+	s.Equal([]byte("value1"), value)
+	s.Equal(uint64(30), *ttl)
+
+	value, ttl, err = client.GetWithTTL(context.Background(), []byte("key2"))
+	s.Nil(err)
+	s.Equal([]byte("value2"), value)
+	s.Equal(uint64(0), *ttl)
+
+	value, ttl, err = client.GetWithTTL(context.Background(), []byte("missing"))
+	s.Nil(err)
+	s.Nil(value)
+	s.Nil(ttl)
+
+	// the key expires between the two requests.
+	delete(ttls, "key1")
+	value, ttl, err = client.GetWithTTL(context.Background(), []byte("key1"))
+	s.Nil(err)
+	s.Nil(value)
+	s.Nil(ttl)
+}
+
+func (s *testRawkvSuite) TestBatchGetKeyTTL() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// split the cluster into regions ["", "key3"), ["key3", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+
+	rpcClient := fakeTTLs(mocktikv.NewRPCClient(s.cluster, mvccStore, nil), map[string]uint64{"key1": 10, "key2": 0, "key4": 40})
+	answer := rpcClient.send
+	var stale int32
+	rpcClient.send = func(ctx context.Context, addr string, req *tikvrpc.Request, next func() (*tikvrpc.Response, error)) (*tikvrpc.Response, error) {
+		// The first request sent to region2 gets an EpochNotMatch error.
+		if req.RegionId == region2 && atomic.CompareAndSwapInt32(&stale, 0, 1) {
+			return tikvrpc.GenRegionErrorResp(req, &errorpb.Error{EpochNotMatch: &errorpb.EpochNotMatch{}})
+		}
+		return answer(ctx, addr, req, next)
+	}
+	client := s.newClient(rpcClient)
+	defer client.Close()
+
+	keys := [][]byte{[]byte("key4"), []byte("key1"), []byte("key2"), []byte("key3"), []byte("key1")}
+	result, err := client.BatchGetKeyTTL(context.Background(), keys)
+	s.Nil(err)
+	s.Len(result, len(keys))
+	s.Equal(uint64(40), *result[0])
+	s.Equal(uint64(10), *result[1])
+	s.Equal(uint64(0), *result[2])
+	s.Nil(result[3])
+	s.Equal(uint64(10), *result[4])
+
+	// the region error only retries the keys of the stale region.
+	requests := make(map[string]int)
+	for _, req := range rpcClient.requests() {
+		requests[string(req.RawGetKeyTTL().GetKey())]++
+	}
+	s.Equal(1, requests["key1"])
+	s.Equal(1, requests["key2"])
+	s.Equal(3, requests["key3"]+requests["key4"])
+}
+
+func (s *testRawkvSuite) TestUpdateTTL() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	recorder := &fakeClient{Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil), cmd: tikvrpc.CmdRawCompareAndSwap}
+	client := s.newClient(recorder)
+	defer client.Close()
+
+	_, err := client.UpdateTTL(context.Background(), []byte("session"), 60)
+	s.ErrorIs(err, ErrAtomicModeRequired)
+
+	client.SetAtomicForCAS(true)
+	found, err := client.UpdateTTL(context.Background(), []byte("session"), 60)
+	s.Nil(err)
+	s.False(found)
+	value, err := client.Get(context.Background(), []byte("session"))
+	s.Nil(err)
+	s.Nil(value)
+
+	s.Nil(client.Put(context.Background(), []byte("session"), []byte("data")))
+	found, err = client.UpdateTTL(context.Background(), []byte("session"), 60)
+	s.Nil(err)
+	s.True(found)
+	s.Equal([]uint64{60}, casTTLs(recorder))
+	value, err = client.Get(context.Background(), []byte("session"))
+	s.Nil(err)
+	s.Equal([]byte("data"), value)
+
+	// a key deleted concurrently is never resurrected.
+	client.rpcClient = recorder.Client
+	for i := 0; i < 20; i++ {
+		key := []byte(fmt.Sprintf("session%d", i))
+		s.Nil(client.Put(context.Background(), key, []byte("data")))
+		var wg sync.WaitGroup
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			_, err := client.UpdateTTL(context.Background(), key, 60)
+			s.Nil(err)
+		}()
+		go func() {
+			defer wg.Done()
+			s.Nil(client.Put(context.Background(), key, []byte("data2")))
+		}()
+		go func() {
+			defer wg.Done()
+			s.Nil(client.Delete(context.Background(), key))
+		}()
+		wg.Wait()
+		found, err := client.UpdateTTL(context.Background(), key, 60)
+		s.Nil(err)
+		value, err := client.Get(context.Background(), key)
+		s.Nil(err)
+		// the key exists only if the Put comes after the Delete.
+		s.Equal(found, value != nil)
+		if value != nil {
+			s.Equal([]byte("data2"), value)
+		}
+	}
+}
+
+func (s *testRawkvSuite) TestPersist() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	recorder := &fakeClient{Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil), cmd: tikvrpc.CmdRawCompareAndSwap}
+	client := s.newClient(recorder)
+	defer client.Close()
+
+	_, err := client.Persist(context.Background(), []byte("record"))
+	s.ErrorIs(err, ErrAtomicModeRequired)
+
+	client.SetAtomicForCAS(true)
+	found, err := client.Persist(context.Background(), []byte("record"))
+	s.Nil(err)
+	s.False(found)
+
+	s.Nil(client.Put(context.Background(), []byte("record"), []byte("tentative")))
+	found, err = client.Persist(context.Background(), []byte("record"), WithTTL(10))
+	s.Nil(err)
+	s.True(found)
+	s.Equal([]uint64{0}, casTTLs(recorder))
+
+	// a concurrent write is a retryable conflict.
+	overwrite := true
+	recorder.send = func(ctx context.Context, addr string, req *tikvrpc.Request, next func() (*tikvrpc.Response, error)) (*tikvrpc.Response, error) {
+		if req.Type == tikvrpc.CmdRawCompareAndSwap && overwrite {
+			// The key is overwritten right before the first RawCAS request, like a concurrent writer.
+			overwrite = false
+			mvccStore.(mocktikv.RawKV).RawPut(req.RawCompareAndSwap().GetCf(), req.RawCompareAndSwap().GetKey(), []byte("confirmed"))
+		}
+		return next()
+	}
+	found, err = client.Persist(context.Background(), []byte("record"))
+	s.ErrorIs(err, ErrCASConflict)
+	s.True(found)
+	found, err = client.Persist(context.Background(), []byte("record"))
+	s.Nil(err)
+	s.True(found)
+	value, err := client.Get(context.Background(), []byte("record"))
+	s.Nil(err)
+	s.Equal([]byte("confirmed"), value)
+}
+
+func (s *testRawkvSuite) TestEmptyValue() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	verifyEmptyValue := func() {
+		value, err := client.Get(context.Background(), []byte("key"))
+		s.Nil(err)
+		s.Equal([]byte{}, value)
+		values, err := client.BatchGet(context.Background(), [][]byte{[]byte("key"), []byte("key1")})
+		s.Nil(err)
+		s.Equal([][]byte{{}, nil}, values)
+	}
+	verifyNotExist := func() {
+		value, err := client.Get(context.Background(), []byte("key"))
+		s.Nil(err)
+		s.Nil(value)
+		values, err := client.BatchGet(context.Background(), [][]byte{[]byte("key"), []byte("key1")})
+		s.Nil(err)
+		s.Equal([][]byte{nil, nil}, values)
+	}
+
+	s.Nil(client.Put(context.Background(), []byte("key"), []byte{}))
+	verifyEmptyValue()
+	s.Nil(client.Delete(context.Background(), []byte("key")))
+	verifyNotExist()
+	s.Nil(client.BatchPut(context.Background(), [][]byte{[]byte("key")}, [][]byte{{}}))
+	verifyEmptyValue()
+
+	client.SetAtomicForCAS(true)
+	s.Nil(client.Delete(context.Background(), []byte("key")))
+	previous, swapped, err := client.CompareAndSwap(context.Background(), []byte("key"), nil, []byte{})
+	s.Nil(err)
+	s.True(swapped)
+	s.Nil(previous)
+	verifyEmptyValue()
+	previous, swapped, err = client.CompareAndSwap(context.Background(), []byte("key"), []byte{}, []byte("value"))
+	s.Nil(err)
+	s.True(swapped)
+	s.Equal([]byte{}, previous)
+}
+
+func (s *testRawkvSuite) TestBatchGetWithExistence() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// split the cluster into regions ["", "key3"), ["key3", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	s.Nil(client.BatchPut(context.Background(),
+		[][]byte{[]byte("key1"), []byte("key2"), []byte("key4")},
+		[][]byte{[]byte("value1"), {}, {}}))
+
+	keys := [][]byte{[]byte("key1"), []byte("key2"), []byte("key3"), []byte("key4"), []byte("key5")}
+	values, exists, err := client.BatchGetWithExistence(context.Background(), keys)
+	s.Nil(err)
+	s.Equal([][]byte{[]byte("value1"), {}, nil, {}, nil}, values)
+	s.Equal([]bool{true, true, false, true, false}, exists)
+}
+
+func (s *testRawkvSuite) TestBatchGetPairs() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// split the cluster into regions ["", "key3"), ["key3", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer client.Close()
+
+	s.Nil(client.BatchPut(context.Background(),
+		[][]byte{[]byte("key1"), []byte("key4"), []byte("key5")},
+		[][]byte{[]byte("value1"), []byte("value4"), {}}))
+
+	keys := make([][]byte, 0, 20)
+	for i := 0; i < 20; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)))
+	}
+	pairs, err := client.BatchGetPairs(context.Background(), keys)
+	s.Nil(err)
+	s.ElementsMatch([]KvPair{
+		{Key: []byte("key1"), Value: []byte("value1")},
+		{Key: []byte("key4"), Value: []byte("value4")},
+		{Key: []byte("key5"), Value: []byte{}},
+	}, pairs)
+}
+
+func (s *testRawkvSuite) TestBatchDedupKeys() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// split the cluster into regions ["", "key3"), ["key3", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+
+	recorder := &fakeClient{Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil)}
+	client := s.newClient(recorder)
+	defer client.Close()
+
+	s.Nil(client.BatchPut(context.Background(),
+		[][]byte{[]byte("key1"), []byte("key4")},
+		[][]byte{[]byte("value1"), []byte("value4")}))
+	recorder.reset()
+
+	var keys [][]byte
+	var expected [][]byte
+	for i := 0; i < 50; i++ {
+		keys = append(keys, []byte("key4"), []byte("key1"), []byte("key2"))
+		expected = append(expected, []byte("value4"), []byte("value1"), nil)
+	}
+	values, err := client.BatchGet(context.Background(), keys)
+	s.Nil(err)
+	s.Equal(expected, values)
+	s.Equal(map[string]int{"key1": 1, "key2": 1, "key4": 1}, countKeys(recorder.requests()))
+
+	recorder.reset()
+	s.Nil(client.BatchDelete(context.Background(), keys))
+	s.Equal(map[string]int{"key1": 1, "key2": 1, "key4": 1}, countKeys(recorder.requests()))
+	values, err = client.BatchGet(context.Background(), keys[:3])
+	s.Nil(err)
+	s.Equal([][]byte{nil, nil, nil}, values)
+}
+
+func (s *testRawkvSuite) TestAsyncWrite() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// split the cluster into regions ["", "b"), ["b", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("b"), peers2, peers2[0])
+
+	newClient := func() *Client {
+		client := s.newClient(&fakeClient{
+			Client:    mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+			cmd:       tikvrpc.CmdRawBatchPut,
+			errRegion: region2,
+			keyErr:    "injected error",
+		})
+		// The store is read by another client after the client is closed.
+		client.externalRPCClient = true
+		return client
+	}
+	client := newClient()
+	ctx := context.Background()
+
+	// The writes to the same key are applied in order, and the error of a region only fails the writes to it.
+	futures := []Future{
+		client.AsyncPut(ctx, []byte("a1"), []byte("1"), 0),
+		client.AsyncPut(ctx, []byte("a2"), []byte("2"), 0),
+		client.AsyncDelete(ctx, []byte("a2")),
+		client.AsyncPut(ctx, []byte("a2"), []byte("3"), 0),
+		client.AsyncPut(ctx, []byte("c1"), []byte("4"), 0),
+		client.AsyncDelete(ctx, []byte("c2")),
+	}
+	for i, f := range futures {
+		err := f.Wait(ctx)
+		if i == 4 {
+			s.NotNil(err)
+			s.Contains(err.Error(), "injected error")
+		} else {
+			s.Nil(err, i)
+		}
+	}
+	values, err := client.BatchGet(ctx, [][]byte{[]byte("a1"), []byte("a2"), []byte("c1")})
+	s.Nil(err)
+	s.Equal([][]byte{[]byte("1"), []byte("3"), nil}, values)
+
+	// Close sends the writes issued before it, and fails the ones after it.
+	futures = futures[:0]
+	for i := 0; i < 100; i++ {
+		futures = append(futures, client.AsyncPut(ctx, []byte(fmt.Sprintf("a%03d", i)), []byte("v"), 0))
+	}
+	s.Nil(client.Close())
+	for _, f := range futures {
+		s.Nil(f.Wait(ctx))
+	}
+	s.ErrorIs(client.AsyncPut(ctx, []byte("a1"), []byte("1"), 0).Wait(ctx), ErrClientClosed)
+	s.ErrorIs(client.AsyncDelete(ctx, []byte("a1")).Wait(ctx), ErrClientClosed)
+
+	client = newClient()
+	defer client.Close()
+	value, err := client.Get(ctx, []byte("a099"))
+	s.Nil(err)
+	s.Equal([]byte("v"), value)
+}
+
+func (s *testRawkvSuite) TestAsyncWriteByRegion() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// split the cluster into regions ["", "b"), ["b", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("b"), peers2, peers2[0])
+
+	unblock := make(chan struct{})
+	client := s.newClient(&fakeClient{
+		Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		send: func(ctx context.Context, addr string, req *tikvrpc.Request, next func() (*tikvrpc.Response, error)) (*tikvrpc.Response, error) {
+			// The writes to region2 wait until unblock is closed.
+			if req.Type == tikvrpc.CmdRawBatchPut && req.RegionId == region2 {
+				<-unblock
+			}
+			return next()
+		},
+	})
+	client.coalesceDelay = 10 * time.Millisecond
+	defer client.Close()
+	ctx := context.Background()
+
+	// A slow region doesn't hold the writes to the others, and the writes to its keys are applied in order.
+	blocked := []Future{client.AsyncPut(ctx, []byte("c1"), []byte("1"), 0)}
+	time.Sleep(50 * time.Millisecond)
+	blocked = append(blocked, client.AsyncPut(ctx, []byte("c1"), []byte("2"), 0))
+	wctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	s.Nil(client.AsyncPut(ctx, []byte("a1"), []byte("1"), 0).Wait(wctx))
+	cancel()
+	close(unblock)
+	for _, f := range blocked {
+		s.Nil(f.Wait(ctx))
+	}
+	value, err := client.Get(ctx, []byte("c1"))
+	s.Nil(err)
+	s.Equal([]byte("2"), value)
+
+	// A write whose ctx is done before it's sent fails without being sent.
+	cctx, cancel := context.WithCancel(ctx)
+	f := client.AsyncPut(cctx, []byte("a2"), []byte("1"), 0)
+	cancel()
+	s.ErrorIs(f.Wait(ctx), context.Canceled)
+	value, err = client.Get(ctx, []byte("a2"))
+	s.Nil(err)
+	s.Nil(value)
+}
+
+func (s *testRawkvSuite) TestAsyncDeleteConcurrency() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// split the cluster into regions ["", "b"), ["b", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("b"), peers2, peers2[0])
+
+	// The deletes of the regions are sent with a single batch slot.
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	client.batchConcurrencyLimit = 1
+	client.batchSlots = newBatchSlots(1)
+	client.coalesceDelay = 10 * time.Millisecond
+	ctx := context.Background()
+	s.Nil(client.Put(ctx, []byte("a1"), []byte("1")))
+	s.Nil(client.Put(ctx, []byte("c1"), []byte("1")))
+
+	wctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	futures := []Future{client.AsyncDelete(ctx, []byte("a1")), client.AsyncDelete(ctx, []byte("c1"))}
+	for _, f := range futures {
+		s.Nil(f.Wait(wctx))
+	}
+	s.Nil(client.Close())
+	reader := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer reader.Close()
+	values, err := reader.BatchGet(ctx, [][]byte{[]byte("a1"), []byte("c1")})
+	s.Nil(err)
+	s.Equal([][]byte{nil, nil}, values)
+}
+
+func (s *testRawkvSuite) TestWriteCoalescing() {
+	_, err := NewClientWithOpts(context.Background(), nil, WithWriteCoalescing(time.Millisecond, 0))
+	s.NotNil(err)
+	opt := &option{}
+	WithWriteCoalescing(time.Millisecond, 100)(opt)
+	s.Nil(opt.validate())
+
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// split the cluster into regions ["", "b"), ["b", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("b"), peers2, peers2[0])
+
+	client := s.newClient(&fakeClient{
+		Client:    mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		cmd:       tikvrpc.CmdRawBatchPut,
+		errRegion: region2,
+		keyErr:    "injected error",
+	})
+	client.stats = newClientStats()
+	client.coalesceDelay = 100 * time.Millisecond
+	client.coalesceBatch = 100
+	defer client.Close()
+
+	// The concurrent Puts are sent together, and only the ones to the failed region fail.
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("a%02d", i)
+			if i%2 == 1 {
+				key = fmt.Sprintf("c%02d", i)
+			}
+			errs[i] = client.Put(context.Background(), []byte(key), []byte("v"))
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if i%2 == 1 {
+			s.NotNil(err, i)
+			s.Contains(err.Error(), "injected error")
+		} else {
+			s.Nil(err, i)
+		}
+	}
+	stats := client.Stats(true)
+	s.Zero(stats.Requests["RawPut"])
+	s.LessOrEqual(stats.Requests["RawBatchPut"], int64(4))
+	value, err := client.Get(context.Background(), []byte("a00"))
+	s.Nil(err)
+	s.Equal([]byte("v"), value)
+
+	s.Nil(client.Delete(context.Background(), []byte("a00")))
+	value, err = client.Get(context.Background(), []byte("a00"))
+	s.Nil(err)
+	s.Nil(value)
+	stats = client.Stats(true)
+	s.Equal(int64(1), stats.Requests["RawBatchDelete"])
+	s.Zero(stats.Requests["RawDelete"])
+
+	// The writes with options and the ones in atomic mode are sent on their own.
+	s.Nil(client.Put(context.Background(), []byte("a00"), []byte("v"), SetColumnFamily("")))
+	client.SetAtomicForCAS(true)
+	s.Nil(client.Delete(context.Background(), []byte("a00")))
+	stats = client.Stats(true)
+	s.Equal(int64(1), stats.Requests["RawPut"])
+	s.Equal(int64(1), stats.Requests["RawDelete"])
+}
+
+// sliceIterator is a KVIterator of the pairs of a slice, which calls onNext before it moves to the i-th pair.
+type sliceIterator struct {
+	pairs  []KvPair
+	idx    int
+	onNext func(i int)
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.idx >= len(it.pairs) {
+		return false
+	}
+	if it.onNext != nil {
+		it.onNext(it.idx)
+	}
+	it.idx++
+	return true
+}
+
+func (it *sliceIterator) Key() []byte   { return it.pairs[it.idx-1].Key }
+func (it *sliceIterator) Value() []byte { return it.pairs[it.idx-1].Value }
+func (it *sliceIterator) Error() error  { return nil }
+
+func (s *testRawkvSuite) TestIngest() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	counter := &fakeClient{Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil), cmd: tikvrpc.CmdRawBatchPut}
+	client := s.newClient(counter)
+	client.stats = newClientStats()
+	client.batchPairCountLimit = 10
+	defer client.Close()
+
+	var pairs []KvPair
+	var size int64
+	for i := 0; i < 100; i++ {
+		pair := KvPair{Key: []byte(fmt.Sprintf("key%03d", i)), Value: []byte(fmt.Sprintf("value%03d", i))}
+		pairs = append(pairs, pair)
+		size += int64(len(pair.Key) + len(pair.Value))
+	}
+	// The region is split in the middle of the ingest, while the batches of the cached region are being written.
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	iter := &sliceIterator{pairs: pairs, onNext: func(i int) {
+		if i == 35 {
+			s.cluster.SplitRaw(s.region1, region2, []byte("key050"), peers2, peers2[0])
+		}
+	}}
+	var progress []IngestProgress
+	s.Nil(client.Ingest(context.Background(), iter, WithIngestConcurrency(2), WithIngestProgress(func(p IngestProgress) {
+		progress = append(progress, p)
+	})))
+
+	// Every pair is written exactly once, although a batch meets the split.
+	s.Greater(client.Stats(false).Errors["region"], int64(0))
+	written := countKeys(counter.succeededRequests())
+	s.Len(written, len(pairs))
+	for key, n := range written {
+		s.Equal(1, n, key)
+	}
+	keys, values, err := client.Scan(context.Background(), []byte("key"), nil, len(pairs)+1)
+	s.Nil(err)
+	s.Len(keys, len(pairs))
+	for i, pair := range pairs {
+		s.Equal(pair.Key, keys[i])
+		s.Equal(pair.Value, values[i])
+	}
+	// The progress only advances, up to all the pairs.
+	for i := 1; i < len(progress); i++ {
+		s.Greater(progress[i].Keys, progress[i-1].Keys)
+		s.Equal(1, bytes.Compare(progress[i].CurrentKey, progress[i-1].CurrentKey))
+	}
+	s.Equal(IngestProgress{Keys: int64(len(pairs)), Bytes: size, CurrentKey: pairs[len(pairs)-1].Key}, progress[len(progress)-1])
+
+	iter = &sliceIterator{pairs: []KvPair{pairs[1], pairs[0]}}
+	s.NotNil(client.Ingest(context.Background(), iter))
+}
+
+// limitedWriter fails the writes beyond limit bytes.
+type limitedWriter struct {
+	bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.Len()+len(p) > w.limit {
+		return 0, errors.New("no space left")
+	}
+	return w.Buffer.Write(p)
+}
+
+func (s *testRawkvSuite) TestExport() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// split the cluster into regions ["", "key050"), ["key050", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key050"), peers2, peers2[0])
+
+	ttls := map[string]uint64{}
+	client := s.newClient(fakeTTLs(mocktikv.NewRPCClient(s.cluster, mvccStore, nil), ttls))
+	defer client.Close()
+
+	var keys, values [][]byte
+	for i := 0; i < 100; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%03d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%03d", i)))
+	}
+	s.Nil(client.BatchPut(context.Background(), keys, values))
+	for _, key := range keys {
+		ttls[string(key)] = 0
+	}
+	ttls["key007"] = 30
+	readExport := func(r io.Reader) ([][]byte, [][]byte, []uint64, error) {
+		er, err := NewExportReader(r)
+		s.Nil(err)
+		var keys, values [][]byte
+		var ttls []uint64
+		for er.Next() {
+			keys, values, ttls = append(keys, er.Key()), append(values, er.Value()), append(ttls, er.TTL())
+		}
+		return keys, values, ttls, er.Error()
+	}
+
+	var buf bytes.Buffer
+	stats, err := client.Export(context.Background(), []byte("key"), nil, &buf, WithExportConcurrency(2), WithExportTTL())
+	s.Nil(err)
+	s.Equal(int64(100), stats.Keys)
+	s.Equal(int64(100*(6+8)), stats.Bytes)
+	s.Equal(crc32.Checksum(buf.Bytes()[:buf.Len()-4], crc32.MakeTable(crc32.Castagnoli)), stats.Checksum)
+	s.Empty(stats.ResumeToken)
+	exported := buf.Bytes()
+	exportedKeys, exportedValues, exportedTTLs, err := readExport(bytes.NewReader(exported))
+	s.Nil(err)
+	s.Equal(keys, exportedKeys)
+	s.Equal(values, exportedValues)
+	s.Equal(uint64(30), exportedTTLs[7])
+	s.Zero(exportedTTLs[8])
+
+	// A corrupted or truncated export is detected.
+	corrupted := append([]byte{}, exported...)
+	corrupted[100]++
+	_, _, _, err = readExport(bytes.NewReader(corrupted))
+	s.ErrorIs(err, ErrInvalidExport)
+	_, _, _, err = readExport(bytes.NewReader(exported[:len(exported)-1]))
+	s.ErrorIs(err, ErrInvalidExport)
+
+	// An interrupted export is resumed after the pairs flushed.
+	w := &limitedWriter{limit: 1000}
+	stats, err = client.Export(context.Background(), []byte("key"), nil, w)
+	s.NotNil(err)
+	s.Equal(int64(50), stats.Keys)
+	token := stats.ResumeToken
+	s.NotEmpty(token)
+	firstKeys, _, _, err := readExport(&w.Buffer)
+	s.ErrorIs(err, ErrInvalidExport)
+	var rest bytes.Buffer
+	stats, err = client.Export(context.Background(), []byte("key"), nil, &rest, WithExportResumeToken(token))
+	s.Nil(err)
+	s.Equal(int64(50), stats.Keys)
+	restKeys, _, _, err := readExport(&rest)
+	s.Nil(err)
+	s.Equal(keys, append(firstKeys, restKeys...))
+	_, err = client.Export(context.Background(), []byte("key"), []byte("key099"), &rest, WithExportResumeToken(token))
+	s.NotNil(err)
+
+	// The export can be restored by Ingest.
+	s.Nil(client.DeleteRange(context.Background(), []byte("key"), nil))
+	er, err := NewExportReader(bytes.NewReader(exported))
+	s.Nil(err)
+	s.Nil(client.Ingest(context.Background(), er))
+	scannedKeys, scannedValues, err := client.Scan(context.Background(), []byte("key"), nil, 200)
+	s.Nil(err)
+	s.Equal(keys, scannedKeys)
+	s.Equal(values, scannedValues)
+
+	// A pair that expires after it's read isn't exported.
+	delete(ttls, "key050")
+	buf.Reset()
+	stats, err = client.Export(context.Background(), []byte("key050"), []byte("key052"), &buf, WithExportTTL())
+	s.Nil(err)
+	s.Equal(int64(1), stats.Keys)
+	exportedKeys, _, _, err = readExport(&buf)
+	s.Nil(err)
+	s.Equal([][]byte{[]byte("key051")}, exportedKeys)
+}
+
+func (s *testRawkvSuite) TestImport() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// split the cluster into regions ["", "key050"), ["key050", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key050"), peers2, peers2[0])
+
+	counter := &fakeClient{Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil), cmd: tikvrpc.CmdRawBatchPut}
+	client := s.newClient(counter)
+	client.batchPairCountLimit = 10
+	defer client.Close()
+
+	// The export starts 100 seconds ago and reads the TTLs 10 seconds ago. Each record is 18 bytes after the 17 bytes
+	// of the header and the 9 bytes of the time.
+	var keys, values [][]byte
+	var buf bytes.Buffer
+	ew := newExportWriter(&buf)
+	s.Nil(ew.writeHeader(time.Now().Add(-100 * time.Second)))
+	ew.writeTime(time.Now().Add(-10 * time.Second))
+	for i := 0; i < 100; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%03d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%03d", i)))
+		var ttl uint64
+		switch i {
+		case 7:
+			ttl = 30
+		case 8:
+			ttl = 5
+		}
+		ew.writeRecord(keys[i], values[i], ttl)
+	}
+	_, err := ew.writeTrailer()
+	s.Nil(err)
+	exported := buf.Bytes()
+
+	counter.reset()
+	stats, err := client.Import(context.Background(), bytes.NewReader(exported), WithImportConcurrency(2))
+	s.Nil(err)
+	s.Equal(ImportStats{Keys: 100, Bytes: 100 * (6 + 8)}, stats)
+	scannedKeys, scannedValues, err := client.Scan(context.Background(), []byte("key"), nil, 200)
+	s.Nil(err)
+	s.Equal(keys, scannedKeys)
+	s.Equal(values, scannedValues)
+	ttls := keyTTLs(counter.succeededRequests())
+	s.Equal(uint64(30), ttls["key007"])
+	s.Equal(uint64(5), ttls["key008"])
+
+	// The TTLs left since they are read are applied, and the expired pairs are skipped.
+	counter.reset()
+	stats, err = client.Import(context.Background(), bytes.NewReader(exported), WithImportTTLMode(ImportTTLPreserveExpiry))
+	s.Nil(err)
+	s.Equal(int64(99), stats.Keys)
+	s.Equal(int64(1), stats.Expired)
+	s.Zero(countKeys(counter.succeededRequests())["key008"])
+	ttls = keyTTLs(counter.succeededRequests())
+	s.LessOrEqual(ttls["key007"], uint64(20))
+	s.Greater(ttls["key007"], uint64(15))
+
+	// The malformed input fails with its offset.
+	corrupted := append([]byte{}, exported...)
+	corrupted[17+9+2*18] = 7
+	_, err = client.Import(context.Background(), bytes.NewReader(corrupted))
+	s.ErrorIs(err, ErrInvalidExport)
+	s.Contains(err.Error(), "the record at offset 62")
+	_, err = client.Import(context.Background(), bytes.NewReader(exported[:len(exported)-1]))
+	s.ErrorIs(err, ErrInvalidExport)
+	s.Contains(err.Error(), fmt.Sprintf("the trailer at offset %d", 17+9+100*18))
+	corrupted = append([]byte{}, exported...)
+	corrupted[8] = 9
+	_, err = client.Import(context.Background(), bytes.NewReader(corrupted))
+	s.ErrorIs(err, ErrInvalidExport)
+	s.Contains(err.Error(), "unsupported version 9")
+
+	// An export of version 1 has no times, so its TTLs are reapplied.
+	var v1 bytes.Buffer
+	ew = newExportWriter(&v1)
+	ew.write([]byte(exportMagic))
+	ew.write([]byte{1})
+	ew.writeRecord(keys[8], values[8], 5)
+	_, err = ew.writeTrailer()
+	s.Nil(err)
+	counter.reset()
+	stats, err = client.Import(context.Background(), &v1, WithImportTTLMode(ImportTTLPreserveExpiry))
+	s.Nil(err)
+	s.Equal(int64(1), stats.Keys)
+	s.Equal(uint64(5), keyTTLs(counter.succeededRequests())["key008"])
+
+	// The existing keys are skipped in the atomic mode.
+	_, err = client.Import(context.Background(), bytes.NewReader(exported), WithImportSkipExisting())
+	s.ErrorIs(err, ErrAtomicModeRequired)
+	client.atomic = true
+	s.Nil(client.DeleteRange(context.Background(), []byte("key001"), nil))
+	s.Nil(client.Put(context.Background(), []byte("key050"), []byte("existing")))
+	stats, err = client.Import(context.Background(), bytes.NewReader(exported), WithImportSkipExisting())
+	s.Nil(err)
+	s.Equal(int64(98), stats.Keys)
+	s.Equal(int64(2), stats.Skipped)
+	value, err := client.Get(context.Background(), []byte("key050"))
+	s.Nil(err)
+	s.Equal([]byte("existing"), value)
+	value, err = client.Get(context.Background(), []byte("key051"))
+	s.Nil(err)
+	s.Equal([]byte("value051"), value)
+}
+
+func (s *testRawkvSuite) TestCopyRange() {
+	srcStore := mocktikv.MustNewMVCCStore()
+	defer srcStore.Close()
+	ttls := map[string]uint64{}
+	src := s.newClient(fakeTTLs(mocktikv.NewRPCClient(s.cluster, srcStore, nil), ttls))
+	defer src.Close()
+
+	// The destination is another cluster of regions ["", "key050"), ["key050", "").
+	dstStore := mocktikv.MustNewMVCCStore()
+	defer dstStore.Close()
+	dstCluster := mocktikv.NewCluster(dstStore)
+	_, _, dstRegion1 := mocktikv.BootstrapWithSingleStore(dstCluster)
+	dstRegion2 := dstCluster.AllocID()
+	dstPeers2 := dstCluster.AllocIDs(1)
+	dstCluster.SplitRaw(dstRegion1, dstRegion2, []byte("key050"), dstPeers2, dstPeers2[0])
+	counter := &fakeClient{Client: mocktikv.NewRPCClient(dstCluster, dstStore, nil), cmd: tikvrpc.CmdRawBatchPut}
+	dst := newMockClient(dstCluster, counter)
+	dst.batchPairCountLimit = 10
+	defer dst.Close()
+
+	var keys, values [][]byte
+	for i := 0; i < 100; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%03d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%03d", i)))
+	}
+	// The checksums of mocktikv are of CF_DEFAULT.
+	cf := "CF_DEFAULT"
+	s.Nil(src.BatchPut(context.Background(), keys, values, SetColumnFamily(cf)))
+	for _, key := range keys {
+		ttls[string(key)] = 0
+	}
+	ttls["key020"] = 30
+	startKey, endKey := []byte("key010"), []byte("key090")
+
+	// The copy fails at the second region of the destination, and is resumed after the pairs copied.
+	counter.errRegion, counter.keyErr = dstRegion2, "injected error"
+	var progress []CopyStats
+	stats, err := CopyRange(context.Background(), src, dst, startKey, endKey, WithCopyRawOptions(SetColumnFamily(cf)),
+		WithCopyConcurrency(1), WithCopyTTL(), WithCopyProgress(func(stats CopyStats) { progress = append(progress, stats) }))
+	s.NotNil(err)
+	s.Contains(err.Error(), "injected error")
+	s.Equal(int64(40), stats.Keys)
+	s.Equal(int64(40*(6+8)), stats.Bytes)
+	s.NotEmpty(stats.ResumeToken)
+	s.Len(progress, 4)
+	s.Equal(CopyStats{Keys: 40, Bytes: 40 * (6 + 8)}, progress[3])
+	copiedTTLs := keyTTLs(counter.succeededRequests())
+	s.Equal(uint64(30), copiedTTLs["key020"])
+	s.Zero(copiedTTLs["key021"])
+
+	counter.keyErr = ""
+	token := stats.ResumeToken
+	stats, err = CopyRange(context.Background(), src, dst, startKey, endKey, WithCopyRawOptions(SetColumnFamily(cf)),
+		WithCopyResumeToken(token), WithCopyVerify())
+	s.Nil(err)
+	s.Equal(int64(40), stats.Keys)
+	s.Empty(stats.ResumeToken)
+	scannedKeys, scannedValues, err := dst.Scan(context.Background(), nil, nil, 200, SetColumnFamily(cf))
+	s.Nil(err)
+	s.Equal(keys[10:90], scannedKeys)
+	s.Equal(values[10:90], scannedValues)
+	written := countKeys(counter.succeededRequests())
+	for _, key := range keys[10:90] {
+		s.Equal(1, written[string(key)])
+	}
+	_, err = CopyRange(context.Background(), src, dst, startKey, []byte("key099"), WithCopyResumeToken(token))
+	s.NotNil(err)
+
+	// A pair that expires after it's read isn't copied.
+	delete(ttls, "key095")
+	stats, err = CopyRange(context.Background(), src, dst, []byte("key090"), nil, WithCopyRawOptions(SetColumnFamily(cf)),
+		WithCopyTTL())
+	s.Nil(err)
+	s.Equal(int64(9), stats.Keys)
+	value, err := dst.Get(context.Background(), []byte("key095"), SetColumnFamily(cf))
+	s.Nil(err)
+	s.Nil(value)
+
+	// The pairs that differ fail the verification.
+	s.Nil(dst.Put(context.Background(), []byte("key0105"), []byte("extra"), SetColumnFamily(cf)))
+	_, err = CopyRange(context.Background(), src, dst, startKey, endKey, WithCopyRawOptions(SetColumnFamily(cf)),
+		WithCopyVerify())
+	s.ErrorIs(err, ErrChecksumMismatch)
+}
+
+func (s *testRawkvSuite) TestVerifyRange() {
+	storeA := mocktikv.MustNewMVCCStore()
+	defer storeA.Close()
+	a := s.newClient(mocktikv.NewRPCClient(s.cluster, storeA, nil))
+	defer a.Close()
+	storeB := mocktikv.MustNewMVCCStore()
+	defer storeB.Close()
+	clusterB := mocktikv.NewCluster(storeB)
+	mocktikv.BootstrapWithSingleStore(clusterB)
+	b := newMockClient(clusterB, mocktikv.NewRPCClient(clusterB, storeB, nil))
+	defer b.Close()
+
+	// The checksums of mocktikv are of CF_DEFAULT.
+	cf := SetColumnFamily("CF_DEFAULT")
+	var keys, values [][]byte
+	for i := 0; i < 2000; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%04d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%04d", i)))
+	}
+	s.Nil(a.BatchPut(context.Background(), keys, values, cf))
+	s.Nil(b.BatchPut(context.Background(), keys, values, cf))
+	s.Nil(a.Put(context.Background(), []byte("other"), []byte("other"), cf))
+
+	report, err := VerifyRange(context.Background(), a, b, []byte("key"), []byte("kez"), WithVerifyRawOptions(cf))
+	s.Nil(err)
+	s.True(report.Consistent())
+	s.Equal(uint64(2000), report.A.TotalKvs)
+	s.Equal(report.A, report.B)
+	s.Greater(len(report.Matched), 8)
+	s.Empty(report.DivergentKeys)
+	_, err = VerifyRange(context.Background(), a, b, []byte("key"), []byte("kez"), WithVerifyShards(0))
+	s.NotNil(err)
+
+	s.Nil(b.Delete(context.Background(), []byte("key0500"), cf))
+	s.Nil(b.Put(context.Background(), []byte("key1200"), []byte("changed"), cf))
+	s.Nil(b.Put(context.Background(), []byte("key13005"), []byte("extra"), cf))
+	divergent := [][]byte{[]byte("key0500"), []byte("key1200"), []byte("key13005")}
+
+	// The shards cover the range, and the divergent keys are in the unmatched ones.
+	report, err = VerifyRange(context.Background(), a, b, []byte("key"), nil, WithVerifyRawOptions(cf), WithVerifyExamples(2))
+	s.Nil(err)
+	s.False(report.Consistent())
+	s.Equal(uint64(2001), report.A.TotalKvs)
+	s.Equal(uint64(2000), report.B.TotalKvs)
+	s.Equal(divergent[:2], report.DivergentKeys)
+	shards := append(append([]VerifyShard{}, report.Matched...), report.Unmatched...)
+	sort.Slice(shards, func(i, j int) bool { return bytes.Compare(shards[i].StartKey, shards[j].StartKey) < 0 })
+	s.Equal([]byte("key"), shards[0].StartKey)
+	s.Empty(shards[len(shards)-1].EndKey)
+	for i := 1; i < len(shards); i++ {
+		s.Equal(shards[i-1].EndKey, shards[i].StartKey)
+	}
+	for _, key := range divergent {
+		found := false
+		for _, shard := range report.Unmatched {
+			found = found || bytes.Compare(key, shard.StartKey) >= 0 && bytes.Compare(key, shard.EndKey) < 0
+		}
+		s.True(found, string(key))
+	}
+
+	// A large unmatched shard is bisected to find the divergent keys.
+	report, err = VerifyRange(context.Background(), a, b, []byte("key"), []byte("kez"), WithVerifyRawOptions(cf),
+		WithVerifyShards(1), WithVerifyExamples(10))
+	s.Nil(err)
+	s.Len(report.Unmatched, 1)
+	s.Equal(divergent, report.DivergentKeys)
+}
+
+func (s *testRawkvSuite) TestLock() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+	clientA := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil)).SetAtomicForCAS(true)
+	clientB := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil)).SetAtomicForCAS(true)
+	defer clientA.Close()
+	defer clientB.Close()
+	ctx := context.Background()
+	key := []byte("lock")
+
+	nonAtomic := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer nonAtomic.Close()
+	_, err := NewLock(nonAtomic, key, time.Second, []byte("a"))
+	s.ErrorIs(err, ErrAtomicModeRequired)
+	_, err = NewLock(clientA, key, time.Second, nil)
+	s.NotNil(err)
+
+	lockA, err := NewLock(clientA, key, time.Second, []byte("a"))
+	s.Nil(err)
+	lockB, err := NewLock(clientB, key, time.Second, []byte("b"))
+	s.Nil(err)
+
+	// The tokens increase every time the lock is acquired.
+	s.Nil(lockA.TryAcquire(ctx))
+	s.Equal(uint64(1), lockA.Token())
+	s.ErrorIs(lockB.TryAcquire(ctx), ErrLockHeld)
+	s.ErrorIs(lockA.TryAcquire(ctx), ErrLockHeld)
+	s.Nil(lockA.Renew(ctx))
+	s.Nil(lockA.Release(ctx))
+	s.Zero(lockA.Token())
+	s.ErrorIs(lockA.Release(ctx), ErrLockLost)
+	s.Nil(lockB.TryAcquire(ctx))
+	s.Equal(uint64(2), lockB.Token())
+
+	// The lock of B expires, so B is a stale holder after A acquires it.
+	s.Nil(clientA.Delete(ctx, key))
+	s.Nil(lockA.Acquire(ctx))
+	s.Equal(uint64(3), lockA.Token())
+	s.ErrorIs(lockB.Renew(ctx), ErrLockLost)
+	s.ErrorIs(lockB.Release(ctx), ErrLockLost)
+	s.Nil(lockA.Release(ctx))
+
+	// Two clients fight over the lock, and only one of them holds it at a time.
+	var (
+		wg      sync.WaitGroup
+		holders int32
+		mu      sync.Mutex
+		tokens  []uint64
+	)
+	for _, lock := range []*Lock{lockA, lockB} {
+		wg.Add(1)
+		go func(lock *Lock) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				err := lock.Do(ctx, func(ctx context.Context) error {
+					s.Equal(int32(1), atomic.AddInt32(&holders, 1))
+					mu.Lock()
+					tokens = append(tokens, lock.Token())
+					mu.Unlock()
+					time.Sleep(time.Millisecond)
+					atomic.AddInt32(&holders, -1)
+					return nil
+				})
+				s.Nil(err)
+			}
+		}(lock)
+	}
+	wg.Wait()
+	s.Len(tokens, 20)
+	for i, token := range tokens {
+		s.Equal(uint64(4+i), token)
+	}
+
+	// The ctx of Do is canceled once the lock is lost.
+	err = lockA.Do(ctx, func(ctx context.Context) error {
+		s.Nil(clientB.Delete(ctx, key))
+		s.Nil(lockB.TryAcquire(ctx))
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	s.ErrorIs(err, ErrLockLost)
+	s.Nil(lockB.Release(ctx))
+	s.Zero(lockA.Token())
+}
+
+func (s *testRawkvSuite) TestSequence() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+	clientA := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil)).SetAtomicForCAS(true)
+	clientB := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil)).SetAtomicForCAS(true)
+	defer clientA.Close()
+	defer clientB.Close()
+	ctx := context.Background()
+	key := []byte("seq")
+
+	nonAtomic := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer nonAtomic.Close()
+	_, err := NewSequence(nonAtomic, key, 10)
+	s.ErrorIs(err, ErrAtomicModeRequired)
+	_, err = NewSequence(clientA, key, 0)
+	s.NotNil(err)
+
+	// The absent key starts at the base.
+	seqA, err := NewSequence(clientA, key, 10, WithSequenceBase(1000))
+	s.Nil(err)
+	s.Zero(seqA.HighWaterMark())
+	id, err := seqA.Next(ctx)
+	s.Nil(err)
+	s.Equal(uint64(1000), id)
+	s.Equal(uint64(1010), seqA.HighWaterMark())
+
+	// A restarted sequence never issues the IDs reserved before.
+	restarted, err := NewSequence(clientA, key, 10, WithSequenceBase(1000))
+	s.Nil(err)
+	id, err = restarted.Next(ctx)
+	s.Nil(err)
+	s.Equal(uint64(1010), id)
+
+	// Two clients allocate IDs concurrently, which are unique and increase in each sequence.
+	seqB, err := NewSequence(clientB, key, 7)
+	s.Nil(err)
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		ids = make(map[uint64]struct{})
+	)
+	for _, seq := range []*Sequence{seqA, seqB} {
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(seq *Sequence) {
+				defer wg.Done()
+				var last uint64
+				for j := 0; j < 50; j++ {
+					id, err := seq.Next(ctx)
+					s.Nil(err)
+					s.Greater(id, last)
+					last = id
+					mu.Lock()
+					_, dup := ids[id]
+					ids[id] = struct{}{}
+					mu.Unlock()
+					s.False(dup, id)
+				}
+			}(seq)
+		}
+	}
+	wg.Wait()
+	s.Len(ids, 400)
+
+	s.Nil(clientA.Put(ctx, key, []byte{math.MaxUint8, math.MaxUint8, math.MaxUint8, math.MaxUint8, math.MaxUint8,
+		math.MaxUint8, math.MaxUint8, 0}))
+	seq, err := NewSequence(clientA, key, 1000)
+	s.Nil(err)
+	_, err = seq.Next(ctx)
+	s.ErrorIs(err, ErrSequenceExhausted)
+	s.Nil(clientA.Put(ctx, key, []byte("invalid")))
+	_, err = seq.Next(ctx)
+	s.NotNil(err)
+}
+
+func (s *testRawkvSuite) TestUpdate() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil)).SetAtomicForCAS(true)
+	defer client.Close()
+	ctx := context.Background()
+	key := []byte("update")
+	appendX := func(old []byte) ([]byte, error) {
+		return append(append([]byte{}, old...), 'x'), nil
+	}
+
+	nonAtomic := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	defer nonAtomic.Close()
+	_, err := nonAtomic.Update(ctx, key, appendX)
+	s.ErrorIs(err, ErrAtomicModeRequired)
+
+	// The absent key is passed as nil.
+	value, err := client.Update(ctx, key, func(old []byte) ([]byte, error) {
+		s.Nil(old)
+		return []byte("a"), nil
+	}, WithUpdateTTL(100))
+	s.Nil(err)
+	s.Equal([]byte("a"), value)
+	value, err = client.Update(ctx, key, appendX)
+	s.Nil(err)
+	s.Equal([]byte("ax"), value)
+
+	// A nil value writes nothing.
+	value, err = client.Update(ctx, key, func(old []byte) ([]byte, error) { return nil, nil })
+	s.Nil(err)
+	s.Equal([]byte("ax"), value)
+
+	// An error of fn aborts the update.
+	cause := errors.New("abort")
+	_, err = client.Update(ctx, key, func(old []byte) ([]byte, error) { return nil, cause })
+	var aborted *UpdateAbortedError
+	s.True(errors.As(err, &aborted))
+	s.ErrorIs(err, cause)
+	value, err = client.Get(ctx, key)
+	s.Nil(err)
+	s.Equal([]byte("ax"), value)
+
+	// fn changes the key every time, so the attempts are exhausted.
+	attempts := 0
+	_, err = client.Update(ctx, key, func(old []byte) ([]byte, error) {
+		attempts++
+		s.Nil(client.Put(ctx, key, []byte(fmt.Sprint(attempts))))
+		return appendX(old)
+	}, WithUpdateMaxAttempts(2))
+	s.Equal(ErrCASConflict, errors.Cause(err))
+	s.False(errors.As(err, &aborted))
+	s.Equal(2, attempts)
+
+	// The concurrent updates all apply.
+	s.Nil(client.Delete(ctx, key))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Update(ctx, key, appendX)
+			s.Nil(err)
+		}()
+	}
+	wg.Wait()
+	value, err = client.Get(ctx, key)
+	s.Nil(err)
+	s.Equal([]byte("xxxxxxxx"), value)
+}
+
+func (s *testRawkvSuite) TestWatch() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	// The keys of the prefix are scanned in several pages.
+	client.maxScanLimit = 100
+	defer client.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// mocktikv checksums CF_DEFAULT only.
+	cf := SetColumnFamily("CF_DEFAULT")
+	next := func(ch <-chan WatchEvent) WatchEvent {
+		select {
+		case event := <-ch:
+			return event
+		case <-time.After(5 * time.Second):
+			s.FailNow("no watch event")
+			return WatchEvent{}
+		}
+	}
+
+	_, err := client.Watch(ctx, []byte("key"), 0)
+	s.NotNil(err)
+
+	// A single key.
+	ch, err := client.Watch(ctx, []byte("key"), 10*time.Millisecond, WithWatchRawOptions(cf))
+	s.Nil(err)
+	s.Nil(client.Put(ctx, []byte("key"), []byte("v1"), cf))
+	s.Equal(WatchEvent{Type: WatchCreated, Key: []byte("key"), NewValue: []byte("v1")}, next(ch))
+	// Writing the same value isn't a change.
+	s.Nil(client.Put(ctx, []byte("key"), []byte("v1"), cf))
+	s.Nil(client.Put(ctx, []byte("other"), []byte("x"), cf))
+	time.Sleep(50 * time.Millisecond)
+	s.Nil(client.Put(ctx, []byte("key"), []byte("v2"), cf))
+	s.Equal(WatchEvent{Type: WatchUpdated, Key: []byte("key"), OldValue: []byte("v1"), NewValue: []byte("v2")}, next(ch))
+	s.Nil(client.Delete(ctx, []byte("key"), cf))
+	s.Equal(WatchEvent{Type: WatchDeleted, Key: []byte("key"), OldValue: []byte("v2")}, next(ch))
+
+	// A prefix with enough keys to span several chunks, reporting the initial keys.
+	prefix := []byte("watch/")
+	var keys [][]byte
+	for i := 0; i < 500; i++ {
+		key := []byte(fmt.Sprintf("watch/%03d", i))
+		keys = append(keys, key)
+		s.Nil(client.Put(ctx, key, []byte("v"), cf))
+	}
+	s.Greater(len(watchChunks(keys)), 2)
+	prefixCtx, prefixCancel := context.WithCancel(ctx)
+	ch, err = client.WatchPrefix(prefixCtx, prefix, 10*time.Millisecond, WithWatchInitialEvents(), WithWatchRawOptions(cf))
+	s.Nil(err)
+	for _, key := range keys {
+		s.Equal(WatchEvent{Type: WatchCreated, Key: key, NewValue: []byte("v")}, next(ch))
+	}
+	// The changes between two polls are sent in key order.
+	s.Nil(client.BatchPut(ctx, [][]byte{[]byte("watch/250"), []byte("watch/aaa"), []byte("watch/100")},
+		[][]byte{[]byte("u"), []byte("new"), []byte("v")}, cf))
+	s.Nil(client.Delete(ctx, []byte("watch/007"), cf))
+	s.Nil(client.Put(ctx, []byte("watcher"), []byte("outside"), cf))
+	var events []WatchEvent
+	for len(events) < 3 {
+		events = append(events, next(ch))
+	}
+	sort.Slice(events, func(i, j int) bool { return bytes.Compare(events[i].Key, events[j].Key) < 0 })
+	s.Equal([]WatchEvent{
+		{Type: WatchDeleted, Key: []byte("watch/007"), OldValue: []byte("v")},
+		{Type: WatchUpdated, Key: []byte("watch/250"), OldValue: []byte("v"), NewValue: []byte("u")},
+		{Type: WatchCreated, Key: []byte("watch/aaa"), NewValue: []byte("new")},
+	}, events)
+
+	// The channel is closed when ctx is done.
+	prefixCancel()
+	for range ch {
+	}
+	select {
+	case event := <-ch:
+		s.Equal(WatchEvent{}, event)
+	default:
+		s.Fail("the channel isn't closed")
+	}
+}
+
+func (s *testRawkvSuite) TestBatchPutWithResult() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// split the cluster into regions ["", "key3"), ["key3", "key6"), ["key6", "")
+	region2 := s.cluster.AllocID()
+	peers2 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, region2, []byte("key3"), peers2, peers2[0])
+	region3 := s.cluster.AllocID()
+	peers3 := s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(region2, region3, []byte("key6"), peers3, peers3[0])
+
+	client := s.newClient(&fakeClient{
+		Client:    mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		cmd:       tikvrpc.CmdRawBatchPut,
+		errRegion: region2,
+		keyErr:    "injected error",
+	})
+	defer client.Close()
+
+	keys := make([][]byte, 0, 9)
+	values := make([][]byte, 0, 9)
+	for i := 1; i <= 9; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%d", i)))
+	}
+	result, err := client.BatchPutWithResult(context.Background(), keys, values, nil)
+	s.NotNil(err)
+	s.ElementsMatch([][]byte{keys[0], keys[1], keys[5], keys[6], keys[7], keys[8]}, result.SucceededKeys)
+	s.Len(result.Failures, 1)
+	s.Equal(region2, result.Failures[0].RegionID)
+	s.ElementsMatch([][]byte{keys[2], keys[3], keys[4]}, result.Failures[0].FailedKeys)
+	s.EqualError(result.Failures[0].Err, "injected error")
+
+	got, err := client.BatchGet(context.Background(), keys)
+	s.Nil(err)
+	for i := range keys {
+		if i >= 2 && i <= 4 {
+			s.Nil(got[i])
+		} else {
+			s.Equal(values[i], got[i])
+		}
+	}
+
+	// BatchPut still returns the error alone, annotated with its batch.
+	err = client.BatchPut(context.Background(), keys, values)
+	s.EqualError(errors.Cause(err), "injected error")
+	s.Contains(err.Error(), fmt.Sprintf("batch of region %d from key %s", region2, kv.StrKey(keys[2])))
+
+	// The errors of all failed batches are returned.
+	client.rpcClient = &fakeClient{
+		Client:    client.rpcClient,
+		cmd:       tikvrpc.CmdRawBatchPut,
+		errRegion: region3,
+		keyErr:    "injected error",
+	}
+	_, err = client.BatchPutWithResult(context.Background(), keys, values, nil)
+	var batchErr *BatchError
+	s.True(errors.As(err, &batchErr))
+	s.Len(batchErr.Unwrap(), 2)
+	for _, err := range batchErr.Unwrap() {
+		s.EqualError(errors.Cause(err), "injected error")
+	}
+	s.True(errors.Is(&BatchError{Errors: []error{io.EOF, annotateBatchErr(ErrCASConflict, region2, keys[2])}}, ErrCASConflict))
+}
+
+func (s *testRawkvSuite) TestBatchPutSameTTL() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	rpcClient := &fakeClient{Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil), cmd: tikvrpc.CmdRawBatchPut}
+	client := s.newClient(rpcClient)
+	defer client.Close()
+
+	keys := [][]byte{[]byte("key1"), []byte("key2"), []byte("key3")}
+	values := [][]byte{[]byte("value1"), []byte("value2"), []byte("value3")}
+	s.Nil(client.BatchPut(context.Background(), keys, values, WithTTL(30)))
+	s.Len(rpcClient.reqs, 1)
+	s.Equal([]uint64{30}, rpcClient.reqs[0].RawBatchPut().Ttls)
+	s.Equal(uint64(30), rpcClient.reqs[0].RawBatchPut().Ttl)
+
+	rpcClient.reqs = nil
+	s.Nil(client.BatchPut(context.Background(), keys, values))
+	s.Len(rpcClient.reqs, 1)
+	s.Empty(rpcClient.reqs[0].RawBatchPut().Ttls)
+	s.Zero(rpcClient.reqs[0].RawBatchPut().Ttl)
+
+	// a TTL per key takes precedence.
+	rpcClient.reqs = nil
+	s.Nil(client.BatchPutWithTTL(context.Background(), keys, values, []uint64{1, 2, 3}, WithTTL(30)))
+	s.Len(rpcClient.reqs, 1)
+	s.ElementsMatch([]uint64{1, 2, 3}, rpcClient.reqs[0].RawBatchPut().Ttls)
+}
+
+func (s *testRawkvSuite) TestBatchLimits() {
+	_, err := NewClientWithOpts(context.Background(), nil, WithBatchPutSizeLimit(-1))
+	s.NotNil(err)
+	_, err = NewClientWithOpts(context.Background(), nil, WithBatchPairCountLimit(-1))
+	s.NotNil(err)
+
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	puts := &fakeClient{Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil), cmd: tikvrpc.CmdRawBatchPut}
+	deletes := &fakeClient{Client: puts, cmd: tikvrpc.CmdRawBatchDelete}
+	client := s.newClient(deletes)
+	defer client.Close()
+
+	keys := make([][]byte, 0, 100)
+	values := make([][]byte, 0, 100)
+	for i := 0; i < 100; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%03d", i)))
+		values = append(values, bytes.Repeat([]byte("v"), 1000))
+	}
+
+	// the default limits.
+	s.Nil(client.BatchPut(context.Background(), keys, values))
+	s.Len(puts.reqs, 7)
+	s.Nil(client.BatchDelete(context.Background(), keys))
+	s.Len(deletes.reqs, 1)
+
+	client.batchPutSizeLimit = 64 * 1024
+	puts.reqs = nil
+	s.Nil(client.BatchPut(context.Background(), keys, values))
+	s.Len(puts.reqs, 2)
+
+	client.batchPairCountLimit = 10
+	puts.reqs = nil
+	s.Nil(client.BatchPut(context.Background(), keys, values))
+	s.Len(puts.reqs, 10)
+	s.Nil(client.BatchDelete(context.Background(), keys))
+	s.Len(deletes.reqs, 1+10)
+}
+
+func (s *testRawkvSuite) TestBatchRetryAfterSplit() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	rpcClient := &fakeClient{Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil), cmd: tikvrpc.CmdRawBatchPut}
+	client := s.newClient(rpcClient)
+	defer client.Close()
+
+	var keys, values [][]byte
+	for i := 0; i < 10; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%d", i)))
+	}
+	// load the region into the cache, then split it so that the cached region is stale
+	s.Nil(client.Put(context.Background(), keys[0], values[0]))
+	split := func(regionID uint64, key string) uint64 {
+		newRegionID := s.cluster.AllocID()
+		peers := s.cluster.AllocIDs(2)
+		s.cluster.SplitRaw(regionID, newRegionID, []byte(key), peers, peers[0])
+		return newRegionID
+	}
+	region2 := split(s.region1, "key3")
+	region3 := split(region2, "key6")
+
+	// the stale batch fails once, then its keys are regrouped into the 3 regions
+	s.Nil(client.BatchPut(context.Background(), keys, values))
+	s.Len(rpcClient.reqs, 1+3)
+
+	split(region3, "key8")
+	got, err := client.BatchGet(context.Background(), keys)
+	s.Nil(err)
+	s.Equal(values, got)
+
+	split(s.region1, "key1")
+	s.Nil(client.BatchDelete(context.Background(), keys))
+	got, err = client.BatchGet(context.Background(), keys)
+	s.Nil(err)
+	for _, value := range got {
+		s.Empty(value)
+	}
+}
+
+func (s *testRawkvSuite) TestBatchCancelNoLeak() {
+	defer goleak.VerifyNone(s.T(), goleak.IgnoreCurrent(),
+		goleak.IgnoreTopFunction("github.com/pingcap/goleveldb/leveldb.(*DB).mpoolDrain"))
+
+	regionID := s.region1
+	for i := 1; i <= 8; i++ {
+		newRegionID := s.cluster.AllocID()
+		peers := s.cluster.AllocIDs(2)
+		s.cluster.SplitRaw(regionID, newRegionID, []byte(fmt.Sprintf("key%d", i)), peers, peers[0])
+		regionID = newRegionID
+	}
+	var keys, values [][]byte
+	for i := 0; i <= 8; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)))
+		values = append(values, []byte(fmt.Sprintf("value%d", i)))
+	}
+
+	for _, c := range []struct {
+		cmd tikvrpc.CmdType
+		run func(ctx context.Context, client *Client) error
+	}{
+		{tikvrpc.CmdRawBatchPut, func(ctx context.Context, client *Client) error {
+			return client.BatchPut(ctx, keys, values)
+		}},
+		{tikvrpc.CmdRawBatchGet, func(ctx context.Context, client *Client) error {
+			_, err := client.BatchGet(ctx, keys)
+			return err
+		}},
+		{tikvrpc.CmdRawBatchDelete, func(ctx context.Context, client *Client) error {
+			return client.BatchDelete(ctx, keys)
+		}},
+		{tikvrpc.CmdRawDeleteRange, func(ctx context.Context, client *Client) error {
+			return client.BatchDeleteRange(ctx, nil, nil)
+		}},
+	} {
+		mvccStore := mocktikv.MustNewMVCCStore()
+		started := make(chan struct{}, 1)
+		client := s.newClient(fakeBlocking(mocktikv.NewRPCClient(s.cluster, mvccStore, nil), c.cmd, started))
+		client.batchConcurrencyLimit = 2
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+		err := c.run(ctx, client)
+		s.True(errors.Is(err, context.Canceled), "%v: %v", c.cmd, err)
+		cancel()
+		client.Close()
+		mvccStore.Close()
+	}
+}
+
+func (s *testRawkvSuite) TestCallOptions() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	recorder := &fakeClient{Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil), cmd: tikvrpc.CmdRawGet}
+	client := s.newClient(recorder)
+	defer client.Close()
+
+	_, err := client.Get(context.Background(), []byte("key"))
+	s.Nil(err)
+	_, err = client.Get(context.Background(), []byte("key"), WithCallTimeout(200*time.Millisecond))
+	s.Nil(err)
+	s.Equal([]time.Duration{client.callTimeout(&rawOptions{}), 200 * time.Millisecond}, recorder.timeouts)
+
+	// The retries give up once the backoff budget is used up.
+	recorder.send = func(ctx context.Context, addr string, req *tikvrpc.Request, next func() (*tikvrpc.Response, error)) (*tikvrpc.Response, error) {
+		return tikvrpc.GenRegionErrorResp(req, &errorpb.Error{EpochNotMatch: &errorpb.EpochNotMatch{}})
+	}
+	start := time.Now()
+	_, err = client.Get(context.Background(), []byte("key"), WithMaxBackoff(100))
+	s.NotNil(err)
+	s.Less(time.Since(start), 5*time.Second)
+
+	// The budget of the client applies to the calls without WithMaxBackoff.
+	s.Equal(rawkvMaxBackoff, client.RetryBudget())
+	client.maxBackoff = 100
+	s.Equal(100, client.RetryBudget())
+	start = time.Now()
+	_, err = client.Get(context.Background(), []byte("key"))
+	s.NotNil(err)
+	s.Less(time.Since(start), 5*time.Second)
+
+	_, err = NewClientWithOpts(context.Background(), nil, WithRetryBudget(-1))
+	s.NotNil(err)
+}
+
+func (s *testRawkvSuite) TestGRPCKeepAlive() {
+	_, err := NewClientWithOpts(context.Background(), nil, WithGRPCKeepAlive(-time.Second, time.Second))
+	s.NotNil(err)
+
+	opt := &option{}
+	WithGRPCKeepAlive(time.Minute, 3*time.Second)(opt)
+	s.Nil(opt.validate())
+	s.Equal(keepalive.ClientParameters{Time: time.Minute, Timeout: 3 * time.Second}, *opt.keepAlive)
+	WithGRPCKeepAliveParams(keepalive.ClientParameters{Time: time.Minute, PermitWithoutStream: true})(opt)
+	s.True(opt.keepAlive.PermitWithoutStream)
+}
+
+func (s *testRawkvSuite) TestGRPCCompression() {
+	_, err := NewClientWithOpts(context.Background(), nil, WithGRPCCompression("snappy"))
+	s.NotNil(err)
+	_, err = NewClientWithRPC(context.Background(), nil, &closeRecorder{}, WithGRPCCompression("gzip"))
+	s.NotNil(err)
+
+	opt := &option{}
+	WithGRPCCompression("gzip")(opt)
+	s.Nil(opt.validate())
+}
+
+func (s *testRawkvSuite) TestRateLimit() {
+	_, err := NewClientWithOpts(context.Background(), nil, WithRateLimit(0, 1))
+	s.NotNil(err)
+	_, err = NewClientWithOpts(context.Background(), nil, WithByteRateLimit(100, 0))
+	s.NotNil(err)
+
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// The limiter is shared by two clients and allows no more requests after the burst.
+	limiter := rate.NewLimiter(rate.Every(time.Hour), 3)
+	newClient := func() *Client {
+		client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+		client.rateLimiter = limiter
+		return client
+	}
+	client1, client2 := newClient(), newClient()
+	defer client1.Close()
+	defer client2.Close()
+
+	newRegionID, peers := s.cluster.AllocID(), s.cluster.AllocIDs(2)
+	s.cluster.SplitRaw(s.region1, newRegionID, []byte("b"), peers, peers[0])
+	keys := [][]byte{[]byte("a"), []byte("b")}
+	s.Nil(client1.BatchPut(context.Background(), keys, keys))
+	_, err = client2.Get(context.Background(), []byte("a"))
+	s.Nil(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = client1.Get(ctx, []byte("a"))
+	s.NotNil(err)
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = client2.Get(ctx, []byte("a"))
+	s.True(errors.Is(err, context.Canceled))
+
+	// The bytes of the requests are limited as well.
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	client.byteRateLimiter = rate.NewLimiter(rate.Every(time.Hour), 64)
+	defer client.Close()
+	s.Nil(client.Put(context.Background(), []byte("a"), make([]byte, 32)))
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s.NotNil(client.Put(ctx, []byte("a"), make([]byte, 32)))
+}
+
+func (s *testRawkvSuite) TestMaxScanLimit() {
+	_, err := NewClientWithOpts(context.Background(), nil, WithMaxScanLimit(-1))
+	s.NotNil(err)
+
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	client.maxScanLimit = 5
+	defer client.Close()
+
+	for i := 0; i < 10; i++ {
+		s.Nil(client.Put(context.Background(), []byte(fmt.Sprintf("key%d", i)), []byte("value")))
+	}
+	keys, _, err := client.Scan(context.Background(), []byte("key"), nil, 5)
+	s.Nil(err)
+	s.Len(keys, 5)
+	_, _, err = client.Scan(context.Background(), []byte("key"), nil, 6)
+	s.Equal(ErrMaxScanLimitExceeded, errors.Cause(err))
+	_, _, err = client.ReverseScan(context.Background(), nil, []byte("key"), 6)
+	s.Equal(ErrMaxScanLimitExceeded, errors.Cause(err))
+	_, _, err = client.BatchScan(context.Background(), [][]byte{[]byte("key")}, [][]byte{nil}, 6)
+	s.Equal(ErrMaxScanLimitExceeded, errors.Cause(err))
+	_, err = client.Iter(context.Background(), []byte("key"), nil, 6)
+	s.Equal(ErrMaxScanLimitExceeded, errors.Cause(err))
+
+	// Counting keys isn't limited by the scan limit, it scans page by page.
+	result, err := client.DeleteRangeWithDetail(context.Background(), []byte("key"), nil, DeleteRangeCountKeys())
+	s.Nil(err)
+	s.Equal(uint64(10), result.Keys)
+
+	_, _, err = client.Scan(context.Background(), []byte("key"), nil, 0)
+	s.Equal(ErrInvalidScanLimit, errors.Cause(err))
+	_, _, err = client.ReverseScan(context.Background(), nil, []byte("key"), -1)
+	s.Equal(ErrInvalidScanLimit, errors.Cause(err))
+}
+
+func (s *testRawkvSuite) TestServerError() {
+	s.Nil(extractKeyErr(""))
+
+	for _, c := range []struct {
+		msg  string
+		kind error
+	}{
+		{"TTL is not enabled", ErrTTLNotEnabled},
+		{"Api version in request does not match with TiKV storage", ErrAPIVersionMismatch},
+		{"Key mode mismatched with the request mode", ErrInvalidKeyMode},
+		{"engine error", nil},
+	} {
+		err := extractKeyErr(c.msg)
+		s.EqualError(err, c.msg)
+		var serverErr *ServerError
+		s.True(errors.As(err, &serverErr))
+		s.Equal(c.msg, serverErr.Msg)
+		for _, kind := range []error{ErrTTLNotEnabled, ErrAPIVersionMismatch, ErrInvalidKeyMode} {
+			s.Equal(kind == c.kind, errors.Is(err, kind), c.msg)
+		}
+	}
+}
+
+func (s *testRawkvSuite) TestBackoffOnRegionError() {
+	for _, c := range []struct {
+		regionErr *errorpb.Error
+		backoff   string
+	}{
+		{&errorpb.Error{EpochNotMatch: &errorpb.EpochNotMatch{CurrentRegions: []*metapb.Region{{Id: 1}}}}, ""},
+		{&errorpb.Error{EpochNotMatch: &errorpb.EpochNotMatch{}}, "regionMiss"},
+		{&errorpb.Error{NotLeader: &errorpb.NotLeader{RegionId: 1}}, "regionScheduling"},
+		{&errorpb.Error{ServerIsBusy: &errorpb.ServerIsBusy{}}, "tikvServerBusy"},
+		{&errorpb.Error{RegionNotFound: &errorpb.RegionNotFound{RegionId: 1}}, "regionMiss"},
+	} {
+		var events []RetryEvent
+		client := &Client{retryHook: func(event RetryEvent) { events = append(events, event) }}
+		bo := retry.NewBackofferWithVars(context.Background(), rawkvMaxBackoff, nil)
+		regionID := locate.NewRegionVerID(2, 0, 0)
+		s.Nil(client.backoffOnRegionError(bo, tikvrpc.CmdRawGet, regionID, c.regionErr, &rawOptions{}))
+		if c.backoff == "" {
+			s.Empty(bo.GetBackoffTimes(), c.regionErr.String())
+		} else {
+			s.Equal(map[string]int{c.backoff: 1}, bo.GetBackoffTimes(), c.regionErr.String())
+		}
+		s.Len(events, 1)
+		s.Equal(tikvrpc.CmdRawGet, events[0].Cmd)
+		s.Equal(uint64(2), events[0].RegionID)
+		s.Equal(locate.RegionErrorToLabel(c.regionErr), events[0].RegionError)
+		s.Equal(c.backoff, events[0].Backoff)
+		s.Equal(time.Duration(bo.GetTotalSleep())*time.Millisecond, events[0].Sleep)
+	}
+}
+
+func (s *testRawkvSuite) TestRetryHook() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	var (
+		mu     sync.Mutex
+		events []RetryEvent
+	)
+	client := s.newClient(&fakeClient{
+		Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		cmd:    tikvrpc.CmdRawBatchGet,
+		regionErrs: []*errorpb.Error{
+			{NotLeader: &errorpb.NotLeader{RegionId: s.region1}},
+			{EpochNotMatch: &errorpb.EpochNotMatch{}},
+		},
+	})
+	client.retryHook = func(event RetryEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+	defer client.Close()
+
+	// The NotLeader is retried by the region request sender in place, and the EpochNotMatch is returned to the
+	// BatchGet, which regroups the keys and sends them again.
+	_, err := client.BatchGet(context.Background(), [][]byte{[]byte("a")})
+	s.Nil(err)
+	s.Len(events, 2)
+	for i, regionErr := range []string{"not_leader", "epoch_not_match"} {
+		s.Equal(tikvrpc.CmdRawBatchGet, events[i].Cmd)
+		s.Equal(s.region1, events[i].RegionID)
+		s.Equal(regionErr, events[i].RegionError)
+		s.NotEmpty(events[i].Backoff)
+		s.Greater(events[i].Sleep, time.Duration(0))
+	}
+}
+
+func (s *testRawkvSuite) TestCancelDuringRegionMiss() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	client := s.newClient(fakeRegionMiss(mocktikv.NewRPCClient(s.cluster, mvccStore, nil)))
+	defer client.Close()
+
+	keys := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	for name, f := range map[string]func(ctx context.Context) error{
+		"Get": func(ctx context.Context) error {
+			_, err := client.Get(ctx, []byte("key"))
+			return err
+		},
+		"BatchGet": func(ctx context.Context) error {
+			_, err := client.BatchGet(ctx, keys)
+			return err
+		},
+		"BatchPut": func(ctx context.Context) error {
+			return client.BatchPut(ctx, keys, keys)
+		},
+		"DeleteRange": func(ctx context.Context) error {
+			return client.DeleteRange(ctx, []byte("a"), []byte("z"))
+		},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		var cancelled time.Time
+		var mu sync.Mutex
+		time.AfterFunc(50*time.Millisecond, func() {
+			mu.Lock()
+			cancelled = time.Now()
+			mu.Unlock()
+			cancel()
+		})
+		err := f(ctx)
+		mu.Lock()
+		s.Less(time.Since(cancelled), 100*time.Millisecond, name)
+		mu.Unlock()
+		s.True(errors.Is(err, context.Canceled), "%s: %v", name, err)
+	}
+}
+
+func (s *testRawkvSuite) TestMaxRetries() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	rpcClient := fakeRegionMiss(mocktikv.NewRPCClient(s.cluster, mvccStore, nil))
+	client := s.newClient(rpcClient)
+	client.backoffFn = func(time.Duration) {}
+	defer client.Close()
+
+	keys := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	for name, f := range map[string]func(opts ...RawOption) error{
+		"Get": func(opts ...RawOption) error {
+			_, err := client.Get(context.Background(), []byte("key"), opts...)
+			return err
+		},
+		"BatchGet": func(opts ...RawOption) error {
+			_, err := client.BatchGet(context.Background(), keys, opts...)
+			return err
+		},
+		"BatchPut": func(opts ...RawOption) error {
+			return client.BatchPut(context.Background(), keys, keys, opts...)
+		},
+		"DeleteRange": func(opts ...RawOption) error {
+			return client.DeleteRange(context.Background(), []byte("a"), []byte("z"), opts...)
+		},
+	} {
+		for _, n := range []int{0, 2} {
+			rpcClient.reset()
+			err := f(WithMaxRetries(n))
+			var retriesErr *ErrRetriesExhausted
+			s.True(errors.As(err, &retriesErr), "%s: %v", name, err)
+			s.Equal(n, retriesErr.Retries, name)
+			s.NotNil(retriesErr.RegionErr.GetEpochNotMatch(), name)
+			s.Equal(n > 0, retriesErr.Backoff > 0, name)
+			s.Len(rpcClient.requests(), n+1, name)
+		}
+	}
+}
+
+func (s *testRawkvSuite) TestBackoffPolicy() {
+	_, err := NewClientWithOpts(context.Background(), nil, WithBackoffPolicy(BackoffPolicy{Base: time.Second, Cap: time.Millisecond}))
+	s.NotNil(err)
+	_, err = NewClientWithOpts(context.Background(), nil, WithBackoffPolicy(BackoffPolicy{Base: time.Millisecond, Cap: time.Second, Jitter: 10}))
+	s.NotNil(err)
+	opt := &option{}
+	WithBackoffPolicy(BackoffPolicy{Base: 2 * time.Millisecond, Cap: time.Second, Jitter: EqualJitter})(opt)
+	s.Nil(opt.validate())
+
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	// firstSleeps returns the sleep before the first retry of each of many calls meeting a region miss at once.
+	firstSleeps := func(policy *BackoffPolicy) map[time.Duration]struct{} {
+		var mu sync.Mutex
+		sleeps := make(map[time.Duration]struct{})
+		opt = &option{backoffPolicy: policy}
+		client := s.newClient(fakeRegionMiss(mocktikv.NewRPCClient(s.cluster, mvccStore, nil)))
+		client.backoffFnCfg = opt.backoffFnCfg()
+		defer client.Close()
+		for i := 0; i < 20; i++ {
+			first := true
+			client.backoffFn = func(d time.Duration) {
+				mu.Lock()
+				defer mu.Unlock()
+				if first {
+					sleeps[d] = struct{}{}
+					first = false
+				}
+			}
+			_, err := client.Get(context.Background(), []byte("key"), WithMaxRetries(1))
+			s.NotNil(err)
+		}
+		return sleeps
+	}
+	s.Equal(map[time.Duration]struct{}{2 * time.Millisecond: {}}, firstSleeps(nil))
+	s.Equal(map[time.Duration]struct{}{100 * time.Millisecond: {}}, firstSleeps(&BackoffPolicy{Base: 100 * time.Millisecond, Cap: time.Second, Jitter: NoJitter}))
+	spread := firstSleeps(&BackoffPolicy{Base: 100 * time.Millisecond, Cap: time.Second, Jitter: FullJitter})
+	s.Greater(len(spread), 1)
+	for d := range spread {
+		s.Less(d, 100*time.Millisecond)
+	}
+}
+
+// closeRecorder records whether the client is closed.
+type closeRecorder struct {
+	client.Client
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return r.Client.Close()
+}
+
+func (s *testRawkvSuite) TestWithRPCClient() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	recorder := &closeRecorder{Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil)}
+	_, err := NewClientWithOpts(context.Background(), nil, WithRPCClient(recorder), WithGRPCDialOptions(grpc.WithBlock()))
+	s.NotNil(err)
+	_, err = NewClientWithOpts(context.Background(), nil, WithRPCClient(recorder), WithGRPCKeepAlive(time.Second, time.Second))
+	s.NotNil(err)
+	_, err = NewClientWithOpts(context.Background(), nil, WithRPCClient(recorder), WithGRPCConnectionCount(4))
+	s.NotNil(err)
+
+	client := s.newClient(recorder)
+	client.externalRPCClient = true
+	s.Nil(client.Put(context.Background(), []byte("key"), []byte("value")))
+	s.Nil(client.Close())
+	s.False(recorder.closed)
+	s.Nil(recorder.Close())
+}
+
+// pdCloseRecorder records whether the PD client is closed.
+type pdCloseRecorder struct {
+	pd.Client
+	closed bool
+}
+
+func (r *pdCloseRecorder) Close() {
+	r.closed = true
+	r.Client.Close()
+}
+
+func (s *testRawkvSuite) TestNewClientWithPD() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	pdCli := &pdCloseRecorder{Client: mocktikv.NewPDClient(s.cluster)}
+	rpcClient := mocktikv.NewRPCClient(s.cluster, mvccStore, nil)
+	_, err := NewClientWithPD(context.Background(), pdCli, config.Security{}, WithRPCClient(rpcClient), WithPDOptions(pd.WithForwardingOption(true)))
+	s.NotNil(err)
+
+	client, err := NewClientWithPD(context.Background(), pdCli, config.Security{}, WithRPCClient(rpcClient))
+	s.Nil(err)
+	s.Equal(pdCli.GetClusterID(context.Background()), client.ClusterID())
+	s.Nil(client.Put(context.Background(), []byte("key"), []byte("value")))
+	value, err := client.Get(context.Background(), []byte("key"))
+	s.Nil(err)
+	s.Equal([]byte("value"), value)
+	s.Nil(client.Close())
+	s.False(pdCli.closed)
+	s.Nil(rpcClient.Close())
+}
+
+func (s *testRawkvSuite) TestNewClientWithRPC() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	_, err := NewClientWithRPC(context.Background(), mocktikv.NewPDClient(s.cluster), nil)
+	s.NotNil(err)
+
+	rpcClient := &fakeClient{
+		Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		cmd:    tikvrpc.CmdRawScan,
+		regionErrs: []*errorpb.Error{
+			{EpochNotMatch: &errorpb.EpochNotMatch{}},
+			{RegionNotFound: &errorpb.RegionNotFound{RegionId: s.region1}},
+		},
+	}
+	defer rpcClient.Close()
+	client, err := NewClientWithRPC(context.Background(), mocktikv.NewPDClient(s.cluster), rpcClient)
+	s.Nil(err)
+	defer client.Close()
+
+	s.Nil(client.BatchPut(context.Background(), [][]byte{[]byte("a"), []byte("b")}, [][]byte{[]byte("1"), []byte("2")}))
+	keys, values, err := client.Scan(context.Background(), []byte("a"), nil, 10)
+	s.Nil(err)
+	s.Equal([][]byte{[]byte("a"), []byte("b")}, keys)
+	s.Equal([][]byte{[]byte("1"), []byte("2")}, values)
+	s.Len(rpcClient.reqs, 3)
+}
+
+func (s *testRawkvSuite) TestRPCInterceptor() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+
+	rpcClient := &fakeClient{
+		Client:     mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		cmd:        tikvrpc.CmdRawGet,
+		regionErrs: []*errorpb.Error{{NotLeader: &errorpb.NotLeader{RegionId: s.region1}}},
+	}
+	defer rpcClient.Close()
+	var (
+		mu      sync.Mutex
+		execLog []string
+	)
+	logInterceptor := func(name string) interceptor.RPCInterceptor {
+		return func(next interceptor.RPCInterceptorFunc) interceptor.RPCInterceptorFunc {
+			return func(target string, req *tikvrpc.Request) (*tikvrpc.Response, error) {
+				mu.Lock()
+				execLog = append(execLog, fmt.Sprintf("%s %s region %d", name, req.Type, req.RegionId))
+				mu.Unlock()
+				s.NotEmpty(target)
+				return next(target, req)
+			}
+		}
+	}
+	client, err := NewClientWithRPC(context.Background(), mocktikv.NewPDClient(s.cluster), rpcClient,
+		WithRPCInterceptor(logInterceptor("first")), WithRPCInterceptor(logInterceptor("second")))
+	s.Nil(err)
+	defer client.Close()
+
+	// The Get meets a NotLeader and is retried, and each attempt goes through the interceptors in order.
+	s.Nil(client.Put(context.Background(), []byte("a"), []byte("1")))
+	_, err = client.Get(context.Background(), []byte("a"))
+	s.Nil(err)
+	s.Greater(len(rpcClient.reqs), 1)
+	expected := []string{
+		fmt.Sprintf("first RawPut region %d", s.region1),
+		fmt.Sprintf("second RawPut region %d", s.region1),
+	}
+	for range rpcClient.reqs {
+		expected = append(expected,
+			fmt.Sprintf("first RawGet region %d", s.region1),
+			fmt.Sprintf("second RawGet region %d", s.region1))
+	}
+	s.Equal(expected, execLog)
+}
+
+// sampleCount returns the number of the observations of a histogram.
+func sampleCount(o prometheus.Observer) uint64 {
+	m := &dto.Metric{}
+	if err := o.(prometheus.Metric).Write(m); err != nil {
+		return 0
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+// sampleSum returns the sum of the observations of a histogram.
+func sampleSum(o prometheus.Observer) float64 {
+	m := &dto.Metric{}
+	if err := o.(prometheus.Metric).Write(m); err != nil {
+		return 0
+	}
+	return m.GetHistogram().GetSampleSum()
+}
+
+func (s *testRawkvSuite) TestMetricsRegisterer() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+	rpcClient := mocktikv.NewRPCClient(s.cluster, mvccStore, nil)
+	defer rpcClient.Close()
+	ctx := context.Background()
+
+	registry := prometheus.NewRegistry()
+	newClient := func(cluster string) *Client {
+		client, err := NewClientWithRPC(ctx, mocktikv.NewPDClient(s.cluster), rpcClient,
+			WithMetricsRegisterer(registry), WithConstLabels(prometheus.Labels{"cluster": cluster}))
+		s.Nil(err)
+		return client
+	}
+	clientA, clientB, clientA2 := newClient("a"), newClient("b"), newClient("a")
+	defer clientA.Close()
+	defer clientB.Close()
+	defer clientA2.Close()
+	// The clients with the same labels share the metrics.
+	s.Equal(clientA.rawkvMetrics.CmdHistogram, clientA2.rawkvMetrics.CmdHistogram)
+
+	defaultGets := sampleCount(metrics.DefaultRawkvMetrics.CmdHistogramWithGet)
+	for _, client := range []*Client{clientA, clientB, clientA2} {
+		_, err := client.Get(ctx, []byte("key"))
+		s.Nil(err)
+	}
+	s.Equal(uint64(2), sampleCount(clientA.rawkvMetrics.CmdHistogramWithGet))
+	s.Equal(uint64(1), sampleCount(clientB.rawkvMetrics.CmdHistogramWithGet))
+	s.Equal(defaultGets, sampleCount(metrics.DefaultRawkvMetrics.CmdHistogramWithGet))
+
+	families, err := registry.Gather()
+	s.Nil(err)
+	clusters := make(map[string]struct{})
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			s.Equal("cluster", m.GetLabel()[0].GetName())
+			clusters[m.GetLabel()[0].GetValue()] = struct{}{}
+		}
+	}
+	s.Equal(map[string]struct{}{"a": {}, "b": {}}, clusters)
+
+	// The client without the options observes to the package-level metrics.
+	client, err := NewClientWithRPC(ctx, mocktikv.NewPDClient(s.cluster), rpcClient)
+	s.Nil(err)
+	defer client.Close()
+	_, err = client.Get(ctx, []byte("key"))
+	s.Nil(err)
+	s.Equal(defaultGets+1, sampleCount(metrics.DefaultRawkvMetrics.CmdHistogramWithGet))
+
+	// The metrics conflicting with the registered ones fail the client.
+	registry = prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "tikv_client_go_rawkv_cmd_seconds", Help: "conflict"}))
+	_, err = NewClientWithRPC(ctx, mocktikv.NewPDClient(s.cluster), rpcClient, WithMetricsRegisterer(registry))
+	s.NotNil(err)
+	// The labeled metrics are never registered with the default registerer.
+	_, err = NewClientWithRPC(ctx, mocktikv.NewPDClient(s.cluster), rpcClient, WithConstLabels(prometheus.Labels{"cluster": "a"}))
+	s.NotNil(err)
+
+	// The latency of checksums is observed to the command histogram.
+	s.Equal(clientA.rawkvMetrics.CmdHistogram.WithLabelValues("raw_checksum"), clientA.rawkvMetrics.CmdHistogramWithRawChecksum)
+}
+
+func (s *testRawkvSuite) TestWithRegionCache() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+	rpcClient := mocktikv.NewRPCClient(s.cluster, mvccStore, nil)
+	defer rpcClient.Close()
+
+	client1, err := NewClientWithRPC(context.Background(), mocktikv.NewPDClient(s.cluster), rpcClient)
+	s.Nil(err)
+	client2, err := NewClientWithRPC(context.Background(), mocktikv.NewPDClient(s.cluster), rpcClient, WithRegionCache(client1.RegionCache()))
+	s.Nil(err)
+	s.Same(client1.RegionCache(), client2.RegionCache())
+
+	s.Nil(client1.Put(context.Background(), []byte("key"), []byte("value")))
+	// client2 doesn't own the cache, which is still used by client1 after client2 is closed.
+	s.Nil(client2.Close())
+	value, err := client1.Get(context.Background(), []byte("key"))
+	s.Nil(err)
+	s.Equal([]byte("value"), value)
+	s.Nil(client1.Close())
+}
+
+func (s *testRawkvSuite) TestWithBackoffFn() {
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+	rpcClient := &fakeClient{
+		Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		cmd:    tikvrpc.CmdRawDeleteRange,
+		regionErrs: []*errorpb.Error{
+			{ServerIsBusy: &errorpb.ServerIsBusy{}},
+			{ServerIsBusy: &errorpb.ServerIsBusy{}},
+		},
+	}
+	defer rpcClient.Close()
+	var (
+		mu     sync.Mutex
+		sleeps []time.Duration
+	)
+	client, err := NewClientWithRPC(context.Background(), mocktikv.NewPDClient(s.cluster), rpcClient, WithBackoffFn(func(d time.Duration) {
+		mu.Lock()
+		sleeps = append(sleeps, d)
+		mu.Unlock()
+	}))
+	s.Nil(err)
+	defer client.Close()
+
+	// The backoffs of ServerIsBusy take seconds if they really sleep.
+	start := time.Now()
+	s.Nil(client.DeleteRange(context.Background(), []byte("a"), []byte("z")))
+	s.Less(time.Since(start), time.Second)
+	s.Len(rpcClient.reqs, 3)
+	s.Len(sleeps, 2)
+	for i, d := range sleeps {
+		// EqualJitter sleeps at least half of the exponential backoff, which starts at 2s.
+		s.GreaterOrEqual(d, time.Second<<i)
+		s.Less(d, 2*time.Second<<i)
+	}
+}
+
+// keyspacePD serves the keyspaces of a map.
+type keyspacePD struct {
+	pd.Client
+	keyspaces map[string]*keyspacepb.KeyspaceMeta
+}
+
+func (c *keyspacePD) LoadKeyspace(ctx context.Context, name string) (*keyspacepb.KeyspaceMeta, error) {
+	return c.keyspaces[name], nil
+}
+
+func (s *testRawkvSuite) TestWithKeyspace() {
+	pdCli := &keyspacePD{
+		Client: mocktikv.NewPDClient(s.cluster),
+		keyspaces: map[string]*keyspacepb.KeyspaceMeta{
+			"ks1":      {Id: 0x0102, Name: "ks1"},
+			"disabled": {Id: 3, Name: "disabled", State: keyspacepb.KeyspaceState_DISABLED},
+		},
+	}
+	mvccStore := mocktikv.MustNewMVCCStore()
+	defer mvccStore.Close()
+	// The keys are recorded as they are encoded by client.RPCClient.
+	var keys [][]byte
+	rpcClient := &fakeClient{
+		Client: mocktikv.NewRPCClient(s.cluster, mvccStore, nil),
+		send: func(ctx context.Context, addr string, req *tikvrpc.Request, next func() (*tikvrpc.Response, error)) (*tikvrpc.Response, error) {
+			if req.Type == tikvrpc.CmdRawPut {
+				encoded, err := client.EncodeRequest(req)
+				if err != nil {
+					return nil, err
+				}
+				keys = append(keys, encoded.RawPut().Key)
+			}
+			return next()
+		},
+	}
+	defer rpcClient.Close()
+
+	_, err := NewClientWithRPC(context.Background(), pdCli, rpcClient, WithKeyspace("ks1"))
+	s.NotNil(err)
+	_, err = NewClientWithRPC(context.Background(), pdCli, rpcClient, WithAPIVersion(kvrpcpb.APIVersion_V2), WithKeyspace("none"))
+	s.ErrorIs(err, ErrKeyspaceNotFound)
+	_, err = NewClientWithRPC(context.Background(), pdCli, rpcClient, WithAPIVersion(kvrpcpb.APIVersion_V2), WithKeyspace("disabled"))
+	s.ErrorIs(err, ErrKeyspaceNotEnabled)
+
+	client, err := NewClientWithRPC(context.Background(), pdCli, rpcClient, WithAPIVersion(kvrpcpb.APIVersion_V2), WithKeyspace("ks1"))
+	s.Nil(err)
+	defer client.Close()
+	s.Equal(uint32(0x0102), client.KeyspaceID())
+	s.Nil(client.Put(context.Background(), []byte("key"), []byte("value")))
+	s.Equal([][]byte{{'r', 0, 1, 2, 'k', 'e', 'y'}}, keys)
+}
+
+func (s *testRawkvSuite) TestWithPrefix() {
+	ctx := context.Background()
+	rpcClient := mocktikv.NewRPCClient(s.cluster, s.mvccStore, nil)
+	client, err := NewClientWithRPC(ctx, mocktikv.NewPDClient(s.cluster), rpcClient)
+	s.Nil(err)
+	defer client.Close()
+	client.SetAtomicForCAS(true)
+	b := func(keys ...string) [][]byte {
+		bs := make([][]byte, len(keys))
+		for i, key := range keys {
+			bs[i] = []byte(key)
+		}
+		return bs
+	}
+
+	s.Nil(client.BatchPut(ctx, b("a", "p", "p0", "q"), b("1", "2", "3", "4")))
+	p := client.WithPrefix([]byte("p/"))
+	s.Nil(p.BatchPut(ctx, b("a", "b", "c"), b("5", "6", "7")))
+	value, err := client.Get(ctx, []byte("p/a"))
+	s.Nil(err)
+	s.Equal([]byte("5"), value)
+
+	keys, values, err := p.Scan(ctx, nil, nil, 10)
+	s.Nil(err)
+	s.Equal(b("a", "b", "c"), keys)
+	s.Equal(b("5", "6", "7"), values)
+	keys, err = p.ReverseScanKeys(ctx, nil, []byte("b"), 10)
+	s.Nil(err)
+	s.Equal(b("c", "b"), keys)
+	pairs, err := p.BatchGetPairs(ctx, b("c", "x"))
+	s.Nil(err)
+	s.Equal([]KvPair{{Key: []byte("c"), Value: []byte("7")}}, pairs)
+
+	pairs, cursor, err := p.ScanPage(ctx, nil, nil, 2)
+	s.Nil(err)
+	s.Len(pairs, 2)
+	startKey, endKey := cursor.Range()
+	s.Equal([]byte("c"), startKey)
+	s.Empty(endKey)
+	pairs, cursor, err = p.ScanNextPage(ctx, cursor, 2)
+	s.Nil(err)
+	s.Equal([]KvPair{{Key: []byte("c"), Value: []byte("7")}}, pairs)
+	s.Nil(cursor)
+	it, err := p.ReverseIter(ctx, nil, nil, 1)
+	s.Nil(err)
+	keys = nil
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	s.Nil(it.Error())
+	s.Equal(b("c", "b", "a"), keys)
+
+	_, swapped, err := p.CompareAndSwap(ctx, []byte("a"), []byte("5"), []byte("8"))
+	s.Nil(err)
+	s.True(swapped)
+	result, err := p.DeleteRangeWithDetail(ctx, []byte("b"), nil)
+	s.Nil(err)
+	s.Equal([]DeletedRange{{RegionID: s.region1, StartKey: []byte("b")}}, result.Ranges)
+	// An empty end key is the end of the prefix, so the keys after the prefix are kept.
+	s.Nil(p.DeleteRange(ctx, nil, nil))
+	keys, values, err = client.Scan(ctx, nil, nil, 10)
+	s.Nil(err)
+	s.Equal(b("a", "p", "p0", "q"), keys)
+	s.Equal(b("1", "2", "3", "4"), values)
+}
+
+func (s *testRawkvSuite) TestReloadSecurity() {
+	client, err := NewClientWithPD(context.Background(), mocktikv.NewPDClient(s.cluster), config.Security{})
+	s.Nil(err)
+	defer client.Close()
+	s.NotNil(client.ReloadSecurity(config.Security{ClusterSSLCA: "/nonexistent/ca.pem"}))
+	s.Nil(client.ReloadSecurity(config.Security{}))
+
+	// The PD client created with PEM blocks can't be reloaded, so nothing is.
+	client.pdSecurityBytes = true
+	s.NotNil(client.ReloadSecurity(config.Security{}))
+
+	rpcClient := mocktikv.NewRPCClient(s.cluster, s.mvccStore, nil)
+	client, err = NewClientWithRPC(context.Background(), mocktikv.NewPDClient(s.cluster), rpcClient)
+	s.Nil(err)
+	defer client.Close()
+	s.NotNil(client.ReloadSecurity(config.Security{}))
 }
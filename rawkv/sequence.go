@@ -0,0 +1,121 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rawkv
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrSequenceExhausted is returned by Sequence.Next if the IDs up to math.MaxUint64 are all reserved.
+var ErrSequenceExhausted = errors.New("the sequence is exhausted")
+
+// Sequence allocates IDs that are unique across the processes sharing its key. The key stores a counter, which is
+// the next ID not reserved yet in 8 bytes big endian. A Sequence reserves a batch of IDs at a time by increasing the
+// counter with CAS, and issues them locally, so the IDs of a Sequence increase, but the IDs of different Sequences
+// interleave. The IDs reserved but not issued, e.g. when the process exits, are never issued, which leaves gaps. It's
+// safe for concurrent use.
+type Sequence struct {
+	client    *Client
+	key       []byte
+	batchSize uint64
+	base      uint64
+
+	mu sync.Mutex
+	// [next, limit) are the IDs reserved but not issued yet.
+	next  uint64
+	limit uint64
+}
+
+// SequenceOption is an option of NewSequence.
+type SequenceOption func(*Sequence)
+
+// WithSequenceBase sets the first ID of the sequence if its key doesn't exist, 1 by default.
+func WithSequenceBase(base uint64) SequenceOption {
+	return func(s *Sequence) {
+		s.base = base
+	}
+}
+
+// NewSequence creates a sequence stored at key, which reserves batchSize IDs at a time. The client must be in the
+// atomic mode, see SetAtomicForCAS.
+func NewSequence(client *Client, key []byte, batchSize uint64, options ...SequenceOption) (*Sequence, error) {
+	if !client.atomic {
+		return nil, errors.WithStack(ErrAtomicModeRequired)
+	}
+	if len(key) == 0 {
+		return nil, errors.New("the key of the sequence is empty")
+	}
+	if batchSize == 0 {
+		return nil, errors.New("the batch size of the sequence is 0")
+	}
+	s := &Sequence{client: client, key: key, batchSize: batchSize, base: 1}
+	for _, option := range options {
+		option(s)
+	}
+	return s, nil
+}
+
+// Next returns the next ID, and reserves a new batch of IDs if the ones reserved are all issued.
+func (s *Sequence) Next(ctx context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next >= s.limit {
+		if err := s.reserve(ctx); err != nil {
+			return 0, err
+		}
+	}
+	id := s.next
+	s.next++
+	return id, nil
+}
+
+// HighWaterMark returns the end of the IDs reserved by the sequence, i.e. the IDs it has issued and will issue
+// before reserving again are below it. It's 0 before the first reservation.
+func (s *Sequence) HighWaterMark() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limit
+}
+
+// reserve increases the counter by the batch size with CAS, and takes the IDs in between. The CAS retries back off
+// on conflicts like Incr.
+func (s *Sequence) reserve(ctx context.Context) error {
+	limit, err := s.client.casUpdate(ctx, s.key, func(current []byte) ([]byte, error) {
+		start := s.base
+		if current != nil {
+			if len(current) != 8 {
+				return nil, errors.Errorf("invalid counter %q of sequence %q", current, s.key)
+			}
+			start = binary.BigEndian.Uint64(current)
+		}
+		if start > math.MaxUint64-s.batchSize {
+			return nil, errors.WithStack(ErrSequenceExhausted)
+		}
+		limit := make([]byte, 8)
+		binary.BigEndian.PutUint64(limit, start+s.batchSize)
+		return limit, nil
+	}, s.client.getRawKVOptions())
+	if err != nil {
+		return err
+	}
+	s.limit = binary.BigEndian.Uint64(limit)
+	s.next = s.limit - s.batchSize
+	return nil
+}
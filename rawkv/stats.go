@@ -0,0 +1,212 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rawkv
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	tikverr "github.com/tikv/client-go/v2/error"
+	"github.com/tikv/client-go/v2/tikvrpc"
+)
+
+// ClientStats is a snapshot of the cumulative counters of a client, which is cheap enough to be taken by a debug
+// endpoint on every request.
+type ClientStats struct {
+	// Requests are the numbers of the requests sent to the regions, keyed by the commands, e.g. "RawGet".
+	Requests map[string]int64
+	// Errors are the numbers of the failed requests, keyed by the categories of the failures:
+	//   - "canceled": the context of the call is canceled or its deadline is exceeded.
+	//   - "store_unavailable": the store is unavailable according to the breaker set by WithStoreBreaker.
+	//   - "send": the request fails to be sent, or the rate limiters fail to wait.
+	//   - "region": TiKV responds with a region error.
+	//   - "server": TiKV responds with an error message, see ServerError.
+	Errors map[string]int64
+	// Retries is the number of the retries on region errors.
+	Retries int64
+	// BytesSent and BytesReceived are the total sizes of the requests and the responses.
+	BytesSent     int64
+	BytesReceived int64
+	// InFlight is the number of the requests being sent, which is a gauge and isn't reset.
+	InFlight int64
+	// Batches is the number of the sub-batches the batch calls are split into.
+	Batches int64
+	// Regroupings is the number of times the batch calls group the keys of the batches that meet region errors by
+	// the refreshed regions again.
+	Regroupings int64
+}
+
+// statsCmds are the commands counted by the client stats.
+var statsCmds = [...]tikvrpc.CmdType{
+	tikvrpc.CmdRawGet,
+	tikvrpc.CmdRawBatchGet,
+	tikvrpc.CmdRawPut,
+	tikvrpc.CmdRawBatchPut,
+	tikvrpc.CmdRawDelete,
+	tikvrpc.CmdRawBatchDelete,
+	tikvrpc.CmdRawDeleteRange,
+	tikvrpc.CmdRawScan,
+	tikvrpc.CmdRawBatchScan,
+	tikvrpc.CmdGetKeyTTL,
+	tikvrpc.CmdRawCompareAndSwap,
+	tikvrpc.CmdRawChecksum,
+}
+
+type errorCategory int
+
+const (
+	errorCanceled errorCategory = iota
+	errorStoreUnavailable
+	errorSend
+	errorRegion
+	errorServer
+	errorCategoryCount
+)
+
+var errorCategoryNames = [errorCategoryCount]string{
+	errorCanceled:         "canceled",
+	errorStoreUnavailable: "store_unavailable",
+	errorSend:             "send",
+	errorRegion:           "region",
+	errorServer:           "server",
+}
+
+// clientStats maintains the counters of ClientStats with atomics. All its methods do nothing if it's nil.
+type clientStats struct {
+	requests [len(statsCmds)]int64
+	errors   [errorCategoryCount]int64
+
+	retries       int64
+	bytesSent     int64
+	bytesReceived int64
+	inFlight      int64
+	batches       int64
+	regroupings   int64
+}
+
+func newClientStats() *clientStats {
+	return &clientStats{}
+}
+
+// onSend counts req, which is being sent.
+func (s *clientStats) onSend(req *tikvrpc.Request) {
+	if s == nil {
+		return
+	}
+	for i, cmd := range statsCmds {
+		if cmd == req.Type {
+			atomic.AddInt64(&s.requests[i], 1)
+			break
+		}
+	}
+	atomic.AddInt64(&s.inFlight, 1)
+	if m, ok := req.Req.(interface{ Size() int }); ok {
+		atomic.AddInt64(&s.bytesSent, int64(m.Size()))
+	}
+}
+
+// onResponse counts the response of a request counted by onSend, or the error of sending it.
+func (s *clientStats) onResponse(resp *tikvrpc.Response, err error) {
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&s.inFlight, -1)
+	if err != nil {
+		atomic.AddInt64(&s.errors[sendErrorCategory(err)], 1)
+		return
+	}
+	if resp == nil {
+		return
+	}
+	if m, ok := resp.Resp.(interface{ Size() int }); ok {
+		atomic.AddInt64(&s.bytesReceived, int64(m.Size()))
+	}
+	if regionErr, _ := resp.GetRegionError(); regionErr != nil {
+		atomic.AddInt64(&s.errors[errorRegion], 1)
+	} else if m, ok := resp.Resp.(interface{ GetError() string }); ok && m.GetError() != "" {
+		atomic.AddInt64(&s.errors[errorServer], 1)
+	}
+}
+
+func sendErrorCategory(err error) errorCategory {
+	var unavailableErr *tikverr.ErrStoreUnavailable
+	switch cause := errors.Cause(err); {
+	case cause == context.Canceled || cause == context.DeadlineExceeded:
+		return errorCanceled
+	case errors.As(err, &unavailableErr):
+		return errorStoreUnavailable
+	}
+	return errorSend
+}
+
+func (s *clientStats) onRetry() {
+	if s != nil {
+		atomic.AddInt64(&s.retries, 1)
+	}
+}
+
+func (s *clientStats) onBatch() {
+	if s != nil {
+		atomic.AddInt64(&s.batches, 1)
+	}
+}
+
+func (s *clientStats) onRegroup() {
+	if s != nil {
+		atomic.AddInt64(&s.regroupings, 1)
+	}
+}
+
+// get returns the snapshot of the counters, and resets them if reset is set.
+func (s *clientStats) get(reset bool) ClientStats {
+	stats := ClientStats{
+		Requests: make(map[string]int64),
+		Errors:   make(map[string]int64),
+	}
+	if s == nil {
+		return stats
+	}
+	load := func(n *int64) int64 {
+		if reset {
+			return atomic.SwapInt64(n, 0)
+		}
+		return atomic.LoadInt64(n)
+	}
+	for i, cmd := range statsCmds {
+		if n := load(&s.requests[i]); n > 0 {
+			stats.Requests[cmd.String()] = n
+		}
+	}
+	for i, name := range errorCategoryNames {
+		if n := load(&s.errors[i]); n > 0 {
+			stats.Errors[name] = n
+		}
+	}
+	stats.Retries = load(&s.retries)
+	stats.BytesSent = load(&s.bytesSent)
+	stats.BytesReceived = load(&s.bytesReceived)
+	stats.InFlight = atomic.LoadInt64(&s.inFlight)
+	stats.Batches = load(&s.batches)
+	stats.Regroupings = load(&s.regroupings)
+	return stats
+}
+
+// Stats returns a snapshot of the cumulative counters of the client. If reset is set, the counters are reset to zero
+// at the same time, so that no request is lost between two snapshots. It's safe to call concurrently with the calls
+// of the client. The requests sent by CompactRange, Ping and CheckStores aren't counted.
+func (c *Client) Stats(reset bool) ClientStats {
+	return c.stats.get(reset)
+}
@@ -0,0 +1,327 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rawkv
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultVerifyShards is the default number of the shards VerifyRange splits the range into.
+	defaultVerifyShards = 16
+	// verifyLeafKeys is the max number of the pairs of a side that VerifyRange compares one by one, instead of
+	// bisecting the range further.
+	verifyLeafKeys = 1024
+)
+
+// VerifyShard is a subrange [StartKey, EndKey) of the range verified by VerifyRange, with its checksums in both
+// clusters. An empty EndKey means unbounded.
+type VerifyShard struct {
+	StartKey []byte
+	EndKey   []byte
+	A        RawChecksum
+	B        RawChecksum
+}
+
+// VerifyReport is the result of VerifyRange.
+type VerifyReport struct {
+	// Matched and Unmatched are the shards whose checksums match or not, in key order.
+	Matched   []VerifyShard
+	Unmatched []VerifyShard
+	// A and B are the checksums of the whole range in the clusters, combined from the shards.
+	A RawChecksum
+	B RawChecksum
+	// DivergentKeys are the examples of the keys that exist in only one of the clusters or have different values,
+	// in key order, see WithVerifyExamples.
+	DivergentKeys [][]byte
+}
+
+// Consistent tells whether the range is the same in both clusters.
+func (r *VerifyReport) Consistent() bool {
+	return len(r.Unmatched) == 0
+}
+
+type verifyOptions struct {
+	shards      int
+	concurrency int
+	examples    int
+	rawOptions  []RawOption
+}
+
+// VerifyOption is an option of VerifyRange.
+type VerifyOption func(*verifyOptions)
+
+// WithVerifyShards sets the number of the shards the range is split into, 16 by default. The more shards there
+// are, the smaller range a mismatch is localized to.
+func WithVerifyShards(n int) VerifyOption {
+	return func(o *verifyOptions) {
+		o.shards = n
+	}
+}
+
+// WithVerifyConcurrency sets the max number of the shards checksummed at the same time, 8 by default.
+func WithVerifyConcurrency(n int) VerifyOption {
+	return func(o *verifyOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithVerifyExamples drills down into the unmatched shards to report up to n divergent keys. An unmatched range is
+// bisected, and the halves are checksummed again, until it's small enough to be scanned and compared pair by pair.
+func WithVerifyExamples(n int) VerifyOption {
+	return func(o *verifyOptions) {
+		o.examples = n
+	}
+}
+
+// WithVerifyRawOptions sets the RawOptions of the checksums and the scans, e.g. SetColumnFamily.
+func WithVerifyRawOptions(options ...RawOption) VerifyOption {
+	return func(o *verifyOptions) {
+		o.rawOptions = append(o.rawOptions, options...)
+	}
+}
+
+// VerifyRange compares the pairs in range [startKey, endKey) of two clusters by the checksums of TiKV, e.g. after a
+// migration by CopyRange. If endKey is empty, it means unbounded. The range between its first and last keys in both
+// clusters is split into shards evenly in the key space, whose checksums are compared, so that a mismatch can be
+// localized. The pairs written during the verification or expiring may be reported as divergent. It returns an
+// error only if it fails to checksum or scan the clusters; a mismatch is told by the report.
+func VerifyRange(ctx context.Context, a, b *Client, startKey, endKey []byte, options ...VerifyOption) (_ VerifyReport, err error) {
+	ctx, span := a.startSpan(ctx, "rawkv.VerifyRange")
+	defer func() { endSpan(span, err) }()
+	o := verifyOptions{shards: defaultVerifyShards, concurrency: defaultRangeConcurrency}
+	for _, option := range options {
+		option(&o)
+	}
+	if o.shards <= 0 {
+		return VerifyReport{}, errors.Errorf("invalid verify shards %d", o.shards)
+	}
+	if o.concurrency <= 0 {
+		return VerifyReport{}, errors.Errorf("invalid verify concurrency %d", o.concurrency)
+	}
+
+	lastKey, err := verifyLastKey(ctx, a, b, startKey, endKey, o.rawOptions)
+	if err != nil {
+		return VerifyReport{}, err
+	}
+	// There are no keys after lastKey, so the range can be bounded by afterLast.
+	afterLast := append(append([]byte{}, lastKey...), 0)
+	ranges := []scanRange{{startKey: startKey, endKey: endKey}}
+	if lastKey != nil {
+		firstKey, err := verifyFirstKey(ctx, a, b, startKey, endKey, o.rawOptions)
+		if err != nil {
+			return VerifyReport{}, err
+		}
+		ranges = ranges[:0]
+		prev := startKey
+		for _, key := range splitKeyRange(firstKey, afterLast, o.shards) {
+			ranges = append(ranges, scanRange{idx: len(ranges), startKey: prev, endKey: key})
+			prev = key
+		}
+		ranges = append(ranges, scanRange{idx: len(ranges), startKey: prev, endKey: endKey})
+	}
+
+	shards := make([]VerifyShard, len(ranges))
+	err = runOnRanges(ctx, ranges, o.concurrency, nil, func(ctx context.Context, r scanRange) error {
+		var err error
+		shards[r.idx], err = verifyChecksum(ctx, a, b, r.startKey, r.endKey, o.rawOptions)
+		return err
+	})
+	if err != nil {
+		return VerifyReport{}, err
+	}
+
+	var report VerifyReport
+	for _, shard := range shards {
+		report.A = combineChecksum(report.A, shard.A)
+		report.B = combineChecksum(report.B, shard.B)
+		if shard.A == shard.B {
+			report.Matched = append(report.Matched, shard)
+			continue
+		}
+		report.Unmatched = append(report.Unmatched, shard)
+		if len(report.DivergentKeys) < o.examples {
+			if len(shard.EndKey) == 0 {
+				shard.EndKey = afterLast
+			}
+			keys, err := drillDown(ctx, a, b, shard, o.examples-len(report.DivergentKeys), o.rawOptions)
+			report.DivergentKeys = append(report.DivergentKeys, keys...)
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
+
+// verifyFirstKey returns the first key in range [startKey, endKey) of a and b.
+func verifyFirstKey(ctx context.Context, a, b *Client, startKey, endKey []byte, options []RawOption) ([]byte, error) {
+	var first []byte
+	for _, c := range []*Client{a, b} {
+		keys, err := c.ScanKeys(ctx, startKey, endKey, 1, options...)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) > 0 && (first == nil || bytes.Compare(keys[0], first) < 0) {
+			first = keys[0]
+		}
+	}
+	return first, nil
+}
+
+// verifyLastKey returns the last key in range [startKey, endKey) of a and b, or nil if the range is empty in both.
+func verifyLastKey(ctx context.Context, a, b *Client, startKey, endKey []byte, options []RawOption) ([]byte, error) {
+	var last []byte
+	for _, c := range []*Client{a, b} {
+		keys, err := c.ReverseScanKeys(ctx, endKey, startKey, 1, options...)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) > 0 && bytes.Compare(keys[0], last) > 0 {
+			last = keys[0]
+		}
+	}
+	return last, nil
+}
+
+// verifyChecksum checksums range [startKey, endKey) of a and b.
+func verifyChecksum(ctx context.Context, a, b *Client, startKey, endKey []byte, options []RawOption) (VerifyShard, error) {
+	shard := VerifyShard{StartKey: startKey, EndKey: endKey}
+	var err error
+	if shard.A, err = a.Checksum(ctx, startKey, endKey, options...); err != nil {
+		return shard, err
+	}
+	shard.B, err = b.Checksum(ctx, startKey, endKey, options...)
+	return shard, err
+}
+
+// drillDown returns up to limit keys that differ in the unmatched shard, whose EndKey isn't empty. The shard is
+// bisected until it's small enough to be compared pair by pair, or it can't be split.
+func drillDown(ctx context.Context, a, b *Client, shard VerifyShard, limit int, options []RawOption) ([][]byte, error) {
+	var mid [][]byte
+	if shard.A.TotalKvs > verifyLeafKeys || shard.B.TotalKvs > verifyLeafKeys {
+		mid = splitKeyRange(shard.StartKey, shard.EndKey, 2)
+	}
+	if len(mid) == 0 {
+		return diffRange(ctx, a, b, shard.StartKey, shard.EndKey, limit, options)
+	}
+	var keys [][]byte
+	for _, r := range [][2][]byte{{shard.StartKey, mid[0]}, {mid[0], shard.EndKey}} {
+		half, err := verifyChecksum(ctx, a, b, r[0], r[1], options)
+		if err != nil {
+			return keys, err
+		}
+		if half.A == half.B {
+			continue
+		}
+		halfKeys, err := drillDown(ctx, a, b, half, limit-len(keys), options)
+		keys = append(keys, halfKeys...)
+		if err != nil || len(keys) >= limit {
+			return keys, err
+		}
+	}
+	return keys, nil
+}
+
+// diffRange scans range [startKey, endKey) of a and b side by side, and returns up to limit keys that exist in only
+// one of them or have different values.
+func diffRange(ctx context.Context, a, b *Client, startKey, endKey []byte, limit int, options []RawOption) ([][]byte, error) {
+	itA, err := a.Iter(ctx, startKey, endKey, 0, options...)
+	if err != nil {
+		return nil, err
+	}
+	defer itA.Close()
+	itB, err := b.Iter(ctx, startKey, endKey, 0, options...)
+	if err != nil {
+		return nil, err
+	}
+	defer itB.Close()
+
+	var keys [][]byte
+	okA, okB := itA.Next(), itB.Next()
+	for (okA || okB) && len(keys) < limit {
+		var cmp int
+		switch {
+		case !okB:
+			cmp = -1
+		case !okA:
+			cmp = 1
+		default:
+			cmp = bytes.Compare(itA.Key(), itB.Key())
+		}
+		switch {
+		case cmp < 0:
+			keys = append(keys, itA.Key())
+			okA = itA.Next()
+		case cmp > 0:
+			keys = append(keys, itB.Key())
+			okB = itB.Next()
+		default:
+			if !bytes.Equal(itA.Value(), itB.Value()) {
+				keys = append(keys, itA.Key())
+			}
+			okA, okB = itA.Next(), itB.Next()
+		}
+	}
+	if err := itA.Error(); err != nil {
+		return keys, err
+	}
+	return keys, itB.Error()
+}
+
+// splitKeyRange returns the keys that split range [startKey, endKey) into n parts evenly in the key space, i.e. the
+// keys are taken as fractions. endKey must not be empty. The keys too close to be told apart are merged, so there
+// may be fewer parts.
+func splitKeyRange(startKey, endKey []byte, n int) [][]byte {
+	// One more byte than the keys for the precision of the tiny ranges.
+	width := len(startKey)
+	if len(endKey) > width {
+		width = len(endKey)
+	}
+	width++
+	pad := func(key []byte) *big.Int {
+		padded := make([]byte, width)
+		copy(padded, key)
+		return new(big.Int).SetBytes(padded)
+	}
+	lo, hi := pad(startKey), pad(endKey)
+	diff := new(big.Int).Sub(hi, lo)
+	var keys [][]byte
+	prev := startKey
+	for i := 1; i < n; i++ {
+		k := new(big.Int).Mul(diff, big.NewInt(int64(i)))
+		k.Div(k, big.NewInt(int64(n)))
+		k.Add(k, lo)
+		// The trailing zeros are trimmed for the readability, which keeps the order of the keys.
+		key := bytes.TrimRight(k.FillBytes(make([]byte, width)), "\x00")
+		if bytes.Compare(key, prev) > 0 && bytes.Compare(key, endKey) < 0 {
+			keys = append(keys, key)
+			prev = key
+		}
+	}
+	return keys
+}
+
+func combineChecksum(a, b RawChecksum) RawChecksum {
+	return RawChecksum{
+		Crc64Xor:   a.Crc64Xor ^ b.Crc64Xor,
+		TotalKvs:   a.TotalKvs + b.TotalKvs,
+		TotalBytes: a.TotalBytes + b.TotalBytes,
+	}
+}
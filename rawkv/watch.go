@@ -0,0 +1,304 @@
+// Copyright 2022 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rawkv
+
+import (
+	"context"
+	"crypto/sha256"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// watchChunkKeys is the average number of the keys of the chunks WatchPrefix checksums, see watchChunks.
+const watchChunkKeys = 64
+
+// WatchEventType is the type of a WatchEvent.
+type WatchEventType int
+
+const (
+	// WatchCreated means the key is written while it doesn't exist.
+	WatchCreated WatchEventType = iota + 1
+	// WatchUpdated means the value of the key is changed.
+	WatchUpdated
+	// WatchDeleted means the key is deleted or expires.
+	WatchDeleted
+	// WatchError means a poll fails, and the watch goes on with the next poll.
+	WatchError
+)
+
+func (t WatchEventType) String() string {
+	switch t {
+	case WatchCreated:
+		return "created"
+	case WatchUpdated:
+		return "updated"
+	case WatchDeleted:
+		return "deleted"
+	case WatchError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// WatchEvent is a change of a key found by Watch or WatchPrefix. OldValue is nil if the key is created, and
+// NewValue is nil if it's deleted. Err is only set if Type is WatchError, and the other fields are empty then.
+type WatchEvent struct {
+	Type     WatchEventType
+	Key      []byte
+	OldValue []byte
+	NewValue []byte
+	Err      error
+}
+
+type watchOptions struct {
+	initial    bool
+	rawOptions []RawOption
+}
+
+// WatchOption is an option of Watch and WatchPrefix.
+type WatchOption func(*watchOptions)
+
+// WithWatchInitialEvents reports the keys that exist when the watch starts as WatchCreated, before the changes.
+// Otherwise only the changes after the watch starts are reported.
+func WithWatchInitialEvents() WatchOption {
+	return func(o *watchOptions) {
+		o.initial = true
+	}
+}
+
+// WithWatchRawOptions sets the RawOptions of the polls, e.g. SetColumnFamily.
+func WithWatchRawOptions(options ...RawOption) WatchOption {
+	return func(o *watchOptions) {
+		o.rawOptions = append(o.rawOptions, options...)
+	}
+}
+
+// watchValue is a value seen by a watch. The values are compared by their digests to tell the no-op writes.
+type watchValue struct {
+	value  []byte
+	digest [sha256.Size]byte
+}
+
+// watcher polls the keys of a watch, and sends the changes since the last poll.
+type watcher struct {
+	interval time.Duration
+	options  watchOptions
+	// poll reads the keys watched, and calls found with every key that exists and its value, and returns the keys
+	// whose values are not read as they are known to be unchanged.
+	poll func(ctx context.Context, found func(key, value []byte)) (map[string]struct{}, error)
+
+	values map[string]watchValue
+	ch     chan WatchEvent
+}
+
+// Watch polls key every interval, with a jitter, and sends an event to the returned channel whenever its value
+// changes. TiKV doesn't notify the changes, so the changes between two polls are merged, e.g. a key updated twice
+// is reported once, and a key created and deleted is missed. Writing the same value isn't a change. The key is read
+// once before Watch returns, and the watch is stopped and the channel is closed when ctx is done. A failed poll is
+// reported by a WatchError event.
+func (c *Client) Watch(ctx context.Context, key []byte, interval time.Duration, options ...WatchOption) (_ <-chan WatchEvent, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.Watch")
+	defer func() { endSpan(span, err) }()
+	w, err := c.newWatcher(interval, options)
+	if err != nil {
+		return nil, err
+	}
+	w.poll = func(ctx context.Context, found func(key, value []byte)) (map[string]struct{}, error) {
+		value, err := c.Get(ctx, key, w.options.rawOptions...)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			found(key, value)
+		}
+		return nil, nil
+	}
+	return w.start(ctx)
+}
+
+// WatchPrefix works like Watch on all the keys with prefix. A poll scans the keys only, and checksums them in
+// chunks, so only the values of the chunks that change since the last poll are read. The events of a poll are sent
+// in key order.
+func (c *Client) WatchPrefix(ctx context.Context, prefix []byte, interval time.Duration, options ...WatchOption) (_ <-chan WatchEvent, err error) {
+	ctx, span := c.startSpan(ctx, "rawkv.WatchPrefix")
+	defer func() { endSpan(span, err) }()
+	w, err := c.newWatcher(interval, options)
+	if err != nil {
+		return nil, err
+	}
+	// checksums are the checksums of the chunks of the last poll, by their first and last keys.
+	var checksums map[[2]string]RawChecksum
+	w.poll = func(ctx context.Context, found func(key, value []byte)) (map[string]struct{}, error) {
+		keys, err := c.scanAllKeys(ctx, prefix, prefixEndKey(prefix), w.options.rawOptions)
+		if err != nil {
+			return nil, err
+		}
+		newChecksums := make(map[[2]string]RawChecksum)
+		unchanged := make(map[string]struct{})
+		for _, chunk := range watchChunks(keys) {
+			lastKey := chunk[len(chunk)-1]
+			startKey, endKey := chunk[0], append(append([]byte{}, lastKey...), 0)
+			// The checksum is taken before the values are read, so a change between them is caught by the next poll.
+			checksum, err := c.Checksum(ctx, startKey, endKey, w.options.rawOptions...)
+			if err != nil {
+				return nil, err
+			}
+			rangeKey := [2]string{string(startKey), string(lastKey)}
+			newChecksums[rangeKey] = checksum
+			if last, ok := checksums[rangeKey]; ok && last == checksum {
+				for _, key := range chunk {
+					unchanged[string(key)] = struct{}{}
+				}
+				continue
+			}
+			values, err := c.BatchGet(ctx, chunk, w.options.rawOptions...)
+			if err != nil {
+				return nil, err
+			}
+			for i, value := range values {
+				// The key may be deleted after the scan.
+				if value != nil {
+					found(chunk[i], value)
+				}
+			}
+		}
+		checksums = newChecksums
+		return unchanged, nil
+	}
+	return w.start(ctx)
+}
+
+func (c *Client) newWatcher(interval time.Duration, options []WatchOption) (*watcher, error) {
+	if interval <= 0 {
+		return nil, errors.Errorf("invalid watch interval %v", interval)
+	}
+	w := &watcher{interval: interval, values: make(map[string]watchValue), ch: make(chan WatchEvent)}
+	for _, option := range options {
+		option(&w.options)
+	}
+	return w, nil
+}
+
+// start reads the keys for the first time, and starts polling in the background.
+func (w *watcher) start(ctx context.Context) (<-chan WatchEvent, error) {
+	events, err := w.diff(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !w.options.initial {
+		events = nil
+	}
+	go w.run(ctx, events)
+	return w.ch, nil
+}
+
+func (w *watcher) run(ctx context.Context, events []WatchEvent) {
+	defer close(w.ch)
+	for {
+		for _, event := range events {
+			select {
+			case w.ch <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+		// The polls of the watchers started together are spread by a jitter of up to a quarter of the interval.
+		jitter := time.Duration(rand.Int63n(int64(w.interval)/2+1)) - w.interval/4
+		select {
+		case <-time.After(w.interval + jitter):
+		case <-ctx.Done():
+			return
+		}
+		var err error
+		if events, err = w.diff(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			events = []WatchEvent{{Type: WatchError, Err: err}}
+		}
+	}
+}
+
+// diff polls the keys, and returns the changes since the last poll in key order.
+func (w *watcher) diff(ctx context.Context) ([]WatchEvent, error) {
+	var events []WatchEvent
+	values := make(map[string]watchValue, len(w.values))
+	unchanged, err := w.poll(ctx, func(key, value []byte) {
+		cur := watchValue{value: value, digest: sha256.Sum256(value)}
+		values[string(key)] = cur
+		last, ok := w.values[string(key)]
+		switch {
+		case !ok:
+			events = append(events, WatchEvent{Type: WatchCreated, Key: key, NewValue: value})
+		case last.digest != cur.digest:
+			events = append(events, WatchEvent{Type: WatchUpdated, Key: key, OldValue: last.value, NewValue: value})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for key := range unchanged {
+		values[key] = w.values[key]
+	}
+	for key, last := range w.values {
+		if _, ok := values[key]; !ok {
+			events = append(events, WatchEvent{Type: WatchDeleted, Key: []byte(key), OldValue: last.value})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return string(events[i].Key) < string(events[j].Key)
+	})
+	w.values = values
+	return events, nil
+}
+
+// scanAllKeys returns all the keys in range [startKey, endKey) page by page.
+func (c *Client) scanAllKeys(ctx context.Context, startKey, endKey []byte, options []RawOption) ([][]byte, error) {
+	var keys [][]byte
+	limit := c.scanLimit()
+	for {
+		page, err := c.ScanKeys(ctx, startKey, endKey, limit, options...)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, page...)
+		if len(page) < limit {
+			return keys, nil
+		}
+		startKey = append(append([]byte{}, page[len(page)-1]...), 0)
+	}
+}
+
+// watchChunks splits the sorted keys into chunks of consecutive keys. A chunk ends after a key whose hash is a
+// multiple of watchChunkKeys, so the boundaries depend on the keys rather than their positions, and a key created
+// or deleted only changes the range of its own chunk.
+func watchChunks(keys [][]byte) [][][]byte {
+	var chunks [][][]byte
+	start := 0
+	for i, key := range keys {
+		h := fnv.New32a()
+		h.Write(key)
+		if h.Sum32()%watchChunkKeys == 0 || i == len(keys)-1 {
+			chunks = append(chunks, keys[start:i+1])
+			start = i + 1
+		}
+	}
+	return chunks
+}
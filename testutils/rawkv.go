@@ -0,0 +1,64 @@
+// Copyright 2021 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tikv/client-go/v2/internal/mockstore/mocktikv"
+	"github.com/tikv/client-go/v2/rawkv"
+)
+
+// NewRawKVClient creates a rawkv client on an in-process mock cluster with a single store, so that the examples
+// and tests of rawkv can run without TiKV. The cluster is split at splitKeys, and can be split further by
+// SplitRawRegion, after which the client finds the new regions by region errors like it does with TiKV.
+// The client and the mock cluster are closed by t.Cleanup.
+func NewRawKVClient(t testing.TB, splitKeys ...[]byte) (*rawkv.Client, *MockCluster) {
+	rpcClient, cluster, pdClient, err := mocktikv.NewTiKVAndPDClient("", nil)
+	if err != nil {
+		t.Fatalf("failed to create the mock cluster: %v", err)
+	}
+	mocktikv.BootstrapWithSingleStore(cluster)
+	for _, key := range splitKeys {
+		SplitRawRegion(cluster, key)
+	}
+	client, err := rawkv.NewClientWithRPC(context.Background(), pdClient, rpcClient)
+	if err != nil {
+		rpcClient.Close()
+		t.Fatalf("failed to create the rawkv client: %v", err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		rpcClient.Close()
+	})
+	return client, cluster
+}
+
+// SplitRawRegion splits the region containing key at key, which is a rawkv key rather than an MVCC-encoded one.
+// It returns the ID of the new region, which starts at key.
+func SplitRawRegion(cluster *MockCluster, key []byte) uint64 {
+	region, leader, _ := cluster.GetRegionByKey(key)
+	ids := cluster.AllocIDs(1 + len(region.GetPeers()))
+	peerIDs := ids[1:]
+	leaderPeerID := peerIDs[0]
+	for i, peer := range region.GetPeers() {
+		if peer.GetId() == leader.GetId() {
+			leaderPeerID = peerIDs[i]
+		}
+	}
+	cluster.SplitRaw(region.GetId(), ids[0], key, peerIDs, leaderPeerID)
+	return ids[0]
+}
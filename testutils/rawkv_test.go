@@ -0,0 +1,52 @@
+// Copyright 2021 TiKV Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRawKVClient(t *testing.T) {
+	ctx := context.Background()
+	client, cluster := NewRawKVClient(t, []byte("c"))
+	client.SetAtomicForCAS(true)
+
+	keys := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e")}
+	require.Nil(t, client.BatchPut(ctx, keys, keys))
+	// The client only learns the new region from the region error.
+	SplitRawRegion(cluster, []byte("e"))
+	region, _, _ := cluster.GetRegionByKey([]byte("e"))
+	require.Equal(t, []byte("e"), region.GetStartKey())
+
+	scanned, _, err := client.Scan(ctx, nil, nil, 10)
+	require.Nil(t, err)
+	require.Equal(t, keys, scanned)
+	value, err := client.Get(ctx, []byte("e"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("e"), value)
+	_, swapped, err := client.CompareAndSwap(ctx, []byte("d"), []byte("d"), []byte("x"))
+	require.Nil(t, err)
+	require.True(t, swapped)
+
+	result, err := client.DeleteRangeWithDetail(ctx, []byte("b"), []byte("e"))
+	require.Nil(t, err)
+	require.Equal(t, 2, result.Regions)
+	scanned, _, err = client.Scan(ctx, nil, nil, 10)
+	require.Nil(t, err)
+	require.Equal(t, [][]byte{[]byte("a"), []byte("e")}, scanned)
+}
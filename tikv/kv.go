@@ -200,6 +200,10 @@ func NewPDClient(pdAddrs []string) (pd.Client, error) {
 		CAPath:   cfg.Security.ClusterSSLCA,
 		CertPath: cfg.Security.ClusterSSLCert,
 		KeyPath:  cfg.Security.ClusterSSLKey,
+
+		SSLCABytes:   cfg.Security.ClusterSSLCABytes,
+		SSLCertBytes: cfg.Security.ClusterSSLCertBytes,
+		SSLKEYBytes:  cfg.Security.ClusterSSLKeyBytes,
 	},
 		pd.WithGRPCDialOptions(
 			grpc.WithKeepaliveParams(keepalive.ClientParameters{
@@ -588,6 +592,10 @@ func NewLockResolver(etcdAddrs []string, security config.Security, opts ...pd.Cl
 		CAPath:   security.ClusterSSLCA,
 		CertPath: security.ClusterSSLCert,
 		KeyPath:  security.ClusterSSLKey,
+
+		SSLCABytes:   security.ClusterSSLCABytes,
+		SSLCertBytes: security.ClusterSSLCertBytes,
+		SSLKEYBytes:  security.ClusterSSLKeyBytes,
 	}, opts...)
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -97,6 +97,9 @@ type CodecPDClientV2 = locate.CodecPDClientV2
 // NewCodecPDClientV2 is a constructor for CodecPDClientV2
 var NewCodecPDClientV2 = locate.NewCodecPDClientV2
 
+// NewCodecPDClientV2WithKeyspace is a constructor for CodecPDClientV2 of the keys of a keyspace.
+var NewCodecPDClientV2WithKeyspace = locate.NewCodecPDClientV2WithKeyspace
+
 // Mode represents the operation mode of a request, export client.Mode
 type Mode = client.Mode
 
@@ -74,7 +74,7 @@ func (s *KVStore) splitBatchRegionsReq(bo *Backoffer, keys [][]byte, scatter boo
 
 	var batches []kvrpc.Batch
 	for regionID, groupKeys := range groups {
-		batches = kvrpc.AppendKeyBatches(batches, regionID, groupKeys, splitBatchRegionLimit)
+		batches = kvrpc.AppendKeyBatches(batches, regionID, groupKeys, 0, splitBatchRegionLimit)
 	}
 
 	if len(batches) == 0 {
@@ -115,6 +115,12 @@ const (
 	CmdEmpty CmdType = 3072 + iota
 )
 
+// CmdTypes added later, whose values are given explicitly, so that the CmdTypes above keep their values.
+const (
+	CmdRawBatchScan CmdType = CmdLockWaitInfo + 1
+	CmdDebugCompact CmdType = CmdCompact + 1
+)
+
 func (t CmdType) String() string {
 	switch t {
 	case CmdGet:
@@ -161,6 +167,8 @@ func (t CmdType) String() string {
 		return "RawScan"
 	case CmdRawChecksum:
 		return "RawChecksum"
+	case CmdRawBatchScan:
+		return "RawBatchScan"
 	case CmdUnsafeDestroyRange:
 		return "UnsafeDestroyRange"
 	case CmdRegisterLockObserver:
@@ -199,6 +207,8 @@ func (t CmdType) String() string {
 		return "DebugGetRegionProperties"
 	case CmdCompact:
 		return "Compact"
+	case CmdDebugCompact:
+		return "DebugCompact"
 	case CmdTxnHeartBeat:
 		return "TxnHeartBeat"
 	case CmdStoreSafeTS:
@@ -229,6 +239,8 @@ type Request struct {
 	// If it's not empty, the store which receive the request will forward it to
 	// the forwarded host. It's useful when network partition occurs.
 	ForwardedHost string
+	// KeyspaceID is the keyspace whose prefix is added to the keys of the request in API V2.
+	KeyspaceID uint32
 }
 
 // NewRequest returns new kv rpc request.
@@ -281,7 +293,7 @@ func (req *Request) IsGlobalStaleRead() bool {
 // IsDebugReq check whether the req is debug req.
 func (req *Request) IsDebugReq() bool {
 	switch req.Type {
-	case CmdDebugGetRegionProperties:
+	case CmdDebugGetRegionProperties, CmdDebugCompact:
 		return true
 	}
 	return false
@@ -387,6 +399,11 @@ func (req *Request) UnsafeDestroyRange() *kvrpcpb.UnsafeDestroyRangeRequest {
 	return req.Req.(*kvrpcpb.UnsafeDestroyRangeRequest)
 }
 
+// RawBatchScan returns RawBatchScanRequest in request.
+func (req *Request) RawBatchScan() *kvrpcpb.RawBatchScanRequest {
+	return req.Req.(*kvrpcpb.RawBatchScanRequest)
+}
+
 // RawGetKeyTTL returns RawGetKeyTTLRequest in request.
 func (req *Request) RawGetKeyTTL() *kvrpcpb.RawGetKeyTTLRequest {
 	return req.Req.(*kvrpcpb.RawGetKeyTTLRequest)
@@ -482,6 +499,11 @@ func (req *Request) DebugGetRegionProperties() *debugpb.GetRegionPropertiesReque
 	return req.Req.(*debugpb.GetRegionPropertiesRequest)
 }
 
+// DebugCompact returns debugpb.CompactRequest in request.
+func (req *Request) DebugCompact() *debugpb.CompactRequest {
+	return req.Req.(*debugpb.CompactRequest)
+}
+
 // Compact returns CompactRequest in request.
 func (req *Request) Compact() *kvrpcpb.CompactRequest {
 	return req.Req.(*kvrpcpb.CompactRequest)
@@ -568,6 +590,8 @@ func (req *Request) ToBatchCommandsRequest() *tikvpb.BatchCommandsRequest_Reques
 		return &tikvpb.BatchCommandsRequest_Request{Cmd: &tikvpb.BatchCommandsRequest_Request_RawDeleteRange{RawDeleteRange: req.RawDeleteRange()}}
 	case CmdRawScan:
 		return &tikvpb.BatchCommandsRequest_Request{Cmd: &tikvpb.BatchCommandsRequest_Request_RawScan{RawScan: req.RawScan()}}
+	case CmdRawBatchScan:
+		return &tikvpb.BatchCommandsRequest_Request{Cmd: &tikvpb.BatchCommandsRequest_Request_RawBatchScan{RawBatchScan: req.RawBatchScan()}}
 	case CmdCop:
 		return &tikvpb.BatchCommandsRequest_Request{Cmd: &tikvpb.BatchCommandsRequest_Request_Coprocessor{Coprocessor: req.Cop()}}
 	case CmdPessimisticLock:
@@ -643,6 +667,8 @@ func FromBatchCommandsResponse(res *tikvpb.BatchCommandsResponse_Response) (*Res
 		return &Response{Resp: res.RawDeleteRange}, nil
 	case *tikvpb.BatchCommandsResponse_Response_RawScan:
 		return &Response{Resp: res.RawScan}, nil
+	case *tikvpb.BatchCommandsResponse_Response_RawBatchScan:
+		return &Response{Resp: res.RawBatchScan}, nil
 	case *tikvpb.BatchCommandsResponse_Response_Coprocessor:
 		return &Response{Resp: res.Coprocessor}, nil
 	case *tikvpb.BatchCommandsResponse_Response_PessimisticLock:
@@ -745,6 +771,8 @@ func SetContext(req *Request, region *metapb.Region, peer *metapb.Peer) error {
 		req.RawCompareAndSwap().Context = ctx
 	case CmdRawChecksum:
 		req.RawChecksum().Context = ctx
+	case CmdRawBatchScan:
+		req.RawBatchScan().Context = ctx
 	case CmdUnsafeDestroyRange:
 		req.UnsafeDestroyRange().Context = ctx
 	case CmdRegisterLockObserver:
@@ -893,6 +921,10 @@ func GenRegionErrorResp(req *Request, e *errorpb.Error) (*Response, error) {
 		p = &kvrpcpb.RawChecksumResponse{
 			RegionError: e,
 		}
+	case CmdRawBatchScan:
+		p = &kvrpcpb.RawBatchScanResponse{
+			RegionError: e,
+		}
 	case CmdCop:
 		p = &coprocessor.Response{
 			RegionError: e,
@@ -1035,6 +1067,8 @@ func CallRPC(ctx context.Context, client tikvpb.TikvClient, req *Request) (*Resp
 		resp.Resp, err = client.RawCompareAndSwap(ctx, req.RawCompareAndSwap())
 	case CmdRawChecksum:
 		resp.Resp, err = client.RawChecksum(ctx, req.RawChecksum())
+	case CmdRawBatchScan:
+		resp.Resp, err = client.RawBatchScan(ctx, req.RawBatchScan())
 	case CmdRegisterLockObserver:
 		resp.Resp, err = client.RegisterLockObserver(ctx, req.RegisterLockObserver())
 	case CmdCheckLockObserver:
@@ -1110,6 +1144,8 @@ func CallDebugRPC(ctx context.Context, client debugpb.DebugClient, req *Request)
 	switch req.Type {
 	case CmdDebugGetRegionProperties:
 		resp.Resp, err = client.GetRegionProperties(ctx, req.DebugGetRegionProperties())
+	case CmdDebugCompact:
+		resp.Resp, err = client.Compact(ctx, req.DebugCompact())
 	default:
 		return nil, errors.Errorf("invalid request type: %v", req.Type)
 	}